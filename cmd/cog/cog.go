@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/replicate/cog/pkg/cli"
 	"github.com/replicate/cog/pkg/util/console"
 )
@@ -12,6 +15,15 @@ func main() {
 	}
 
 	if err = cmd.Execute(); err != nil {
+		if errors.Is(err, cli.ErrInterrupted) {
+			// The user knows, because they pressed Ctrl-C
+			os.Exit(130)
+		}
+		var exitErr *cli.ExitError
+		if errors.As(err, &exitErr) {
+			console.Errorf("%s", err)
+			os.Exit(exitErr.Code)
+		}
 		console.Fatalf("%s", err)
 	}
 }
@@ -0,0 +1,461 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	predictInputFile   string
+	predictResume      bool
+	predictConcurrency int
+	predictMaxRestarts int
+)
+
+// batchReadAhead is how many records of --input-file, for each prediction that can run at once, are read ahead of the
+// results that have been written. Results are written in order, so this limits how many are held in memory while a
+// slow prediction finishes.
+const batchReadAhead = 4
+
+// batchBusyRetryInterval is how long to wait before sending a prediction again if the model is busy running ones that
+// weren't sent by this batch. It's doubled each time it's still busy, up to batchBusyMaxRetryInterval.
+const (
+	batchBusyRetryInterval    = 200 * time.Millisecond
+	batchBusyMaxRetryInterval = 10 * time.Second
+)
+
+func addBatchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&predictInputFile, "input-file", "", "JSONL file with the inputs for a prediction on each line, or CSV file with a column for each input, to run a prediction for each of them. The results are written to --output")
+	cmd.Flags().BoolVar(&predictResume, "resume", false, "Continue a batch of predictions from --input-file that didn't finish, instead of starting again")
+	cmd.Flags().IntVar(&predictConcurrency, "concurrency", 1, "Number of predictions from --input-file to run at once")
+	cmd.Flags().IntVar(&predictMaxRestarts, "max-restarts", 3, "How many times in a row to start the model again if it crashes while running predictions from --input-file, before stopping the batch")
+}
+
+// checkBatchFlags returns an error if flags that don't work with --input-file are used with it
+func checkBatchFlags() error {
+	if predictInputFile == "" {
+		switch {
+		case predictResume:
+			return fmt.Errorf("--resume can only be used with --input-file")
+		case predictConcurrency != 1:
+			return fmt.Errorf("--concurrency can only be used with --input-file")
+		case predictMaxRestarts != 3:
+			return fmt.Errorf("--max-restarts can only be used with --input-file")
+		}
+		return nil
+	}
+	switch {
+	case predictConcurrency < 1:
+		return fmt.Errorf("--concurrency must be at least 1")
+	case predictMaxRestarts < 0:
+		return fmt.Errorf("--max-restarts can't be negative")
+	case predictInputJSON != "":
+		return fmt.Errorf("--input-json and --input-file can't be used together")
+	case len(predictFailOn) > 0:
+		return fmt.Errorf("--fail-on can't be used with --input-file. Each result has its status in it")
+	case outputFilter != "":
+		return fmt.Errorf("--output-filter can't be used with --input-file")
+	}
+	return nil
+}
+
+// batchResult is a line of the results of a batch of predictions
+type batchResult struct {
+	// Index is the number of the record of --input-file the inputs were in, not counting blank lines or the header
+	// row of a CSV file, starting at 0
+	Index int                    `json:"index"`
+	Input map[string]interface{} `json:"input,omitempty"`
+	// Duration is how long the prediction took, in seconds, including uploading its inputs
+	Duration float64 `json:"duration"`
+	*predict.Response
+}
+
+// batchRecord is a record of --input-file to run a prediction for
+type batchRecord struct {
+	index int
+	input map[string]interface{}
+	// err is why the record isn't valid, if it isn't
+	err error
+}
+
+// batchOutcome is what a worker sends back for a record: its result, or an error if the batch should stop
+type batchOutcome struct {
+	result *batchResult
+	err    error
+}
+
+// errBatchStopped stops reading --input-file when the batch has stopped
+var errBatchStopped = errors.New("The batch was stopped")
+
+// batchCrashError is returned when the model can't be reached while running the prediction for the index'th record,
+// like when it has crashed
+type batchCrashError struct {
+	index int
+	err   error
+}
+
+func (e *batchCrashError) Error() string {
+	return e.err.Error()
+}
+
+func (e *batchCrashError) Unwrap() error {
+	return e.err
+}
+
+// batchLimiter limits how many predictions of a batch are sent to the model at once. It starts at --concurrency, and
+// is lowered to the number that are running when the model says it's busy, so the predictions that are waiting are
+// sent when one of those finishes, rather than being sent again and again until the model can take them.
+type batchLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	// finished is closed, and replaced, when a prediction finishes
+	finished chan struct{}
+}
+
+func newBatchLimiter(limit int) *batchLimiter {
+	return &batchLimiter{limit: limit, finished: make(chan struct{})}
+}
+
+// acquire waits until another prediction can be sent
+func (l *batchLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.running < l.limit {
+			l.running++
+			l.mu.Unlock()
+			return nil
+		}
+		finished := l.finished
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-finished:
+		}
+	}
+}
+
+// release is called when a prediction that was sent finishes
+func (l *batchLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	close(l.finished)
+	l.finished = make(chan struct{})
+}
+
+// busy is called instead of release when the model rejects a prediction because it's busy. It returns whether
+// predictions of the batch are running, so acquire will wait for one of them to finish. If none are, the model is
+// busy with predictions from somewhere else.
+func (l *batchLimiter) busy() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	if l.running == 0 {
+		return false
+	}
+	if l.running < l.limit {
+		l.limit = l.running
+		console.Debugf("The model is busy, so only %d predictions will be sent to it at once", l.limit)
+	}
+	return true
+}
+
+// batchOutputPath returns where the results of --input-file are written: --output, or the input file's name with
+// .predictions.jsonl on the end
+func batchOutputPath() (string, error) {
+	if outPath != "" {
+		return homedir.Expand(outPath)
+	}
+	return strings.TrimSuffix(predictInputFile, filepath.Ext(predictInputFile)) + ".predictions.jsonl", nil
+}
+
+// predictBatch runs a prediction for each record of --input-file, --concurrency at a time, and writes the results as
+// JSONL in the order of the records as they finish. Records are only read a little ahead of the results that have been
+// written, so a batch of any size runs in the same amount of memory. Inputs passed with -i are passed to every
+// prediction, unless a record has that input.
+//
+// If the model crashes, its container is started again, up to --max-restarts times in a row without any results, and
+// the batch carries on from the prediction that was running. If the model crashes again while running that one, its
+// result is failed, so one bad input doesn't stop the batch.
+func predictBatch(ctx context.Context, predictor predict.Predictor, inputs predict.Inputs) error {
+	inputPath, err := homedir.Expand(predictInputFile)
+	if err != nil {
+		return err
+	}
+	total, err := countBatchRecords(inputPath)
+	if err != nil {
+		return err
+	}
+	outputPath, err := batchOutputPath()
+	if err != nil {
+		return err
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	// The progress of the batch is shown instead of the progress of each upload
+	predictor.SetUploadProgress(nil)
+
+	writer, err := predict.OpenBatchWriter(outputPath, predictResume)
+	if err != nil {
+		return err
+	}
+	skip := writer.Completed()
+	if skip > 0 {
+		console.Infof("Resuming after %d of %d predictions that have already finished", skip, total)
+	}
+
+	progress := console.NewProgressBar("Running predictions", int64(total), false)
+	progress.Set(int64(skip))
+	failed := 0
+	// crashed is the records the model crashed while running
+	crashed := map[int]bool{}
+	restarts := 0
+	for {
+		completed := writer.Completed()
+		var batchFailed int
+		batchFailed, err = runBatch(ctx, &predictor, schema, inputPath, inputs, writer, crashed, func(result *batchResult) {
+			progress.Add(1)
+		})
+		failed += batchFailed
+		var crash *batchCrashError
+		if !errors.As(err, &crash) || !predictor.RunsContainer() || ctx.Err() != nil {
+			break
+		}
+		if writer.Completed() > completed {
+			restarts = 0
+		}
+		if restarts >= predictMaxRestarts {
+			err = fmt.Errorf("The model crashed %d times in a row: %w", restarts+1, err)
+			break
+		}
+		restarts++
+		crashed[crash.index] = true
+		console.Warnf("The model crashed while running the prediction for record %d: %s. Its logs are above. Starting it again (%d/%d)...", crash.index, err, restarts, predictMaxRestarts)
+		if err = restartCrashedPredictor(&predictor); err != nil {
+			break
+		}
+	}
+	progress.Finish("")
+	if err != nil {
+		if closeErr := writer.Close(); closeErr != nil {
+			console.Warnf("%s", closeErr)
+		}
+		return fmt.Errorf("%w\n\nRun the same command with --resume to continue from where it stopped", err)
+	}
+	if err := writer.Finish(); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Wrote the results of %d predictions to %s", writer.Completed(), outputPath)
+	if failed > 0 {
+		message += fmt.Sprintf(". %d of them didn't succeed", failed)
+	}
+	console.Info(message)
+	return nil
+}
+
+// restartCrashedPredictor starts the model's container again after it crashed. The container is removed when it
+// stops, so it's started from scratch, unless it's still there because only the model's server stopped responding.
+func restartCrashedPredictor(predictor *predict.Predictor) error {
+	if err := predictor.Stop(); err != nil {
+		console.Debugf("Failed to stop the crashed container: %s", err)
+	}
+	if err := predictor.Start(console.Writer(console.InfoLevel)); err != nil {
+		return fmt.Errorf("Failed to start the model again after it crashed: %w", err)
+	}
+	return nil
+}
+
+// runBatch runs the predictions for the records of inputPath that writer doesn't already have the results of, with
+// --concurrency workers, and writes their results. onResult is called as each one finishes. It returns how many of
+// them didn't succeed. If the model crashes while running the prediction for a record in crashed, its result is
+// failed, rather than the batch stopping with a *batchCrashError.
+func runBatch(ctx context.Context, predictor *predict.Predictor, schema *openapi3.T, inputPath string, defaults predict.Inputs, writer *predict.BatchWriter, crashed map[int]bool, onResult func(*batchResult)) (int, error) {
+	skip := writer.Completed()
+	// Results of a batch that was stopped by a crash can be waiting for the ones in front of them
+	written := map[int]bool{}
+	for _, index := range writer.Pending() {
+		written[index] = true
+	}
+	records := make(chan batchRecord)
+	outcomes := make(chan batchOutcome)
+	// A slot is taken for each record that's read, and given back when its result is written
+	slots := make(chan struct{}, batchReadAhead*predictConcurrency)
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+	limiter := newBatchLimiter(predictConcurrency)
+
+	go func() {
+		defer close(records)
+		index := 0
+		readErr <- predict.ReadBatchInputs(inputPath, func(input map[string]interface{}, err error) error {
+			record := batchRecord{index: index, input: input, err: err}
+			index++
+			if record.index < skip || written[record.index] {
+				return nil
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return errBatchStopped
+			}
+			select {
+			case records <- record:
+				return nil
+			case <-stop:
+				return errBatchStopped
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < predictConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				result, err := runBatchRecord(ctx, predictor, limiter, schema, record, defaults, filepath.Dir(inputPath), crashed[record.index])
+				outcomes <- batchOutcome{result: result, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	failed := 0
+	var batchErr error
+	for outcome := range outcomes {
+		if batchErr != nil {
+			// The batch has stopped, and the predictions that were running are finishing
+			continue
+		}
+		err := outcome.err
+		if err == nil {
+			written := writer.Completed()
+			if err = writer.WriteAt(outcome.result.Index, outcome.result); err == nil {
+				for i := written; i < writer.Completed(); i++ {
+					<-slots
+				}
+				if outcome.result.Response.Status != "succeeded" {
+					failed++
+				}
+				onResult(outcome.result)
+			}
+		}
+		if err != nil {
+			batchErr = err
+			close(stop)
+		}
+	}
+	if batchErr != nil {
+		return failed, batchErr
+	}
+	if err := <-readErr; err != nil {
+		return failed, err
+	}
+	return failed, nil
+}
+
+// runBatchRecord runs a prediction with the inputs in a record of --input-file. If the prediction can't be run, like
+// if the record isn't valid, it's the error of a failed result. If the model is busy, it waits for limiter to send it
+// again. An error is only returned if the batch should stop. crashed is whether the model has already crashed while
+// running it.
+func runBatchRecord(ctx context.Context, predictor *predict.Predictor, limiter *batchLimiter, schema *openapi3.T, record batchRecord, defaults predict.Inputs, baseDir string, crashed bool) (*batchResult, error) {
+	result := &batchResult{Index: record.index, Input: record.input}
+	if record.err != nil {
+		result.Response = &predict.Response{Status: "failed", Error: record.err.Error()}
+		return result, nil
+	}
+
+	inputs := predict.Inputs{}
+	for name, input := range defaults {
+		inputs[name] = input
+	}
+	for name, value := range record.input {
+		value := value
+		if s, ok := value.(string); ok && strings.HasPrefix(s, "@") {
+			// Files are relative to the input file, so it works wherever cog is run from
+			path := s[1:]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			inputs[name] = predict.Input{File: &path}
+		} else {
+			inputs[name] = predict.Input{Value: &value}
+		}
+	}
+
+	err := inputs.CheckFileLimits(schema)
+	retryInterval := batchBusyRetryInterval
+	for err == nil {
+		if err := limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		result.Response, err = predictor.Predict(ctx, inputs)
+		result.Duration = math.Round(time.Since(start).Seconds()*1000) / 1000
+		if !errors.Is(err, predict.ErrBusy) {
+			limiter.release()
+			break
+		}
+		err = nil
+		if limiter.busy() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+		if retryInterval *= 2; retryInterval > batchBusyMaxRetryInterval {
+			retryInterval = batchBusyMaxRetryInterval
+		}
+	}
+	if err != nil {
+		// If the model couldn't be reached, like if it crashed or the user hit Ctrl-C, the rest of the batch would fail
+		// too, so it's stopped to start the model again or be resumed later
+		var urlErr *url.Error
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.As(err, &urlErr) && crashed:
+			result.Response = &predict.Response{Status: "failed", Error: fmt.Sprintf("The model crashed while running this prediction twice: %s", err)}
+		case errors.As(err, &urlErr):
+			return nil, &batchCrashError{index: record.index, err: err}
+		default:
+			result.Response = &predict.Response{Status: "failed", Error: err.Error()}
+		}
+	}
+	return result, nil
+}
+
+// countBatchRecords returns how many predictions there are in a file of inputs
+func countBatchRecords(path string) (int, error) {
+	count := 0
+	err := predict.ReadBatchInputs(path, func(input map[string]interface{}, err error) error {
+		count++
+		return nil
+	})
+	return count, err
+}
@@ -1,9 +1,16 @@
 package cli
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	units "github.com/docker/go-units"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/spf13/cobra"
@@ -14,6 +21,17 @@ var buildSeparateWeights bool
 var buildSecrets []string
 var buildNoCache bool
 var buildProgressOutput string
+var buildWarnSize string
+var buildFailOnSize string
+var buildCogPackage string
+var buildDryRun bool
+var buildCacheFrom []string
+var buildCacheTo []string
+var buildPlatform string
+var buildSquashFinal bool
+var buildRunTests bool
+var buildLFSPull bool
+var buildIfChanged bool
 
 func newBuildCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -26,16 +44,55 @@ func newBuildCommand() *cobra.Command {
 	addSecretsFlag(cmd)
 	addNoCacheFlag(cmd)
 	addSeparateWeightsFlag(cmd)
+	addCacheFlags(cmd)
+	addPlatformFlag(cmd)
+	addSquashFinalFlag(cmd)
+	addRunTestsFlag(cmd)
+	addLFSPullFlag(cmd)
 	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().StringVar(&buildWarnSize, "warn-size", "10GB", "Suggest ways to make the image smaller if the layers Cog adds to its base image are larger than this size")
+	cmd.Flags().StringVar(&buildFailOnSize, "fail-on-size", "", "Fail if the image is larger than this size, e.g. 5GB")
+	cmd.Flags().BoolVar(&buildDryRun, "dry-run", false, "Print the Dockerfiles and docker commands that would build the image, without building it")
+	cmd.Flags().BoolVar(&buildIfChanged, "if-changed", false, "Only build the image if the project has changed since it was last built, going by the image locally or in its registry")
+	cmd.Flags().StringVar(&buildCogPackage, "cog-package", "", "The Python cog package to install, overriding build.cog_package in cog.yaml: a version, a path to a wheel or a pip requirement")
 	return cmd
 }
 
 func buildCommand(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	warnSize, err := units.FromHumanSize(buildWarnSize)
+	if err != nil {
+		return fmt.Errorf("Invalid --warn-size: %w", err)
+	}
+	var failSize int64
+	if buildFailOnSize != "" {
+		if failSize, err = units.FromHumanSize(buildFailOnSize); err != nil {
+			return fmt.Errorf("Invalid --fail-on-size: %w", err)
+		}
+	}
+
+	platforms, err := buildPlatforms()
 	if err != nil {
 		return err
 	}
 
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+	if err := checkRunTests(cfg); err != nil {
+		return err
+	}
+
+	if buildCogPackage != "" {
+		cfg.Build.CogPackage = buildCogPackage
+		// Paths in cog.yaml are relative to it, but paths in flags are relative to the current directory
+		if strings.HasSuffix(buildCogPackage, ".whl") && !strings.Contains(buildCogPackage, "://") {
+			if cfg.Build.CogPackage, err = filepath.Abs(buildCogPackage); err != nil {
+				return err
+			}
+		}
+	}
+
 	imageName := cfg.Image
 	if buildTag != "" {
 		imageName = buildTag
@@ -44,12 +101,206 @@ func buildCommand(cmd *cobra.Command, args []string) error {
 		imageName = config.DockerImageName(projectDir)
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildProgressOutput); err != nil {
+	if buildLFSPull {
+		if err := image.PullLFS(projectDir); err != nil {
+			return err
+		}
+	}
+
+	builds, err := imageBuilds(cfg, imageName)
+	if err != nil {
 		return err
 	}
+	squash := squashFinal()
+	for _, build := range builds {
+		if err := buildImage(build, projectDir, platforms, squash, warnSize, failSize); err != nil {
+			return err
+		}
+	}
+	if len(builds) > 1 && !buildDryRun {
+		names := make([]string, len(builds))
+		for i, build := range builds {
+			names[i] = build.imageName
+		}
+		console.Infof("\nBuilt an image for each of the CUDA targets: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
 
+// imageBuild is an image 'cog build' builds
+type imageBuild struct {
+	cfg       *config.Config
+	imageName string
+}
+
+// imageBuilds returns the images to build for a model. With cuda_targets, there's one for each of them, with the CUDA
+// version added to imageName's tag.
+func imageBuilds(cfg *config.Config, imageName string) ([]imageBuild, error) {
+	targets, err := cfg.CUDATargetConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if targets == nil {
+		return []imageBuild{{cfg: cfg, imageName: imageName}}, nil
+	}
+	builds := []imageBuild{}
+	for _, target := range targets {
+		builds = append(builds, imageBuild{cfg: target, imageName: config.CUDATargetImageName(imageName, target.Build.CUDA)})
+	}
+	return builds, nil
+}
+
+func buildImage(build imageBuild, projectDir string, platforms []string, squash bool, warnSize, failSize int64) error {
+	imageName := build.imageName
+	options := image.BuildOptions{
+		Secrets:         buildSecrets,
+		NoCache:         buildNoCache,
+		SeparateWeights: buildSeparateWeights,
+		ProgressOutput:  buildProgressOutput,
+		Cache:           buildCache(),
+		Platforms:       platforms,
+		Squash:          squash,
+		RunTests:        buildRunTests,
+	}
+	if buildDryRun {
+		options.Builder = &docker.DryRunBuilder{Out: os.Stdout}
+	}
+	if buildIfChanged && !projectChanged(build.cfg, projectDir, imageName, options) {
+		console.Infof("No changes since %s was built, so it wasn't built again", imageName)
+		return nil
+	}
+
+	if err := image.Build(build.cfg, projectDir, imageName, options); err != nil {
+		if len(platforms) > 1 {
+			console.Warnf("Docker can only load images built for several platforms if it uses the containerd image store. Otherwise, push the image as it's built with 'cog push --platform %s'", buildPlatform)
+		}
+		return err
+	}
+
+	if buildDryRun {
+		console.Infof("\nDry run, so %s wasn't built", imageName)
+		return nil
+	}
 	console.Infof("\nImage built as %s", imageName)
 
+	return checkImageSize(build.cfg, projectDir, imageName, warnSize, failSize)
+}
+
+// projectChanged returns whether the project in projectDir, its configuration, the build options or the version of Cog
+// have changed since imageName was last built, by comparing the build hash with the one on the image. If that can't be
+// told, like if the image doesn't exist, it has changed, so it's built.
+func projectChanged(cfg *config.Config, projectDir, imageName string, options image.BuildOptions) bool {
+	builtHash, err := image.BuiltBuildHash(imageName)
+	if err != nil {
+		console.Warnf("Failed to find the source %s was built from, so it's built again: %s", imageName, err)
+		return true
+	}
+	if builtHash == "" {
+		return true
+	}
+	hash, err := image.BuildHash(cfg, projectDir, options)
+	if err != nil {
+		console.Warnf("%s, so %s is built again", err, imageName)
+		return true
+	}
+	return hash != builtHash
+}
+
+// checkImageSize suggests ways to make the image smaller if the layers Cog added to its base image are larger than
+// warnSize, and fails if the whole image is larger than failSize, unless failSize is 0. The base image, with CUDA in
+// it for GPU models, is usually already cached where the image is pulled, so it isn't counted towards warnSize.
+func checkImageSize(cfg *config.Config, projectDir, imageName string, warnSize, failSize int64) error {
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	size := inspect.Size
+	humanSize := units.HumanSize(float64(size))
+	addedSize, err := image.AddedSize(cfg, imageName)
+	if err != nil {
+		return err
+	}
+
+	tooLarge := failSize > 0 && size > failSize
+	if addedSize > warnSize || tooLarge {
+		console.Warnf("The image is %s, of which %s is on top of its base image, which makes it slow to push, pull and start.", humanSize, units.HumanSize(float64(addedSize)))
+		suggestions, err := image.SizeSuggestions(projectDir, buildSeparateWeights)
+		if err != nil {
+			console.Warnf("Failed to determine how to make the image smaller: %s", err)
+		}
+		for _, suggestion := range suggestions {
+			console.Warnf("- %s", suggestion)
+		}
+	}
+	if tooLarge {
+		return fmt.Errorf("The image is %s, which is larger than the limit set with --fail-on-size, %s", humanSize, units.HumanSize(float64(failSize)))
+	}
+	return nil
+}
+
+// defaultImageName returns the name that 'cog build' gives the image for the project, without building it
+func defaultImageName(cmd *cobra.Command) (string, error) {
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Image != "" {
+		return cfg.Image, nil
+	}
+	return config.DockerImageName(projectDir), nil
+}
+
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&buildCacheFrom, "cache-from", []string{}, "Where to import the build cache from, like docker buildx build --cache-from, e.g. type=registry,ref=user/model:cache. Defaults to the image itself, if its name includes a registry or user, so layers pushed from other machines are reused")
+	cmd.Flags().StringArrayVar(&buildCacheTo, "cache-to", []string{}, "Where to export the build cache to, like docker buildx build --cache-to, e.g. type=registry,ref=user/model:cache,mode=max. Defaults to inline in the image")
+}
+
+// buildCache returns the cache options from --cache-from and --cache-to
+func buildCache() docker.BuildCache {
+	return docker.BuildCache{From: buildCacheFrom, To: buildCacheTo}
+}
+
+func addPlatformFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildPlatform, "platform", "", "Platforms to build the image for, like docker buildx build --platform, e.g. linux/arm64 or linux/amd64,linux/arm64")
+}
+
+// buildPlatforms returns the platforms from --platform, or nil if it isn't set
+func buildPlatforms() ([]string, error) {
+	if buildPlatform == "" {
+		return nil, nil
+	}
+	platforms, err := dockerfile.ParsePlatforms(buildPlatform)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --platform: %w", err)
+	}
+	return platforms, nil
+}
+
+func addSquashFinalFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildSquashFinal, "squash-final", false, "Squash the image into a single layer, which makes it smaller and faster to pull, but means its layers can't be reused by other images or later pushes")
+}
+
+// squashFinal returns whether --squash-final is set, warning about what it costs
+func squashFinal() bool {
+	if buildSquashFinal {
+		console.Warn("--squash-final makes the image a single layer, so it doesn't share layers with its base image or previous versions of the model. Every push and pull transfers the whole image, and the build cache isn't kept in it for --cache-from.")
+	}
+	return buildSquashFinal
+}
+
+func addRunTestsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildRunTests, "run-tests", false, "Run the commands in the test section of cog.yaml in the image once it's built, and fail if any of them fail")
+}
+
+func addLFSPullFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildLFSPull, "lfs-pull", false, "Download files stored in Git LFS with 'git lfs pull' before building, so the image has them rather than their pointers")
+}
+
+// checkRunTests returns an error if --run-tests is set but there aren't any tests to run
+func checkRunTests(cfg *config.Config) error {
+	if buildRunTests && len(cfg.Test) == 0 {
+		return fmt.Errorf("--run-tests was passed, but there are no commands in the test section of cog.yaml")
+	}
 	return nil
 }
 
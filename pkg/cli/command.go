@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ErrInterrupted is returned by commands that were stopped by a signal, like Ctrl-C
+var ErrInterrupted = errors.New("Interrupted")
+
+// ExitError is returned by commands that exit with a particular status, so scripts can tell why they failed
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// commandSettings returns the settings for a command, which are set from the root command's flags
+func commandSettings(cmd *cobra.Command) *global.Settings {
+	return global.SettingsFromContext(cmd.Context())
+}
+
+// interruptSignals are the signals that cancel a command's context
+var interruptSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// cleanupStack is the functions that undo what a command has done, like stopping the containers it started
+type cleanupStack struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+type cleanupsKey struct{}
+
+// addCleanup registers fn to be run when cmd exits, or straight away if it's interrupted, so whatever the command is
+// blocked on fails and it can exit. Cleanups are run once each, most recently added first. Each run of a command has
+// its own cleanups, which are in its context.
+func addCleanup(cmd *cobra.Command, fn func()) {
+	cleanups := cmd.Context().Value(cleanupsKey{}).(*cleanupStack)
+	cleanups.mu.Lock()
+	defer cleanups.mu.Unlock()
+	cleanups.fns = append(cleanups.fns, fn)
+}
+
+// run runs and removes all the cleanups that have been added
+func (s *cleanupStack) run() {
+	s.mu.Lock()
+	fns := s.fns
+	s.fns = nil
+	s.mu.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
+// wrapCommands makes cmd and all its subcommands run with a context that is cancelled when the process is
+// interrupted, available from cmd.Context(), and run their cleanups when they exit
+func wrapCommands(cmd *cobra.Command) {
+	if runE := cmd.RunE; runE != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return runCommand(cmd, args, runE)
+		}
+	}
+	for _, subcommand := range cmd.Commands() {
+		wrapCommands(subcommand)
+	}
+}
+
+func runCommand(cmd *cobra.Command, args []string, runE func(cmd *cobra.Command, args []string) error) error {
+	parent := cmd.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(parent, interruptSignals...)
+	defer stop()
+	cleanups := &cleanupStack{}
+	cmd.SetContext(context.WithValue(ctx, cleanupsKey{}, cleanups))
+
+	done := make(chan struct{})
+	interruptDone := make(chan struct{})
+	go func() {
+		defer close(interruptDone)
+		select {
+		case <-ctx.Done():
+			// Go back to the default behavior, so a second Ctrl-C exits straight away if cleaning up hangs
+			stop()
+			cleanups.run()
+		case <-done:
+		}
+	}()
+
+	err := runE(cmd, args)
+	close(done)
+	<-interruptDone
+	cleanups.run()
+
+	if err != nil && ctx.Err() != nil && parent.Err() == nil {
+		// Whatever failed was most likely stopped by the cleanups, so its error isn't useful
+		console.Debugf("Error after interrupt: %s", err)
+		return ErrInterrupted
+	}
+	return err
+}
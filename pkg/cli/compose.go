@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/replicate/cog/pkg/compose"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var composeFile string
+
+func newComposeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compose",
+		Short: "Run several models together",
+		Long: `Run several models together.
+
+The models are defined in a cog-compose.yaml file. For example:
+
+    models:
+      detector:
+        project: ./detector
+        port: 5001
+      classifier:
+        image: r8.im/example/classifier
+        port: 5002
+        depends_on:
+          - detector
+
+Each model is either a Cog project directory or an image built by Cog.`,
+	}
+	cmd.PersistentFlags().StringVarP(&composeFile, "file", "f", compose.DefaultFilename, "Path to the compose file")
+
+	cmd.AddCommand(newComposeUpCommand())
+
+	return cmd
+}
+
+func newComposeUpCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Build and start all the models in a compose file",
+		Long: `Build and start all the models in a compose file.
+
+Models are started after the models they depend on, and models that
+don't depend on each other are started at the same time. Once they are all
+running, a table of the URLs they are served at is printed. Press Ctrl-C
+to stop them.`,
+		RunE: composeUp,
+		Args: cobra.NoArgs,
+	}
+	addBuildProgressOutputFlag(cmd)
+	addAddressFamilyFlag(cmd)
+
+	return cmd
+}
+
+type composedModel struct {
+	name      string
+	source    string
+	predictor predict.Predictor
+}
+
+func composeUp(cmd *cobra.Command, args []string) error {
+	conf, err := compose.Load(composeFile)
+	if err != nil {
+		return err
+	}
+	levels, err := conf.Levels()
+	if err != nil {
+		return err
+	}
+
+	containers := stopContainersOnExit(cmd, func(name string) {
+		console.Infof("Stopping %s...", name)
+	})
+	// The models that don't depend on each other are started at the same time, so their setup() runs in parallel
+	started := []*composedModel{}
+	for _, level := range levels {
+		models := make([]*composedModel, len(level))
+		var group errgroup.Group
+		for i, name := range level {
+			i, name := i, name
+			group.Go(func() error {
+				model, err := startComposedModel(conf, name, commandSettings(cmd), containers)
+				if err != nil {
+					return fmt.Errorf("Failed to start %s: %w", name, err)
+				}
+				models[i] = model
+				return nil
+			})
+		}
+		if err := group.Wait(); err != nil {
+			return err
+		}
+		started = append(started, models...)
+	}
+
+	console.Info("")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tURL")
+	for _, model := range started {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", model.name, model.source, model.predictor.URL())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	console.Info("")
+	console.Info("Press Ctrl-C to stop")
+
+	<-cmd.Context().Done()
+	return nil
+}
+
+// startComposedModel starts the model called name in conf. Its container is added to containers as soon as it's
+// started, so it's stopped when the command exits, even if setup() fails.
+func startComposedModel(conf *compose.Config, name string, settings *global.Settings, containers *runningContainers) (*composedModel, error) {
+	model := conf.Models[name]
+	imageName := model.Image
+	source := model.Image
+	volumes := []docker.Volume{}
+	gpus := ""
+
+	var cfg *config.Config
+	if model.Project != "" {
+		projectDir := conf.ProjectDir(name)
+		source = projectDir
+		var err error
+		cfg, projectDir, err = config.GetConfig(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		console.Infof("Building %s...", name)
+		if imageName, err = image.BuildBase(cfg, projectDir, buildProgressOutput); err != nil {
+			return nil, err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{
+			Source:      projectDir,
+			Destination: "/src",
+		})
+		if cfg.Build.GPU {
+			gpus = "all"
+		}
+	} else {
+		exists, err := docker.ImageExists(imageName)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+		}
+		if !exists {
+			if err := docker.Pull(imageName); err != nil {
+				return nil, fmt.Errorf("Failed to pull %s: %w", imageName, err)
+			}
+		}
+		if cfg, err = image.GetConfig(imageName); err != nil {
+			return nil, err
+		}
+		if cfg.Build.GPU {
+			gpus = "all"
+		}
+	}
+
+	ports := []docker.Port{}
+	if model.Port != 0 {
+		ports = append(ports, docker.Port{HostPort: model.Port, ContainerPort: 5000})
+	}
+
+	console.Infof("Starting %s and running setup()...", name)
+	predictor := predict.NewPredictor(docker.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Ports:   ports,
+		Volumes: volumes,
+	}, settings)
+	if cfg.SetupTimeout != nil {
+		predictor.SetSetupTimeout(time.Duration(*cfg.SetupTimeout * float64(time.Second)))
+	}
+	containers.track(&predictor, name)
+	if err := predictor.Start(newPrefixWriter(console.Writer(console.InfoLevel), name+" | ")); err != nil {
+		return nil, err
+	}
+
+	return &composedModel{name: name, source: source, predictor: predictor}, nil
+}
+
+// prefixWriter prefixes every line written to it, so logs from several containers can be told apart
+type prefixWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(out io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(append([]byte{}, w.prefix...), w.buf[:i+1]...)
+		if _, err := w.out.Write(line); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close writes what has been written since the last newline, if anything, and closes out if it needs closing
+func (w *prefixWriter) Close() error {
+	w.mu.Lock()
+	partial := len(w.buf) > 0
+	w.mu.Unlock()
+	if partial {
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+	if closer, ok := w.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
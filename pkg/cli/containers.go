@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// runningContainers are the containers a command has started. They're added by the goroutines that start them, as
+// soon as Docker returns their IDs, and can be stopped from the one that handles interrupts.
+type runningContainers struct {
+	mu         sync.Mutex
+	containers []runningContainer
+}
+
+type runningContainer struct {
+	name string
+	id   string
+}
+
+// stopContainersOnExit returns containers that are stopped when cmd exits or is interrupted. onStop is called with
+// the name of each before it's stopped.
+func stopContainersOnExit(cmd *cobra.Command, onStop func(name string)) *runningContainers {
+	containers := &runningContainers{}
+	addCleanup(cmd, func() {
+		containers.stop(onStop)
+	})
+	return containers
+}
+
+// track adds the container of predictor, with name, as soon as it's started
+func (r *runningContainers) track(predictor *predict.Predictor, name string) {
+	predictor.SetOnStart(func(containerID string) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.containers = append(r.containers, runningContainer{name: name, id: containerID})
+	})
+}
+
+// stop stops the containers, most recently started first, and forgets them
+func (r *runningContainers) stop(onStop func(name string)) {
+	r.mu.Lock()
+	containers := r.containers
+	r.containers = nil
+	r.mu.Unlock()
+	for i := len(containers) - 1; i >= 0; i-- {
+		container := containers[i]
+		if container.id == "" {
+			continue
+		}
+		onStop(container.name)
+		if err := docker.Stop(container.id); err != nil {
+			console.Warnf("Failed to stop %s: %s", container.name, err)
+		}
+	}
+}
@@ -2,16 +2,22 @@ package cli
 
 import (
 	"fmt"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/dotcog"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-var imageName string
+var (
+	imageName string
+	debugArch string
+)
 
 func newDebugCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -24,11 +30,147 @@ func newDebugCommand() *cobra.Command {
 	addSeparateWeightsFlag(cmd)
 	cmd.Flags().StringVarP(&imageName, "image-name", "", "", "The image name to use for the generated Dockerfile")
 
+	cmd.AddCommand(newDebugDockerfileCommand(), newDebugDumpCommand())
+
+	return cmd
+}
+
+func newDebugDockerfileCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dockerfile",
+		Short: "Print the Dockerfile Cog generates for the project",
+		Long: `Print the Dockerfile Cog generates for the project, without building it.
+
+By default, the Dockerfile is for a CPU or GPU image depending on the gpu
+option in ` + global.ConfigFilename + `. Pass --arch to see the other one. The Dockerfile
+refers to files in a temporary directory, which is removed when the command
+exits. Use 'cog debug dump' to keep them.`,
+		Example: `  cog debug dockerfile --arch gpu`,
+		RunE:    cmdDebugDockerfile,
+		Args:    cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&debugArch, "arch", "", "Generate the Dockerfile for a 'cpu' or 'gpu' image, instead of what "+global.ConfigFilename+" sets")
+	return cmd
+}
+
+func cmdDebugDockerfile(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	switch debugArch {
+	case "":
+	case "cpu", "gpu":
+		if gpu := debugArch == "gpu"; gpu != cfg.Build.GPU {
+			cfg.Build.GPU = gpu
+			if !gpu {
+				// CUDA targets are only for GPU images
+				cfg.Build.CUDATargets = nil
+			}
+			// Work out the CUDA versions for the GPU image
+			if err := cfg.ValidateAndComplete(projectDir); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("--arch must be 'cpu' or 'gpu', not '%s'", debugArch)
+	}
+
+	generator, err := dockerfile.NewGenerator(cfg, projectDir)
+	if err != nil {
+		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	addCleanup(cmd, func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up after build: %v", err)
+		}
+	})
+
+	contents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+	if err != nil {
+		return err
+	}
+	console.Output(contents)
+	return nil
+}
+
+func newDebugDumpCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write the files Cog generates for the project to " + dotcog.Dir,
+		Long: `Write the files Cog generates for the project to ` + dotcog.Dir + `, so they can be inspected.
+
+This writes the Dockerfile for each platform and the Python cog package that
+comes with the CLI, and prints what ` + dotcog.Dir + `/build.json records about the last
+image built from the project. The Dockerfiles refer to files in ` + dotcog.Dir + `/tmp,
+which are removed after a day. Use 'cog schema --format openapi' to see the
+schema of the project's image.`,
+		RunE: cmdDebugDump,
+		Args: cobra.NoArgs,
+	}
 	return cmd
 }
 
+// dumpPlatforms are the platforms that 'cog debug dump' generates Dockerfiles for
+var dumpPlatforms = []struct{ goos, goarch string }{
+	{"linux", "amd64"},
+	{"linux", "arm64"},
+}
+
+func cmdDebugDump(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	written := []string{}
+	for _, platform := range dumpPlatforms {
+		// The generator isn't cleaned up, so the files the Dockerfile refers to are still there
+		generator, err := dockerfile.NewGenerator(cfg, projectDir)
+		if err != nil {
+			return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+		}
+		generator.GOOS = platform.goos
+		generator.GOARCH = platform.goarch
+		contents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+		if err != nil {
+			return err
+		}
+		path := dotcog.DockerfilePath(projectDir, platform.goos, platform.goarch)
+		if err := dotcog.WriteFile(path, []byte(contents+"\n")); err != nil {
+			return err
+		}
+		written = append(written, path)
+	}
+
+	wheelPath := filepath.Join(dotcog.WheelDir(projectDir), dockerfile.CogWheelFilename)
+	if err := dotcog.WriteFile(wheelPath, dockerfile.CogWheel()); err != nil {
+		return err
+	}
+	written = append(written, wheelPath)
+
+	for _, path := range written {
+		if rel, err := filepath.Rel(projectDir, path); err == nil {
+			path = rel
+		}
+		console.Infof("Wrote %s", path)
+	}
+
+	metadata, err := dotcog.ReadBuildMetadata(projectDir)
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		console.Info("No image has been built from the project with 'cog build'")
+	} else {
+		console.Infof("Last built image %s with Cog %s at %s", metadata.Image, metadata.CogVersion, metadata.BuiltAt.Local().Format(time.RFC1123))
+	}
+	return nil
+}
+
 func cmdDockerfile(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
 	if err != nil {
 		return err
 	}
@@ -37,11 +179,11 @@ func cmdDockerfile(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
 	}
-	defer func() {
+	addCleanup(cmd, func() {
 		if err := generator.Cleanup(); err != nil {
 			console.Warnf("Error cleaning up after build: %v", err)
 		}
-	}()
+	})
 
 	if buildSeparateWeights {
 		if imageName == "" {
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var diffJSON bool
+
+func newDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff IMAGE1 IMAGE2",
+		Short: "Show what changed between two images built by Cog",
+		Long: `Show what changed between two images built by Cog.
+
+Compares the cog.yaml each image was built with, the versions of the Python
+packages installed in them, and their input and output schemas. Images that
+don't exist locally are pulled, and both images are run to list their
+Python packages.`,
+		Example: `  cog diff r8.im/user/model@sha256:... r8.im/user/model:latest`,
+		RunE:    cmdDiff,
+		Args:    cobra.ExactArgs(2),
+	}
+	cmd.Flags().BoolVar(&diffJSON, "json", false, "Print the differences as JSON")
+
+	return cmd
+}
+
+func cmdDiff(cmd *cobra.Command, args []string) error {
+	for _, imageName := range args {
+		exists, err := docker.ImageExists(imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+		}
+		if !exists {
+			if err := docker.Pull(imageName); err != nil {
+				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
+			}
+		}
+	}
+
+	diff, err := image.DiffImages(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	if diffJSON {
+		return printJSON(diff)
+	}
+	if diff.Empty() {
+		console.Infof("%s and %s have the same config, Python packages and schema", args[0], args[1])
+		return nil
+	}
+	printChanges("Config", diff.Config)
+	printChanges("Python packages", diff.PythonPackages)
+	printChanges("Schema", diff.Schema)
+	return nil
+}
+
+func printChanges(title string, changes []image.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	console.Output(title + ":")
+	for _, change := range changes {
+		switch {
+		case change.Old == "":
+			console.Output(fmt.Sprintf("  + %s: %s", change.Key, change.New))
+		case change.New == "":
+			console.Output(fmt.Sprintf("  - %s: %s", change.Key, change.Old))
+		default:
+			console.Output(fmt.Sprintf("  ~ %s: %s -> %s", change.Key, change.Old, change.New))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/ui"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	docsDemoHTML string
+	docsEndpoint string
+)
+
+func newDocsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate documentation for a model",
+		Long: `Generate documentation for a model.
+
+With --demo-html, the web form that 'cog serve --ui' serves is exported as
+static HTML and JavaScript, so it can be hosted anywhere as a demo page for
+a deployed model. The page loads the model's schema from --endpoint when it
+is opened, so the model must allow cross-origin requests from wherever the
+page is hosted, by running it with COG_CORS_ORIGINS set to the page's
+origin. If --endpoint is not set, the page must be served from the same
+origin as the model.`,
+		Example: `  cog docs --demo-html out/ --endpoint https://my-model.internal`,
+		RunE:    cmdDocs,
+		Args:    cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&docsDemoHTML, "demo-html", "", "Directory to export a static demo page to")
+	cmd.Flags().StringVar(&docsEndpoint, "endpoint", "", "URL of the model's HTTP API that the demo page runs predictions on")
+	_ = cmd.MarkFlagRequired("demo-html")
+
+	return cmd
+}
+
+func cmdDocs(cmd *cobra.Command, args []string) error {
+	if err := ui.Export(docsDemoHTML, docsEndpoint); err != nil {
+		return fmt.Errorf("Failed to export demo page: %w", err)
+	}
+	console.Infof("Demo page written to %s", docsDemoHTML)
+	return nil
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func newExecCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec <container> <command> [arg...]",
+		Short: "Run a command inside a running model container",
+		Long: `Run a command inside a running model container.
+
+This is useful for inspecting a container started by 'cog predict',
+'cog serve' or 'cog compose up' while it is running. You can find the
+container's ID with 'docker ps'.`,
+		Example: `  cog exec 3f2a1b nvidia-smi
+  cog exec 3f2a1b bash`,
+		RunE: execCommand,
+		Args: cobra.MinimumNArgs(2),
+	}
+	// Flags after the container are considered args and passed to the command
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+func execCommand(cmd *cobra.Command, args []string) error {
+	return docker.Exec(args[0], args[1:], os.Stdin, os.Stdout, os.Stderr)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/clientgen"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	generateClientLanguage string
+	generateClientOutput   string
+)
+
+func newGenerateClientCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate-client [image]",
+		Short: "Generate a typed client for a model's HTTP API",
+		Long: `Generate a typed client for a model's HTTP API.
+
+The client is generated from the OpenAPI schema stored in the image. If
+'image' is not passed, the image built from the current directory is used.`,
+		Example: `  cog generate-client --language python --output client.py
+  cog generate-client r8.im/replicate/hello-world --language typescript`,
+		RunE: generateClient,
+		Args: cobra.MaximumNArgs(1),
+	}
+	cmd.Flags().StringVarP(&generateClientLanguage, "language", "l", "python", "Language to generate the client in: "+strings.Join(clientgen.LanguageNames(), ", "))
+	cmd.Flags().StringVarP(&generateClientOutput, "output", "o", "", "File to write the client to. Defaults to stdout")
+
+	return cmd
+}
+
+func generateClient(cmd *cobra.Command, args []string) error {
+	lang, err := clientgen.GetLanguage(generateClientLanguage)
+	if err != nil {
+		return err
+	}
+
+	var imageName string
+	if len(args) > 0 {
+		imageName = args[0]
+	} else if imageName, err = defaultImageName(cmd); err != nil {
+		return err
+	}
+
+	schema, err := image.GetOrGenerateOpenAPISchema(imageName)
+	if err != nil {
+		return fmt.Errorf("%w\nIf you haven't built the model yet, run 'cog build' first", err)
+	}
+
+	source, err := clientgen.Generate(lang, schema)
+	if err != nil {
+		return err
+	}
+
+	if generateClientOutput == "" {
+		console.Output(source)
+		return nil
+	}
+	if err := os.WriteFile(generateClientOutput, []byte(source), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", generateClientOutput, err)
+	}
+	console.Infof("Written %s client to %s", lang.Name, generateClientOutput)
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/cog/pkg/dependencies"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/files"
 )
@@ -22,16 +24,25 @@ var cogYamlContent []byte
 //go:embed init-templates/predict.py
 var predictPyContent []byte
 
+var initFromImports bool
+
 func newInitCommand() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:        "init",
 		SuggestFor: []string{"new", "start"},
 		Short:      "Configure your project for use with Cog",
+		Long: `Configure your project for use with Cog.
+
+With --from-imports, the Python files in the current directory are scanned
+for the packages they import, and those packages are added to
+python_packages in cog.yaml. Check the list, and pin the version of each
+package.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return initCommand(args)
 		},
 		Args: cobra.MaximumNArgs(0),
 	}
+	cmd.Flags().BoolVar(&initFromImports, "from-imports", false, "Add the Python packages that the project's code imports to cog.yaml")
 
 	return cmd
 }
@@ -44,8 +55,22 @@ func initCommand(args []string) error {
 		return err
 	}
 
+	cogYaml := cogYamlContent
+	if initFromImports {
+		modules, err := dependencies.ScanImports(cwd)
+		if err != nil {
+			return fmt.Errorf("Failed to scan Python imports: %w", err)
+		}
+		packages := dependencies.PythonPackagesForImports(modules)
+		if len(packages) > 0 {
+			console.Infof("Found imports of these Python packages: %s", strings.Join(packages, ", "))
+			console.Infof("Pin their versions in cog.yaml, e.g. numpy==1.26.0, so builds are reproducible\n")
+		}
+		cogYaml = cogYAMLWithPythonPackages(cogYaml, packages)
+	}
+
 	fileContentMap := map[string][]byte{
-		"cog.yaml":      cogYamlContent,
+		"cog.yaml":      cogYaml,
 		"predict.py":    predictPyContent,
 		".dockerignore": dockerignoreContent,
 	}
@@ -72,3 +97,22 @@ func initCommand(args []string) error {
 
 	return nil
 }
+
+// pythonPackagesTemplate is the example python_packages in the cog.yaml template
+const pythonPackagesTemplate = `  # python_packages:
+  #   - "numpy==1.19.4"
+  #   - "torch==1.8.0"
+  #   - "torchvision==0.9.0"
+`
+
+// cogYAMLWithPythonPackages replaces the example python_packages in the cog.yaml template with packages
+func cogYAMLWithPythonPackages(template []byte, packages []string) []byte {
+	if len(packages) == 0 {
+		return template
+	}
+	lines := []string{"  python_packages:"}
+	for _, pkg := range packages {
+		lines = append(lines, fmt.Sprintf("    - %q", pkg))
+	}
+	return []byte(strings.Replace(string(template), pythonPackagesTemplate, strings.Join(lines, "\n")+"\n", 1))
+}
@@ -20,3 +20,23 @@ func TestInit(t *testing.T) {
 	require.FileExists(t, path.Join(dir, "cog.yaml"))
 	require.FileExists(t, path.Join(dir, "predict.py"))
 }
+
+func TestInitFromImports(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.Chdir(dir))
+	require.NoError(t, os.WriteFile(path.Join(dir, "run.py"), []byte("import cv2\nimport numpy as np\n"), 0o644))
+
+	initFromImports = true
+	defer func() { initFromImports = false }()
+	err := initCommand([]string{})
+	require.NoError(t, err)
+
+	cogYaml, err := os.ReadFile(path.Join(dir, "cog.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, string(cogYaml), `
+  python_packages:
+    - "opencv-python"
+    - "numpy"
+`)
+}
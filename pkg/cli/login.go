@@ -1,8 +1,9 @@
 package cli
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,12 +12,14 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/httpclient"
 )
 
 type VerifyResponse struct {
@@ -32,6 +35,7 @@ func newLoginCommand() *cobra.Command {
 		Args:       cobra.MaximumNArgs(0),
 	}
 
+	cmd.Flags().Bool("no-device-code", false, "Paste a token from the browser, instead of approving a code shown in the terminal")
 	cmd.Flags().Bool("token-stdin", false, "Pass login token on stdin instead of opening a browser. You can find your Replicate login token at https://replicate.com/auth/token")
 	cmd.Flags().String("registry", global.ReplicateRegistryHost, "Registry host")
 	_ = cmd.Flags().MarkHidden("registry")
@@ -48,7 +52,12 @@ func login(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	noDeviceCode, err := cmd.Flags().GetBool("no-device-code")
+	if err != nil {
+		return err
+	}
 
+	client := httpclient.New(commandSettings(cmd).HTTPTimeout)
 	var token string
 	if tokenStdin {
 		token, err = readTokenFromStdin()
@@ -56,14 +65,20 @@ func login(cmd *cobra.Command, args []string) error {
 			return err
 		}
 	} else {
-		token, err = readTokenInteractively(registryHost)
+		err = errDeviceCodeUnsupported
+		if !noDeviceCode {
+			token, err = readTokenWithDeviceCode(cmd.Context(), client, registryHost)
+		}
+		if errors.Is(err, errDeviceCodeUnsupported) {
+			token, err = readTokenInteractively(client, registryHost)
+		}
 		if err != nil {
 			return err
 		}
 	}
 	token = strings.TrimSpace(token)
 
-	username, err := verifyToken(registryHost, token)
+	username, err := verifyToken(client, registryHost, token)
 	if err != nil {
 		return err
 	}
@@ -85,8 +100,8 @@ func readTokenFromStdin() (string, error) {
 	return string(tokenBytes), nil
 }
 
-func readTokenInteractively(registryHost string) (string, error) {
-	url, err := getDisplayTokenURL(registryHost)
+func readTokenInteractively(client *http.Client, registryHost string) (string, error) {
+	url, err := getDisplayTokenURL(client, registryHost)
 	if err != nil {
 		return "", err
 	}
@@ -95,9 +110,8 @@ func readTokenInteractively(registryHost string) (string, error) {
 
 	// TODO(bfirsh): if you have defined a registry in cog.yaml that is not r8.im, suggest to use 'docker login'
 
-	console.Info("Hit enter to get started. A browser will open with an authentication token that you need to paste here.")
-	if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err != nil {
-		return "", err
+	if _, err := console.Ask("Hit enter to get started. A browser will open with an authentication token that you need to paste here."); err != nil {
+		return "", loginInputError(err)
 	}
 
 	console.Info("If it didn't open automatically, open this URL in a web browser:")
@@ -105,16 +119,161 @@ func readTokenInteractively(registryHost string) (string, error) {
 	maybeOpenBrowser(url)
 
 	console.Info("")
-	console.Info("Once you've signed in, copy the authentication token from that web page, paste it here, then hit enter:")
-	token, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	token, err := console.AskSecret("Once you've signed in, copy the authentication token from that web page, paste it here, then hit enter:")
 	if err != nil {
-		return "", err
+		return "", loginInputError(err)
 	}
 	return token, nil
 }
 
-func getDisplayTokenURL(registryHost string) (string, error) {
-	resp, err := http.Get(addressWithScheme(registryHost) + "/cog/v1/display-token-url")
+// loginInputError suggests passing the token on stdin if it can't be asked for
+func loginInputError(err error) error {
+	if errors.Is(err, console.ErrNotInteractive) {
+		return fmt.Errorf("%w. Pass the token with --token-stdin instead", err)
+	}
+	return err
+}
+
+// errDeviceCodeUnsupported is returned by readTokenWithDeviceCode if the registry doesn't support logging in with a
+// device code, so the token has to be pasted instead
+var errDeviceCodeUnsupported = errors.New("Registry doesn't support logging in with a device code")
+
+// deviceCodeResponse is what the registry returns when a device code login is started, like in the OAuth 2.0 device
+// authorization grant (RFC 8628)
+type deviceCodeResponse struct {
+	// DeviceCode is what the CLI polls for a token with. It's never shown, so only this process can get the token.
+	DeviceCode string `json:"device_code"`
+	// UserCode is shown both here and in the browser, so the user can check they're approving this login
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	// ExpiresIn and Interval are in seconds
+	ExpiresIn int `json:"expires_in"`
+	Interval  int `json:"interval"`
+}
+
+// readTokenWithDeviceCode gets a token by showing a code that the user approves in a browser, which can be on
+// another machine, e.g. when logging in over SSH, then polling the registry until they have.
+//
+// This depends on the registry serving the device authorization grant of RFC 8628 next to
+// /cog/v1/display-token-url: POST /cog/v1/device-code is the device authorization request (section 3.1) and returns
+// a deviceCodeResponse (section 3.2), and POST /cog/v1/device-token is the token request (section 3.4), which returns
+// {"token": ...} once the login is approved, or one of the errors in section 3.5. Registries that don't serve it
+// answer the first request with 404 Not Found, 405 Method Not Allowed or 501 Not Implemented, so
+// errDeviceCodeUnsupported is returned for those and the token is pasted instead.
+func readTokenWithDeviceCode(ctx context.Context, client *http.Client, registryHost string) (string, error) {
+	resp, err := client.PostForm(addressWithScheme(registryHost)+"/cog/v1/device-code", url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("Failed to log in to %s: %w", registryHost, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return "", errDeviceCodeUnsupported
+	default:
+		return "", fmt.Errorf("%s returned HTTP status %d", registryHost, resp.StatusCode)
+	}
+	code := &deviceCodeResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(code); err != nil {
+		return "", fmt.Errorf("Failed to start logging in to %s: %w", registryHost, err)
+	}
+	verificationURI, err := url.Parse(code.VerificationURI)
+	if err != nil || verificationURI.Scheme != "https" || code.DeviceCode == "" || code.UserCode == "" {
+		return "", fmt.Errorf("%s returned an invalid device code", registryHost)
+	}
+
+	console.Infof("This command will authenticate Docker with Replicate's '%s' Docker registry. You will need a Replicate account.", registryHost)
+	console.Info("")
+	console.Info("Open this URL in a web browser, on this or any other machine:")
+	console.Info(code.VerificationURI)
+	console.Info("")
+	console.Infof("Check that it shows this code, then approve the login: %s", code.UserCode)
+	console.Info("")
+	// The complete URI has the code in it, so it doesn't need typing in. It's opened without being shown, so only open
+	// it if it's on the same site as the one that is.
+	if u, err := url.Parse(code.VerificationURIComplete); err == nil && u.Scheme == "https" && u.Host == verificationURI.Host {
+		maybeOpenBrowser(code.VerificationURIComplete)
+	} else {
+		maybeOpenBrowser(code.VerificationURI)
+	}
+	console.Info("Waiting for you to approve the login...")
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(code.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 15 * time.Minute
+	}
+	deadline := time.Now().Add(expiresIn)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		token, pollErr, err := pollDeviceToken(client, registryHost, code.DeviceCode)
+		if errors.Is(err, errDeviceTokenUnavailable) {
+			// The registry or the network is having a moment, which shouldn't throw away a login that may be approved
+			console.Debugf("%s, trying again", err)
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		switch pollErr {
+		case "":
+			return token, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return "", fmt.Errorf("The login was denied in the browser")
+		case "expired_token":
+			return "", fmt.Errorf("The code expired before the login was approved. Run 'cog login' again")
+		default:
+			return "", fmt.Errorf("Failed to log in to %s: %s", registryHost, pollErr)
+		}
+	}
+	return "", fmt.Errorf("The code expired before the login was approved. Run 'cog login' again")
+}
+
+// errDeviceTokenUnavailable is returned by pollDeviceToken if the registry couldn't be asked for the token this time,
+// because of a network error or a server error, so it can be asked again
+var errDeviceTokenUnavailable = errors.New("Failed to check whether the login has been approved")
+
+// pollDeviceToken asks the registry for the token for a device code, returning it if the login has been approved, or
+// the reason it hasn't been, like authorization_pending
+func pollDeviceToken(client *http.Client, registryHost string, deviceCode string) (token string, pollErr string, err error) {
+	resp, err := client.PostForm(addressWithScheme(registryHost)+"/cog/v1/device-token", url.Values{
+		"device_code": []string{deviceCode},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", errDeviceTokenUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return "", "", fmt.Errorf("%w: %s returned HTTP status %d", errDeviceTokenUnavailable, registryHost, resp.StatusCode)
+	}
+	body := &struct {
+		Token string `json:"token"`
+		Error string `json:"error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return "", "", fmt.Errorf("%s returned HTTP status %d", registryHost, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusOK && body.Token != "" {
+		return body.Token, "", nil
+	}
+	if body.Error == "" {
+		return "", "", fmt.Errorf("%s returned HTTP status %d", registryHost, resp.StatusCode)
+	}
+	return "", body.Error, nil
+}
+
+func getDisplayTokenURL(client *http.Client, registryHost string) (string, error) {
+	resp, err := client.Get(addressWithScheme(registryHost) + "/cog/v1/display-token-url")
 	if err != nil {
 		return "", fmt.Errorf("Failed to log in to %s: %w", registryHost, err)
 	}
@@ -151,8 +310,8 @@ func maybeOpenBrowser(url string) {
 	}
 }
 
-func verifyToken(registryHost string, token string) (username string, err error) {
-	resp, err := http.PostForm(addressWithScheme(registryHost)+"/cog/v1/verify-token", url.Values{
+func verifyToken(client *http.Client, registryHost string, token string) (username string, err error) {
+	resp, err := client.PostForm(addressWithScheme(registryHost)+"/cog/v1/verify-token", url.Values{
 		"token": []string{token},
 	})
 	if err != nil {
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/compose"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+var (
+	pipelineInputFlags []string
+	pipelineOutPath    string
+)
+
+func newPipelineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pipeline",
+		Short: "Run predictions that chain several models together",
+		Long: `Run predictions that chain several models together.
+
+A pipeline is defined in a pipeline.yaml file. It refers to models in a
+cog-compose.yaml file and passes the outputs of each step to the next:
+
+    compose: cog-compose.yaml
+    steps:
+      - model: detector
+        inputs:
+          image: $inputs.image
+      - model: cropper
+        inputs:
+          image: $inputs.image
+          box: $steps.detector.output.boxes.0
+      - model: classifier
+        inputs:
+          image: $steps.cropper.output
+
+Files are passed between models as data URLs, so no glue code is needed.`,
+	}
+
+	cmd.AddCommand(newPipelineRunCommand())
+
+	return cmd
+}
+
+func newPipelineRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "run [pipeline.yaml]",
+		Short:   "Start the models a pipeline needs and run it",
+		Example: `  cog pipeline run pipeline.yaml -i image=@photo.jpg`,
+		RunE:    pipelineRun,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addBuildProgressOutputFlag(cmd)
+	addAddressFamilyFlag(cmd)
+	cmd.Flags().StringArrayVarP(&pipelineInputFlags, "input", "i", []string{}, "Pipeline inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i image=@photo.jpg")
+	cmd.Flags().StringVarP(&pipelineOutPath, "output", "o", "", "Output path")
+
+	return cmd
+}
+
+func pipelineRun(cmd *cobra.Command, args []string) error {
+	path := compose.DefaultPipelineFilename
+	if len(args) == 1 {
+		path = args[0]
+	}
+	pipeline, err := compose.LoadPipeline(path)
+	if err != nil {
+		return err
+	}
+	inputs, err := parseInputFlags(pipelineInputFlags)
+	if err != nil {
+		return err
+	}
+	names, err := pipeline.Models()
+	if err != nil {
+		return err
+	}
+
+	predictors := map[string]*predict.Predictor{}
+	containers := stopContainersOnExit(cmd, func(name string) {
+		console.Debugf("Stopping %s...", name)
+	})
+
+	for _, name := range names {
+		model, err := startComposedModel(pipeline.Config, name, commandSettings(cmd), containers)
+		if err != nil {
+			return fmt.Errorf("Failed to start %s: %w", name, err)
+		}
+		predictors[name] = &model.predictor
+	}
+
+	outputs := map[string]interface{}{}
+	var output interface{}
+	for _, step := range pipeline.Steps {
+		stepInputs, err := resolveStepInputs(step, inputs, outputs)
+		if err != nil {
+			return err
+		}
+		console.Infof("Running step %s...", step.Name)
+		prediction, err := predictors[step.Model].Predict(cmd.Context(), stepInputs)
+		if err != nil {
+			return fmt.Errorf("Step %s failed: %w", step.Name, err)
+		}
+		if prediction.Status != "succeeded" {
+			return fmt.Errorf("Step %s did not succeed (status: %s): %s", step.Name, prediction.Status, prediction.Error)
+		}
+		output = nil
+		if prediction.Output != nil {
+			output = *prediction.Output
+		}
+		outputs[step.Name] = output
+	}
+
+	return writePipelineOutput(output, pipelineOutPath)
+}
+
+// resolveStepInputs replaces references in a step's inputs with pipeline inputs and the outputs of earlier steps
+func resolveStepInputs(step *compose.Step, inputs predict.Inputs, outputs map[string]interface{}) (predict.Inputs, error) {
+	resolved := predict.Inputs{}
+	for name, value := range step.Inputs {
+		value := value
+		ref, ok, err := compose.ParseReference(value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !ok:
+			resolved[name] = predict.Input{String: &value}
+		case ref.Step == "":
+			input, ok := inputs[ref.Input]
+			if !ok {
+				return nil, fmt.Errorf("Step %s needs the pipeline input '%s'. Pass it with -i %s=...", step.Name, ref.Input, ref.Input)
+			}
+			resolved[name] = input
+		default:
+			v, err := ref.Lookup(outputs[ref.Step])
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get input '%s' for step %s: %w", name, step.Name, err)
+			}
+			resolved[name] = predict.Input{Value: &v}
+		}
+	}
+	return resolved, nil
+}
+
+func writePipelineOutput(output interface{}, outputPath string) error {
+	if s, ok := output.(string); ok && strings.HasPrefix(s, "data:") {
+		dataurlObj, err := dataurl.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("Failed to decode dataurl: %w", err)
+		}
+		if outputPath == "" {
+			outputPath = "output" + mime.ExtensionByType(dataurlObj.ContentType())
+		}
+		return writeOutput(strings.TrimPrefix(outputPath, "@"), dataurlObj.Data)
+	}
+
+	var out []byte
+	if s, ok := output.(string); ok {
+		out = []byte(s)
+	} else {
+		rawJSON, err := json.Marshal(output)
+		if err != nil {
+			return fmt.Errorf("Failed to encode pipeline output as JSON: %w", err)
+		}
+		var indentedJSON bytes.Buffer
+		if err := json.Indent(&indentedJSON, rawJSON, "", "  "); err != nil {
+			return err
+		}
+		out = indentedJSON.Bytes()
+	}
+	if outputPath == "" {
+		console.Output(string(out))
+		return nil
+	}
+	return writeOutput(strings.TrimPrefix(outputPath, "@"), out)
+}
@@ -2,13 +2,16 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mitchellh/go-homedir"
@@ -17,6 +20,7 @@ import (
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/predict"
 	"github.com/replicate/cog/pkg/util/console"
@@ -24,8 +28,31 @@ import (
 )
 
 var (
-	inputFlags []string
-	outPath    string
+	inputFlags       []string
+	predictInputJSON string
+	outPath          string
+	predictURL       string
+	predictJSON      bool
+	predictSeed      int
+	predictFailOn    []string
+	outputFilter     string
+
+	// predictFailOnConditions are parsed from --fail-on
+	predictFailOnConditions []*predict.Condition
+
+	predictRebuildIfStale    bool
+	predictPull              bool
+	predictRequireProvenance bool
+
+	setupTimeout      time.Duration
+	predictionTimeout time.Duration
+)
+
+const (
+	// exitCodePredictionFailed is the exit status of cog predict if the prediction didn't succeed
+	exitCodePredictionFailed = 2
+	// exitCodeFailOn is the exit status of cog predict if the prediction matched a --fail-on condition
+	exitCodeFailOn = 3
 )
 
 func newPredictCommand() *cobra.Command {
@@ -35,30 +62,135 @@ func newPredictCommand() *cobra.Command {
 		Long: `Run a prediction.
 
 If 'image' is passed, it will run the prediction on that Docker image.
-It must be an image that has been built by Cog.
+It must be an image that has been built by Cog. If it is in a registry, its
+tag is resolved to a digest, and the prediction is run on the image with
+that digest, so the tag changing while it runs doesn't change the model.
+The digest is included in the output of --json. With --require-provenance,
+the image must have provenance signed by the given identity, like
+'cog verify --provenance' checks.
 
 Otherwise, it will build the model in the current directory and run
-the prediction on that.`,
+the prediction on that.
+
+With --url, the prediction is run on a model that is already being served
+with Cog's HTTP API at that URL, like a deployed model, instead of starting
+a container. If the model needs credentials, pass a bearer token with
+--token, or put a username and password in the URL for basic auth. With
+--remote, the URL and credentials come from a profile in
+~/.config/cog/profiles.yaml, which can have a token_command
+that's run to get a token, and run again to refresh it if it's rejected.
+
+With --input-file, a prediction is run for each line of a JSONL file of
+inputs, or each row of a CSV file with a header row of input names, and
+the results are written to --output as JSONL, in order, as they finish.
+--concurrency sets how many run at once. If it's stopped part of the way
+through, run it again with --resume to carry on from where it stopped.
+
+A prediction that runs for longer than --prediction-timeout, or
+max_prediction_time in cog.yaml, is cancelled, and has the status
+timed_out. Ctrl-C cancels the prediction that's running, including on a
+deployed model, and stops the container.
+
+If the prediction fails, cog predict exits with status 2, unless --json is
+set, in which case the failed prediction is written out like any other.
+With --fail-on, it exits with status 3 if the prediction matches a
+condition, after writing its output, so scripts and CI can check the
+result. A condition is one of:
+
+  error                     the prediction didn't succeed (exit status 2)
+  output.nsfw               the value is truthy: not false, null, 0 or empty
+  output.score < 0.5        the value compared with ==, !=, <, <=, > or >=
+                            to a number, true, false, null or a string
+
+Paths start with output, status, error, logs or metrics, and use .name for
+fields and [i] for items of arrays, like output[0].label. --fail-on can be
+passed more than once, and fails if any condition matches.`,
+		Example: `  cog predict -i prompt="a photo of a cat"
+  cog predict r8.im/user/model -i image=@photo.jpg
+  cog predict --url https://my-model.internal:5000 -i image=@photo.jpg
+  cog predict --remote staging -i image=@photo.jpg
+  cog predict --input-file inputs.jsonl -o results.jsonl
+  cog predict --input-file inputs.csv --concurrency 4
+  cog predict -i prompt="a photo of a cat" --prediction-timeout 5m
+  cog predict -i image=@photo.jpg --json --fail-on error --fail-on 'output.score < 0.5'`,
 		RunE:       cmdPredict,
 		Args:       cobra.MaximumNArgs(1),
 		SuggestFor: []string{"infer"},
 	}
 	addBuildProgressOutputFlag(cmd)
-	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
-	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path")
+	addAddressFamilyFlag(cmd)
+	addNetworkFlags(cmd)
+	addSecurityFlags(cmd)
+	addDeviceFlags(cmd)
+	addSetupTimeoutFlag(cmd)
+	cmd.Flags().DurationVar(&predictionTimeout, "prediction-timeout", 0, "How long a prediction can run for before it's cancelled, e.g. 10m, or 0 for as long as it takes. Overrides max_prediction_time in cog.yaml")
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg. URLs are downloaded by the model. E.g. -i path=https://example.com/image.jpg")
+	cmd.Flags().StringVar(&predictInputJSON, "input-json", "", "All the inputs, as a JSON object, or @ and the path to a file containing one. Use this instead of -i")
+	addBatchFlags(cmd)
+	cmd.Flags().StringVar(&predictURL, "url", "", "URL of a model being served with Cog's HTTP API to run the prediction on, instead of starting a container")
+	addRemoteFlags(cmd)
+	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path. If it's a directory, or the model outputs several files, the files the model outputs are written to it")
+	cmd.Flags().StringVar(&outputFilter, "output-filter", "", "Shell command to pipe the output through before it's printed or written to a file, like 'jq .label' or 'convert png:- jpg:-'. It's run for each file the model outputs")
+	cmd.Flags().BoolVar(&predictJSON, "json", false, "Write the whole prediction as JSON, including its status, output, error, timing and the logs it printed to stdout and stderr")
+	cmd.Flags().StringArrayVar(&predictFailOn, "fail-on", []string{}, "Exit with a non-zero status if the prediction matches a condition, like 'error' or 'output.score < 0.5'")
+	cmd.Flags().IntVar(&predictSeed, "seed", 0, "Seed to pass to the model's 'seed' input, so the prediction can be reproduced")
+	cmd.Flags().BoolVar(&predictRebuildIfStale, "rebuild-if-stale", false, "Rebuild the image if the code in the current project has changed since it was built")
+	cmd.Flags().BoolVar(&predictPull, "pull", false, "Pull the image even if it exists locally, so its tag resolves to the latest digest in the registry")
+	cmd.Flags().BoolVar(&predictRequireProvenance, "require-provenance", false, "Only run the image if it has verified provenance")
+	addProvenanceIdentityFlags(cmd)
 
 	return cmd
 }
 
 func cmdPredict(cmd *cobra.Command, args []string) error {
+	var inputs predict.Inputs
+	var err error
+	if predictFailOnConditions, err = parseFailOn(predictFailOn); err != nil {
+		return err
+	}
+	if err := checkBatchFlags(); err != nil {
+		return err
+	}
+	if predictInputJSON != "" {
+		if len(inputFlags) > 0 {
+			return fmt.Errorf("--input-json and -i can't be used together")
+		}
+		inputs, err = parseInputJSON(predictInputJSON)
+	} else {
+		inputs, err = parseInputFlags(inputFlags)
+	}
+	if err != nil {
+		return err
+	}
+
+	if predictURL != "" || remoteProfile != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("An image can't be passed with --url or --remote, because the prediction is run on the deployed model")
+		}
+		predictor, modelURL, err := newRemotePredictor(cmd, predictURL)
+		if err != nil {
+			return err
+		}
+		// Shown in the output of --json, so it mustn't have credentials in it
+		predictURL = modelURL
+		console.Infof("Running prediction on %s", modelURL)
+		return explainUnauthorized(runPrediction(cmd, predictor, "", inputs, nil))
+	}
+	if remoteToken != "" {
+		return fmt.Errorf("--token can only be used with --url or --remote")
+	}
+
 	imageName := ""
+	runImage := ""
 	volumes := []docker.Volume{}
 	gpus := ""
+	var cfg *config.Config
+	projectDir := ""
 
 	if len(args) == 0 {
 		// Build image
 
-		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		cfg, projectDir, err = config.GetConfig(commandSettings(cmd).ProjectDir)
 		if err != nil {
 			return err
 		}
@@ -66,6 +198,7 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		if imageName, err = image.BuildBase(cfg, projectDir, buildProgressOutput); err != nil {
 			return err
 		}
+		runImage = imageName
 
 		// Base image doesn't have /src in it, so mount as volume
 		volumes = append(volumes, docker.Volume{
@@ -85,53 +218,52 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
 		}
-		if !exists {
-			console.Infof("Pulling image: %s", imageName)
+		if !exists || predictPull {
 			if err := docker.Pull(imageName); err != nil {
 				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
 			}
 		}
-		conf, err := image.GetConfig(imageName)
-		if err != nil {
+		if err := checkImageIsStale(cmd, imageName); err != nil {
+			return err
+		}
+		if runImage, err = resolveImageDigest(imageName); err != nil {
+			return err
+		}
+		if cfg, err = image.GetConfig(imageName); err != nil {
 			return err
 		}
-		if conf.Build.GPU {
+		if cfg.Build.GPU {
 			gpus = "all"
 		}
 	}
 
 	console.Info("")
-	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	console.Infof("Starting Docker image %s and running setup()...", runImage)
 
-	predictor := predict.NewPredictor(docker.RunOptions{
+	runOptions := docker.RunOptions{
 		GPUs:    gpus,
-		Image:   imageName,
+		Image:   runImage,
 		Volumes: volumes,
-	})
-
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
-
-		<-captureSignal
+	}
+	applyNetworkOptions(&runOptions, cfg)
+	applySecurityOptions(&runOptions, cfg, projectDir)
+	applyDeviceOptions(&runOptions)
+	predictor := predict.NewPredictor(runOptions, commandSettings(cmd))
+	applySetupTimeout(cmd, &predictor, cfg)
 
-		console.Info("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
+	containers := stopContainerOnExit(cmd, &predictor)
 
-	if err := predictor.Start(os.Stderr); err != nil {
-		if gpus != "" && errors.Is(err, docker.ErrMissingDeviceDriver) {
+	if err := predictor.Start(console.Writer(console.InfoLevel)); err != nil {
+		if runOptions.GPUs != "" && runGPUs == "" && errors.Is(err, docker.ErrMissingDeviceDriver) {
 			console.Info("Missing device driver, re-trying without GPU")
 
-			_ = predictor.Stop()
-			predictor = predict.NewPredictor(docker.RunOptions{
-				Image:   imageName,
-				Volumes: volumes,
-			})
+			containers.stop(func(string) {})
+			runOptions.GPUs = ""
+			predictor = predict.NewPredictor(runOptions, commandSettings(cmd))
+			applySetupTimeout(cmd, &predictor, cfg)
+			containers.track(&predictor, "container")
 
-			if err := predictor.Start(os.Stderr); err != nil {
+			if err := predictor.Start(console.Writer(console.InfoLevel)); err != nil {
 				return err
 			}
 		} else {
@@ -139,42 +271,203 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// FIXME: will not run on signal
-	defer func() {
-		console.Debugf("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
+	return runPrediction(cmd, predictor, imageName, inputs, cfg)
+}
+
+// runPrediction runs a prediction on a model that has been started, or that is being served at a URL, in which case
+// imageName is empty and cfg is nil, and writes its output
+func runPrediction(cmd *cobra.Command, predictor predict.Predictor, imageName string, inputs predict.Inputs, cfg *config.Config) error {
+	predictor.SetUploadProgress(newUploadProgress())
+
+	switch {
+	case cmd.Flags().Changed("prediction-timeout"):
+		predictor.SetMaxPredictionTime(predictionTimeout)
+	case cfg != nil && cfg.MaxPredictionTime > 0:
+		predictor.SetMaxPredictionTime(time.Duration(cfg.MaxPredictionTime * float64(time.Second)))
+	}
+
+	if cmd.Flags().Changed("seed") {
+		schema, err := predictor.GetSchema()
+		if err != nil {
+			return err
 		}
-	}()
+		if inputSchema := schema.Components.Schemas["Input"]; inputSchema == nil || inputSchema.Value.Properties["seed"] == nil {
+			return fmt.Errorf("--seed can't be used, because the model doesn't have an input named 'seed'")
+		}
+		seed := strconv.Itoa(predictSeed)
+		inputs["seed"] = predict.Input{String: &seed}
+	}
+
+	if predictInputFile != "" {
+		return predictBatch(cmd.Context(), predictor, inputs)
+	}
+	return predictIndividualInputs(cmd.Context(), predictor, imageName, inputs, outPath)
+}
+
+func addSetupTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&setupTimeout, "setup-timeout", global.StartupTimeout, "How long to wait for the model's setup() to finish, e.g. 30m, or 0 to wait for as long as it takes. Overrides setup_timeout in cog.yaml")
+}
+
+// applySetupTimeout sets how long the predictor waits for setup() to finish, from --setup-timeout or cog.yaml
+func applySetupTimeout(cmd *cobra.Command, predictor *predict.Predictor, cfg *config.Config) {
+	switch {
+	case cmd.Flags().Changed("setup-timeout"):
+		predictor.SetSetupTimeout(setupTimeout)
+	case cfg != nil && cfg.SetupTimeout != nil:
+		predictor.SetSetupTimeout(time.Duration(*cfg.SetupTimeout * float64(time.Second)))
+	}
+}
+
+// stopContainerOnExit stops the container of the predictor when the command exits or is interrupted. The containers it
+// returns can be used to stop it before then, and to track the container of another predictor that replaces it.
+func stopContainerOnExit(cmd *cobra.Command, predictor *predict.Predictor) *runningContainers {
+	containers := stopContainersOnExit(cmd, func(string) {
+		if cmd.Context().Err() != nil {
+			console.Info("Stopping container...")
+		} else {
+			console.Debugf("Stopping container...")
+		}
+	})
+	containers.track(predictor, "container")
+	return containers
+}
+
+// resolveImageDigest returns the reference by digest of an image in a registry, checking its provenance if
+// --require-provenance is set. Images that have only been built locally don't have a digest, so they are returned
+// as they are.
+func resolveImageDigest(imageName string) (string, error) {
+	digest := imageName
+	if !strings.Contains(imageName, "@") {
+		var err error
+		if digest, err = docker.RepoDigest(imageName); err != nil {
+			if predictRequireProvenance {
+				return "", fmt.Errorf("Can't verify the provenance of %s, because it isn't in a registry: %w", imageName, err)
+			}
+			console.Debugf("Running %s by name: %s", imageName, err)
+			return imageName, nil
+		}
+		console.Infof("Resolved %s to %s", imageName, digest)
+	}
+	if predictRequireProvenance {
+		statement, err := verifyImageProvenance(digest)
+		if err != nil {
+			return "", err
+		}
+		console.Infof("Verified provenance: built from %s", statement.SourceDescription())
+	}
+	return digest, nil
+}
 
-	return predictIndividualInputs(predictor, inputFlags, outPath)
+// checkImageIsStale warns if imageName was built from the project in the current directory, and the project has
+// changed since. With --rebuild-if-stale, it is rebuilt instead.
+func checkImageIsStale(cmd *cobra.Command, imageName string) error {
+	projectImageName, err := defaultImageName(cmd)
+	if err != nil || strings.TrimSuffix(imageName, ":latest") != strings.TrimSuffix(projectImageName, ":latest") {
+		// Not in a project, or it's an image of something else
+		return nil
+	}
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	stale, err := image.IsStale(imageName, projectDir)
+	if err != nil {
+		console.Warnf("Failed to determine if %s is stale: %s", imageName, err)
+		return nil
+	}
+	if !stale {
+		return nil
+	}
+	if !predictRebuildIfStale {
+		console.Warnf("The code in %s has changed since %s was built. Run 'cog build' to rebuild it, or pass --rebuild-if-stale.", projectDir, imageName)
+		return nil
+	}
+	console.Infof("The code in %s has changed since %s was built, so rebuilding it...", projectDir, imageName)
+	return image.Build(cfg, projectDir, imageName, image.BuildOptions{ProgressOutput: buildProgressOutput})
 }
 
-func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, outputPath string) error {
+func predictIndividualInputs(ctx context.Context, predictor predict.Predictor, imageName string, inputs predict.Inputs, outputPath string) (err error) {
 	console.Info("Running prediction...")
 	schema, err := predictor.GetSchema()
 	if err != nil {
 		return err
 	}
 
-	inputs, err := parseInputFlags(inputFlags)
-	if err != nil {
+	if err := inputs.CheckFileLimits(schema); err != nil {
 		return err
 	}
 
-	prediction, err := predictor.Predict(inputs)
+	responseSchema := schema.Paths["/predictions"].Post.Responses["200"].Value.Content["application/json"].Schema.Value
+	outputSchema := responseSchema.Properties["output"].Value
+	multipleFileOutput := outputSchema.Type == "array" && outputSchema.Items.Value != nil && outputSchema.Items.Value.Type == "string" && outputSchema.Items.Value.Format == "uri"
+	// Text a model yields a piece at a time, like the tokens of a language model, is joined together
+	concatenateOutput := outputSchema.Type == "array" && outputSchema.Extensions["x-cog-array-display"] == "concatenate"
+
+	// Files the model outputs are written to outputDir, and outputPath is where the output itself is written, if it's
+	// not a directory
+	outputDir := "."
+	if !predictJSON {
+		// Ignore @, to make it behave the same as -i
+		outputPath = strings.TrimPrefix(outputPath, "@")
+		dir, err := outputDirectory(outputPath, multipleFileOutput)
+		if err != nil {
+			return err
+		}
+		if dir != "" {
+			outputDir, outputPath = dir, ""
+		} else if outputPath != "" {
+			outputDir = filepath.Dir(outputPath)
+		}
+	}
+
+	var prediction *predict.Response
+	progressive := &progressiveOutput{writeFiles: multipleFileOutput && !predictJSON, dir: outputDir, progress: -1}
+	// Text that's printed is printed as it's output, unless it's piped through --output-filter
+	streamText := concatenateOutput && !predictJSON && outputPath == "" && outputFilter == "" && predict.SupportsProgressive(schema)
+	if streamText {
+		prediction, err = predictor.PredictStream(ctx, inputs, printStreamedOutput)
+		if err == nil && len(outputList(prediction)) > 0 {
+			console.Output("")
+		}
+	} else if predict.SupportsProgressive(schema) {
+		prediction, err = predictor.PredictProgressive(ctx, inputs, progressive.update)
+	} else {
+		prediction, err = predictor.Predict(ctx, inputs)
+	}
 	if err != nil {
 		return err
 	}
+	// Checked once the output has been written, so it's there to look at when the command fails
+	defer func() {
+		if err == nil {
+			err = checkFailOn(prediction)
+		}
+	}()
+
+	if predictJSON {
+		return writePredictionJSON(newPredictionResult(prediction, imageName, inputs), outputPath)
+	}
+
+	if prediction.Status != "succeeded" {
+		message := fmt.Sprintf("Prediction %s", prediction.Status)
+		if prediction.Error != "" {
+			message += ": " + prediction.Error
+		}
+		return &ExitError{Code: exitCodePredictionFailed, Err: errors.New(message)}
+	}
 
 	// Generate output depending on type in schema
 	var out []byte
-	responseSchema := schema.Paths["/predictions"].Post.Responses["200"].Value.Content["application/json"].Schema.Value
-	outputSchema := responseSchema.Properties["output"].Value
+
+	if streamText {
+		return nil
+	}
 
 	// Multiple outputs!
-	if outputSchema.Type == "array" && outputSchema.Items.Value != nil && outputSchema.Items.Value.Type == "string" && outputSchema.Items.Value.Format == "uri" {
-		return handleMultipleFileOutput(prediction, outputSchema)
+	if multipleFileOutput {
+		// Files that were output while the prediction was running have already been written
+		return handleMultipleFileOutput(prediction, progressive.written, outputDir)
 	}
 
 	if outputSchema.Type == "string" && outputSchema.Format == "uri" {
@@ -184,19 +477,22 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 		}
 		out = dataurlObj.Data
 		if outputPath == "" {
-			outputPath = "output"
-			extension := mime.ExtensionByType(dataurlObj.ContentType())
-			if extension != "" {
-				outputPath += extension
-			}
+			outputPath = filepath.Join(outputDir, "output"+mime.ExtensionByType(dataurlObj.ContentType()))
 		}
+	} else if concatenateOutput {
+		out = []byte(concatenate(outputList(prediction)))
 	} else if outputSchema.Type == "string" {
 		// Handle strings separately because if we encode it to JSON it will be surrounded by quotes.
 		s := (*prediction.Output).(string)
 		out = []byte(s)
 	} else {
 		// Treat everything else as JSON -- ints, floats, bools will all convert correctly.
-		rawJSON, err := json.Marshal(prediction.Output)
+		// Files in it, like the fields of an object, are written to disk, and their paths are output instead.
+		output, err := writeFileOutputs(*prediction.Output, outputSchema, "output", outputDir)
+		if err != nil {
+			return err
+		}
+		rawJSON, err := json.Marshal(output)
 		if err != nil {
 			return fmt.Errorf("Failed to encode prediction output as JSON: %w", err)
 		}
@@ -215,16 +511,155 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 
 	// Write to stdout
 	if outputPath == "" {
-		console.Output(string(out))
-		return nil
+		return printOutput(out)
 	}
 
 	// Fall back to writing file
+	return writeOutput(outputPath, out)
+}
 
-	// Ignore @, to make it behave the same as -i
-	outputPath = strings.TrimPrefix(outputPath, "@")
+// parseFailOn parses the --fail-on conditions
+func parseFailOn(conditions []string) ([]*predict.Condition, error) {
+	parsed := []*predict.Condition{}
+	for _, s := range conditions {
+		condition, err := predict.ParseCondition(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --fail-on: %w", err)
+		}
+		parsed = append(parsed, condition)
+	}
+	return parsed, nil
+}
 
-	return writeOutput(outputPath, out)
+// checkFailOn returns an ExitError if the prediction matches any of the --fail-on conditions
+func checkFailOn(prediction *predict.Response) error {
+	for _, condition := range predictFailOnConditions {
+		matches, description, err := condition.Matches(prediction)
+		if err != nil {
+			return fmt.Errorf("Failed to check --fail-on: %w", err)
+		}
+		if !matches {
+			continue
+		}
+		code := exitCodeFailOn
+		if condition.String() == "error" {
+			code = exitCodePredictionFailed
+		}
+		return &ExitError{Code: code, Err: fmt.Errorf("The prediction matched --fail-on '%s', because %s", condition, description)}
+	}
+	return nil
+}
+
+// filterOutput pipes output through the --output-filter command, if it's set, and returns what the command prints
+func filterOutput(output []byte) ([]byte, error) {
+	if outputFilter == "" {
+		return output, nil
+	}
+	cmd := exec.Command("sh", "-c", outputFilter)
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stderr = os.Stderr
+	console.Debug("$ sh -c " + outputFilter)
+	filtered, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("--output-filter '%s' failed: %w", outputFilter, err)
+	}
+	return filtered, nil
+}
+
+// outputDirectory returns the directory that --output refers to, creating it if needed, or "" if it refers to a file.
+// It's a directory if it already exists as one or ends in a slash, or if the model outputs several files.
+func outputDirectory(outputPath string, multipleFiles bool) (string, error) {
+	if outputPath == "" {
+		return "", nil
+	}
+	dir, err := homedir.Expand(outputPath)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir, nil
+	}
+	if !multipleFiles && !strings.HasSuffix(dir, "/") && !strings.HasSuffix(dir, string(filepath.Separator)) {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("Failed to create output directory: %w", err)
+	}
+	return dir, nil
+}
+
+// predictionResult is a prediction along with what is needed to reproduce it
+type predictionResult struct {
+	*predict.Response
+	// Seed is the seed the model was passed, if it was passed one
+	Seed  *int64 `json:"seed,omitempty"`
+	Image string `json:"image,omitempty"`
+	// URL is where the model was served, if the prediction was run with --url or --remote
+	URL         string `json:"url,omitempty"`
+	ImageDigest string `json:"image_digest,omitempty"`
+	CogVersion  string `json:"cog_version"`
+}
+
+func newPredictionResult(prediction *predict.Response, imageName string, inputs predict.Inputs) *predictionResult {
+	result := &predictionResult{
+		Response:   prediction,
+		Image:      imageName,
+		CogVersion: global.Version,
+	}
+	if input, ok := inputs["seed"]; ok && input.String != nil {
+		if seed, err := strconv.ParseInt(*input.String, 10, 64); err == nil {
+			result.Seed = &seed
+		}
+	} else if ok && input.Value != nil {
+		// From --input-json
+		if f, isNumber := (*input.Value).(float64); isNumber {
+			seed := int64(f)
+			result.Seed = &seed
+		}
+	}
+	if imageName == "" {
+		result.URL = predictURL
+		return result
+	}
+	// Prefer the registry digest, which can be pulled elsewhere. Images that have only been built locally only have an ID.
+	if strings.Contains(imageName, "@") {
+		result.ImageDigest = imageName
+	} else if digest, err := docker.RepoDigest(imageName); err == nil {
+		result.ImageDigest = digest
+	} else if inspect, err := docker.ImageInspect(imageName); err != nil {
+		console.Warnf("Failed to determine digest of %s: %s", imageName, err)
+	} else if len(inspect.RepoDigests) > 0 {
+		result.ImageDigest = inspect.RepoDigests[0]
+	} else {
+		result.ImageDigest = inspect.ID
+	}
+	return result
+}
+
+func writePredictionJSON(prediction *predictionResult, outputPath string) error {
+	out, err := json.MarshalIndent(prediction, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode prediction as JSON: %w", err)
+	}
+	if outputPath == "" {
+		return printOutput(out)
+	}
+	return writeOutput(strings.TrimPrefix(outputPath, "@"), out)
+}
+
+// printOutput writes output to stdout, through --output-filter if it's set. What the filter prints is written as it
+// is, without a newline added, because it can be a file like an image.
+func printOutput(output []byte) error {
+	if outputFilter == "" {
+		console.Output(string(output))
+		return nil
+	}
+	filtered, err := filterOutput(output)
+	if err != nil {
+		return err
+	}
+	console.OutputPart(string(filtered))
+	return nil
 }
 
 func writeOutput(outputPath string, output []byte) error {
@@ -232,9 +667,12 @@ func writeOutput(outputPath string, output []byte) error {
 	if err != nil {
 		return err
 	}
+	if output, err = filterOutput(output); err != nil {
+		return err
+	}
 
 	// Write to file
-	outFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE, 0o755)
+	outFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
 	if err != nil {
 		return err
 	}
@@ -249,22 +687,14 @@ func writeOutput(outputPath string, output []byte) error {
 	return nil
 }
 
-func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openapi3.Schema) error {
+func handleMultipleFileOutput(prediction *predict.Response, from int, dir string) error {
 	outputs, ok := (*prediction.Output).([]interface{})
 	if !ok {
 		return fmt.Errorf("Failed to decode output")
 	}
 
-	for i, output := range outputs {
-		outputString := output.(string)
-		dataurlObj, err := dataurl.DecodeString(outputString)
-		if err != nil {
-			return fmt.Errorf("Failed to decode dataurl: %w", err)
-		}
-		out := dataurlObj.Data
-		extension := mime.ExtensionByType(dataurlObj.ContentType())
-		outputPath := fmt.Sprintf("output.%d%s", i, extension)
-		if err := writeOutput(outputPath, out); err != nil {
+	for i := from; i < len(outputs); i++ {
+		if err := writeFileOutput(outputs[i], i, dir); err != nil {
 			return err
 		}
 	}
@@ -272,6 +702,156 @@ func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openap
 	return nil
 }
 
+func writeFileOutput(output interface{}, i int, dir string) error {
+	outputString, ok := output.(string)
+	if !ok {
+		return fmt.Errorf("Failed to decode output")
+	}
+	_, err := writeDataURL(outputString, fmt.Sprintf("output.%d", i), dir)
+	return err
+}
+
+// writeDataURL writes the file in a data URL to dir, named name with the extension for its content type, and
+// returns the path it was written to
+func writeDataURL(s string, name string, dir string) (string, error) {
+	dataurlObj, err := dataurl.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode dataurl: %w", err)
+	}
+	outputPath := filepath.Join(dir, name+mime.ExtensionByType(dataurlObj.ContentType()))
+	if err := writeOutput(outputPath, dataurlObj.Data); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// writeFileOutputs writes the files in an output that its schema says are URIs, like the fields of an object, to
+// dir, and returns the output with the paths they were written to in place of them. Files are named after where they
+// are in the output, like output.images.0.png. URLs that aren't data URLs, like uploaded files, are left as they are.
+func writeFileOutputs(output interface{}, schema *openapi3.Schema, name string, dir string) (interface{}, error) {
+	if schema == nil {
+		return output, nil
+	}
+	switch value := output.(type) {
+	case string:
+		if schema.Type != "string" || schema.Format != "uri" || !strings.HasPrefix(value, "data:") {
+			return value, nil
+		}
+		return writeDataURL(value, name, dir)
+	case []interface{}:
+		if schema.Items == nil {
+			return value, nil
+		}
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			written, err := writeFileOutputs(item, schema.Items.Value, fmt.Sprintf("%s.%d", name, i), dir)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = written
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			var propertySchema *openapi3.Schema
+			if ref := schema.Properties[key]; ref != nil {
+				propertySchema = ref.Value
+			}
+			written, err := writeFileOutputs(item, propertySchema, name+"."+key, dir)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = written
+		}
+		return result, nil
+	}
+	return output, nil
+}
+
+// printStreamedOutput prints a piece of text a model has output, straight after the ones before it
+func printStreamedOutput(item interface{}) error {
+	console.OutputPart(concatenate([]interface{}{item}))
+	return nil
+}
+
+// outputList returns the items of a prediction's output, if it's an array
+func outputList(prediction *predict.Response) []interface{} {
+	if prediction.Output == nil {
+		return nil
+	}
+	items, _ := (*prediction.Output).([]interface{})
+	return items
+}
+
+// concatenate joins the pieces of text a model has output. Anything that isn't a string is added as JSON.
+func concatenate(items []interface{}) string {
+	var b strings.Builder
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			b.WriteString(s)
+		} else if encoded, err := json.Marshal(item); err == nil {
+			b.Write(encoded)
+		}
+	}
+	return b.String()
+}
+
+// progressiveOutput shows the progress of a running prediction, and writes the files it outputs as they are output,
+// e.g. the intermediate images of a diffusion model
+type progressiveOutput struct {
+	writeFiles bool
+	// dir is the directory the files are written to
+	dir string
+	// written is the number of files that have been written
+	written int
+	// progress is the last percentage that was shown, or -1 if none has been
+	progress int
+}
+
+func (o *progressiveOutput) update(prediction *predict.Response) error {
+	if progress, ok := prediction.Progress(); ok && progress != o.progress {
+		console.Infof("Progress: %d%%", progress)
+		o.progress = progress
+	}
+
+	if !o.writeFiles || prediction.Output == nil {
+		return nil
+	}
+	outputs, ok := (*prediction.Output).([]interface{})
+	if !ok {
+		return nil
+	}
+	for ; o.written < len(outputs); o.written++ {
+		if err := writeFileOutput(outputs[o.written], o.written, o.dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadProgressMinSize is how big the files in a prediction's inputs must be for upload progress to be shown
+const uploadProgressMinSize = 10 * 1024 * 1024
+
+// newUploadProgress returns a function that shows a progress bar while the files in a prediction's inputs are uploaded
+func newUploadProgress() predict.UploadProgress {
+	var bar *console.ProgressBar
+	return func(sent, total int64) {
+		if total < uploadProgressMinSize {
+			return
+		}
+		if bar == nil {
+			bar = console.NewProgressBar("Uploading inputs", total, true)
+		}
+		bar.Set(sent)
+		if sent >= total {
+			bar.Finish("")
+			// Each prediction that's run uploads its inputs again
+			bar = nil
+		}
+	}
+}
+
 func parseInputFlags(inputs []string) (predict.Inputs, error) {
 	keyVals := map[string]string{}
 	for _, input := range inputs {
@@ -295,3 +875,28 @@ func parseInputFlags(inputs []string) (predict.Inputs, error) {
 
 	return predict.NewInputs(keyVals), nil
 }
+
+// parseInputJSON parses the value of --input-json, which is a JSON object or @ and the path to a file containing one
+func parseInputJSON(value string) (predict.Inputs, error) {
+	data := []byte(value)
+	if strings.HasPrefix(value, "@") {
+		path, err := homedir.Expand(value[1:])
+		if err != nil {
+			return nil, err
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("Failed to read --input-json: %w", err)
+		}
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("--input-json must be a JSON object: %w", err)
+	}
+	inputs := predict.Inputs{}
+	for name, v := range values {
+		v := v
+		inputs[name] = predict.Input{Value: &v}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	// Not set, so files are written to the current directory
+	outputDir, err := outputDirectory("", true)
+	require.NoError(t, err)
+	require.Equal(t, "", outputDir)
+
+	// A file
+	outputDir, err = outputDirectory(filepath.Join(dir, "output.png"), false)
+	require.NoError(t, err)
+	require.Equal(t, "", outputDir)
+	require.NoFileExists(t, filepath.Join(dir, "output.png"))
+
+	// An existing directory
+	outputDir, err = outputDirectory(dir, false)
+	require.NoError(t, err)
+	require.Equal(t, dir, outputDir)
+
+	// Ends in a slash, so it's created
+	outputDir, err = outputDirectory(filepath.Join(dir, "slash")+"/", false)
+	require.NoError(t, err)
+	require.DirExists(t, outputDir)
+
+	// Several files can't be written to one file, so it's created
+	outputDir, err = outputDirectory(filepath.Join(dir, "multiple"), true)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "multiple"), outputDir)
+	require.DirExists(t, outputDir)
+}
+
+func TestWriteFileOutputs(t *testing.T) {
+	dir := t.TempDir()
+	uri := openapi3.NewStringSchema().WithFormat("uri")
+	schema := openapi3.NewObjectSchema().
+		WithProperty("text", openapi3.NewStringSchema()).
+		WithProperty("image", uri).
+		WithProperty("files", openapi3.NewArraySchema().WithItems(uri)).
+		WithProperty("url", uri)
+	output := map[string]interface{}{
+		"text":  "data:not a file",
+		"image": "data:text/plain;base64,aGVsbG8=",
+		"files": []interface{}{"data:text/plain;base64,Zm9v"},
+		// Uploaded files are left as they are
+		"url": "https://example.com/output.png",
+		// Not in the schema
+		"other": "data:text/plain;base64,YmFy",
+	}
+
+	written, err := writeFileOutputs(output, schema, "output", dir)
+	require.NoError(t, err)
+
+	imagePath := filepath.Join(dir, "output.image.txt")
+	filePath := filepath.Join(dir, "output.files.0.txt")
+	require.Equal(t, map[string]interface{}{
+		"text":  "data:not a file",
+		"image": imagePath,
+		"files": []interface{}{filePath},
+		"url":   "https://example.com/output.png",
+		"other": "data:text/plain;base64,YmFy",
+	}, written)
+	contents, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+	contents, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(contents))
+}
@@ -1,64 +1,333 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dotcog"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/modelcard"
+	"github.com/replicate/cog/pkg/provenance"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
+var (
+	pushImage         string
+	pushProvenance    bool
+	pushProvenanceKey string
+	pushRetries       int
+	pushHFCard        string
+)
+
 func newPushCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "push [IMAGE]",
 
-		Short:   "Build and push model in current directory to a Docker registry",
-		Example: `cog push registry.hooli.corp/hotdog-detector`,
-		RunE:    push,
-		Args:    cobra.MaximumNArgs(1),
+		Short: "Build and push model in current directory to a Docker registry",
+		Long: `Build and push model in current directory to a Docker registry.
+
+The image can be pushed to any registry, like Replicate, Docker Hub, GitHub
+Container Registry, Amazon ECR or Google Artifact Registry. Its name is
+taken from IMAGE, --image, or the 'image' option in cog.yaml. Cog uses
+Docker's credentials for the registry, so log in to it with 'docker login',
+or 'cog login' for Replicate, or set up its credential helper first.
+
+After the image is pushed, SLSA provenance describing the source it was built
+from, the version of Cog that built it and the options it was built with is
+written to .cog/provenance. With --provenance, the provenance is also signed
+and attached to the image in the registry with cosign, so it can be checked
+with 'cog verify --provenance'.
+
+With --export-hf-card, a Hugging Face model card is written for the pushed
+image, with its inputs and output from its schema, so the model can be
+published on the Hugging Face Hub alongside the image.
+
+If cog.yaml sets build.cuda_targets, an image is built and pushed for each
+of them, with the CUDA version added to its tag.`,
+		Example: `  cog push registry.hooli.corp/hotdog-detector
+  cog push --image ghcr.io/hooli/hotdog-detector
+  cog push --platform linux/amd64,linux/arm64 ghcr.io/hooli/hotdog-detector
+  cog push r8.im/hooli/sdxl-turbo --export-hf-card README.md`,
+		RunE: push,
+		Args: cobra.MaximumNArgs(1),
 	}
 	addBuildProgressOutputFlag(cmd)
 	addSecretsFlag(cmd)
 	addNoCacheFlag(cmd)
 	addSeparateWeightsFlag(cmd)
+	addCacheFlags(cmd)
+	addPlatformFlag(cmd)
+	addSquashFinalFlag(cmd)
+	addRunTestsFlag(cmd)
+	addLFSPullFlag(cmd)
+	cmd.Flags().StringVar(&pushImage, "image", "", "Name of the image to push, including its registry, like ghcr.io/user/model. Overrides the 'image' option in cog.yaml")
+	cmd.Flags().IntVar(&pushRetries, "retries", 3, "Number of times to retry the push if it fails. Layers that were already uploaded aren't uploaded again")
+	cmd.Flags().BoolVar(&pushProvenance, "provenance", false, "Sign the image's provenance and attach it to the image with cosign")
+	cmd.Flags().StringVar(&pushProvenanceKey, "provenance-key", "", "Key to sign the provenance with. If not set, cosign signs it keylessly")
+	cmd.Flags().StringVar(&pushHFCard, "export-hf-card", "", "Write a Hugging Face model card for the pushed image, generated from its schema, to this file, like README.md")
 
 	return cmd
 }
 
 func push(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	platforms, err := buildPlatforms()
+	if err != nil {
+		return err
+	}
+
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
 	if err != nil {
 		return err
 	}
+	if err := checkRunTests(cfg); err != nil {
+		return err
+	}
 
 	imageName := cfg.Image
+	if len(args) > 0 && pushImage != "" {
+		return fmt.Errorf("Pass the image name either as an argument or with --image, not both")
+	}
 	if len(args) > 0 {
 		imageName = args[0]
+	} else if pushImage != "" {
+		imageName = pushImage
 	}
 
 	if imageName == "" {
 		return fmt.Errorf("To push images, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog push registry.hooli.corp/hotdog-detector'")
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildProgressOutput); err != nil {
+	registryHost := docker.RegistryHost(imageName)
+	if !docker.HasCredentials(registryHost) {
+		console.Warnf("Docker doesn't have credentials for %s, so the push will fail unless the registry allows anonymous pushes. %s", registryHost, loginHint(registryHost))
+	}
+
+	if pushProvenance && len(platforms) > 0 {
+		return fmt.Errorf("--provenance can't be used with --platform yet")
+	}
+	if pushProvenance && !provenance.CosignInstalled() {
+		return fmt.Errorf("--provenance requires cosign, which could not be found. See https://docs.sigstore.dev/system_config/installation/")
+	}
+
+	if buildLFSPull {
+		if err := image.PullLFS(projectDir); err != nil {
+			return err
+		}
+	}
+
+	builds, err := imageBuilds(cfg, imageName)
+	if err != nil {
 		return err
 	}
+	if err := buildAndPush(cmd.Context(), builds, projectDir, platforms, squashFinal()); err != nil {
+		return err
+	}
+
+	replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
+	if strings.HasPrefix(imageName, replicatePrefix) {
+		replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
+		console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
+	}
+
+	if pushHFCard != "" {
+		// The images for each of the CUDA targets have the same schema, so the card is for the first of them
+		if err := exportHFCard(cfg, builds[0].imageName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// builtImage is an image that has been built to push
+type builtImage struct {
+	imageBuild
+	startedOn  time.Time
+	finishedOn time.Time
+}
+
+// buildAndPush builds the images, pushes them, then generates their provenance. With several images, like for each of
+// the CUDA targets, they're all built first, then pushed at the same time.
+func buildAndPush(ctx context.Context, builds []imageBuild, projectDir string, platforms []string, squash bool) error {
+	// Images built with --platform are pushed as they're built, because Docker can't load images for several
+	// platforms, and the image it loads for one of them doesn't have the labels
+	pushedByBuild := len(platforms) > 0
+
+	built := []builtImage{}
+	for _, build := range builds {
+		startedOn := time.Now()
+		options := image.BuildOptions{
+			Secrets:         buildSecrets,
+			NoCache:         buildNoCache,
+			SeparateWeights: buildSeparateWeights,
+			ProgressOutput:  buildProgressOutput,
+			Cache:           buildCache(),
+			Platforms:       platforms,
+			Push:            pushedByBuild,
+			Squash:          squash,
+			RunTests:        buildRunTests,
+		}
+		if err := image.Build(build.cfg, projectDir, build.imageName, options); err != nil {
+			return err
+		}
+		built = append(built, builtImage{imageBuild: build, startedOn: startedOn, finishedOn: time.Now()})
+	}
+
+	if pushedByBuild {
+		for _, build := range built {
+			console.Infof("Image '%s' pushed", build.imageName)
+		}
+		// The local image isn't the one that was pushed, so it doesn't have its digest
+		console.Info("Provenance isn't generated for images built with --platform")
+		return nil
+	}
 
-	console.Infof("\nPushing image '%s'...", imageName)
+	// The images are all in the same repository, so they're pushed with the same credentials
+	registryHost := docker.RegistryHost(built[0].imageName)
+	var err error
+	if len(built) == 1 {
+		err = docker.PushWithRetries(ctx, built[0].imageName, pushRetries)
+		if err != nil {
+			err = fmt.Errorf("Failed to push %s: %w", built[0].imageName, err)
+		}
+	} else {
+		names := make([]string, len(built))
+		for i, build := range built {
+			names[i] = build.imageName
+		}
+		err = docker.PushAllWithRetries(ctx, names, pushRetries)
+	}
+	if err != nil {
+		return fmt.Errorf("%w. If the registry denied access, check you have permission to push to it. %s", err, loginHint(registryHost))
+	}
 
-	exitStatus := docker.Push(imageName)
-	if exitStatus == nil {
-		console.Infof("Image '%s' pushed", imageName)
-		replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
-		if strings.HasPrefix(imageName, replicatePrefix) {
-			replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
-			console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
+	for _, build := range built {
+		if err := attachProvenance(projectDir, build); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachProvenance generates the provenance of a pushed image, and attaches it to the image with --provenance
+func attachProvenance(projectDir string, build builtImage) error {
+	imageName := build.imageName
+	statement, digest, err := generateProvenance(projectDir, imageName, build.startedOn, build.finishedOn)
+	if err != nil {
+		if pushProvenance {
+			return fmt.Errorf("Failed to generate provenance: %w", err)
 		}
+		console.Warnf("Failed to generate provenance: %s", err)
+		return nil
+	}
+	if pushProvenance {
+		console.Info("Attaching provenance to image...")
+		if err := provenance.Attest(statement, digest, pushProvenanceKey); err != nil {
+			return err
+		}
+		console.Infof("Provenance attached. Check it with 'cog verify --provenance %s'", imageName)
+	}
+	return nil
+}
+
+// exportHFCard writes a Hugging Face model card for a pushed image to --export-hf-card
+func exportHFCard(cfg *config.Config, imageName string) error {
+	schema, err := image.GetOrGenerateOpenAPISchema(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to get the schema for the model card: %w", err)
+	}
+	model := modelcard.Model{Image: imageName}
+	if cfg.HuggingFace != nil {
+		model.BaseModel = cfg.HuggingFace.Repo
+	}
+	card, err := modelcard.Generate(schema, model)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(pushHFCard, []byte(card), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", pushHFCard, err)
+	}
+	console.Infof("Wrote a Hugging Face model card to %s", pushHFCard)
+	return nil
+}
+
+// loginHint returns how to log in to a registry
+func loginHint(registryHost string) string {
+	switch {
+	case registryHost == global.ReplicateRegistryHost:
+		return "Log in with 'cog login'"
+	case registryHost == docker.DockerHubHost:
+		return "Log in with 'docker login'"
+	case strings.Contains(registryHost, ".dkr.ecr."):
+		return fmt.Sprintf("Log in with 'aws ecr get-login-password | docker login --username AWS --password-stdin %s'", registryHost)
+	case registryHost == "gcr.io" || strings.HasSuffix(registryHost, ".gcr.io") || strings.HasSuffix(registryHost, "-docker.pkg.dev"):
+		return fmt.Sprintf("Log in with 'gcloud auth configure-docker %s'", registryHost)
+	}
+	return fmt.Sprintf("Log in with 'docker login %s'", registryHost)
+}
+
+// generateProvenance generates the provenance of a pushed image and writes it to the .cog directory. It returns the
+// provenance and the reference by digest it describes.
+func generateProvenance(projectDir, imageName string, startedOn, finishedOn time.Time) (*provenance.Statement, string, error) {
+	digest, err := docker.RepoDigest(imageName)
+	if err != nil {
+		return nil, "", err
+	}
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return nil, "", err
+	}
+	statement, err := provenance.New(provenance.Build{
+		Image:     digest,
+		Labels:    inspect.Config.Labels,
+		SourceURI: gitRemoteURL(projectDir),
+		Parameters: map[string]interface{}{
+			"image":           imageName,
+			"noCache":         buildNoCache,
+			"separateWeights": buildSeparateWeights,
+			"squashFinal":     buildSquashFinal,
+			"runTests":        buildRunTests,
+		},
+		StartedOn:  startedOn,
+		FinishedOn: finishedOn,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	contents, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := dotcog.WriteFile(dotcog.ProvenancePath(projectDir, imageName), append(contents, '\n')); err != nil {
+		return nil, "", err
+	}
+	return statement, digest, nil
+}
+
+// gitRemoteURL returns the URL of the project's origin remote, or an empty string if it doesn't have one. Credentials
+// are removed from it, because the provenance is public.
+func gitRemoteURL(dir string) string {
+	cmd := exec.Command("git", "remote", "get-url", "origin")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	remote := string(bytes.TrimSpace(out))
+	if u, err := url.Parse(remote); err == nil && u.User != nil {
+		u.User = nil
+		remote = u.String()
 	}
-	return exitStatus
+	return remote
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -10,9 +11,11 @@ import (
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-var projectDirFlag string
-
+// NewRootCommand returns the cog command. The settings shared by all commands, like --debug, are put in each
+// command's context when it runs. Each command's own flags are kept in package variables, so only one command can run
+// at a time in a process.
 func NewRootCommand() (*cobra.Command, error) {
+	settings := global.DefaultSettings()
 	rootCmd := cobra.Command{
 		Use:   "cog",
 		Short: "Cog: Containers for machine learning",
@@ -24,36 +27,70 @@ https://github.com/replicate/cog`,
       $ cog run echo hello world`,
 		Version: fmt.Sprintf("%s (built %s)", global.Version, global.BuildTime),
 		// This stops errors being printed because we print them in cmd/cog/cog.go
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			if global.Debug {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Copied, so setting flags of this command doesn't change the settings of others
+			cmdSettings := *settings
+			if cmdSettings.Debug {
 				console.SetLevel(console.DebugLevel)
 			}
+			if flag := cmd.Flags().Lookup("address-family"); flag != nil {
+				cmdSettings.AddressFamily = flag.Value.String()
+			}
+			// Commands get their settings from their context, rather than package variables
+			cmd.SetContext(global.WithSettings(cmd.Context(), &cmdSettings))
+			switch cmdSettings.LogFormat {
+			case "text":
+			case "json":
+				console.SetMachine(true)
+			default:
+				return fmt.Errorf("Invalid --log-format %q. It must be 'text' or 'json'", cmdSettings.LogFormat)
+			}
 			cmd.SilenceUsage = true
 			if err := update.DisplayAndCheckForRelease(); err != nil {
 				console.Debugf("%s", err)
 			}
+			return nil
 		},
 		SilenceErrors: true,
 	}
-	setPersistentFlags(&rootCmd)
+	setPersistentFlags(&rootCmd, settings)
 
 	rootCmd.AddCommand(
 		newBuildCommand(),
+		newComposeCommand(),
 		newDebugCommand(),
+		newDiffCommand(),
+		newDocsCommand(),
+		newExecCommand(),
+		newGenerateClientCommand(),
 		newInitCommand(),
 		newLoginCommand(),
+		newPipelineCommand(),
 		newPredictCommand(),
 		newPushCommand(),
 		newRunCommand(),
+		newSchemaCommand(),
+		newServeCommand(),
 		newTrainCommand(),
+		newValidateCommand(),
+		newValidateRemoteCommand(),
+		newVerifyCommand(),
+		newWorkspaceCommand(),
 	)
+	wrapCommands(&rootCmd)
 
 	return &rootCmd, nil
 }
 
-func setPersistentFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().BoolVar(&global.Debug, "debug", false, "Show debugging output")
-	cmd.PersistentFlags().BoolVar(&global.ProfilingEnabled, "profile", false, "Enable profiling")
+func setPersistentFlags(cmd *cobra.Command, settings *global.Settings) {
+	cmd.PersistentFlags().BoolVar(&settings.Debug, "debug", false, "Show debugging output")
+	cmd.PersistentFlags().Bool("profile", false, "Enable profiling")
 	cmd.PersistentFlags().Bool("version", false, "Show version of Cog")
-	_ = cmd.PersistentFlags().MarkHidden("profile")
+	defaultLogFormat := os.Getenv("COG_LOG_FORMAT")
+	if defaultLogFormat == "" {
+		defaultLogFormat = "text"
+	}
+	cmd.PersistentFlags().StringVar(&settings.LogFormat, "log-format", defaultLogFormat, "Format of log messages: 'text', or 'json' for a JSON object per line with level, time and message, e.g. for CI or log aggregators. Defaults to $COG_LOG_FORMAT")
+	cmd.PersistentFlags().DurationVar(&settings.HTTPTimeout, "timeout", settings.HTTPTimeout, "How long to wait for requests to registries, and for requests to the model other than predictions, e.g. 2m, or 0 to wait for as long as they take")
+	_ = cmd.PersistentFlags().MarkDeprecated("profile", "it has no effect")
 }
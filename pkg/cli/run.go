@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -12,7 +15,20 @@ import (
 )
 
 var (
-	runPorts []string
+	runPorts      []string
+	runNetwork    string
+	runDNS        []string
+	runExtraHosts []string
+
+	runReadOnly        bool
+	runCapDrop         []string
+	runNoNewPrivileges bool
+	runSeccompProfile  string
+	runTmpfs           []string
+	runUser            string
+
+	runGPUs    string
+	runDevices []string
 )
 
 func newRunCommand() *cobra.Command {
@@ -23,6 +39,10 @@ func newRunCommand() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 	}
 	addBuildProgressOutputFlag(cmd)
+	addAddressFamilyFlag(cmd)
+	addNetworkFlags(cmd)
+	addSecurityFlags(cmd)
+	addDeviceFlags(cmd)
 
 	flags := cmd.Flags()
 	// Flags after first argment are considered args and passed to command
@@ -36,7 +56,7 @@ func newRunCommand() *cobra.Command {
 }
 
 func run(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
 	if err != nil {
 		return err
 	}
@@ -52,12 +72,16 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	runOptions := docker.RunOptions{
-		Args:    args,
-		GPUs:    gpus,
-		Image:   imageName,
-		Volumes: []docker.Volume{{Source: projectDir, Destination: "/src"}},
-		Workdir: "/src",
+		AddressFamily: commandSettings(cmd).AddressFamily,
+		Args:          args,
+		GPUs:          gpus,
+		Image:         imageName,
+		Volumes:       []docker.Volume{{Source: projectDir, Destination: "/src"}},
+		Workdir:       "/src",
 	}
+	applyNetworkOptions(&runOptions, cfg)
+	applySecurityOptions(&runOptions, cfg, projectDir)
+	applyDeviceOptions(&runOptions)
 
 	for _, portString := range runPorts {
 		port, err := strconv.Atoi(portString)
@@ -71,13 +95,119 @@ func run(cmd *cobra.Command, args []string) error {
 	console.Info("")
 	console.Infof("Running '%s' in Docker with the current directory mounted as a volume...", strings.Join(args, " "))
 
-	err = docker.Run(runOptions)
-	if runOptions.GPUs != "" && err == docker.ErrMissingDeviceDriver {
+	// The command's stdout is what it outputs, so it isn't logged in machine mode like its stderr is
+	stderr := console.Writer(console.InfoLevel)
+	defer stderr.Close()
+	err = docker.RunWithIO(runOptions, os.Stdin, os.Stdout, stderr)
+	if runOptions.GPUs != "" && runGPUs == "" && err == docker.ErrMissingDeviceDriver {
 		console.Info("Missing device driver, re-trying without GPU")
 
 		runOptions.GPUs = ""
-		err = docker.Run(runOptions)
+		err = docker.RunWithIO(runOptions, os.Stdin, os.Stdout, stderr)
 	}
 
 	return err
 }
+
+// addressFamilyValue is a flag value that only accepts the address families containers' ports can be published on.
+// The root command copies it to the command's settings.
+type addressFamilyValue struct {
+	value string
+}
+
+func (v *addressFamilyValue) String() string {
+	return v.value
+}
+
+func (v *addressFamilyValue) Set(s string) error {
+	switch s {
+	case "", "ipv4", "ipv6":
+		v.value = s
+		return nil
+	}
+	return fmt.Errorf("must be 'ipv4' or 'ipv6'")
+}
+
+func (v *addressFamilyValue) Type() string {
+	return "string"
+}
+
+func addAddressFamilyFlag(cmd *cobra.Command) {
+	cmd.Flags().Var(&addressFamilyValue{}, "address-family", "Only publish the model's ports on 'ipv4' or 'ipv6' addresses. Defaults to both")
+}
+
+func addNetworkFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&runNetwork, "network", "", "Network to connect the container to: 'bridge', 'host', 'none' or the name of a Docker network. Overrides network.mode in cog.yaml")
+	cmd.Flags().StringArrayVar(&runDNS, "dns", []string{}, "DNS server for the container to use, in addition to any in cog.yaml")
+	cmd.Flags().StringArrayVar(&runExtraHosts, "add-host", []string{}, "Add a host to the container's /etc/hosts, in the form host:ip, in addition to any in cog.yaml")
+}
+
+// applyNetworkOptions sets the network options from cog.yaml and the network flags on runOptions
+func applyNetworkOptions(runOptions *docker.RunOptions, cfg *config.Config) {
+	if cfg != nil && cfg.Network != nil {
+		runOptions.Network = cfg.Network.Mode
+		runOptions.DNS = append(runOptions.DNS, cfg.Network.DNS...)
+		runOptions.ExtraHosts = append(runOptions.ExtraHosts, cfg.Network.ExtraHosts...)
+	}
+	if runNetwork != "" {
+		runOptions.Network = runNetwork
+	}
+	runOptions.DNS = append(runOptions.DNS, runDNS...)
+	runOptions.ExtraHosts = append(runOptions.ExtraHosts, runExtraHosts...)
+}
+
+func addDeviceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&runGPUs, "gpus", "", "GPUs to use, like docker run --gpus: 'all', a number of GPUs, 'device=' and a list of GPU indexes or UUIDs, or 'none' to run without GPUs. Defaults to all GPUs if build.gpu is set in cog.yaml")
+	cmd.Flags().StringArrayVar(&runDevices, "device", []string{}, "Add a host device to the container, in the form path[:container-path[:permissions]], e.g. --device /dev/dri")
+}
+
+// applyDeviceOptions sets the GPUs and devices from the device flags on runOptions. --gpus overrides the GPUs that
+// cog.yaml asks for.
+func applyDeviceOptions(runOptions *docker.RunOptions) {
+	switch runGPUs {
+	case "":
+	case "none":
+		runOptions.GPUs = ""
+	default:
+		runOptions.GPUs = runGPUs
+	}
+	runOptions.Devices = append(runOptions.Devices, runDevices...)
+}
+
+func addSecurityFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&runReadOnly, "read-only", false, "Mount the container's root filesystem as read-only. /tmp is writable unless --tmpfs is set")
+	cmd.Flags().StringArrayVar(&runCapDrop, "cap-drop", []string{}, "Linux capability to drop from the container, e.g. --cap-drop ALL")
+	cmd.Flags().BoolVar(&runNoNewPrivileges, "no-new-privileges", false, "Stop processes in the container from gaining new privileges")
+	cmd.Flags().StringVar(&runSeccompProfile, "seccomp-profile", "", "Path to a seccomp profile to run the container with. Overrides security.seccomp_profile in cog.yaml")
+	cmd.Flags().StringArrayVar(&runTmpfs, "tmpfs", []string{}, "Mount a writable tmpfs at a path in the container, e.g. --tmpfs /root/.cache")
+	cmd.Flags().StringVar(&runUser, "user", "", "User to run the container as, in the form uid[:gid]. Defaults to the user set with build.uid in cog.yaml, or root")
+}
+
+// applySecurityOptions sets the security options from cog.yaml and the security flags on runOptions.
+// Relative seccomp profile paths in cog.yaml are relative to projectDir.
+func applySecurityOptions(runOptions *docker.RunOptions, cfg *config.Config, projectDir string) {
+	seccompProfile := runSeccompProfile
+	if cfg != nil && cfg.Security != nil {
+		runOptions.ReadOnly = cfg.Security.ReadOnly
+		runOptions.CapDrop = append(runOptions.CapDrop, cfg.Security.CapDrop...)
+		runOptions.NoNewPrivileges = cfg.Security.NoNewPrivileges
+		runOptions.Tmpfs = append(runOptions.Tmpfs, cfg.Security.Tmpfs...)
+		if seccompProfile == "" && cfg.Security.SeccompProfile != "" {
+			seccompProfile = cfg.Security.SeccompProfile
+			if !filepath.IsAbs(seccompProfile) && projectDir != "" {
+				seccompProfile = filepath.Join(projectDir, seccompProfile)
+			}
+		}
+	}
+	runOptions.ReadOnly = runOptions.ReadOnly || runReadOnly
+	runOptions.CapDrop = append(runOptions.CapDrop, runCapDrop...)
+	runOptions.NoNewPrivileges = runOptions.NoNewPrivileges || runNoNewPrivileges
+	runOptions.SeccompProfile = seccompProfile
+	runOptions.Tmpfs = append(runOptions.Tmpfs, runTmpfs...)
+	runOptions.User = runUser
+
+	// Python and the model server need somewhere to write temporary files
+	if runOptions.ReadOnly && len(runOptions.Tmpfs) == 0 {
+		runOptions.Tmpfs = []string{"/tmp"}
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/schema"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+var schemaFormat string
+
+func newSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema [image]",
+		Short: "Print the input and output schema of a model",
+		Long: `Print the input and output schema of a model.
+
+If 'image' is not passed, the image built from the current directory is used.
+The schema is read from the image's labels, or generated by running the
+image if it was not built with 'cog build'.`,
+		RunE: cmdSchema,
+		Args: cobra.MaximumNArgs(1),
+	}
+	cmd.Flags().StringVar(&schemaFormat, "format", "table", "Output format: 'table', 'openapi' or 'jsonschema'")
+
+	return cmd
+}
+
+func cmdSchema(cmd *cobra.Command, args []string) error {
+	if !slices.ContainsString([]string{"table", "openapi", "jsonschema"}, schemaFormat) {
+		return fmt.Errorf("Invalid --format %q, must be one of 'table', 'openapi' or 'jsonschema'", schemaFormat)
+	}
+
+	var imageName string
+	var err error
+	if len(args) > 0 {
+		imageName = args[0]
+	} else if imageName, err = defaultImageName(cmd); err != nil {
+		return err
+	}
+
+	s, err := image.GetOrGenerateOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+
+	switch schemaFormat {
+	case "openapi":
+		return printJSON(s)
+	case "jsonschema":
+		return printJSON(schema.JSONSchema(s))
+	}
+	printSchemaTable(s)
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	console.Output(string(out))
+	return nil
+}
+
+func printSchemaTable(s *openapi3.T) {
+	input := schema.Input(s)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION")
+	for _, name := range schema.InputNames(s) {
+		// Defaults and descriptions are set on the property itself, not the enum it refers to
+		raw := &openapi3.Schema{}
+		if ref := input.Properties[name]; ref != nil && ref.Value != nil {
+			raw = ref.Value
+		}
+		prop := schema.Resolve(input.Properties[name])
+		typeName := schema.TypeName(prop)
+		if prop != nil && len(prop.Enum) > 0 {
+			choices := []string{}
+			for _, e := range prop.Enum {
+				choices = append(choices, fmt.Sprint(e))
+			}
+			typeName += " (" + strings.Join(choices, ", ") + ")"
+		}
+		defaultValue := ""
+		if d := raw.Default; d != nil {
+			defaultValue = fmt.Sprint(d)
+		}
+		required := ""
+		if slices.ContainsString(input.Required, name) {
+			required = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, typeName, required, defaultValue, raw.Description)
+	}
+	_ = w.Flush()
+
+	console.Output("")
+	console.Output("Output: " + schema.TypeName(schema.Output(s)))
+}
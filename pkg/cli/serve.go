@@ -0,0 +1,374 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/ui"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	servePort    int
+	serveHostIP  string
+	servePublish string
+	serveUI      bool
+	serveReload  bool
+)
+
+// reloadInterval is how often cog serve --reload checks whether the model's code has changed
+const reloadInterval = time.Second
+
+func newServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve [image]",
+		Short: "Serve a model's HTTP API",
+		Long: `Serve a model's HTTP API.
+
+If 'image' is passed, it will serve that Docker image.
+It must be an image that has been built by Cog.
+
+Otherwise, it will build the model in the current directory and serve that.
+
+By default, the model is served on all of the host's network interfaces. Use
+--host-ip 127.0.0.1 to only serve it to this machine, or --host-ip or
+--publish to serve it on a particular interface, like your LAN's.
+
+With --ui, a web form for trying out the model is also served at /ui/.
+
+With --reload, the model's container is restarted, running setup() again,
+whenever a Python file in the current directory changes, so you can work on
+predict.py without rebuilding the image.`,
+		RunE: cmdServe,
+		Args: cobra.MaximumNArgs(1),
+	}
+	addBuildProgressOutputFlag(cmd)
+	addAddressFamilyFlag(cmd)
+	addNetworkFlags(cmd)
+	addSecurityFlags(cmd)
+	addDeviceFlags(cmd)
+	addSetupTimeoutFlag(cmd)
+	cmd.Flags().IntVarP(&servePort, "port", "p", 5000, "Port on the host to serve the model on")
+	cmd.Flags().StringVar(&serveHostIP, "host-ip", "", "Address on the host to serve the model on, like 127.0.0.1 for only this machine or 0.0.0.0 for all interfaces. Defaults to all interfaces")
+	cmd.Flags().StringVar(&servePublish, "publish", "", "Address and port on the host to serve the model on, in the form [host-ip:]port, like 192.168.1.10:8080. Use this instead of --host-ip and --port")
+	cmd.Flags().BoolVar(&serveUI, "ui", false, "Serve a web form for trying out the model at /ui/")
+	cmd.Flags().BoolVar(&serveReload, "reload", false, "Restart the model when its Python files change")
+
+	return cmd
+}
+
+func cmdServe(cmd *cobra.Command, args []string) error {
+	hostIP, port, err := serveAddress(cmd)
+	if err != nil {
+		return err
+	}
+	if serveReload && len(args) > 0 {
+		return fmt.Errorf("--reload only works when serving the model in the current directory, because an image's code can't change")
+	}
+
+	imageName := ""
+	volumes := []docker.Volume{}
+	gpus := ""
+	var cfg *config.Config
+	projectDir := ""
+
+	if len(args) == 0 {
+		cfg, projectDir, err = config.GetConfig(commandSettings(cmd).ProjectDir)
+		if err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cfg, projectDir, buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{
+			Source:      projectDir,
+			Destination: "/src",
+		})
+		if cfg.Build.GPU {
+			gpus = "all"
+		}
+	} else {
+		imageName = args[0]
+		exists, err := docker.ImageExists(imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+		}
+		if !exists {
+			if err := docker.Pull(imageName); err != nil {
+				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
+			}
+		}
+		if cfg, err = image.GetConfig(imageName); err != nil {
+			return err
+		}
+		if cfg.Build.GPU {
+			gpus = "all"
+		}
+	}
+
+	// When serving the UI, the model is published on a random loopback port and proxied to from servePort, so it
+	// can only be reached through the proxy
+	ports := []docker.Port{{HostIP: hostIP, HostPort: port, ContainerPort: 5000}}
+	if serveUI {
+		ports = []docker.Port{{HostIP: loopbackIP(commandSettings(cmd).AddressFamily), HostPort: 0, ContainerPort: 5000}}
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	runOptions := docker.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Ports:   ports,
+		Volumes: volumes,
+	}
+	applyNetworkOptions(&runOptions, cfg)
+	applySecurityOptions(&runOptions, cfg, projectDir)
+	applyDeviceOptions(&runOptions)
+	predictor := predict.NewPredictor(runOptions, commandSettings(cmd))
+	applySetupTimeout(cmd, &predictor, cfg)
+	stopContainerOnExit(cmd, &predictor)
+
+	// Files are listed before the model starts, so changes made while setup() is running cause a reload
+	var sourceFiles string
+	if serveReload {
+		if sourceFiles, err = listPythonFiles(projectDir); err != nil {
+			return err
+		}
+	}
+	if err := predictor.Start(console.Writer(console.InfoLevel)); err != nil {
+		if !serveReload {
+			return err
+		}
+		// The container keeps running when setup() fails, so it can be restarted once the problem has been fixed
+		console.Warnf("%s", err)
+		console.Info("Fix the problem and save your changes to reload the model")
+	}
+
+	// The model's URL changes when it's restarted if it's published on a random port, which it is with --ui
+	var modelURL atomic.Pointer[url.URL]
+	setModelURL := func() error {
+		u, err := url.Parse(predictor.URL())
+		if err != nil {
+			return err
+		}
+		modelURL.Store(u)
+		return nil
+	}
+	if err := setModelURL(); err != nil {
+		return err
+	}
+	// Started once the URL has been printed, because restarting the model changes it
+	startReloading := func() {
+		if serveReload {
+			go reloadOnChange(cmd.Context(), projectDir, sourceFiles, func() error {
+				if err := predictor.Restart(console.Writer(console.InfoLevel)); err != nil {
+					return err
+				}
+				return setModelURL()
+			})
+		}
+	}
+
+	if !serveUI {
+		console.Infof("Serving at %s", predictor.URL())
+		warnIfExposed(hostIP, port)
+		startReloading()
+		<-cmd.Context().Done()
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", http.StripPrefix("/ui", ui.Handler("")))
+	mux.Handle("/", &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(modelURL.Load())
+		},
+	})
+	server := &http.Server{Handler: mux}
+
+	// "tcp" listens on both IPv4 and IPv6 where the host supports it
+	network := "tcp"
+	switch commandSettings(cmd).AddressFamily {
+	case "ipv4":
+		network = "tcp4"
+	case "ipv6":
+		network = "tcp6"
+	}
+	listener, err := net.Listen(network, net.JoinHostPort(hostIP, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("Failed to listen on port %d: %w", port, err)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+
+	serveURL := "http://" + net.JoinHostPort(serveHost(hostIP), strconv.Itoa(port))
+	console.Infof("Serving at %s", serveURL)
+	console.Infof("UI available at %s/ui/", serveURL)
+	warnIfExposed(hostIP, port)
+	startReloading()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("Failed to serve: %w", err)
+		}
+	case <-cmd.Context().Done():
+		if err := server.Close(); err != nil {
+			console.Warnf("Failed to stop server: %s", err)
+		}
+	}
+	return nil
+}
+
+// serveAddress returns the host address and port to serve the model on, from --host-ip and --port, or --publish.
+// The address is empty if it wasn't set, to serve on all interfaces.
+func serveAddress(cmd *cobra.Command) (string, int, error) {
+	hostIP, port := serveHostIP, servePort
+	if servePublish != "" {
+		if cmd.Flags().Changed("host-ip") || cmd.Flags().Changed("port") {
+			return "", 0, fmt.Errorf("Use either --publish, or --host-ip and --port, not both")
+		}
+		var err error
+		if hostIP, port, err = parsePublish(servePublish); err != nil {
+			return "", 0, err
+		}
+	}
+	if hostIP != "" && net.ParseIP(hostIP) == nil {
+		return "", 0, fmt.Errorf("%s is not an IP address. Pass the address of one of this machine's network interfaces, like 192.168.1.10, or 0.0.0.0 for all of them", hostIP)
+	}
+	if port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("%d is not a valid port. It must be between 1 and 65535", port)
+	}
+	return hostIP, port, nil
+}
+
+// parsePublish parses a --publish value in the form [host-ip:]port, like 8080, 192.168.1.10:8080 or [::1]:8080
+func parsePublish(value string) (string, int, error) {
+	hostIP, portString := "", value
+	if strings.Contains(value, ":") {
+		var err error
+		if hostIP, portString, err = net.SplitHostPort(value); err != nil {
+			return "", 0, fmt.Errorf("Invalid --publish %s. It must be in the form [host-ip:]port, with IPv6 addresses in brackets, like [::1]:8080", value)
+		}
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid --publish %s. %s is not a port", value, portString)
+	}
+	return hostIP, port, nil
+}
+
+// serveHost returns the host to print in the URL the model is served at
+func serveHost(hostIP string) string {
+	if ip := net.ParseIP(hostIP); ip != nil && !ip.IsUnspecified() {
+		return ip.String()
+	}
+	return "localhost"
+}
+
+// loopbackIP returns the loopback address for an address family
+func loopbackIP(addressFamily string) string {
+	if addressFamily == "ipv6" {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// warnIfExposed warns that the model can be reached from other machines if it is served on an address that isn't
+// loopback, because the model's HTTP API has no authentication. An empty hostIP means all interfaces.
+func warnIfExposed(hostIP string, port int) {
+	where := "all network interfaces"
+	if hostIP != "" {
+		ip := net.ParseIP(hostIP)
+		if ip == nil || ip.IsLoopback() {
+			return
+		}
+		if !ip.IsUnspecified() {
+			where = hostIP
+		}
+	}
+	console.Warnf("The model is being served on %s, so anyone who can reach this machine on port %d can use it. Its HTTP API has no authentication, so only do this on networks you trust.", where, port)
+}
+
+// reloadOnChange calls reload whenever the Python files in projectDir change from files, which is what
+// listPythonFiles returned for them, until ctx is done
+func reloadOnChange(ctx context.Context, projectDir string, files string, reload func() error) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := listPythonFiles(projectDir)
+		if err != nil {
+			// Files can disappear while they're being listed, e.g. when an editor saves them
+			console.Debugf("Failed to list Python files: %s", err)
+			continue
+		}
+		if current == files {
+			continue
+		}
+		files = current
+
+		console.Info("Python files changed, restarting the model and running setup()...")
+		if err := reload(); err != nil {
+			if ctx.Err() == nil {
+				console.Warnf("%s", err)
+				console.Info("Fix the problem and save your changes to reload the model")
+			}
+			continue
+		}
+		console.Info("Model reloaded")
+	}
+}
+
+// listPythonFiles returns the path, size and modification time of each Python file in dir, so it can be told when
+// one has changed. Only Python files are listed, because models often write other files, like weights, into the
+// project directory, which shouldn't cause a reload.
+func listPythonFiles(dir string) (string, error) {
+	var files strings.Builder
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "__pycache__") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(name, ".py") {
+			fmt.Fprintf(&files, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return files.String(), nil
+}
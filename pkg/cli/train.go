@@ -1,10 +1,6 @@
 package cli
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
-
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/image"
@@ -29,7 +25,10 @@ It will build the model in the current directory and train it.`,
 		Hidden: true,
 	}
 	addBuildProgressOutputFlag(cmd)
-	cmd.Flags().StringArrayVarP(&trainInputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	addAddressFamilyFlag(cmd)
+	addDeviceFlags(cmd)
+	addSetupTimeoutFlag(cmd)
+	cmd.Flags().StringArrayVarP(&trainInputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg. URLs are downloaded by the model. E.g. -i path=https://example.com/image.jpg")
 
 	return cmd
 }
@@ -42,7 +41,12 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 
 	// Build image
 
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	cfg, projectDir, err := config.GetConfig(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	serverCommand, err := cfg.TrainServerCommand()
 	if err != nil {
 		return err
 	}
@@ -64,36 +68,25 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 	console.Info("")
 	console.Infof("Starting Docker image %s...", imageName)
 
-	predictor := predict.NewPredictor(docker.RunOptions{
+	runOptions := docker.RunOptions{
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: volumes,
-		Args:    []string{"python", "-m", "cog.server.http", "--x-mode", "train"},
-	})
-
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
-
-		<-captureSignal
+		Args:    serverCommand,
+	}
+	applyDeviceOptions(&runOptions)
+	predictor := predict.NewPredictor(runOptions, commandSettings(cmd))
 
-		console.Info("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
+	applySetupTimeout(cmd, &predictor, cfg)
+	stopContainerOnExit(cmd, &predictor)
 
-	if err := predictor.Start(os.Stderr); err != nil {
+	if err := predictor.Start(console.Writer(console.InfoLevel)); err != nil {
 		return err
 	}
 
-	// FIXME: will not run on signal
-	defer func() {
-		console.Debugf("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
-
-	return predictIndividualInputs(predictor, trainInputFlags, weightsPath)
+	inputs, err := parseInputFlags(trainInputFlags)
+	if err != nil {
+		return err
+	}
+	return predictIndividualInputs(cmd.Context(), predictor, imageName, inputs, weightsPath)
 }
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check cog.yaml for problems",
+		Long: `Check cog.yaml for problems, without building the image.
+
+As well as the checks that are done before every build, this checks for
+options that don't exist, files that are missing, predict and train
+options that don't point at a Python file and class, invalid image names,
+and CUDA versions that might not work with the installed PyTorch or
+TensorFlow. Each problem is printed with its line in cog.yaml and a
+suggestion for how to fix it.
+
+It exits with status 1 if there are any problems.`,
+		RunE: validateConfig,
+		Args: cobra.NoArgs,
+	}
+	return cmd
+}
+
+func validateConfig(cmd *cobra.Command, args []string) error {
+	projectDir, err := config.GetProjectDir(commandSettings(cmd).ProjectDir)
+	if err != nil {
+		return err
+	}
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	problems := config.Check(contents, projectDir)
+	for _, problem := range problems {
+		location := configPath
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, problem.Line)
+		}
+		console.Output(fmt.Sprintf("%s: error: %s", location, problem.Message))
+		if problem.Fix != "" {
+			console.Output("    " + problem.Fix)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Found %d %s in %s", len(problems), plural(len(problems), "error"), global.ConfigFilename)
+	}
+	console.Infof("%s is valid", global.ConfigFilename)
+	return nil
+}
+
+// plural returns word with an s on the end, unless n is 1
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/schema"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	validateRemoteImage      string
+	validateRemoteInputFlags []string
+)
+
+func newValidateRemoteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate-remote <url>",
+		Short: "Check that a deployed model matches the model in the current directory",
+		Long: `Check that a deployed model matches the model in the current directory.
+
+The OpenAPI schema served at <url> is compared to the schema of the image
+built from the current directory (or the image passed with --image).
+
+If any inputs are passed with -i, a prediction is also run against <url>
+and its output is checked against the deployed schema.
+
+If the model needs credentials, pass a token with --token, put a username
+and password in <url> for basic auth, or use a profile with --remote.`,
+		Example: `  cog validate-remote https://my-model.internal:5000
+  cog validate-remote https://my-model.internal:5000 -i prompt="a photo of a cat"`,
+		RunE: validateRemote,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.Flags().StringVar(&validateRemoteImage, "image", "", "Image to compare against. Defaults to the image built from the current directory")
+	addRemoteFlags(cmd)
+	cmd.Flags().StringArrayVarP(&validateRemoteInputFlags, "input", "i", []string{}, "Inputs for a test prediction, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+
+	return cmd
+}
+
+func validateRemote(cmd *cobra.Command, args []string) error {
+	url := args[0]
+
+	imageName := validateRemoteImage
+	if imageName == "" {
+		var err error
+		if imageName, err = defaultImageName(cmd); err != nil {
+			return err
+		}
+	}
+
+	exists, err := docker.ImageExists(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+	}
+	if !exists {
+		return fmt.Errorf("Image %s does not exist. Run 'cog build' first, or pass an image with --image", imageName)
+	}
+
+	localSchema, err := image.GetOrGenerateOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+
+	predictor, url, err := newRemotePredictor(cmd, url)
+	if err != nil {
+		return err
+	}
+	remoteSchema, err := predictor.GetSchema()
+	if err != nil {
+		return explainUnauthorized(fmt.Errorf("Failed to get schema from %s: %w", url, err))
+	}
+
+	diffs := schema.Diff(localSchema, remoteSchema)
+	if len(diffs) > 0 {
+		console.Warnf("The schema at %s does not match %s:", url, imageName)
+		for _, d := range diffs {
+			console.Warnf("  %s", d)
+		}
+		return fmt.Errorf("%s does not match %s", url, imageName)
+	}
+	console.Infof("The schema at %s matches %s", url, imageName)
+
+	if len(validateRemoteInputFlags) == 0 {
+		return nil
+	}
+
+	console.Info("Running test prediction...")
+	inputs, err := parseInputFlags(validateRemoteInputFlags)
+	if err != nil {
+		return err
+	}
+	prediction, err := predictor.Predict(cmd.Context(), inputs)
+	if err != nil {
+		return explainUnauthorized(err)
+	}
+	if prediction.Status != "succeeded" {
+		return fmt.Errorf("Test prediction did not succeed (status: %s): %s", prediction.Status, prediction.Error)
+	}
+	if outputSchema := schema.Output(remoteSchema); outputSchema != nil && prediction.Output != nil {
+		if err := outputSchema.VisitJSON(*prediction.Output); err != nil {
+			return fmt.Errorf("Test prediction output does not match the schema: %w", err)
+		}
+	}
+	console.Info("Test prediction succeeded")
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/provenance"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	verifyProvenance            bool
+	verifyKey                   string
+	verifyCertificateIdentity   string
+	verifyCertificateOIDCIssuer string
+)
+
+func newVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify IMAGE",
+		Short: "Verify an image pushed by Cog",
+		Long: `Verify an image pushed by Cog.
+
+With --provenance, checks that the image has SLSA provenance attached by
+'cog push --provenance', signed by the given key or keyless identity, and
+that the provenance describes the image. This requires cosign.
+
+If IMAGE is a tag rather than a reference by digest, the image is looked up
+locally to find its digest, and it must have been pushed or pulled.`,
+		Example: `  cog verify --provenance --key cosign.pub r8.im/user/model
+  cog verify --provenance \
+    --certificate-identity https://github.com/user/model/.github/workflows/push.yaml@refs/heads/main \
+    --certificate-oidc-issuer https://token.actions.githubusercontent.com \
+    r8.im/user/model@sha256:...`,
+		RunE: cmdVerify,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.Flags().BoolVar(&verifyProvenance, "provenance", false, "Verify the image's SLSA provenance")
+	addProvenanceIdentityFlags(cmd)
+
+	return cmd
+}
+
+func addProvenanceIdentityFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&verifyKey, "key", "", "Public key the provenance must be signed with")
+	cmd.Flags().StringVar(&verifyCertificateIdentity, "certificate-identity", "", "Identity the provenance must be keylessly signed by")
+	cmd.Flags().StringVar(&verifyCertificateOIDCIssuer, "certificate-oidc-issuer", "", "OIDC issuer of the keyless signing identity")
+}
+
+func cmdVerify(cmd *cobra.Command, args []string) error {
+	if !verifyProvenance {
+		return fmt.Errorf("Nothing to verify. Pass --provenance to verify the image's provenance")
+	}
+
+	imageName := args[0]
+	digest := imageName
+	if !strings.Contains(imageName, "@") {
+		var err error
+		if digest, err = docker.RepoDigest(imageName); err != nil {
+			return fmt.Errorf("Failed to find digest of %s: %w", imageName, err)
+		}
+	}
+
+	statement, err := verifyImageProvenance(digest)
+	if err != nil {
+		return err
+	}
+	console.Infof("Provenance of %s verified", digest)
+	console.Infof("Built by Cog %s from %s", statement.Predicate.BuildDefinition.InternalParameters["cogVersion"], statement.SourceDescription())
+	if metadata := statement.Predicate.RunDetails.Metadata; metadata != nil && metadata.FinishedOn != nil {
+		console.Infof("Built at %s", metadata.FinishedOn.Format("2006-01-02 15:04:05 MST"))
+	}
+	return nil
+}
+
+// verifyImageProvenance checks that the image with the given digest reference has provenance generated by Cog,
+// signed by the identity passed on the command line, and returns it
+func verifyImageProvenance(digest string) (*provenance.Statement, error) {
+	if !provenance.CosignInstalled() {
+		return nil, fmt.Errorf("Verifying provenance requires cosign, which could not be found. See https://docs.sigstore.dev/system_config/installation/")
+	}
+	statements, err := provenance.Verify(digest, provenance.VerifyOptions{
+		Key:                   verifyKey,
+		CertificateIdentity:   verifyCertificateIdentity,
+		CertificateOIDCIssuer: verifyCertificateOIDCIssuer,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, statement := range statements {
+		if lastErr = provenance.Check(statement, digest); lastErr == nil {
+			return statement, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("%s has no provenance", digest)
+}
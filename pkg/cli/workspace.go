@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/workspace"
+)
+
+var (
+	workspaceFile         string
+	workspaceChangedSince string
+)
+
+func newWorkspaceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workspace",
+		Short: "Build, test and push several models in one repository",
+		Long: `Build, test and push several models in one repository.
+
+The models are listed in a cog-workspace.yaml file. For example:
+
+    models:
+      - models/*
+      - upscaler
+    shared:
+      - lib
+
+Each model is a directory with a cog.yaml in it, and directories can be
+glob patterns. 'shared' lists files and directories, relative to the
+workspace file, that all the models depend on.
+
+With --changed-since, only the models that have changed since a Git
+commit, like origin/main, are included. A model has changed if a file in
+its directory has, or a shared file, or the workspace file itself. Shared
+files are only used for this: each image is built from its model's
+directory, so copy shared files into it before building if the model
+needs them.
+
+The models are built one after another, so the layers they have in
+common, like the base image, Python and Cog, are only built once and
+shared between them.`,
+	}
+	cmd.PersistentFlags().StringVarP(&workspaceFile, "file", "f", workspace.DefaultFilename, "Path to the workspace file")
+	cmd.PersistentFlags().StringVar(&workspaceChangedSince, "changed-since", "", "Only include the models that have changed since this Git commit, like origin/main")
+
+	cmd.AddCommand(
+		newWorkspaceBuildCommand(),
+		newWorkspaceListCommand(),
+		newWorkspacePushCommand(),
+		newWorkspaceTestCommand(),
+	)
+
+	return cmd
+}
+
+func newWorkspaceListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Short:   "List the models in a workspace",
+		Example: `  cog workspace list --changed-since origin/main`,
+		RunE:    workspaceList,
+		Args:    cobra.NoArgs,
+	}
+}
+
+func newWorkspaceBuildCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "build",
+		Short: "Build the models in a workspace",
+		Long: `Build the models in a workspace.
+
+Each model's image is named after the 'image' option in its cog.yaml, or
+else its directory, like 'cog build'. Models with build.cuda_targets have
+an image built for each of them, with the CUDA version added to its tag.
+If a model fails to build, the others are still built, and the ones that
+failed are listed at the end.`,
+		Example: `  cog workspace build
+  cog workspace build --changed-since origin/main`,
+		RunE: workspaceBuild,
+		Args: cobra.NoArgs,
+	}
+	addWorkspaceBuildFlags(cmd)
+	return cmd
+}
+
+func newWorkspaceTestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Build the models in a workspace and run their tests",
+		Long: `Build the models in a workspace and run their tests.
+
+Each model is built, then the commands in the test section of its cog.yaml
+are run in its image, like 'cog build --run-tests'. Models without tests
+are built, but not tested.`,
+		Example: `  cog workspace test --changed-since origin/main`,
+		RunE:    workspaceTest,
+		Args:    cobra.NoArgs,
+	}
+	addWorkspaceBuildFlags(cmd)
+	return cmd
+}
+
+func newWorkspacePushCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Build the models in a workspace and push them",
+		Long: `Build the models in a workspace and push them.
+
+Each model is pushed to the image in the 'image' option of its cog.yaml,
+which they must all have.`,
+		Example: `  cog workspace push --changed-since origin/main --run-tests`,
+		RunE:    workspacePush,
+		Args:    cobra.NoArgs,
+	}
+	addWorkspaceBuildFlags(cmd)
+	addRunTestsFlag(cmd)
+	cmd.Flags().IntVar(&pushRetries, "retries", 3, "Number of times to retry each push if it fails. Layers that were already uploaded aren't uploaded again")
+	return cmd
+}
+
+func addWorkspaceBuildFlags(cmd *cobra.Command) {
+	addBuildProgressOutputFlag(cmd)
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addCacheFlags(cmd)
+	addLFSPullFlag(cmd)
+}
+
+// workspaceModel is a model in a workspace
+type workspaceModel struct {
+	// dir is the model's directory, relative to the workspace file
+	dir        string
+	projectDir string
+	cfg        *config.Config
+}
+
+// imageName returns the name to build the model's image as: the 'image' option in its cog.yaml, or else one made from
+// its directory
+func (m *workspaceModel) imageName() string {
+	if m.cfg.Image != "" {
+		return m.cfg.Image
+	}
+	return config.DockerImageName(m.projectDir)
+}
+
+// loadWorkspaceModels returns the models in --file, or the ones that have changed if --changed-since is set. Their
+// cog.yaml files are all loaded first, so a mistake in one of them doesn't fail the command part of the way through.
+func loadWorkspaceModels() ([]*workspaceModel, error) {
+	ws, err := workspace.Load(workspaceFile)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := ws.ModelDirs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", workspaceFile, err)
+	}
+	if workspaceChangedSince != "" {
+		changedFiles, err := ws.ChangedFiles(workspaceChangedSince)
+		if err != nil {
+			return nil, err
+		}
+		dirs = ws.Changed(dirs, changedFiles)
+	}
+
+	models := []*workspaceModel{}
+	for _, dir := range dirs {
+		cfg, projectDir, err := config.GetConfig(filepath.Join(ws.Dir, filepath.FromSlash(dir)))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load the cog.yaml of %s: %w", dir, err)
+		}
+		models = append(models, &workspaceModel{dir: dir, projectDir: projectDir, cfg: cfg})
+	}
+	return models, nil
+}
+
+func workspaceList(cmd *cobra.Command, args []string) error {
+	models, err := loadWorkspaceModels()
+	if err != nil {
+		return err
+	}
+	for _, model := range models {
+		console.Output(model.dir)
+	}
+	return nil
+}
+
+func workspaceBuild(cmd *cobra.Command, args []string) error {
+	models, err := loadWorkspaceModels()
+	if err != nil {
+		return err
+	}
+	return forEachWorkspaceModel(models, "Building", func(model *workspaceModel) error {
+		_, err := buildWorkspaceModel(model, false)
+		return err
+	})
+}
+
+func workspaceTest(cmd *cobra.Command, args []string) error {
+	models, err := loadWorkspaceModels()
+	if err != nil {
+		return err
+	}
+	return forEachWorkspaceModel(models, "Testing", func(model *workspaceModel) error {
+		if len(model.cfg.Test) == 0 {
+			console.Infof("%s has no commands in the test section of its cog.yaml, so it's only built", model.dir)
+		}
+		_, err := buildWorkspaceModel(model, len(model.cfg.Test) > 0)
+		return err
+	})
+}
+
+func workspacePush(cmd *cobra.Command, args []string) error {
+	models, err := loadWorkspaceModels()
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, model := range models {
+		if model.cfg.Image == "" {
+			missing = append(missing, model.dir)
+		}
+		if err := checkRunTests(model.cfg); err != nil {
+			return fmt.Errorf("%s: %w", model.dir, err)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("To push the models in a workspace, they must all set the 'image' option in their cog.yaml. These don't: %s", strings.Join(missing, ", "))
+	}
+
+	return forEachWorkspaceModel(models, "Pushing", func(model *workspaceModel) error {
+		imageNames, err := buildWorkspaceModel(model, buildRunTests)
+		if err != nil {
+			return err
+		}
+		for _, imageName := range imageNames {
+			registryHost := docker.RegistryHost(imageName)
+			if err := docker.PushWithRetries(cmd.Context(), imageName, pushRetries); err != nil {
+				return fmt.Errorf("Failed to push %s: %w. If the registry denied access, check you have permission to push to it. %s", imageName, err, loginHint(registryHost))
+			}
+		}
+		return nil
+	})
+}
+
+// buildWorkspaceModel builds a model in a workspace, with the flags of the workspace command, and returns the names
+// of the images it built. That's one for each of the model's CUDA targets, if it has them.
+func buildWorkspaceModel(model *workspaceModel, runTests bool) ([]string, error) {
+	if buildLFSPull {
+		if err := image.PullLFS(model.projectDir); err != nil {
+			return nil, err
+		}
+	}
+	builds, err := imageBuilds(model.cfg, model.imageName())
+	if err != nil {
+		return nil, err
+	}
+	options := image.BuildOptions{
+		Secrets:        buildSecrets,
+		NoCache:        buildNoCache,
+		ProgressOutput: buildProgressOutput,
+		Cache:          buildCache(),
+		RunTests:       runTests,
+	}
+	imageNames := []string{}
+	for _, build := range builds {
+		if err := image.Build(build.cfg, model.projectDir, build.imageName, options); err != nil {
+			return nil, err
+		}
+		imageNames = append(imageNames, build.imageName)
+	}
+	return imageNames, nil
+}
+
+// forEachWorkspaceModel runs fn for each of the models. If it fails for some of them, it carries on with the rest, and
+// returns an error listing the ones it failed for.
+func forEachWorkspaceModel(models []*workspaceModel, action string, fn func(model *workspaceModel) error) error {
+	if len(models) == 0 {
+		if workspaceChangedSince != "" {
+			console.Infof("None of the models have changed since %s", workspaceChangedSince)
+		} else {
+			console.Info("There are no models in the workspace")
+		}
+		return nil
+	}
+
+	failed := []string{}
+	for i, model := range models {
+		console.Infof("\n%s %s (%d of %d)...", action, model.dir, i+1, len(models))
+		if err := fn(model); err != nil {
+			console.Errorf("%s: %s", model.dir, err)
+			failed = append(failed, model.dir)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d models failed: %s", len(failed), len(models), strings.Join(failed, ", "))
+	}
+	console.Infof("\nFinished %d models: %s", len(models), strings.Join(workspaceModelDirs(models), ", "))
+	return nil
+}
+
+func workspaceModelDirs(models []*workspaceModel) []string {
+	dirs := make([]string, len(models))
+	for i, model := range models {
+		dirs[i] = model.dir
+	}
+	return dirs
+}
@@ -0,0 +1,280 @@
+// Package clientgen generates typed clients for a model's HTTP API from its OpenAPI schema
+package clientgen
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/schema"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+//go:embed templates/*.tmpl
+var templatesFS embed.FS
+
+// Language is a language that a client can be generated in
+type Language struct {
+	Name      string
+	Filename  string
+	template  string
+	typeNamer func(s *openapi3.Schema) string
+	// identifier returns an input's name in a form that can be used for it in the generated source
+	identifier func(name string) string
+	// comment returns a description in a form that can be put in a comment in the generated source
+	comment func(description string) string
+}
+
+var languages = []Language{
+	{Name: "python", Filename: "client.py", template: "python.tmpl", typeNamer: pythonType, identifier: pythonIdentifier, comment: pythonDocstring},
+	{Name: "typescript", Filename: "client.ts", template: "typescript.tmpl", typeNamer: typescriptType, identifier: typescriptPropertyName, comment: typescriptComment},
+	{Name: "go", Filename: "client.go", template: "go.tmpl", typeNamer: goType, identifier: goIdentifier, comment: goComment},
+}
+
+// LanguageNames returns the names of the supported languages
+func LanguageNames() []string {
+	names := []string{}
+	for _, l := range languages {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// GetLanguage returns the language with the given name
+func GetLanguage(name string) (*Language, error) {
+	for _, l := range languages {
+		if l.Name == name {
+			l := l
+			return &l, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown language %q, must be one of: %s", name, strings.Join(LanguageNames(), ", "))
+}
+
+// Field is a single input to the model
+type Field struct {
+	// Name is the name of the input, as sent in the request
+	Name string
+	// Identifier is Name in a form that can be used in the language, like a Python parameter or an exported Go field
+	Identifier string
+	Type       string
+	Required   bool
+	// Description is escaped so it can be put in a comment
+	Description string
+}
+
+type templateData struct {
+	Inputs     []Field
+	OutputType string
+}
+
+// Generate returns the source code of a client for the model described by s
+func Generate(lang *Language, s *openapi3.T) (string, error) {
+	input := schema.Input(s)
+	data := templateData{Inputs: []Field{}, OutputType: lang.typeNamer(schema.Output(s))}
+	identifiers := map[string]bool{}
+	for _, name := range schema.InputNames(s) {
+		prop := schema.Resolve(input.Properties[name])
+		description := ""
+		if prop != nil {
+			description = lang.comment(strings.TrimSpace(prop.Description))
+		}
+		data.Inputs = append(data.Inputs, Field{
+			Name:        name,
+			Identifier:  uniqueIdentifier(lang.identifier(name), identifiers),
+			Type:        lang.typeNamer(prop),
+			Required:    slices.ContainsString(input.Required, name),
+			Description: description,
+		})
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/"+lang.template)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("Failed to generate %s client: %w", lang.Name, err)
+	}
+	if lang.Name == "go" {
+		formatted, err := format.Source(out.Bytes())
+		if err != nil {
+			return "", fmt.Errorf("Failed to format Go client: %w", err)
+		}
+		return string(formatted), nil
+	}
+	return out.String(), nil
+}
+
+func pythonType(s *openapi3.Schema) string {
+	if s == nil {
+		return "Any"
+	}
+	switch s.Type {
+	case "string":
+		return "str"
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "array":
+		if s.Items != nil {
+			return "List[" + pythonType(schema.Resolve(s.Items)) + "]"
+		}
+		return "List[Any]"
+	case "object":
+		return "Dict[str, Any]"
+	}
+	return "Any"
+}
+
+func typescriptType(s *openapi3.Schema) string {
+	if s == nil {
+		return "unknown"
+	}
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		if s.Items != nil {
+			return typescriptType(schema.Resolve(s.Items)) + "[]"
+		}
+		return "unknown[]"
+	case "object":
+		return "Record<string, unknown>"
+	}
+	return "unknown"
+}
+
+func goType(s *openapi3.Schema) string {
+	if s == nil {
+		return "interface{}"
+	}
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		if s.Items != nil {
+			return "[]" + goType(schema.Resolve(s.Items))
+		}
+		return "[]interface{}"
+	case "object":
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// uniqueIdentifier adds a number to identifier if it's already used by another input, like when inputs called a-b and
+// a_b are both a_b in Python, and marks it as used
+func uniqueIdentifier(identifier string, used map[string]bool) string {
+	unique := identifier
+	for i := 2; used[unique]; i++ {
+		unique = identifier + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// goIdentifier converts snake_case input names to CamelCase. Characters that can't be in an identifier separate
+// words like underscores do.
+func goIdentifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !isIdentifierRune(r) || r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	identifier := b.String()
+	if identifier == "" || unicode.IsDigit(rune(identifier[0])) {
+		identifier = "X" + identifier
+	}
+	return identifier
+}
+
+// pythonKeywords are Python's reserved words, and self, which is the name of predict's first parameter
+var pythonKeywords = []string{
+	"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del",
+	"elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal",
+	"not", "or", "pass", "raise", "return", "self", "try", "while", "with", "yield",
+}
+
+// pythonIdentifier replaces characters that can't be in a Python identifier with underscores, and adds an underscore
+// to keywords, like PEP 8 suggests, so class becomes class_
+func pythonIdentifier(name string) string {
+	identifier := strings.Map(func(r rune) rune {
+		if isIdentifierRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if identifier == "" || unicode.IsDigit(rune(identifier[0])) {
+		identifier = "_" + identifier
+	}
+	if slices.ContainsString(pythonKeywords, identifier) {
+		identifier += "_"
+	}
+	return identifier
+}
+
+// typescriptPropertyName quotes names that aren't valid identifiers, like ones with hyphens. Reserved words can be
+// property names in TypeScript, so they don't need to be.
+func typescriptPropertyName(name string) string {
+	for i, r := range name {
+		if !isIdentifierRune(r) && r != '$' || i == 0 && unicode.IsDigit(r) {
+			return strconv.Quote(name)
+		}
+	}
+	if name == "" {
+		return `""`
+	}
+	return name
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// pythonDocstring escapes a description so it can be put in a """ docstring, and indents its lines to line up with the
+// docstring in predict
+func pythonDocstring(description string) string {
+	description = strings.ReplaceAll(description, `\`, `\\`)
+	description = strings.ReplaceAll(description, `"""`, `\"\"\"`)
+	return strings.Join(strings.Split(description, "\n"), "\n            ")
+}
+
+// typescriptComment escapes a description so it can be put in a /** */ comment
+func typescriptComment(description string) string {
+	description = strings.ReplaceAll(description, "*/", "*\\/")
+	return strings.Join(strings.Split(description, "\n"), "\n   * ")
+}
+
+// goComment puts each line of a description after //
+func goComment(description string) string {
+	return strings.Join(strings.Split(description, "\n"), "\n\t// ")
+}
@@ -0,0 +1,133 @@
+package clientgen
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func testSchema(t *testing.T) *openapi3.T {
+	s, err := openapi3.NewLoader().LoadFromData([]byte(`{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {"schemas": {
+    "Input": {
+      "type": "object",
+      "properties": {
+        "prompt": {"type": "string", "description": "Text prompt", "x-order": 0},
+        "num_outputs": {"type": "integer", "x-order": 1}
+      },
+      "required": ["prompt"]
+    },
+    "Output": {"type": "array", "items": {"type": "string", "format": "uri"}}
+  }}
+}`))
+	require.NoError(t, err)
+	return s
+}
+
+func TestGeneratePython(t *testing.T) {
+	lang, err := GetLanguage("python")
+	require.NoError(t, err)
+	source, err := Generate(lang, testSchema(t))
+	require.NoError(t, err)
+	require.Contains(t, source, "        prompt: str,\n        num_outputs: Optional[int] = None,\n    ) -> List[str]:")
+	require.Contains(t, source, "prompt: Text prompt")
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	lang, err := GetLanguage("typescript")
+	require.NoError(t, err)
+	source, err := Generate(lang, testSchema(t))
+	require.NoError(t, err)
+	require.Contains(t, source, "  prompt: string;\n  num_outputs?: number;\n}")
+	require.Contains(t, source, "export type Output = string[];")
+}
+
+func TestGenerateGo(t *testing.T) {
+	lang, err := GetLanguage("go")
+	require.NoError(t, err)
+	source, err := Generate(lang, testSchema(t))
+	require.NoError(t, err)
+	require.Contains(t, source, "\tPrompt     string `json:\"prompt\"`\n\tNumOutputs *int   `json:\"num_outputs,omitempty\"`")
+	require.Contains(t, source, "type Output = []string")
+}
+
+// awkwardSchema has inputs whose names are reserved words or aren't valid identifiers, and descriptions that would
+// end the comments they're put in
+func awkwardSchema(t *testing.T) *openapi3.T {
+	s, err := openapi3.NewLoader().LoadFromData([]byte(`{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {"schemas": {
+    "Input": {
+      "type": "object",
+      "properties": {
+        "class": {"type": "string", "description": "The class.\nEnds with \"\"\" and */", "x-order": 0},
+        "max-tokens": {"type": "integer", "x-order": 1},
+        "lambda": {"type": "number", "x-order": 2},
+        "max_tokens": {"type": "integer", "x-order": 3}
+      },
+      "required": ["class"]
+    },
+    "Output": {"type": "string"}
+  }}
+}`))
+	require.NoError(t, err)
+	return s
+}
+
+func TestGenerateEscapesNamesAndDescriptions(t *testing.T) {
+	for _, tt := range []struct {
+		language string
+		contains []string
+	}{
+		{"python", []string{
+			"        class_: str,\n        max_tokens: Optional[int] = None,\n        lambda_: Optional[float] = None,",
+			"        class_: The class.\n            Ends with \\\"\\\"\\\" and */\n",
+			`            "class": class_,`,
+			`            "max-tokens": max_tokens,`,
+			// max_tokens would be the same as max-tokens
+			`            "max_tokens": max_tokens2,`,
+		}},
+		{"typescript", []string{
+			"  /** The class.\n   * Ends with \"\"\" and *\\/ */\n  class: string;",
+			`  "max-tokens"?: number;`,
+			"  lambda?: number;",
+		}},
+		{"go", []string{
+			"\t// The class.\n\t// Ends with \"\"\" and */\n",
+			"\tMaxTokens  *int ",
+			"\tMaxTokens2 *int     `json:\"max_tokens,omitempty\"`",
+		}},
+	} {
+		lang, err := GetLanguage(tt.language)
+		require.NoError(t, err)
+		source, err := Generate(lang, awkwardSchema(t))
+		require.NoError(t, err, tt.language)
+		for _, c := range tt.contains {
+			require.Contains(t, source, c, tt.language)
+		}
+	}
+}
+
+func TestGenerateInputWithoutSchema(t *testing.T) {
+	input := openapi3.NewObjectSchema()
+	input.Properties["anything"] = nil
+	s := &openapi3.T{Components: &openapi3.Components{Schemas: openapi3.Schemas{"Input": openapi3.NewSchemaRef("", input)}}}
+	for _, name := range LanguageNames() {
+		lang, err := GetLanguage(name)
+		require.NoError(t, err)
+		source, err := Generate(lang, s)
+		require.NoError(t, err, name)
+		require.Contains(t, source, "anything", name)
+	}
+}
+
+func TestUnknownLanguage(t *testing.T) {
+	_, err := GetLanguage("cobol")
+	require.Error(t, err)
+}
@@ -0,0 +1,178 @@
+// Package compose loads cog-compose.yaml files, which describe several models that run together
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const DefaultFilename = "cog-compose.yaml"
+
+// Model is a single model in a compose file. Exactly one of Project or Image must be set.
+type Model struct {
+	// Project is the path to a directory containing cog.yaml, relative to the compose file
+	Project string `yaml:"project"`
+	// Image is a Docker image built by Cog
+	Image string `yaml:"image"`
+	// Port is the host port the model's HTTP API is published on. If 0, a random port is used.
+	Port      int      `yaml:"port"`
+	DependsOn []string `yaml:"depends_on"`
+}
+
+type Config struct {
+	Models map[string]*Model `yaml:"models"`
+
+	// Dir is the directory the compose file is in
+	Dir string `yaml:"-"`
+}
+
+// Load reads and validates a compose file
+func Load(path string) (*Config, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s does not exist. Are you in the right directory?", path)
+		}
+		return nil, err
+	}
+	conf, err := FromYAML(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", path, err)
+	}
+	conf.Dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// FromYAML parses and validates the contents of a compose file
+func FromYAML(contents []byte) (*Config, error) {
+	conf := &Config{}
+	if err := yaml.UnmarshalStrict(contents, conf); err != nil {
+		return nil, fmt.Errorf("Failed to parse compose yaml: %w", err)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func (c *Config) Validate() error {
+	if len(c.Models) == 0 {
+		return fmt.Errorf("No models are defined in 'models'")
+	}
+
+	errs := []error{}
+	ports := map[int]string{}
+	for _, name := range c.names() {
+		model := c.Models[name]
+		if model == nil {
+			errs = append(errs, fmt.Errorf("Model '%s' is empty", name))
+			continue
+		}
+		if (model.Project == "") == (model.Image == "") {
+			errs = append(errs, fmt.Errorf("Model '%s' must set exactly one of 'project' or 'image'", name))
+		}
+		if model.Port < 0 || model.Port > 65535 {
+			errs = append(errs, fmt.Errorf("Model '%s' has an invalid port %d", name, model.Port))
+		}
+		if other, ok := ports[model.Port]; ok && model.Port != 0 {
+			errs = append(errs, fmt.Errorf("Models '%s' and '%s' both use port %d", other, name, model.Port))
+		}
+		ports[model.Port] = name
+		for _, dep := range model.DependsOn {
+			if _, ok := c.Models[dep]; !ok {
+				errs = append(errs, fmt.Errorf("Model '%s' depends on '%s', which is not defined", name, dep))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	_, err := c.Order()
+	return err
+}
+
+// Order returns the names of the models in the order they need to be started, so that every model starts after the models it depends on
+func (c *Config) Order() ([]string, error) {
+	order := []string{}
+	// 0 = not visited, 1 = visiting, 2 = done
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("Models have a circular dependency: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		deps := append([]string{}, c.Models[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range c.names() {
+		if err := visit(name, []string{}); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Levels returns the names of the models grouped by when they can be started. The models in each level only depend on
+// models in the levels before it, so the models in a level can be started at the same time.
+func (c *Config) Levels() ([][]string, error) {
+	order, err := c.Order()
+	if err != nil {
+		return nil, err
+	}
+	levels := [][]string{}
+	levelOf := map[string]int{}
+	for _, name := range order {
+		level := 0
+		for _, dep := range c.Models[name].DependsOn {
+			if levelOf[dep]+1 > level {
+				level = levelOf[dep] + 1
+			}
+		}
+		levelOf[name] = level
+		if level == len(levels) {
+			levels = append(levels, []string{})
+		}
+		levels[level] = append(levels[level], name)
+	}
+	return levels, nil
+}
+
+// ProjectDir returns the absolute path to a model's project directory
+func (c *Config) ProjectDir(name string) string {
+	project := c.Models[name].Project
+	if filepath.IsAbs(project) {
+		return project
+	}
+	return filepath.Join(c.Dir, project)
+}
+
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Models))
+	for name := range c.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
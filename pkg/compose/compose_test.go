@@ -0,0 +1,89 @@
+package compose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderRespectsDependencies(t *testing.T) {
+	conf, err := FromYAML([]byte(`
+models:
+  classifier:
+    image: r8.im/replicate/classifier
+    depends_on: [cropper]
+  cropper:
+    project: ./cropper
+    port: 5002
+    depends_on: [detector]
+  detector:
+    project: ./detector
+    port: 5001
+`))
+	require.NoError(t, err)
+	order, err := conf.Order()
+	require.NoError(t, err)
+	require.Equal(t, []string{"detector", "cropper", "classifier"}, order)
+}
+
+func TestLevels(t *testing.T) {
+	conf, err := FromYAML([]byte(`
+models:
+  classifier:
+    image: r8.im/replicate/classifier
+    depends_on: [cropper, detector]
+  cropper:
+    project: ./cropper
+  detector:
+    project: ./detector
+    depends_on: [upscaler]
+  upscaler:
+    image: r8.im/replicate/upscaler
+`))
+	require.NoError(t, err)
+	levels, err := conf.Levels()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"cropper", "upscaler"}, {"detector"}, {"classifier"}}, levels)
+}
+
+func TestCircularDependency(t *testing.T) {
+	_, err := FromYAML([]byte(`
+models:
+  a:
+    image: a
+    depends_on: [b]
+  b:
+    image: b
+    depends_on: [a]
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "circular dependency: a -> b -> a")
+}
+
+func TestValidate(t *testing.T) {
+	_, err := FromYAML([]byte(`
+models:
+  a:
+    image: a
+    project: ./a
+    port: 5000
+  b:
+    image: b
+    port: 5000
+    depends_on: [c]
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Model 'a' must set exactly one of 'project' or 'image'")
+	require.Contains(t, err.Error(), "Models 'a' and 'b' both use port 5000")
+	require.Contains(t, err.Error(), "Model 'b' depends on 'c', which is not defined")
+}
+
+func TestUnknownKeys(t *testing.T) {
+	_, err := FromYAML([]byte(`
+models:
+  a:
+    image: a
+    ports: 5000
+`))
+	require.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const DefaultPipelineFilename = "pipeline.yaml"
+
+// Pipeline is a sequence of predictions on the models in a compose file, where the inputs of each step can refer to the pipeline's inputs or to the outputs of earlier steps
+type Pipeline struct {
+	// Compose is the path to the compose file that defines the models, relative to the pipeline file
+	Compose string  `yaml:"compose"`
+	Steps   []*Step `yaml:"steps"`
+
+	// Config is the compose file the pipeline runs on
+	Config *Config `yaml:"-"`
+}
+
+// Step is a single prediction in a pipeline.
+// Input values are passed to the model as-is, unless they are references like "$inputs.image" or "$steps.detector.output.boxes".
+type Step struct {
+	// Name identifies the step in references. It defaults to the name of the model.
+	Name   string            `yaml:"name"`
+	Model  string            `yaml:"model"`
+	Inputs map[string]string `yaml:"inputs"`
+}
+
+// Reference is an input value that refers to one of the pipeline's inputs or to the output of an earlier step
+type Reference struct {
+	// Step is the name of the step whose output is referred to, or empty if this refers to a pipeline input
+	Step string
+	// Input is the name of the pipeline input referred to
+	Input string
+	// Path is a list of object keys and array indexes to look up in the step's output
+	Path []string
+}
+
+// LoadPipeline reads and validates a pipeline file, and the compose file it refers to
+func LoadPipeline(path string) (*Pipeline, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s does not exist. Are you in the right directory?", path)
+		}
+		return nil, err
+	}
+	pipeline := &Pipeline{}
+	if err := yaml.UnmarshalStrict(contents, pipeline); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+
+	composePath := pipeline.Compose
+	if composePath == "" {
+		composePath = DefaultFilename
+	}
+	if !filepath.IsAbs(composePath) {
+		composePath = filepath.Join(filepath.Dir(path), composePath)
+	}
+	if pipeline.Config, err = Load(composePath); err != nil {
+		return nil, err
+	}
+
+	if err := pipeline.Validate(); err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", path, err)
+	}
+	return pipeline, nil
+}
+
+func (p *Pipeline) Validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("No steps are defined in 'steps'")
+	}
+
+	errs := []error{}
+	seen := map[string]bool{}
+	for i, step := range p.Steps {
+		if step == nil {
+			errs = append(errs, fmt.Errorf("Step %d is empty", i+1))
+			continue
+		}
+		if step.Name == "" {
+			step.Name = step.Model
+		}
+		if _, ok := p.Config.Models[step.Model]; !ok {
+			errs = append(errs, fmt.Errorf("Step '%s' uses model '%s', which is not defined in the compose file", step.Name, step.Model))
+		}
+		for name, value := range step.Inputs {
+			ref, ok, err := ParseReference(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Step '%s' input '%s': %w", step.Name, name, err))
+			} else if ok && ref.Step != "" && !seen[ref.Step] {
+				errs = append(errs, fmt.Errorf("Step '%s' input '%s' refers to step '%s', which does not run before it", step.Name, name, ref.Step))
+			}
+		}
+		if seen[step.Name] {
+			errs = append(errs, fmt.Errorf("There is more than one step named '%s'. Set 'name' to tell them apart", step.Name))
+		}
+		seen[step.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Models returns the names of the models the pipeline needs, including the models they depend on, in the order they need to be started
+func (p *Pipeline) Models() ([]string, error) {
+	order, err := p.Config.Order()
+	if err != nil {
+		return nil, err
+	}
+	needed := map[string]bool{}
+	var need func(name string)
+	need = func(name string) {
+		if needed[name] {
+			return
+		}
+		needed[name] = true
+		for _, dep := range p.Config.Models[name].DependsOn {
+			need(dep)
+		}
+	}
+	for _, step := range p.Steps {
+		need(step.Model)
+	}
+	models := []string{}
+	for _, name := range order {
+		if needed[name] {
+			models = append(models, name)
+		}
+	}
+	return models, nil
+}
+
+// ParseReference parses an input value that starts with "$inputs." or "$steps.".
+// It returns false if the value is not a reference.
+func ParseReference(value string) (*Reference, bool, error) {
+	switch {
+	case strings.HasPrefix(value, "$inputs."):
+		name := strings.TrimPrefix(value, "$inputs.")
+		if name == "" || strings.Contains(name, ".") {
+			return nil, false, fmt.Errorf("Invalid reference '%s', expected '$inputs.<name>'", value)
+		}
+		return &Reference{Input: name}, true, nil
+	case strings.HasPrefix(value, "$steps."):
+		parts := strings.Split(strings.TrimPrefix(value, "$steps."), ".")
+		if len(parts) < 2 || parts[0] == "" || parts[1] != "output" {
+			return nil, false, fmt.Errorf("Invalid reference '%s', expected '$steps.<name>.output'", value)
+		}
+		return &Reference{Step: parts[0], Path: parts[2:]}, true, nil
+	}
+	return nil, false, nil
+}
+
+// Lookup returns the part of a step's output that the reference points at
+func (r *Reference) Lookup(output interface{}) (interface{}, error) {
+	value := output
+	for i, key := range r.Path {
+		at := strings.Join(append([]string{r.Step, "output"}, r.Path[:i]...), ".")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("%s has no key '%s'", at, key)
+			}
+			value = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("%s has no index '%s'", at, key)
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("%s is not an object or array, so '%s' can't be looked up in it", at, key)
+		}
+	}
+	return value, nil
+}
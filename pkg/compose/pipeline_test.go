@@ -0,0 +1,90 @@
+package compose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func testPipeline(t *testing.T, steps string) *Pipeline {
+	conf, err := FromYAML([]byte(`
+models:
+  detector:
+    project: ./detector
+  cropper:
+    project: ./cropper
+    depends_on: [detector]
+  classifier:
+    image: r8.im/replicate/classifier
+  unused:
+    image: r8.im/replicate/unused
+`))
+	require.NoError(t, err)
+	pipeline := &Pipeline{Config: conf}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(steps), pipeline))
+	return pipeline
+}
+
+func TestPipelineValidate(t *testing.T) {
+	pipeline := testPipeline(t, `
+steps:
+  - model: detector
+    inputs:
+      image: $inputs.image
+  - model: cropper
+    inputs:
+      image: $inputs.image
+      box: $steps.detector.output.boxes.0
+  - model: classifier
+    inputs:
+      image: $steps.cropper.output
+`)
+	require.NoError(t, pipeline.Validate())
+
+	models, err := pipeline.Models()
+	require.NoError(t, err)
+	require.Equal(t, []string{"classifier", "detector", "cropper"}, models)
+}
+
+func TestPipelineValidateErrors(t *testing.T) {
+	pipeline := testPipeline(t, `
+steps:
+  - model: classifier
+    inputs:
+      image: $steps.cropper.output
+  - model: missing
+  - model: classifier
+    inputs:
+      image: $steps.classifier
+`)
+	err := pipeline.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Step 'classifier' input 'image' refers to step 'cropper', which does not run before it")
+	require.Contains(t, err.Error(), "Step 'missing' uses model 'missing', which is not defined in the compose file")
+	require.Contains(t, err.Error(), "Invalid reference '$steps.classifier'")
+	require.Contains(t, err.Error(), "There is more than one step named 'classifier'")
+}
+
+func TestReferenceLookup(t *testing.T) {
+	ref, ok, err := ParseReference("$steps.detector.output.boxes.1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "detector", ref.Step)
+
+	output := map[string]interface{}{
+		"boxes": []interface{}{"a", "b"},
+	}
+	value, err := ref.Lookup(output)
+	require.NoError(t, err)
+	require.Equal(t, "b", value)
+
+	ref, _, err = ParseReference("$steps.detector.output.labels")
+	require.NoError(t, err)
+	_, err = ref.Lookup(output)
+	require.EqualError(t, err, "detector.output has no key 'labels'")
+
+	_, ok, err = ParseReference("a photo of a cat")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,455 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	yamlv2 "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+const docsURL = "https://github.com/replicate/cog/blob/main/docs/yaml.md"
+
+// Problem is something wrong with a cog.yaml, found by Check
+type Problem struct {
+	// Path is the option the problem is with, like build.python_version, or empty if it's not about one option
+	Path string
+	// Line is the line of cog.yaml the option is on, or 0 if it isn't known
+	Line    int
+	Message string
+	// Fix suggests how to fix the problem
+	Fix string
+}
+
+// modelReferenceRegexp matches the predict and train options, like predict.py:Predictor
+var modelReferenceRegexp = regexp.MustCompile(`^[^:]+\.py:[A-Za-z_][A-Za-z0-9_]*$`)
+
+// imageNameRegexp matches image names, like r8.im/user/model or localhost:5000/model:latest. It's simpler than
+// Docker's, but catches the usual mistakes, like uppercase letters and spaces.
+var imageNameRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:\.[a-z0-9-]+)*(?::[0-9]+)?(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?$`)
+
+// Check looks for problems in the contents of a cog.yaml in projectDir, with the line of each one. It checks
+// everything ValidateAndComplete does, and also checks for options that don't exist, files that are missing and
+// CUDA versions that might not work with the installed PyTorch or TensorFlow.
+//
+// ValidateAndComplete is only run if there are no other errors, because it would report them again without lines.
+func Check(contents []byte, projectDir string) []Problem {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(contents, &root); err != nil {
+		return []Problem{yamlSyntaxProblem(err)}
+	}
+
+	problems := checkSchema(contents, &root)
+	if len(problems) > 0 {
+		return problems
+	}
+
+	config := DefaultConfig()
+	if err := yamlv2.Unmarshal(contents, config); err != nil {
+		return append(problems, Problem{Message: err.Error()})
+	}
+	if config.Build == nil {
+		config.Build = DefaultConfig().Build
+	}
+
+	problems = append(problems, config.checkFiles(projectDir, &root)...)
+	if len(problems) > 0 {
+		return problems
+	}
+	problems = append(problems, config.checkCUDA(projectDir, &root)...)
+	if len(problems) > 0 {
+		return problems
+	}
+	if err := config.ValidateAndComplete(projectDir); err != nil {
+		for _, err := range unjoin(err) {
+			problems = append(problems, Problem{Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+// checkSchema checks cog.yaml against the JSON schema, and suggests the option that was probably meant for ones that
+// don't exist
+func checkSchema(contents []byte, root *yamlv3.Node) []Problem {
+	data, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return []Problem{{Message: err.Error()}}
+	}
+	if string(data) == "null" {
+		// An empty cog.yaml is fine
+		return nil
+	}
+	schemaLoader, err := getSchema(defaultVersion)
+	if err != nil {
+		return []Problem{{Message: err.Error()}}
+	}
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return []Problem{{Message: err.Error()}}
+	}
+
+	problems := []Problem{}
+	seen := map[string]bool{}
+	for _, resultErr := range result.Errors() {
+		fieldPath := schemaFieldPath(resultErr.Field())
+		switch resultErr.Type() {
+		case "additional_property_not_allowed":
+			property, _ := resultErr.Details()["property"].(string)
+			problems = append(problems, unknownOptionProblem(root, fieldPath, property))
+			continue
+		case "required":
+			property, _ := resultErr.Details()["property"].(string)
+			// Like FromYAML, a cog.yaml without a build section gets the default one
+			if property == "build" && len(fieldPath) == 0 {
+				continue
+			}
+		case jsonschemaAnyOf, jsonschemaOneOf:
+			// These are followed by the errors for each of the options, which say more
+			continue
+		}
+		key := strings.Join(fieldPath, ".")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		problems = append(problems, Problem{
+			Path:    key,
+			Line:    lineOf(root, fieldPath),
+			Message: schemaErrorDescription(resultErr),
+			Fix:     "See " + docsLink(fieldPath) + " for what it can be set to",
+		})
+	}
+	return problems
+}
+
+func unknownOptionProblem(root *yamlv3.Node, parent []string, property string) Problem {
+	fieldPath := append(append([]string{}, parent...), property)
+	problem := Problem{
+		Path:    strings.Join(fieldPath, "."),
+		Line:    lineOf(root, fieldPath),
+		Message: fmt.Sprintf("%q isn't an option", property),
+		Fix:     "Remove it, or see " + docsLink(parent) + " for the options you can use",
+	}
+	if len(parent) > 0 {
+		problem.Message = fmt.Sprintf("%q isn't an option in %s", property, strings.Join(parent, "."))
+	}
+	if suggestion := closestOption(property, optionsAt(parent)); suggestion != "" {
+		problem.Fix = fmt.Sprintf("Did you mean %q?", suggestion)
+	}
+	return problem
+}
+
+// checkFiles checks that files in cog.yaml exist and that predict and train point at classes in Python files
+func (c *Config) checkFiles(projectDir string, root *yamlv3.Node) []Problem {
+	problems := []Problem{}
+	fileOption := func(option, value, what string) {
+		if value == "" {
+			return
+		}
+		if _, err := os.Stat(path.Join(projectDir, value)); err != nil {
+			fieldPath := strings.Split(option, ".")
+			problems = append(problems, Problem{
+				Path:    option,
+				Line:    lineOf(root, fieldPath),
+				Message: fmt.Sprintf("%s doesn't exist", value),
+				Fix:     fmt.Sprintf("Set %s to the path of %s, relative to cog.yaml", fieldPath[len(fieldPath)-1], what),
+			})
+		}
+	}
+	fileOption("build.python_requirements", c.Build.PythonRequirements, "your requirements.txt")
+	fileOption("build.conda_file", c.Build.CondaFile, "your conda environment file")
+	if c.Security != nil {
+		fileOption("security.seccomp_profile", c.Security.SeccompProfile, "your seccomp profile")
+	}
+
+	if len(c.Build.PythonPackages) > 0 && c.Build.PythonRequirements != "" {
+		problems = append(problems, Problem{
+			Path:    "build.python_packages",
+			Line:    lineOf(root, []string{"build", "python_packages"}),
+			Message: "Only one of python_packages or python_requirements can be set",
+			Fix:     fmt.Sprintf("Move the packages in python_packages to %s, and remove python_packages", c.Build.PythonRequirements),
+		})
+	}
+
+	for _, option := range []struct{ name, value, example string }{
+		{"predict", c.Predict, "predict.py:Predictor"},
+		{"train", c.Train, "train.py:train"},
+	} {
+		if option.value == "" {
+			continue
+		}
+		line := lineOf(root, []string{option.name})
+		if !modelReferenceRegexp.MatchString(option.value) {
+			problems = append(problems, Problem{
+				Path:    option.name,
+				Line:    line,
+				Message: fmt.Sprintf("%q isn't a Python file and class", option.value),
+				Fix:     fmt.Sprintf("Set %s to the file and the name of the class or function in it, like %q", option.name, option.example),
+			})
+			continue
+		}
+		file := strings.Split(option.value, ":")[0]
+		if _, err := os.Stat(path.Join(projectDir, file)); err != nil {
+			problems = append(problems, Problem{
+				Path:    option.name,
+				Line:    line,
+				Message: fmt.Sprintf("%s doesn't exist", file),
+				Fix:     fmt.Sprintf("Set %s to the path of the file, relative to cog.yaml, and the name of the class or function in it, like %q", option.name, option.example),
+			})
+		}
+	}
+
+	if c.Image != "" && !imageNameRegexp.MatchString(c.Image) {
+		problems = append(problems, Problem{
+			Path:    "image",
+			Line:    lineOf(root, []string{"image"}),
+			Message: fmt.Sprintf("%q isn't a valid image name", c.Image),
+			Fix:     "Use lowercase letters, numbers, and . _ - / : in the name, like r8.im/your-username/your-model",
+		})
+	}
+	return problems
+}
+
+// checkCUDA checks that the CUDA and cuDNN versions in cog.yaml work with each other, and with the versions of PyTorch
+// and TensorFlow that are installed
+func (c *Config) checkCUDA(projectDir string, root *yamlv3.Node) []Problem {
+	if !c.Build.GPU || c.Build.CUDA == "" {
+		return nil
+	}
+	problems := []Problem{}
+	cudaLine := lineOf(root, []string{"build", "cuda"})
+
+	if c.Build.CuDNN != "" {
+		if compatible := compatibleCuDNNsForCUDA(c.Build.CUDA); !slices.ContainsString(compatible, c.Build.CuDNN) {
+			problems = append(problems, Problem{
+				Path:    "build.cudnn",
+				Line:    lineOf(root, []string{"build", "cudnn"}),
+				Message: fmt.Sprintf("cuDNN %s isn't compatible with CUDA %s", c.Build.CuDNN, c.Build.CUDA),
+				Fix:     suggestVersions("cudnn", compatible),
+			})
+		}
+	}
+
+	// The versions of PyTorch and TensorFlow are found in the requirements, which ValidateAndComplete would load
+	c.Build.pythonRequirementsContent = c.Build.PythonPackages
+	if c.Build.PythonRequirements != "" {
+		contents, err := os.ReadFile(path.Join(projectDir, c.Build.PythonRequirements))
+		if err != nil {
+			return append(problems, Problem{Path: "build.python_requirements", Message: err.Error()})
+		}
+		c.Build.pythonRequirementsContent = strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	}
+
+	if tfVersion, tfCUDA, _, err := c.cudaFromTF(); err == nil && tfVersion != "" && tfCUDA != "" && !sameCUDAMinor(tfCUDA, c.Build.CUDA) {
+		problems = append(problems, Problem{
+			Path:    "build.cuda",
+			Line:    cudaLine,
+			Message: fmt.Sprintf("CUDA %s isn't compatible with tensorflow==%s", c.Build.CUDA, tfVersion),
+			Fix:     suggestVersions("cuda", []string{tfCUDA}),
+		})
+	} else if torchVersion, torchCUDAs, err := c.cudasFromTorch(); err == nil && tfVersion == "" && len(torchCUDAs) > 0 {
+		if torchCUDA, err := latestCUDAUpTo(torchCUDAs, c.Build.CUDA); err == nil && torchCUDA == "" {
+			problems = append(problems, Problem{
+				Path:    "build.cuda",
+				Line:    cudaLine,
+				Message: fmt.Sprintf("CUDA %s isn't compatible with torch==%s", c.Build.CUDA, torchVersion),
+				Fix:     suggestVersions("cuda", torchCUDAs),
+			})
+		}
+	}
+	return problems
+}
+
+func suggestVersions(option string, versions []string) string {
+	if len(versions) == 1 {
+		return fmt.Sprintf("Set %s to %s, or remove it to let Cog pick a version", option, versions[0])
+	}
+	return fmt.Sprintf("Set %s to one of %s, or remove it to let Cog pick a version", option, strings.Join(versions, ", "))
+}
+
+func yamlSyntaxProblem(err error) Problem {
+	problem := Problem{Message: err.Error(), Fix: "Check the indentation and quoting of the line. Values with : or # in them need quotes"}
+	// yaml.v3 errors look like "yaml: line 3: mapping values are not allowed in this context"
+	if m := regexp.MustCompile(`line (\d+): (.*)`).FindStringSubmatch(err.Error()); m != nil {
+		problem.Line, _ = strconv.Atoi(m[1])
+		problem.Message = m[2]
+	}
+	return problem
+}
+
+// schemaFieldPath turns the field of a JSON schema error, like build.run.0 or (root), into a path
+func schemaFieldPath(field string) []string {
+	if field == "" || field == "(root)" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(field, "(root)."), ".")
+}
+
+func schemaErrorDescription(err gojsonschema.ResultError) string {
+	description := err.Description()
+	if err.Type() == "invalid_type" {
+		if expected, ok := err.Details()["expected"].(string); ok {
+			description = "It must be a " + humanReadableType(expected)
+		}
+	}
+	if field := err.Field(); field != "(root)" {
+		description = field + ": " + description
+	}
+	return description
+}
+
+// lineOf returns the line of the option at fieldPath in a parsed cog.yaml, or of the closest option above it if it
+// isn't there
+func lineOf(root *yamlv3.Node, fieldPath []string) int {
+	node := root
+	if node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := 0
+	for _, element := range fieldPath {
+		var next *yamlv3.Node
+		switch node.Kind {
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == element {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+				}
+			}
+		case yamlv3.SequenceNode:
+			if i, err := strconv.Atoi(element); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// optionsAt returns the names of the options in the section of cog.yaml at fieldPath, from the fields of Config
+func optionsAt(fieldPath []string) []string {
+	t := reflect.TypeOf(Config{})
+	for _, element := range fieldPath {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		if _, err := strconv.Atoi(element); err == nil {
+			continue
+		}
+		field, ok := fieldByYAMLName(t, element)
+		if !ok {
+			return nil
+		}
+		t = field.Type
+	}
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	options := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if name := yamlName(t.Field(i)); name != "" {
+			options = append(options, name)
+		}
+	}
+	sort.Strings(options)
+	return options
+}
+
+func fieldByYAMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func yamlName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// closestOption returns the option that's most like name, if it's close enough to be a typo
+func closestOption(name string, options []string) string {
+	best, bestDistance := "", len(name)/3+2
+	for _, option := range options {
+		if d := editDistance(strings.ToLower(name), option); d < bestDistance {
+			best, bestDistance = option, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func docsLink(fieldPath []string) string {
+	for i := len(fieldPath) - 1; i >= 0; i-- {
+		if _, err := strconv.Atoi(fieldPath[i]); err != nil {
+			return docsURL + "#" + fieldPath[i]
+		}
+	}
+	return docsURL
+}
+
+// unjoin returns the errors that were joined with errors.Join, or just err if it's a single error
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckValid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "predict.py"), []byte(""), 0o644))
+
+	problems := Check([]byte(`build:
+  python_version: "3.11"
+  python_packages:
+    - "torch==2.0.1"
+predict: "predict.py:Predictor"
+`), dir)
+	require.Empty(t, problems)
+
+	require.Empty(t, Check([]byte(""), dir))
+}
+
+func TestCheckUnknownOptions(t *testing.T) {
+	problems := Check([]byte(`build:
+  python_version: "3.11"
+  pyton_packages:
+    - torch
+predcit: "predict.py:Predictor"
+frobnicate: true
+`), t.TempDir())
+
+	require.Equal(t, []Problem{
+		{Path: "build.pyton_packages", Line: 3, Message: `"pyton_packages" isn't an option in build`, Fix: `Did you mean "python_packages"?`},
+		{Path: "frobnicate", Line: 6, Message: `"frobnicate" isn't an option`, Fix: "Remove it, or see " + docsURL + " for the options you can use"},
+		{Path: "predcit", Line: 5, Message: `"predcit" isn't an option`, Fix: `Did you mean "predict"?`},
+	}, sortedProblems(problems))
+}
+
+func TestCheckSchemaTypes(t *testing.T) {
+	problems := Check([]byte(`build:
+  gpu: "yes"
+  python_version: "3.11"
+  run:
+    - echo hello
+    - 5
+`), t.TempDir())
+
+	require.Equal(t, []Problem{
+		{Path: "build.gpu", Line: 2, Message: "build.gpu: It must be a boolean", Fix: "See " + docsURL + "#gpu for what it can be set to"},
+		{Path: "build.run.1", Line: 6, Message: "build.run.1: It must be a string", Fix: "See " + docsURL + "#run for what it can be set to"},
+	}, sortedProblems(problems))
+}
+
+func TestCheckSyntaxError(t *testing.T) {
+	problems := Check([]byte("build:\n  python_version: \"3.11\"\n  gpu: true: false\n"), t.TempDir())
+	require.Len(t, problems, 1)
+	require.Equal(t, 3, problems[0].Line)
+	require.NotEmpty(t, problems[0].Fix)
+}
+
+func TestCheckFiles(t *testing.T) {
+	problems := Check([]byte(`build:
+  python_version: "3.11"
+  python_requirements: requirements.txt
+image: r8.im/User/Model
+predict: predict.py
+train: "train.py:train"
+`), t.TempDir())
+
+	require.Equal(t, []string{"build.python_requirements", "image", "predict", "train"}, problemPaths(sortedProblems(problems)))
+	for _, problem := range problems {
+		require.NotZero(t, problem.Line)
+		require.NotEmpty(t, problem.Fix)
+	}
+}
+
+func TestCheckCUDA(t *testing.T) {
+	problems := Check([]byte(`build:
+  gpu: true
+  python_version: "3.11"
+  python_packages:
+    - "torch==2.0.1"
+  cuda: "10.2"
+`), t.TempDir())
+
+	require.Len(t, problems, 1)
+	require.Equal(t, "build.cuda", problems[0].Path)
+	require.Equal(t, 6, problems[0].Line)
+	require.Contains(t, problems[0].Fix, "11.8")
+}
+
+func TestCheckCuDNN(t *testing.T) {
+	problems := Check([]byte(`build:
+  gpu: true
+  python_version: "3.11"
+  cuda: "11.8"
+  cudnn: "7"
+`), t.TempDir())
+
+	require.Len(t, problems, 1)
+	require.Equal(t, "build.cudnn", problems[0].Path)
+	require.Equal(t, 5, problems[0].Line)
+}
+
+func TestClosestOption(t *testing.T) {
+	options := optionsAt([]string{"build"})
+	require.Contains(t, options, "python_version")
+	require.Equal(t, "python_version", closestOption("python_verison", options))
+	require.Equal(t, "gpu", closestOption("GPU", options))
+	require.Equal(t, "", closestOption("something_else", options))
+	require.Equal(t, []string{"command", "mounts"}, optionsAt([]string{"build", "run", "0"}))
+}
+
+func problemPaths(problems []Problem) []string {
+	paths := []string{}
+	for _, problem := range problems {
+		paths = append(paths, problem.Path)
+	}
+	return paths
+}
+
+func sortedProblems(problems []Problem) []Problem {
+	sorted := append([]Problem{}, problems...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	return sorted
+}
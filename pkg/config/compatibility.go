@@ -8,7 +8,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
 
 	"github.com/replicate/cog/pkg/util/version"
@@ -120,10 +119,12 @@ func init() {
 	TorchCompatibilityMatrix = filteredTorchCompatibilityMatrix
 }
 
+// cudasFromTorch returns the CUDA versions that there are torch packages for. If ver has a variant pinned, like
+// 2.0.1+cu118, only that package's CUDA version is returned.
 func cudasFromTorch(ver string) ([]string, error) {
 	cudas := []string{}
 	for _, compat := range TorchCompatibilityMatrix {
-		if ver == compat.TorchVersion() && compat.CUDA != nil {
+		if (ver == compat.TorchVersion() || ver == compat.Torch) && compat.CUDA != nil {
 			cudas = append(cudas, *compat.CUDA)
 		}
 	}
@@ -172,6 +173,42 @@ func latestCUDAFrom(cudas []string) string {
 	return latest
 }
 
+// latestCUDAUpTo returns the latest of cudas that is at most as high as cuda, or an empty string if they're all higher.
+// Torch packages bundle the CUDA libraries they need, so a package built for an older CUDA works on a newer base image.
+func latestCUDAUpTo(cudas []string, cuda string) (string, error) {
+	compatible := []string{}
+	for _, c := range cudas {
+		greater, err := versionGreater(c, cuda)
+		if err != nil {
+			return "", err
+		}
+		if !greater {
+			compatible = append(compatible, c)
+		}
+	}
+	return latestCUDAFrom(compatible), nil
+}
+
+// sameCUDAMinor returns whether two CUDA versions, like 11.8 and 11.8.0, have the same major and minor version
+func sameCUDAMinor(a string, b string) bool {
+	aVer, err := version.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	bVer, err := version.NewVersion(b)
+	if err != nil {
+		return false
+	}
+	return aVer.EqualMinor(bVer)
+}
+
+// splitLocalVersion splits a version like 2.0.1+cu118 into its public version and its local version label, which
+// PyTorch uses for the CUDA variant of a package
+func splitLocalVersion(ver string) (public string, local string) {
+	public, local, _ = strings.Cut(ver, "+")
+	return public, local
+}
+
 // resolveMinorToPatch takes a minor version string (e.g. 11.1) and resolves it to its full patch version (11.1.1)
 // If no patch version exists, it returns the plain old minor version (e.g. 10.3)
 func resolveMinorToPatch(minor string) (string, error) {
@@ -250,18 +287,24 @@ func CUDABaseImageFor(cuda string, cuDNN string) (string, error) {
 
 func tfGPUPackage(ver string, cuda string) (name string, cpuVersion string, err error) {
 	for _, compat := range TFCompatibilityMatrix {
-		if compat.TF == ver && version.Equal(compat.CUDA, cuda) {
+		if compat.TF == ver && sameCUDAMinor(compat.CUDA, cuda) {
 			return splitPinnedPythonRequirement(compat.TFGPUPackage)
 		}
 	}
-	// We've already warned user if they're doing something stupid in validateAndCompleteCUDA(), so fail silently
-	return "", "", nil
+	// validateAndCompleteCUDA() has already failed if Cog knows this version doesn't work with this CUDA version, so
+	// this is a version Cog doesn't know about
+	return "tensorflow", ver, nil
 }
 
 func torchCPUPackage(ver, goos, goarch string) (name, cpuVersion, findLinks, extraIndexURL string, err error) {
+	if _, variant := splitLocalVersion(ver); variant != "" {
+		name, cpuVersion, findLinks, extraIndexURL = torchPinnedPackage(ver)
+		return name, cpuVersion, findLinks, extraIndexURL, nil
+	}
+
 	for _, compat := range TorchCompatibilityMatrix {
 		if compat.TorchVersion() == ver && compat.CUDA == nil {
-			return "torch", torchStripCPUSuffixForM1(compat.Torch, goos, goarch), compat.FindLinks, compat.ExtraIndexURL, nil
+			return "torch", torchStripCPUSuffixForARM64(compat.Torch, goarch), compat.FindLinks, compat.ExtraIndexURL, nil
 		}
 	}
 
@@ -270,6 +313,11 @@ func torchCPUPackage(ver, goos, goarch string) (name, cpuVersion, findLinks, ext
 }
 
 func torchGPUPackage(ver string, cuda string) (name, cpuVersion, findLinks, extraIndexURL string, err error) {
+	if _, variant := splitLocalVersion(ver); variant != "" {
+		name, cpuVersion, findLinks, extraIndexURL = torchPinnedPackage(ver)
+		return name, cpuVersion, findLinks, extraIndexURL, nil
+	}
+
 	// find the torch package that has the requested torch version and the latest cuda version
 	// that is at most as high as the requested cuda version
 	var latest *TorchCompatibility
@@ -307,10 +355,21 @@ func torchGPUPackage(ver string, cuda string) (name, cpuVersion, findLinks, extr
 	return "torch", latest.Torch, latest.FindLinks, latest.ExtraIndexURL, nil
 }
 
+// torchPinnedPackage returns the torch package for a version with its variant pinned in cog.yaml, like 2.0.1+cu118,
+// along with where to find it. Variants Cog doesn't know about are installed as they are.
+func torchPinnedPackage(ver string) (name, cpuVersion, findLinks, extraIndexURL string) {
+	for _, compat := range TorchCompatibilityMatrix {
+		if compat.Torch == ver {
+			return "torch", compat.Torch, compat.FindLinks, compat.ExtraIndexURL
+		}
+	}
+	return "torch", ver, "", ""
+}
+
 func torchvisionCPUPackage(ver, goos, goarch string) (name, cpuVersion, findLinks, extraIndexURL string, err error) {
 	for _, compat := range TorchCompatibilityMatrix {
 		if compat.TorchvisionVersion() == ver && compat.CUDA == nil {
-			return "torchvision", torchStripCPUSuffixForM1(compat.Torchvision, goos, goarch), compat.FindLinks, compat.ExtraIndexURL, nil
+			return "torchvision", torchStripCPUSuffixForARM64(compat.Torchvision, goarch), compat.FindLinks, compat.ExtraIndexURL, nil
 		}
 	}
 	// Fall back to just installing default version. For older torchvision versions, they don't have any CPU versions.
@@ -357,10 +416,11 @@ func torchvisionGPUPackage(ver, cuda string) (name, cpuVersion, findLinks, extra
 }
 
 // aarch64 packages don't have +cpu suffix: https://download.pytorch.org/whl/torch_stable.html
+// This applies to Apple Silicon Macs and to images built for linux/arm64.
 // TODO(andreas): clean up this hack by actually parsing the torch_stable.html list in the generator
-func torchStripCPUSuffixForM1(version string, goos string, goarch string) string {
+func torchStripCPUSuffixForARM64(version string, goarch string) string {
 	// TODO(andreas): clean up this hack
-	if util.IsAppleSiliconMac(goos, goarch) {
+	if goarch == "arm64" {
 		return strings.ReplaceAll(version, "+cpu", "")
 	}
 	return version
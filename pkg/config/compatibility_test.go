@@ -19,3 +19,20 @@ func TestResolveMinorToPatch(t *testing.T) {
 	_, err = resolveMinorToPatch("1214348324.432879432")
 	require.Error(t, err)
 }
+
+func TestLatestCUDAUpTo(t *testing.T) {
+	cudas := []string{"11.7", "11.8", "12.1"}
+	for _, tt := range []struct {
+		cuda     string
+		expected string
+	}{
+		{"11.8.0", "11.8"},
+		{"12.0", "11.8"},
+		{"12.1.1", "12.1"},
+		{"11.6", ""},
+	} {
+		actual, err := latestCUDAUpTo(cudas, tt.cuda)
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, actual)
+	}
+}
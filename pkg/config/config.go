@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -13,7 +14,6 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/replicate/cog/pkg/util/console"
-	"github.com/replicate/cog/pkg/util/slices"
 )
 
 // TODO(andreas): support conda packages
@@ -31,17 +31,57 @@ type RunItem struct {
 }
 
 type Build struct {
-	GPU                bool      `json:"gpu,omitempty" yaml:"gpu"`
-	PythonVersion      string    `json:"python_version,omitempty" yaml:"python_version"`
-	PythonRequirements string    `json:"python_requirements,omitempty" yaml:"python_requirements"`
-	PythonPackages     []string  `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
-	Run                []RunItem `json:"run,omitempty" yaml:"run"`
-	SystemPackages     []string  `json:"system_packages,omitempty" yaml:"system_packages"`
-	PreInstall         []string  `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
-	CUDA               string    `json:"cuda,omitempty" yaml:"cuda"`
-	CuDNN              string    `json:"cudnn,omitempty" yaml:"cudnn"`
+	GPU                bool         `json:"gpu,omitempty" yaml:"gpu"`
+	PythonVersion      string       `json:"python_version,omitempty" yaml:"python_version"`
+	PythonRequirements string       `json:"python_requirements,omitempty" yaml:"python_requirements"`
+	PythonPackages     []string     `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
+	Run                []RunItem    `json:"run,omitempty" yaml:"run"`
+	SystemPackages     []string     `json:"system_packages,omitempty" yaml:"system_packages"`
+	PreInstall         []string     `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
+	CUDA               string       `json:"cuda,omitempty" yaml:"cuda"`
+	CuDNN              string       `json:"cudnn,omitempty" yaml:"cudnn"`
+	CUDATargets        []CUDATarget `json:"cuda_targets,omitempty" yaml:"cuda_targets"`
+	UID                int          `json:"uid,omitempty" yaml:"uid"`
+	PipDownload        bool         `json:"pip_download,omitempty" yaml:"pip_download"`
+	PipIndexURL        string       `json:"pip_index_url,omitempty" yaml:"pip_index_url"`
+	PipExtraIndexURLs  []string     `json:"pip_extra_index_urls,omitempty" yaml:"pip_extra_index_urls"`
+	PipNetrcSecret     string       `json:"pip_netrc_secret,omitempty" yaml:"pip_netrc_secret"`
+	CogPackage         string       `json:"cog_package,omitempty" yaml:"cog_package"`
+	CondaFile          string       `json:"conda_file,omitempty" yaml:"conda_file"`
 
 	pythonRequirementsContent []string
+	// cudaFromTargets is whether CUDA and CuDNN were set from the first of CUDATargets, rather than in cog.yaml
+	cudaFromTargets bool
+}
+
+// CUDATarget is a version of CUDA, and optionally cuDNN, that 'cog build' builds an image for
+type CUDATarget struct {
+	CUDA  string `json:"cuda,omitempty" yaml:"cuda"`
+	CuDNN string `json:"cudnn,omitempty" yaml:"cudnn"`
+}
+
+// Network is how the containers a model runs in are connected to the network
+type Network struct {
+	Mode       string   `json:"mode,omitempty" yaml:"mode"`
+	DNS        []string `json:"dns,omitempty" yaml:"dns"`
+	ExtraHosts []string `json:"extra_hosts,omitempty" yaml:"extra_hosts"`
+}
+
+// Security is how the containers a model runs in are locked down
+type Security struct {
+	ReadOnly        bool     `json:"read_only,omitempty" yaml:"read_only"`
+	CapDrop         []string `json:"cap_drop,omitempty" yaml:"cap_drop"`
+	NoNewPrivileges bool     `json:"no_new_privileges,omitempty" yaml:"no_new_privileges"`
+	SeccompProfile  string   `json:"seccomp_profile,omitempty" yaml:"seccomp_profile"`
+	Tmpfs           []string `json:"tmpfs,omitempty" yaml:"tmpfs"`
+}
+
+// HuggingFace is a repository on the Hugging Face Hub that files are downloaded from into the image when it's built
+type HuggingFace struct {
+	Repo     string   `json:"repo,omitempty" yaml:"repo"`
+	Revision string   `json:"revision,omitempty" yaml:"revision"`
+	Files    []string `json:"files,omitempty" yaml:"files"`
+	Path     string   `json:"path,omitempty" yaml:"path"`
 }
 
 type Example struct {
@@ -50,10 +90,17 @@ type Example struct {
 }
 
 type Config struct {
-	Build   *Build `json:"build" yaml:"build"`
-	Image   string `json:"image,omitempty" yaml:"image"`
-	Predict string `json:"predict,omitempty" yaml:"predict"`
-	Train   string `json:"train,omitempty" yaml:"train"`
+	Build             *Build       `json:"build" yaml:"build"`
+	HuggingFace       *HuggingFace `json:"huggingface,omitempty" yaml:"huggingface"`
+	Image             string       `json:"image,omitempty" yaml:"image"`
+	MaxPredictionTime float64      `json:"max_prediction_time,omitempty" yaml:"max_prediction_time"`
+	Network           *Network     `json:"network,omitempty" yaml:"network"`
+	Predict           string       `json:"predict,omitempty" yaml:"predict"`
+	Security          *Security    `json:"security,omitempty" yaml:"security"`
+	ServerCommand     []string     `json:"server_command,omitempty" yaml:"server_command"`
+	SetupTimeout      *float64     `json:"setup_timeout,omitempty" yaml:"setup_timeout"`
+	Test              []string     `json:"test,omitempty" yaml:"test"`
+	Train             string       `json:"train,omitempty" yaml:"train"`
 }
 
 func DefaultConfig() *Config {
@@ -186,7 +233,8 @@ func (c *Config) pythonPackageVersion(name string) (version string, ok bool) {
 	for _, pkg := range c.Build.pythonRequirementsContent {
 		pkgName, version, err := splitPinnedPythonRequirement(pkg)
 		if err != nil {
-			return "", false
+			// Comments, options and unpinned packages can't be the one we're looking for
+			continue
 		}
 		if pkgName == name {
 			return version, true
@@ -217,7 +265,14 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		errs = append(errs, fmt.Errorf("Only one of python_packages or python_requirements can be set in your cog.yaml, not both"))
 	}
 
+	if c.Build.CondaFile != "" {
+		if _, err := os.Stat(path.Join(projectDir, c.Build.CondaFile)); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to open conda_file: %w", err))
+		}
+	}
+
 	// Load python_requirements into memory to simplify reading it multiple times
+	c.Build.pythonRequirementsContent = nil
 	if c.Build.PythonRequirements != "" {
 		fh, err := os.Open(path.Join(projectDir, c.Build.PythonRequirements))
 		if err != nil {
@@ -235,7 +290,29 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		c.Build.pythonRequirementsContent = c.Build.PythonPackages
 	}
 
-	if c.Build.GPU {
+	for _, indexURL := range append([]string{c.Build.PipIndexURL}, c.Build.PipExtraIndexURLs...) {
+		if err := validatePipIndexURL(indexURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.ServerCommand != nil {
+		if err := validateServerCommand(c.ServerCommand); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.HuggingFace != nil {
+		if err := c.HuggingFace.validateAndComplete(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.Build.CUDATargets) > 0 {
+		if err := c.validateAndCompleteCUDATargets(); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.Build.GPU {
 		if err := c.validateAndCompleteCUDA(); err != nil {
 			errs = append(errs, err)
 		}
@@ -248,6 +325,128 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 	return nil
 }
 
+// validatePipIndexURL checks a package index URL from cog.yaml. The URL ends up in the Dockerfile, and so in the
+// image's history, so it mustn't contain credentials.
+func validatePipIndexURL(indexURL string) error {
+	if indexURL == "" {
+		return nil
+	}
+	u, err := url.Parse(indexURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s in cog.yaml is not a valid package index URL", indexURL)
+	}
+	if u.User != nil {
+		u.User = nil
+		return fmt.Errorf("The package index URL %s in cog.yaml contains credentials, which would be saved in the image. Remove them and set pip_netrc_secret to pass them in a .netrc file instead", u.String())
+	}
+	return nil
+}
+
+// huggingFaceRepoRegexp matches the ID of a repository on the Hugging Face Hub, like stabilityai/sdxl-turbo or gpt2
+var huggingFaceRepoRegexp = regexp.MustCompile(`^[\w.-]+(/[\w.-]+)?$`)
+
+// huggingFaceCommitRegexp matches the full hash of a commit in a repository on the Hugging Face Hub
+var huggingFaceCommitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// DefaultHuggingFacePath is where the files in huggingface are put in the image, unless path is set
+const DefaultHuggingFacePath = "/weights"
+
+func (h *HuggingFace) validateAndComplete() error {
+	if !huggingFaceRepoRegexp.MatchString(h.Repo) {
+		return fmt.Errorf("huggingface.repo in cog.yaml must be the ID of a repository on the Hugging Face Hub, like stabilityai/sdxl-turbo, not '%s'", h.Repo)
+	}
+	// The download is cached until huggingface changes, so a branch would stay at the commit it was first built with
+	if !huggingFaceCommitRegexp.MatchString(h.Revision) {
+		return fmt.Errorf("huggingface.revision in cog.yaml must be the full hash of a commit in %s, so the image gets the same files each time it's built, not '%s'. The commits are listed at https://huggingface.co/%[1]s/commits/main", h.Repo, h.Revision)
+	}
+	if h.Path == "" {
+		h.Path = DefaultHuggingFacePath
+	}
+	h.Path = path.Clean(h.Path)
+	if !path.IsAbs(h.Path) {
+		return fmt.Errorf("huggingface.path in cog.yaml must be an absolute path in the image, like %s", DefaultHuggingFacePath)
+	}
+	// cog predict and cog run mount the project over /src, which would hide the files
+	if h.Path == "/" || h.Path == "/src" || strings.HasPrefix(h.Path, "/src/") {
+		return fmt.Errorf("huggingface.path in cog.yaml can't be %s, because the project is mounted over /src when it's run with cog predict. Use a path like %s instead", h.Path, DefaultHuggingFacePath)
+	}
+	return nil
+}
+
+// serverPortFlags are the flags that common Python servers, like uvicorn, gunicorn and hypercorn, take a port or
+// address to listen on with
+var serverPortFlags = []string{"--port", "--bind", "-b"}
+
+// portlessServers are common Python servers that listen on a port other than 5000, usually 8000, unless they're given
+// one with serverPortFlags
+var portlessServers = map[string]bool{"uvicorn": true, "gunicorn": true, "hypercorn": true}
+
+// validateServerCommand checks that a server_command from cog.yaml can still be run by Cog, which sends health checks
+// and predictions to the server on port 5000
+func validateServerCommand(command []string) error {
+	if len(command) == 0 || strings.TrimSpace(command[0]) == "" {
+		return fmt.Errorf("server_command in cog.yaml can't be empty. Remove it to use Cog's server")
+	}
+	portSet := false
+	for i, arg := range command {
+		var value string
+		for _, flag := range serverPortFlags {
+			if arg == flag && i+1 < len(command) {
+				value = command[i+1]
+			} else if strings.HasPrefix(arg, flag+"=") {
+				value = strings.TrimPrefix(arg, flag+"=")
+			}
+		}
+		if value == "" {
+			continue
+		}
+		portSet = true
+		// --bind takes an address like 0.0.0.0:5000, and --port just the port
+		if _, port, found := strings.Cut(value, ":"); found {
+			value = port
+		}
+		if value != "5000" {
+			return fmt.Errorf("server_command in cog.yaml listens on %s, but it must listen on port 5000, which is where Cog sends health checks and predictions", value)
+		}
+	}
+	// The server is the program, or the module in python -m module
+	server := path.Base(command[0])
+	if len(command) > 2 && command[1] == "-m" {
+		server = command[2]
+	}
+	if !portSet && portlessServers[server] {
+		return fmt.Errorf("server_command in cog.yaml doesn't set the port %s listens on, which isn't 5000 by default. Add --port 5000, or --bind 0.0.0.0:5000 for gunicorn and hypercorn", server)
+	}
+	if !runsCogServer(command) {
+		console.Warnf("server_command in cog.yaml doesn't run cog.server.http, so make sure it responds to GET /health-check and POST /predictions on port 5000 like Cog's server does, or Cog won't be able to run your model")
+	}
+	return nil
+}
+
+// runsCogServer returns whether a server command runs Cog's server, rather than a server of the model's own
+func runsCogServer(command []string) bool {
+	for _, arg := range command {
+		if strings.Contains(arg, "cog.server") {
+			return true
+		}
+	}
+	return false
+}
+
+// TrainServerCommand returns the command that runs the server for cog train, which is Cog's server in training mode.
+// If server_command runs Cog's server with other options, like --threads, they're kept. Servers of the model's own
+// can't train it, so it returns an error if server_command runs one.
+func (c *Config) TrainServerCommand() ([]string, error) {
+	if c.ServerCommand == nil {
+		return []string{"python", "-m", "cog.server.http", "--x-mode", "train"}, nil
+	}
+	if !runsCogServer(c.ServerCommand) {
+		return nil, fmt.Errorf("cog train runs Cog's server, but server_command in cog.yaml runs %s. Remove server_command to train the model", c.ServerCommand[0])
+	}
+	command := append([]string{}, c.ServerCommand...)
+	return append(command, "--x-mode", "train"), nil
+}
+
 // PythonRequirementsForArch returns a requirements.txt file with all the GPU packages resolved for given OS and architecture.
 func (c *Config) PythonRequirementsForArch(goos string, goarch string) (string, error) {
 	packages := []string{}
@@ -331,6 +530,62 @@ func (c *Config) pythonPackageForArch(pkg, goos, goarch string) (actualPackage,
 	return pkgWithVersion, findLinks, extraIndexURL, nil
 }
 
+// validateAndCompleteCUDATargets checks each of the CUDA targets. The first one is used by commands that only build one
+// image, like 'cog predict', so its versions of CUDA and cuDNN are set as 'cuda' and 'cudnn'.
+func (c *Config) validateAndCompleteCUDATargets() error {
+	switch {
+	case !c.Build.GPU:
+		return fmt.Errorf("'cuda_targets' can only be set in your cog.yaml if 'gpu' is true")
+	case (c.Build.CUDA != "" || c.Build.CuDNN != "") && !c.Build.cudaFromTargets:
+		return fmt.Errorf("Only one of 'cuda_targets' or 'cuda' and 'cudnn' can be set in your cog.yaml, not both")
+	}
+
+	configs, err := c.CUDATargetConfigs()
+	if err != nil {
+		return err
+	}
+	c.Build.CUDA, c.Build.CuDNN = configs[0].Build.CUDA, configs[0].Build.CuDNN
+	c.Build.cudaFromTargets = true
+	return nil
+}
+
+// CUDATargetConfigs returns a config for each of the CUDA targets, with the versions of CUDA and cuDNN picked for it,
+// to build an image for each of them. It returns nil if there aren't any.
+func (c *Config) CUDATargetConfigs() ([]*Config, error) {
+	if len(c.Build.CUDATargets) == 0 {
+		return nil, nil
+	}
+	configs := []*Config{}
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, target := range c.Build.CUDATargets {
+		config := c.forCUDATarget(target)
+		if err := config.validateAndCompleteCUDA(); err != nil {
+			errs = append(errs, fmt.Errorf("CUDA target %s: %w", target.CUDA, err))
+			continue
+		}
+		if seen[config.Build.CUDA] {
+			errs = append(errs, fmt.Errorf("CUDA %s is in 'cuda_targets' more than once", config.Build.CUDA))
+		}
+		seen[config.Build.CUDA] = true
+		configs = append(configs, config)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return configs, nil
+}
+
+// forCUDATarget returns a copy of the config that builds an image for target
+func (c *Config) forCUDATarget(target CUDATarget) *Config {
+	build := *c.Build
+	build.CUDA, build.CuDNN = target.CUDA, target.CuDNN
+	build.CUDATargets = nil
+	config := *c
+	config.Build = &build
+	return &config
+}
+
 func (c *Config) validateAndCompleteCUDA() error {
 	if c.Build.CUDA != "" && c.Build.CuDNN != "" {
 		compatibleCuDNNs := compatibleCuDNNsForCUDA(c.Build.CUDA)
@@ -358,9 +613,13 @@ Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(co
 			}
 			console.Debugf("Setting CUDA to version %s from Tensorflow version", tfCUDA)
 			c.Build.CUDA = tfCUDA
-		} else if tfCUDA != c.Build.CUDA {
-			// TODO: can we suggest a CUDA version known to be compatible?
+		} else if tfCUDA == "" {
 			console.Warnf("Cog doesn't know if CUDA %s is compatible with Tensorflow %s. This might cause CUDA problems.", c.Build.CUDA, tfVersion)
+		} else if !sameCUDAMinor(tfCUDA, c.Build.CUDA) {
+			return fmt.Errorf(`The specified CUDA version %s is not compatible with tensorflow==%s.
+Compatible CUDA version is: %s
+
+Set the 'cuda' option in cog.yaml to %s, or remove it to let Cog pick it.`, c.Build.CUDA, tfVersion, tfCUDA, tfCUDA)
 		}
 		if c.Build.CuDNN == "" && tfCuDNN != "" {
 			console.Debugf("Setting CuDNN to version %s from Tensorflow version", tfCuDNN)
@@ -371,8 +630,9 @@ Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(co
 				return err
 			}
 			console.Debugf("Setting CuDNN to version %s", c.Build.CUDA)
-		} else if tfCuDNN != c.Build.CuDNN {
+		} else if tfCuDNN == "" {
 			console.Warnf("Cog doesn't know if cuDNN %s is compatible with Tensorflow %s. This might cause CUDA problems.", c.Build.CuDNN, tfVersion)
+		} else if tfCuDNN != c.Build.CuDNN {
 			return fmt.Errorf(`The specified cuDNN version %s is not compatible with tensorflow==%s.
 Compatible cuDNN version is: %s`,
 				c.Build.CuDNN, tfVersion, tfCuDNN)
@@ -388,9 +648,20 @@ Compatible cuDNN version is: %s`,
 				return err
 			}
 			console.Debugf("Setting CUDA to version %s from Torch version", c.Build.CUDA)
-		} else if !slices.ContainsString(torchCUDAs, c.Build.CUDA) {
-			// TODO: can we suggest a CUDA version known to be compatible?
+		} else if len(torchCUDAs) == 0 {
 			console.Warnf("Cog doesn't know if CUDA %s is compatible with PyTorch %s. This might cause CUDA problems.", c.Build.CUDA, torchVersion)
+		} else {
+			torchCUDA, err := latestCUDAUpTo(torchCUDAs, c.Build.CUDA)
+			if err != nil {
+				return fmt.Errorf("Invalid CUDA version %s: %w", c.Build.CUDA, err)
+			}
+			if torchCUDA == "" {
+				return fmt.Errorf(`The specified CUDA version %s is not compatible with torch==%s.
+Compatible CUDA versions are: %s
+
+Set the 'cuda' option in cog.yaml to one of those, or remove it to let Cog pick one.`, c.Build.CUDA, torchVersion, strings.Join(torchCUDAs, ","))
+			}
+			console.Debugf("Using torch==%s built for CUDA %s", torchVersion, torchCUDA)
 		}
 
 		if c.Build.CuDNN == "" {
@@ -417,9 +688,10 @@ Compatible cuDNN version is: %s`,
 	return nil
 }
 
-// splitPythonPackage returns the name and version from a requirements.txt line in the form name==version
+// splitPythonPackage returns the name and version from a requirements.txt line in the form name==version. The version
+// can have a local version label, like the +cu118 in torch==2.0.1+cu118.
 func splitPinnedPythonRequirement(requirement string) (name string, version string, err error) {
-	pinnedPackageRe := regexp.MustCompile(`^([a-zA-Z0-9\-_]+)==([\d\.]+)$`)
+	pinnedPackageRe := regexp.MustCompile(`^([a-zA-Z0-9\-_]+)==([\d\.]+(?:\+[a-zA-Z0-9\.]+)?)$`)
 
 	match := pinnedPackageRe.FindStringSubmatch(requirement)
 	if match == nil {
@@ -35,3 +35,12 @@ func DockerImageName(projectDir string) string {
 func BaseDockerImageName(projectDir string) string {
 	return DockerImageName(projectDir) + "-base"
 }
+
+// CUDATargetImageName returns the name of the image built for a CUDA target, with the CUDA version added to the tag,
+// like r8.im/user/model:cuda11.8 or r8.im/user/model:v2-cuda11.8
+func CUDATargetImageName(imageName, cuda string) string {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName + "-cuda" + cuda
+	}
+	return imageName + ":cuda" + cuda
+}
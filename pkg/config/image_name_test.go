@@ -13,3 +13,9 @@ func TestDockerImageName(t *testing.T) {
 	require.Equal(t, "cog-my-great-model", DockerImageName("/home/joe/my great model"))
 	require.Equal(t, 30, len(DockerImageName("/home/joe/verylongverylongverylongverylongverylongverylongverylong")))
 }
+
+func TestCUDATargetImageName(t *testing.T) {
+	require.Equal(t, "r8.im/user/model:cuda11.8", CUDATargetImageName("r8.im/user/model", "11.8"))
+	require.Equal(t, "r8.im/user/model:v2-cuda11.8", CUDATargetImageName("r8.im/user/model:v2", "11.8"))
+	require.Equal(t, "localhost:5000/model:cuda12.1", CUDATargetImageName("localhost:5000/model", "12.1"))
+}
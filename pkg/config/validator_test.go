@@ -91,3 +91,51 @@ func TestValidateNullListsAllowed(t *testing.T) {
 	err := Validate(config, "1.0")
 	require.NoError(t, err)
 }
+
+func TestValidateNetwork(t *testing.T) {
+	config := `build:
+  python_version: "3.8"
+network:
+  mode: host
+  dns:
+    - 10.0.0.2
+  extra_hosts:
+    - "db.internal:10.0.0.5"`
+
+	err := Validate(config, "1.0")
+	require.NoError(t, err)
+}
+
+func TestValidateSecurity(t *testing.T) {
+	config := `build:
+  python_version: "3.8"
+security:
+  read_only: true
+  cap_drop:
+    - ALL
+  no_new_privileges: true
+  seccomp_profile: seccomp.json
+  tmpfs:
+    - /tmp`
+
+	err := Validate(config, "1.0")
+	require.NoError(t, err)
+}
+
+func TestValidateTest(t *testing.T) {
+	config := `build:
+  python_version: "3.8"
+test:
+  - pytest tests/
+  - python -m doctest predict.py`
+
+	err := Validate(config, "1.0")
+	require.NoError(t, err)
+
+	config = `build:
+  python_version: "3.8"
+test: pytest tests/`
+
+	err = Validate(config, "1.0")
+	require.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package dependencies
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	importRegexp     = regexp.MustCompile(`^\s*import\s+(.+)$`)
+	fromImportRegexp = regexp.MustCompile(`^\s*from\s+([A-Za-z_][\w.]*)\s+import\b`)
+)
+
+// skipDirs are directories that don't contain the project's own code
+var skipDirs = map[string]bool{
+	"__pycache__":   true,
+	"node_modules":  true,
+	"site-packages": true,
+	"venv":          true,
+	"env":           true,
+}
+
+// ScanImports returns the top-level modules that the Python files in dir import, excluding the standard library, Cog
+// and modules that are part of the project itself.
+func ScanImports(dir string) ([]string, error) {
+	imported := map[string]bool{}
+	local := map[string]bool{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || skipDirs[name]) {
+				return filepath.SkipDir
+			}
+			if filepath.Dir(path) == dir {
+				local[name] = true
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".py" {
+			return nil
+		}
+		if filepath.Dir(path) == dir {
+			local[strings.TrimSuffix(name, ".py")] = true
+		}
+		modules, err := scanFileImports(path)
+		if err != nil {
+			return err
+		}
+		for _, module := range modules {
+			imported[module] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modules := []string{}
+	for module := range imported {
+		if local[module] || stdlibModules[module] || module == "cog" {
+			continue
+		}
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules, nil
+}
+
+// scanFileImports returns the top-level modules imported by a Python file. Relative imports are ignored.
+func scanFileImports(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	modules := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if match := fromImportRegexp.FindStringSubmatch(line); match != nil {
+			modules = append(modules, topLevelModule(match[1]))
+		} else if match := importRegexp.FindStringSubmatch(line); match != nil {
+			// e.g. import numpy as np, torch.nn
+			for _, name := range strings.Split(match[1], ",") {
+				fields := strings.Fields(name)
+				if len(fields) > 0 {
+					modules = append(modules, topLevelModule(fields[0]))
+				}
+			}
+		}
+	}
+	return modules, scanner.Err()
+}
+
+func topLevelModule(name string) string {
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+// stdlibModules are the top-level modules in Python's standard library
+var stdlibModules = map[string]bool{}
+
+func init() {
+	for _, module := range strings.Fields(`__future__ abc aifc antigravity argparse array ast asynchat asyncio asyncore
+atexit audioop base64 bdb binascii bisect builtins bz2 cProfile calendar cgi cgitb chunk cmath cmd code codecs codeop
+collections colorsys compileall concurrent configparser contextlib contextvars copy copyreg crypt csv ctypes curses
+dataclasses datetime dbm decimal difflib dis distutils doctest email encodings ensurepip enum errno faulthandler fcntl
+filecmp fileinput fnmatch fractions ftplib functools gc genericpath getopt getpass gettext glob graphlib grp gzip
+hashlib heapq hmac html http idlelib imaplib imghdr imp importlib inspect io ipaddress itertools json keyword lib2to3
+linecache locale logging lzma mailbox mailcap marshal math mimetypes mmap modulefinder msilib msvcrt multiprocessing
+netrc nis nntplib nt ntpath nturl2path numbers opcode operator optparse os ossaudiodev pathlib pdb pickle pickletools
+pipes pkgutil platform plistlib poplib posix posixpath pprint profile pstats pty pwd py_compile pyclbr pydoc
+pydoc_data pyexpat queue quopri random re readline reprlib resource rlcompleter runpy sched secrets select selectors
+shelve shlex shutil signal site smtpd smtplib sndhdr socket socketserver spwd sqlite3 sre_compile sre_constants
+sre_parse ssl stat statistics string stringprep struct subprocess sunau symtable sys sysconfig syslog tabnanny tarfile
+telnetlib tempfile termios textwrap this threading time timeit tkinter token tokenize tomllib trace traceback
+tracemalloc tty turtle turtledemo types typing unicodedata unittest urllib uu uuid venv warnings wave weakref
+webbrowser winreg winsound wsgiref xdrlib xml xmlrpc zipapp zipfile zipimport zlib zoneinfo`) {
+		stdlibModules[module] = true
+	}
+}
@@ -0,0 +1,45 @@
+package dependencies
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "predict.py"), `import os, sys
+import numpy as np
+import torch.nn as nn
+from PIL import Image
+from cog import BasePredictor, Input, Path
+from . import helpers
+from .models import Model
+from utils.image import load  # a local package
+import cv2  # for resizing
+# import tensorflow
+`)
+	writeFile(t, filepath.Join(dir, "helpers.py"), "from transformers import AutoModel\n")
+	writeFile(t, filepath.Join(dir, "utils", "image.py"), "import helpers\nfrom skimage import io\n")
+	writeFile(t, filepath.Join(dir, ".venv", "lib", "site.py"), "import requests\n")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "import pandas\n")
+
+	modules, err := ScanImports(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PIL", "cv2", "numpy", "skimage", "torch", "transformers"}, modules)
+}
+
+func TestPythonPackagesForImports(t *testing.T) {
+	require.Equal(t,
+		[]string{"pillow", "opencv-python", "numpy", "matplotlib"},
+		PythonPackagesForImports([]string{"PIL", "cv2", "numpy", "matplotlib", "mpl_toolkits"}),
+	)
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
@@ -0,0 +1,56 @@
+package dependencies
+
+// pythonPackagesForImports are the PyPI packages for modules that are imported by a different name than the package
+// they are installed from
+var pythonPackagesForImports = map[string]string{
+	"attr":                  "attrs",
+	"bs4":                   "beautifulsoup4",
+	"clip":                  "openai-clip",
+	"Crypto":                "pycryptodome",
+	"cv2":                   "opencv-python",
+	"dateutil":              "python-dateutil",
+	"docx":                  "python-docx",
+	"dotenv":                "python-dotenv",
+	"faiss":                 "faiss-cpu",
+	"fitz":                  "PyMuPDF",
+	"git":                   "GitPython",
+	"jwt":                   "PyJWT",
+	"llama_cpp":             "llama-cpp-python",
+	"magic":                 "python-magic",
+	"mpl_toolkits":          "matplotlib",
+	"OpenSSL":               "pyOpenSSL",
+	"PIL":                   "pillow",
+	"pkg_resources":         "setuptools",
+	"pptx":                  "python-pptx",
+	"sentence_transformers": "sentence-transformers",
+	"serial":                "pyserial",
+	"skimage":               "scikit-image",
+	"sklearn":               "scikit-learn",
+	"usb":                   "pyusb",
+	"whisper":               "openai-whisper",
+	"yaml":                  "PyYAML",
+	"zmq":                   "pyzmq",
+}
+
+// PythonPackageForImport returns the name of the PyPI package that provides a top-level module.
+// Most packages have the same name as their module, but some common ones don't, like cv2, which is opencv-python.
+func PythonPackageForImport(module string) string {
+	if pkg, ok := pythonPackagesForImports[module]; ok {
+		return pkg
+	}
+	return module
+}
+
+// PythonPackagesForImports returns the PyPI packages that provide modules, without duplicates
+func PythonPackagesForImports(modules []string) []string {
+	seen := map[string]bool{}
+	packages := []string{}
+	for _, module := range modules {
+		pkg := PythonPackageForImport(module)
+		if !seen[pkg] {
+			seen[pkg] = true
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
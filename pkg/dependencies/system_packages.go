@@ -0,0 +1,78 @@
+package dependencies
+
+import (
+	"regexp"
+	"strings"
+)
+
+// systemPackagesForPythonPackages are the Ubuntu/Debian packages that Python packages need at runtime or to build,
+// but don't install themselves
+var systemPackagesForPythonPackages = map[string][]string{
+	"dlib":                   {"cmake"},
+	"face-recognition":       {"cmake"},
+	"ffmpeg-python":          {"ffmpeg"},
+	"librosa":                {"libsndfile1"},
+	"moviepy":                {"ffmpeg"},
+	"mysqlclient":            {"default-libmysqlclient-dev"},
+	"openai-whisper":         {"ffmpeg"},
+	"opencv-contrib-python":  {"libgl1", "libglib2.0-0"},
+	"opencv-python":          {"libgl1", "libglib2.0-0"},
+	"opencv-python-headless": {"libglib2.0-0"},
+	"pdf2image":              {"poppler-utils"},
+	"phonemizer":             {"espeak-ng"},
+	"psycopg2":               {"libpq-dev"},
+	"pyaudio":                {"portaudio19-dev"},
+	"pycairo":                {"libcairo2-dev"},
+	"pydub":                  {"ffmpeg"},
+	"pytesseract":            {"tesseract-ocr"},
+	"python-magic":           {"libmagic1"},
+	"pyvips":                 {"libvips"},
+	"soundfile":              {"libsndfile1"},
+	"torchaudio":             {"libsndfile1"},
+}
+
+var requirementNameRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// SystemPackage is a system package that a Python package needs
+type SystemPackage struct {
+	Name string
+	// NeededBy is the Python package that needs it
+	NeededBy string
+}
+
+// MissingSystemPackages returns the system packages that the Python packages in requirements need, but that aren't in
+// systemPackages. requirements are lines from a requirements file, e.g. opencv-python==4.8.0.76.
+func MissingSystemPackages(requirements []string, systemPackages []string) []SystemPackage {
+	missing := []SystemPackage{}
+	added := map[string]bool{}
+	for _, requirement := range requirements {
+		match := requirementNameRegexp.FindStringSubmatch(strings.TrimSpace(requirement))
+		if match == nil {
+			continue
+		}
+		name := normalizePythonPackageName(match[1])
+		for _, systemPackage := range systemPackagesForPythonPackages[name] {
+			if added[systemPackage] || hasSystemPackage(systemPackages, systemPackage) {
+				continue
+			}
+			added[systemPackage] = true
+			missing = append(missing, SystemPackage{Name: systemPackage, NeededBy: name})
+		}
+	}
+	return missing
+}
+
+// hasSystemPackage returns whether name, or a variant of it like libgl1-mesa-glx for libgl1, is in systemPackages
+func hasSystemPackage(systemPackages []string, name string) bool {
+	for _, pkg := range systemPackages {
+		if pkg == name || strings.HasPrefix(pkg, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePythonPackageName normalizes a package name the way PyPI does, so e.g. Opencv_Python matches opencv-python
+func normalizePythonPackageName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
@@ -0,0 +1,29 @@
+package dependencies
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingSystemPackages(t *testing.T) {
+	requirements := []string{
+		"--extra-index-url https://download.pytorch.org/whl/cu118",
+		"torch==2.0.1",
+		"Opencv_Python==4.8.0.76",
+		"soundfile>=0.12",
+		"librosa",
+		"pydub ; python_version >= '3.8'",
+	}
+
+	require.Equal(t, []SystemPackage{
+		{Name: "libgl1", NeededBy: "opencv-python"},
+		{Name: "libglib2.0-0", NeededBy: "opencv-python"},
+		{Name: "libsndfile1", NeededBy: "soundfile"},
+		{Name: "ffmpeg", NeededBy: "pydub"},
+	}, MissingSystemPackages(requirements, nil))
+
+	require.Equal(t, []SystemPackage{
+		{Name: "libsndfile1", NeededBy: "soundfile"},
+	}, MissingSystemPackages(requirements, []string{"libgl1-mesa-glx", "libglib2.0-0", "ffmpeg"}))
+}
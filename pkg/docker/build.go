@@ -5,48 +5,91 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Build(dir, dockerfile, imageName string, secrets []string, noCache bool, progressOutput string) error {
+func Build(options BuildOptions) error {
+	cmd := exec.Command("docker", buildArgs(options)...)
+	cmd.Dir = options.Dir
+	// Redirect stdout to stderr - build output is all messaging
+	if console.IsAnimated() {
+		// BuildKit only draws its progress with --progress auto if its output is a terminal, so this is stderr itself
+		// rather than a console writer
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	} else {
+		output := console.Writer(console.InfoLevel)
+		defer output.Close()
+		cmd.Stdout = output
+		cmd.Stderr = output
+	}
+	cmd.Stdin = strings.NewReader(options.Dockerfile)
+
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	return cmd.Run()
+}
+
+// buildArgs returns the arguments to docker that build an image from a Dockerfile passed on stdin
+func buildArgs(options BuildOptions) []string {
 	var args []string
 
 	args = append(args,
 		"buildx", "build",
 	)
 
-	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
+	switch {
+	case len(options.Platforms) > 0:
+		args = append(args, "--platform", strings.Join(options.Platforms, ","))
+		if options.Push {
+			args = append(args, "--push")
+		} else {
+			args = append(args, "--load")
+		}
+	case util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH):
 		// Fixes "WARNING: The requested image's platform (linux/amd64) does not match the detected host platform (linux/arm64/v8) and no specific platform was requested"
 		args = append(args, "--platform", "linux/amd64", "--load")
 	}
 
-	for _, secret := range secrets {
+	for _, secret := range options.Secrets {
 		args = append(args, "--secret", secret)
 	}
 
-	if noCache {
+	if options.NoCache {
 		args = append(args, "--no-cache")
 	}
 
+	for _, cacheFrom := range options.Cache.From {
+		args = append(args, "--cache-from", cacheFrom)
+	}
+	cacheTo := options.Cache.To
+	if len(cacheTo) == 0 {
+		// Export the cache in the image itself, so other machines can use it with --cache-from once it's pushed
+		cacheTo = []string{"type=inline"}
+	}
+	for _, to := range cacheTo {
+		args = append(args, "--cache-to", to)
+	}
+
+	labelKeys := make([]string, 0, len(options.Labels))
+	for key := range options.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		args = append(args, "--label", key+"="+options.Labels[key])
+	}
+
 	args = append(args,
 		"--file", "-",
-		"--cache-to", "type=inline",
-		"--tag", imageName,
-		"--progress", progressOutput,
+		"--tag", options.ImageName,
+		"--progress", options.ProgressOutput,
 		".",
 	)
-
-	cmd := exec.Command("docker", args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stderr // redirect stdout to stderr - build output is all messaging
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(dockerfile)
-
-	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	return args
 }
 
 func BuildAddLabelsToImage(image string, labels map[string]string) error {
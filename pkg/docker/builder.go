@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// BuildOptions describe an image to build from a Dockerfile
+type BuildOptions struct {
+	// Dir is the build context
+	Dir        string
+	Dockerfile string
+	ImageName  string
+	// Secrets are passed to docker buildx build --secret, in the form id=foo,src=/path/to/file
+	Secrets        []string
+	NoCache        bool
+	ProgressOutput string
+	Cache          BuildCache
+	// Platforms are the platforms to build the image for, like linux/arm64. If there are several, the image is a
+	// manifest list with an image for each of them.
+	Platforms []string
+	// Labels are added to the image
+	Labels map[string]string
+	// Push pushes the image to its registry when it's built, instead of loading it into Docker, which is needed
+	// for images built for several platforms unless Docker uses the containerd image store
+	Push bool
+}
+
+// BuildCache is where a build imports its cache from and exports it to, in the form of docker buildx build
+// --cache-from and --cache-to, e.g. type=registry,ref=user/model:cache. By default, the cache is exported inline in
+// the image.
+type BuildCache struct {
+	From []string
+	To   []string
+}
+
+// ImageBuilder builds Docker images. CLIBuilder is the implementation that builds them with Docker. Other
+// implementations let the build process be run without a Docker daemon, e.g. in tests and dry runs.
+type ImageBuilder interface {
+	// Build builds an image and tags it as options.ImageName
+	Build(options BuildOptions) error
+	// AddLabels adds labels to an image that has been built
+	AddLabels(imageName string, labels map[string]string) error
+	// DryRun returns whether images aren't really built, so there aren't any to run afterwards, like to get their
+	// schemas
+	DryRun() bool
+}
+
+// CLIBuilder builds images with docker buildx build
+type CLIBuilder struct{}
+
+func (CLIBuilder) Build(options BuildOptions) error {
+	return Build(options)
+}
+
+func (CLIBuilder) AddLabels(imageName string, labels map[string]string) error {
+	return BuildAddLabelsToImage(imageName, labels)
+}
+
+func (CLIBuilder) DryRun() bool {
+	return false
+}
+
+// DryRunBuilder doesn't build anything. It writes the Dockerfiles and docker commands it would have run to Out,
+// if it's set, and records the builds, so tests can check them.
+type DryRunBuilder struct {
+	Out io.Writer
+
+	Builds []BuildOptions
+	Labels map[string]map[string]string
+}
+
+func (b *DryRunBuilder) Build(options BuildOptions) error {
+	b.Builds = append(b.Builds, options)
+	if b.Out == nil {
+		return nil
+	}
+	args := buildArgs(options)
+	_, err := fmt.Fprintf(b.Out, "$ cd %s && docker %s <<EOF\n%s\nEOF\n", options.Dir, strings.Join(args, " "), strings.TrimSpace(options.Dockerfile))
+	return err
+}
+
+func (b *DryRunBuilder) DryRun() bool {
+	return true
+}
+
+func (b *DryRunBuilder) AddLabels(imageName string, labels map[string]string) error {
+	if b.Labels == nil {
+		b.Labels = map[string]map[string]string{}
+	}
+	if b.Labels[imageName] == nil {
+		b.Labels[imageName] = map[string]string{}
+	}
+	for key, value := range labels {
+		b.Labels[imageName][key] = value
+	}
+	if b.Out == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	_, err := fmt.Fprintf(b.Out, "Labels added to %s: %s\n", imageName, strings.Join(keys, ", "))
+	return err
+}
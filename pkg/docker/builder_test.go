@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunBuilder(t *testing.T) {
+	out := new(bytes.Buffer)
+	builder := &DryRunBuilder{Out: out}
+
+	options := BuildOptions{Dir: "/src", Dockerfile: "FROM python:3.11\n", ImageName: "model", Secrets: []string{"id=pip,src=pip.conf"}, ProgressOutput: "auto"}
+	require.NoError(t, builder.Build(options))
+	require.NoError(t, builder.AddLabels("model", map[string]string{"run.cog.version": "dev", "run.cog.config": "{}"}))
+
+	require.Equal(t, []BuildOptions{options}, builder.Builds)
+	require.Equal(t, map[string]map[string]string{"model": {"run.cog.version": "dev", "run.cog.config": "{}"}}, builder.Labels)
+	require.Contains(t, out.String(), "docker buildx build")
+	require.Contains(t, out.String(), "--secret id=pip,src=pip.conf")
+	require.Contains(t, out.String(), "<<EOF\nFROM python:3.11\nEOF\n")
+	require.Contains(t, out.String(), "Labels added to model: run.cog.config, run.cog.version\n")
+}
+
+func TestBuildArgsCache(t *testing.T) {
+	args := buildArgs(BuildOptions{ImageName: "r8.im/user/model", ProgressOutput: "auto"})
+	require.Contains(t, args, "type=inline")
+	require.NotContains(t, args, "--cache-from")
+
+	args = buildArgs(BuildOptions{
+		ImageName:      "r8.im/user/model",
+		ProgressOutput: "auto",
+		Cache: BuildCache{
+			From: []string{"r8.im/user/model", "type=registry,ref=r8.im/user/model:cache"},
+			To:   []string{"type=registry,ref=r8.im/user/model:cache,mode=max"},
+		},
+	})
+	require.Contains(t, strings.Join(args, " "), "--cache-from r8.im/user/model --cache-from type=registry,ref=r8.im/user/model:cache --cache-to type=registry,ref=r8.im/user/model:cache,mode=max --file")
+	require.NotContains(t, args, "type=inline")
+}
+
+func TestBuildArgsPlatforms(t *testing.T) {
+	args := buildArgs(BuildOptions{
+		ImageName:      "r8.im/user/model",
+		ProgressOutput: "auto",
+		Platforms:      []string{"linux/amd64", "linux/arm64"},
+		Labels:         map[string]string{"run.cog.version": "0.9.0", "run.cog.config": `{"build":{}}`},
+		Push:           true,
+	})
+	joined := strings.Join(args, " ")
+	require.Contains(t, joined, "--platform linux/amd64,linux/arm64 --push")
+	require.Contains(t, joined, `--label run.cog.config={"build":{}} --label run.cog.version=0.9.0`)
+	require.NotContains(t, args, "--load")
+
+	args = buildArgs(BuildOptions{ImageName: "model", ProgressOutput: "auto", Platforms: []string{"linux/arm64"}})
+	require.Contains(t, strings.Join(args, " "), "--platform linux/arm64 --load")
+}
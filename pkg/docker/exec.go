@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Exec runs a command in a running container
+func Exec(containerID string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	dockerArgs := []string{"exec", "--interactive"}
+	if f, ok := stdin.(*os.File); ok && isatty.IsTerminal(f.Fd()) {
+		dockerArgs = append(dockerArgs, "--tty")
+	}
+	dockerArgs = append(dockerArgs, containerID)
+	dockerArgs = append(dockerArgs, args...)
+
+	cmd := exec.Command("docker", dockerArgs...)
+	cmd.Env = os.Environ()
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	return cmd.Run()
+}
@@ -0,0 +1,15 @@
+package docker
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// RemoveImage removes an image's name. Its layers are kept if other images use them, or as the build cache.
+func RemoveImage(image string) error {
+	cmd := exec.Command("docker", "image", "rm", image)
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	return cmd.Run()
+}
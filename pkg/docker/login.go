@@ -1,8 +1,10 @@
 package docker
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -19,8 +21,28 @@ type credentialHelperInput struct {
 	ServerURL string
 }
 
+// dockerHubAuthKey is the key Docker stores Docker Hub credentials under
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// HasCredentials returns whether Docker has credentials for a registry, from `docker login`, `cog login` or a
+// credential helper, like the ones for ECR and GCR
+func HasCredentials(registryHost string) bool {
+	if registryHost == DockerHubHost {
+		registryHost = dockerHubAuthKey
+	}
+	conf := config.LoadDefaultConfigFile(io.Discard)
+	auth, err := conf.GetAuthConfig(registryHost)
+	if err != nil {
+		console.Debugf("Failed to get credentials for %s: %s", registryHost, err)
+		return false
+	}
+	return auth.Username != "" || auth.Password != "" || auth.Auth != "" || auth.IdentityToken != "" || auth.RegistryToken != ""
+}
+
 func SaveLoginToken(registryHost string, username string, token string) error {
-	conf := config.LoadDefaultConfigFile(os.Stderr)
+	warnings := console.Writer(console.WarnLevel)
+	defer warnings.Close()
+	conf := config.LoadDefaultConfigFile(warnings)
 	credsStore := conf.CredentialsStore
 	if credsStore == "" {
 		return saveAuthToConfig(conf, registryHost, username, token)
@@ -49,7 +71,8 @@ func saveAuthToCredentialsStore(credsStore string, registryHost string, username
 	}
 	cmd := exec.Command(binary, "store")
 	cmd.Env = os.Environ()
-	cmd.Stderr = os.Stderr
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("Failed to connect stdin to %s: %w", binary, err)
@@ -65,7 +88,7 @@ func saveAuthToCredentialsStore(credsStore string, registryHost string, username
 		return fmt.Errorf("Failed to close stdin to %s: %w", binary, err)
 	}
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("Failed to run %s: %w", binary, err)
+		return fmt.Errorf("Failed to run %s: %w", binary, withOutput(err, stderr.Bytes()))
 	}
 	return nil
 }
@@ -4,10 +4,21 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"time"
 )
 
 func ContainerLogsFollow(containerID string, out io.Writer) error {
-	cmd := exec.Command("docker", "container", "logs", "--follow", containerID)
+	return ContainerLogsFollowSince(containerID, time.Time{}, out)
+}
+
+// ContainerLogsFollowSince writes a container's logs from since onwards to out until it stops, or all its logs if
+// since is zero
+func ContainerLogsFollowSince(containerID string, since time.Time, out io.Writer) error {
+	args := []string{"container", "logs", "--follow"}
+	if !since.IsZero() {
+		args = append(args, "--since", since.Format(time.RFC3339Nano))
+	}
+	cmd := exec.Command("docker", append(args, containerID)...)
 	cmd.Env = os.Environ()
 	cmd.Stdout = out
 	cmd.Stderr = out
@@ -1,6 +1,9 @@
 package docker
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
@@ -9,10 +12,65 @@ import (
 )
 
 func Pull(image string) error {
-	cmd := exec.Command("docker", "pull", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.Command("docker", progressArgs("pull", image)...)
+	return runWithProgress(cmd, "Pulling image "+image, "Pulled image "+image)
+}
+
+// progressArgs returns the arguments of a docker command that has its own progress output, like docker push, with
+// --quiet added if its progress can't be drawn on a terminal
+func progressArgs(command string, args ...string) []string {
+	if console.IsAnimated() {
+		return append([]string{command}, args...)
+	}
+	return append([]string{command, "--quiet"}, args...)
+}
+
+// runWithProgress runs a docker command that has its own progress output. On a terminal, Docker's progress is shown
+// on stderr. Otherwise, like in machine mode or in logs, the command should have been passed --quiet with
+// progressArgs, and a console spinner is shown instead so logs aren't filled up. Its output is only shown if it fails.
+func runWithProgress(cmd *exec.Cmd, message, done string) error {
+	if console.IsAnimated() {
+		// Docker only draws progress bars if its output is a terminal, so this is stderr itself rather than a
+		// console writer
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		console.Debug("$ " + strings.Join(cmd.Args, " "))
+		return cmd.Run()
+	}
+	spinner := console.StartSpinner(message)
+	if err := runQuietly(cmd); err != nil {
+		spinner.Stop("")
+		return err
+	}
+	spinner.Stop(done)
+	return nil
+}
 
+// runQuietly runs a docker command without showing its output, unless it fails
+func runQuietly(cmd *exec.Cmd) error {
+	output := new(bytes.Buffer)
+	cmd.Stdout = output
+	cmd.Stderr = output
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return withOutput(err, output.Bytes())
+	}
+	return nil
+}
+
+// withOutput adds what a command printed to the error it failed with
+func withOutput(err error, output []byte) error {
+	if out := strings.TrimSpace(string(output)); out != "" {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return err
+}
+
+// withStderr adds what a command run with cmd.Output printed to stderr to the error it failed with, if it failed
+func withStderr(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return withOutput(err, exitErr.Stderr)
+	}
+	return err
 }
@@ -1,19 +1,109 @@
 package docker
 
 import (
-	"os"
+	"context"
+	"fmt"
 	"os/exec"
 	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 
 	"github.com/replicate/cog/pkg/util/console"
 )
 
+const maxPushRetryDelay = 2 * time.Minute
+
+// DockerHubHost is the registry of images that don't have a registry host in their names, like user/model
+const DockerHubHost = "docker.io"
+
+// RegistryHost returns the host of the registry an image is pushed to and pulled from, like r8.im or ghcr.io
+func RegistryHost(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	// Like Docker, the first part of the name is only a host if it looks like one
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return DockerHubHost
+	}
+	return host
+}
+
 func Push(image string) error {
-	cmd := exec.Command(
-		"docker", "push", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.Command("docker", progressArgs("push", image)...)
+	return runWithProgress(cmd, "Pushing image "+image, "Pushed image "+image)
+}
+
+// PushWithRetries pushes image, retrying up to retries times if it fails. The registry keeps the layers that were
+// uploaded before a failure, so a retry only uploads the layers that hadn't finished. It isn't retried if the registry
+// denied access, or ctx is done.
+func PushWithRetries(ctx context.Context, image string, retries int) error {
+	return pushWithRetries(ctx, image, retries, func(image string) error {
+		cmd := exec.CommandContext(ctx, "docker", progressArgs("push", image)...)
+		return runWithProgress(cmd, "Pushing image "+image, "Pushed image "+image)
+	})
+}
+
+// PushAllWithRetries pushes several images at the same time, like the images for each CUDA target of a model, with
+// one progress bar for all of them, because the progress output of several pushes at once can't be read. Each one is retried like with PushWithRetries. The layers they share are only
+// uploaded once, because Docker waits for a layer that's being uploaded to a repository rather than uploading it again.
+func PushAllWithRetries(ctx context.Context, images []string, retries int) error {
+	progress := console.NewProgressBar(fmt.Sprintf("Pushing %d images", len(images)), int64(len(images)), false)
+	var group errgroup.Group
+	for _, image := range images {
+		image := image
+		group.Go(func() error {
+			err := pushWithRetries(ctx, image, retries, func(image string) error {
+				return runQuietly(exec.CommandContext(ctx, "docker", "push", "--quiet", image))
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to push %s: %w", image, err)
+			}
+			progress.Add(1)
+			return nil
+		})
+	}
+	err := group.Wait()
+	progress.Finish("")
+	if err != nil {
+		return err
+	}
+	console.Infof("Pushed images %s", strings.Join(images, ", "))
+	return nil
+}
+
+func pushWithRetries(ctx context.Context, image string, retries int, push func(image string) error) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			delay := pushRetryDelay(attempt)
+			console.Warnf("Push of %s failed: %s. Retrying in %s (%d/%d)...", image, err, delay, attempt, retries)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+		}
+		if err = push(image); err == nil || ctx.Err() != nil || accessDenied(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// accessDenied returns whether a push failed because the registry denied access to the repository, which pushing
+// again won't fix
+func accessDenied(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "denied") || strings.Contains(message, "unauthorized")
+}
 
-	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+// pushRetryDelay doubles the time between each retry, starting from 5 seconds
+func pushRetryDelay(attempt int) time.Duration {
+	delay := 5 * time.Second
+	for i := 1; i < attempt && delay < maxPushRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxPushRetryDelay {
+		return maxPushRetryDelay
+	}
+	return delay
 }
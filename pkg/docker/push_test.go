@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushRetryDelay(t *testing.T) {
+	require.Equal(t, 5*time.Second, pushRetryDelay(1))
+	require.Equal(t, 10*time.Second, pushRetryDelay(2))
+	require.Equal(t, 20*time.Second, pushRetryDelay(3))
+	require.Equal(t, maxPushRetryDelay, pushRetryDelay(6))
+	require.Equal(t, maxPushRetryDelay, pushRetryDelay(100))
+}
+
+func TestRegistryHost(t *testing.T) {
+	require.Equal(t, "r8.im", RegistryHost("r8.im/user/model"))
+	require.Equal(t, "123456789012.dkr.ecr.us-east-1.amazonaws.com", RegistryHost("123456789012.dkr.ecr.us-east-1.amazonaws.com/model:latest"))
+	require.Equal(t, "localhost:5000", RegistryHost("localhost:5000/model"))
+	require.Equal(t, "localhost", RegistryHost("localhost/model"))
+	require.Equal(t, DockerHubHost, RegistryHost("user/model"))
+	require.Equal(t, DockerHubHost, RegistryHost("model"))
+}
+
+func TestPushWithRetries(t *testing.T) {
+	attempts := 0
+	err := pushWithRetries(context.Background(), "r8.im/user/model", 3, func(image string) error {
+		attempts++
+		return errors.New("exit status 1: denied: requested access to the resource is denied")
+	})
+	require.ErrorContains(t, err, "denied")
+	require.Equal(t, 1, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = pushWithRetries(ctx, "r8.im/user/model", 3, func(image string) error {
+		attempts++
+		cancel()
+		return errors.New("exit status 1: connection reset by peer")
+	})
+	require.ErrorContains(t, err, "connection reset")
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// RemoteImageLabels returns the labels of image in its registry, without pulling it. It returns ErrNoSuchImage if the
+// registry doesn't have it.
+func RemoteImageLabels(image string) (map[string]string, error) {
+	cmd := exec.Command("docker", "buildx", "imagetools", "inspect", "--format", "{{json .Image}}", image)
+	cmd.Env = os.Environ()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		// TODO: this is fragile in case the error message changes, like in ImageInspect
+		if strings.Contains(message, "not found") {
+			return nil, ErrNoSuchImage
+		}
+		return nil, fmt.Errorf("%w: %s", err, message)
+	}
+	return parseRemoteImageLabels(out)
+}
+
+type imageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// parseRemoteImageLabels parses the labels from the image config docker buildx imagetools inspect prints. An image
+// built for several platforms has a config for each of them, and the labels of the first one with any are returned,
+// because Cog gives them all the same labels.
+func parseRemoteImageLabels(out []byte) (map[string]string, error) {
+	var configs map[string]json.RawMessage
+	if err := json.Unmarshal(out, &configs); err != nil {
+		return nil, fmt.Errorf("Failed to parse image config: %w", err)
+	}
+	if _, ok := configs["config"]; ok {
+		configs = map[string]json.RawMessage{"": out}
+	}
+	platforms := make([]string, 0, len(configs))
+	for platform := range configs {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	for _, platform := range platforms {
+		config := imageConfig{}
+		if err := json.Unmarshal(configs[platform], &config); err != nil {
+			return nil, fmt.Errorf("Failed to parse image config: %w", err)
+		}
+		if len(config.Config.Labels) > 0 {
+			return config.Config.Labels, nil
+		}
+	}
+	return map[string]string{}, nil
+}
@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteImageLabels(t *testing.T) {
+	labels, err := parseRemoteImageLabels([]byte(`{"architecture": "amd64", "os": "linux", "config": {"Labels": {"run.cog.source_hash": "4f2b"}}}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"run.cog.source_hash": "4f2b"}, labels)
+
+	// The attestation manifests buildx adds have no labels
+	labels, err = parseRemoteImageLabels([]byte(`{
+  "unknown/unknown": {"config": {}},
+  "linux/arm64": {"config": {"Labels": {"run.cog.source_hash": "4f2b"}}},
+  "linux/amd64": {"config": {"Labels": {"run.cog.source_hash": "4f2b"}}}
+}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"run.cog.source_hash": "4f2b"}, labels)
+
+	labels, err = parseRemoteImageLabels([]byte(`{"config": {}}`))
+	require.NoError(t, err)
+	require.Empty(t, labels)
+}
@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RepoDigest returns the reference by digest (repository@sha256:...) that image has in its registry. The image must
+// have been pushed or pulled, otherwise Docker doesn't know its digest.
+func RepoDigest(image string) (string, error) {
+	inspect, err := ImageInspect(image)
+	if err != nil {
+		return "", err
+	}
+	repository := repositoryName(image)
+	for _, digest := range inspect.RepoDigests {
+		if strings.HasPrefix(digest, repository+"@") {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no digest in %s. Has it been pushed?", image, repository)
+}
+
+// repositoryName strips the tag and digest from an image name
+func repositoryName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
@@ -0,0 +1,15 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryName(t *testing.T) {
+	require.Equal(t, "r8.im/user/model", repositoryName("r8.im/user/model"))
+	require.Equal(t, "r8.im/user/model", repositoryName("r8.im/user/model:latest"))
+	require.Equal(t, "r8.im/user/model", repositoryName("r8.im/user/model@sha256:abc"))
+	require.Equal(t, "localhost:5000/model", repositoryName("localhost:5000/model:v1"))
+	require.Equal(t, "localhost:5000/model", repositoryName("localhost:5000/model"))
+}
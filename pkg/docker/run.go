@@ -9,9 +9,12 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/mattn/go-isatty"
 	"github.com/replicate/cog/pkg/util"
@@ -19,6 +22,8 @@ import (
 )
 
 type Port struct {
+	// HostIP is the host address to publish the port on. If empty, it is derived from the RunOptions' AddressFamily.
+	HostIP        string
 	HostPort      int
 	ContainerPort int
 }
@@ -29,11 +34,28 @@ type Volume struct {
 }
 
 type RunOptions struct {
-	Args    []string
-	Env     []string
-	GPUs    string
-	Image   string
-	Ports   []Port
+	// AddressFamily forces ports to be published on "ipv4" or "ipv6" only. If empty, both are used where available.
+	AddressFamily string
+	Args          []string
+	CapDrop       []string
+	// Devices are host devices to add to the container, in the form path[:container-path[:permissions]]
+	Devices    []string
+	DNS        []string
+	Env        []string
+	ExtraHosts []string
+	// GPUs are the GPUs to use, in the format of docker run --gpus, e.g. "all", "2" or "device=1"
+	GPUs  string
+	Image string
+	// Network is the network mode, e.g. "host", or the name of a Docker network
+	Network         string
+	NoNewPrivileges bool
+	Ports           []Port
+	ReadOnly        bool
+	SeccompProfile  string
+	// Tmpfs is a list of paths in the container to mount writable tmpfs filesystems at
+	Tmpfs []string
+	// User is the user to run as, in the form uid[:gid] or name[:group]. If empty, the image's user is used.
+	User    string
 	Volumes []Volume
 	Workdir string
 }
@@ -41,6 +63,8 @@ type RunOptions struct {
 // used for generating arguments, with a few options not exposed by public API
 type internalRunOptions struct {
 	RunOptions
+	// CIDFile is a path that Docker writes the container ID to when the container is created
+	CIDFile     string
 	Detach      bool
 	Interactive bool
 	TTY         bool
@@ -57,24 +81,57 @@ func generateDockerArgs(options internalRunOptions) []string {
 		// TODO: relative to pwd and cog.yaml
 	}
 
+	if options.CIDFile != "" {
+		dockerArgs = append(dockerArgs, "--cidfile", options.CIDFile)
+	}
 	if options.Detach {
 		dockerArgs = append(dockerArgs, "--detach")
 	}
+	for _, capability := range options.CapDrop {
+		dockerArgs = append(dockerArgs, "--cap-drop", capability)
+	}
+	if options.Network != "" {
+		dockerArgs = append(dockerArgs, "--network", options.Network)
+	}
+	for _, dns := range options.DNS {
+		dockerArgs = append(dockerArgs, "--dns", dns)
+	}
+	for _, host := range options.ExtraHosts {
+		dockerArgs = append(dockerArgs, "--add-host", host)
+	}
 	for _, env := range options.Env {
 		dockerArgs = append(dockerArgs, "--env", env)
 	}
+	for _, device := range options.Devices {
+		dockerArgs = append(dockerArgs, "--device", device)
+	}
 	if options.GPUs != "" {
-		dockerArgs = append(dockerArgs, "--gpus", options.GPUs)
+		dockerArgs = append(dockerArgs, "--gpus", gpusArg(options.GPUs))
 	}
 	if options.Interactive {
 		dockerArgs = append(dockerArgs, "--interactive")
 	}
 	for _, port := range options.Ports {
-		dockerArgs = append(dockerArgs, "--publish", fmt.Sprintf("%d:%d", port.HostPort, port.ContainerPort))
+		dockerArgs = append(dockerArgs, "--publish", publishArg(port, options.AddressFamily))
+	}
+	if options.ReadOnly {
+		dockerArgs = append(dockerArgs, "--read-only")
+	}
+	if options.NoNewPrivileges {
+		dockerArgs = append(dockerArgs, "--security-opt", "no-new-privileges")
+	}
+	if options.SeccompProfile != "" {
+		dockerArgs = append(dockerArgs, "--security-opt", "seccomp="+options.SeccompProfile)
+	}
+	for _, path := range options.Tmpfs {
+		dockerArgs = append(dockerArgs, "--tmpfs", path)
 	}
 	if options.TTY {
 		dockerArgs = append(dockerArgs, "--tty")
 	}
+	if options.User != "" {
+		dockerArgs = append(dockerArgs, "--user", options.User)
+	}
 	for _, volume := range options.Volumes {
 		// This needs escaping if we want to support commas in filenames
 		// https://github.com/moby/moby/issues/8604
@@ -88,6 +145,38 @@ func generateDockerArgs(options internalRunOptions) []string {
 	return dockerArgs
 }
 
+// gpusArg returns the argument to `docker run --gpus`. Docker parses it as CSV, so a list of devices like
+// device=0,1 has to be quoted, which is easy to forget.
+func gpusArg(gpus string) string {
+	if strings.HasPrefix(gpus, "device=") && strings.Contains(gpus, ",") {
+		return `"` + gpus + `"`
+	}
+	return gpus
+}
+
+// publishArg returns the argument to `docker run --publish` for a port, e.g. "8080:5000" or "[::]:8080:5000"
+func publishArg(port Port, addressFamily string) string {
+	hostIP := port.HostIP
+	if hostIP == "" {
+		hostIP = HostIP(addressFamily)
+	}
+	if hostIP == "" {
+		return fmt.Sprintf("%d:%d", port.HostPort, port.ContainerPort)
+	}
+	return fmt.Sprintf("%s:%d", net.JoinHostPort(hostIP, strconv.Itoa(port.HostPort)), port.ContainerPort)
+}
+
+// HostIP returns the address to publish ports on for an address family, or an empty string to let Docker publish on all addresses
+func HostIP(addressFamily string) string {
+	switch addressFamily {
+	case "ipv4":
+		return "0.0.0.0"
+	case "ipv6":
+		return "::"
+	}
+	return ""
+}
+
 func generateEnv(options internalRunOptions) []string {
 	env := os.Environ()
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
@@ -113,6 +202,13 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	stderrCopy := new(bytes.Buffer)
 	stderrMultiWriter := io.MultiWriter(stderr, stderrCopy)
 
+	cidDir, err := os.MkdirTemp("", "cog-run")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cidDir)
+	internalOptions.CIDFile = filepath.Join(cidDir, "cid")
+
 	dockerArgs := generateDockerArgs(internalOptions)
 	cmd := exec.Command("docker", dockerArgs...)
 	cmd.Env = generateEnv(internalOptions)
@@ -121,7 +217,12 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	cmd.Stderr = stderrMultiWriter
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 
-	err := cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stopForwarding := forwardSignals(cmd, internalOptions.CIDFile)
+	err = cmd.Wait()
+	stopForwarding()
 	if err != nil {
 		stderrString := stderrCopy.String()
 		if strings.Contains(stderrString, "could not select device driver") || strings.Contains(stderrString, "nvidia-container-cli: initialization error") {
@@ -132,6 +233,44 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	return nil
 }
 
+// forwardSignals sends SIGTERM and SIGHUP received by Cog to the container, so scripts can shut it down cleanly.
+// (SIGINT from a terminal already reaches Docker, because it is in the same process group.)
+// It returns a function that stops forwarding.
+func forwardSignals(cmd *exec.Cmd, cidFile string) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				name := "TERM"
+				if sig == syscall.SIGHUP {
+					name = "HUP"
+				}
+				// Docker doesn't proxy signals to containers with a TTY, so send it to the container directly
+				containerID, err := os.ReadFile(cidFile)
+				if err == nil && len(containerID) > 0 {
+					console.Debugf("Sending SIG%s to container %s", name, containerID)
+					if err := Kill(string(containerID), name); err != nil {
+						console.Warnf("Failed to send SIG%s to container: %s", name, err)
+					}
+				} else if err := cmd.Process.Signal(sig); err != nil {
+					console.Warnf("Failed to send SIG%s to docker: %s", name, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
 func RunDaemon(options RunOptions, stderr io.Writer) (string, error) {
 	internalOptions := internalRunOptions{RunOptions: options}
 	internalOptions.Detach = true
@@ -160,43 +299,52 @@ func RunDaemon(options RunOptions, stderr io.Writer) (string, error) {
 	return strings.TrimSpace(string(containerID)), nil
 }
 
-func GetPort(containerID string, containerPort int) (int, error) {
+// GetPort returns the host port a container's port is published on. If addressFamily is set, only ports published on
+// addresses of that family are considered.
+func GetPort(containerID string, containerPort int, addressFamily string) (int, error) {
 	cmd := exec.Command("docker", "port", containerID, fmt.Sprintf("%d", containerPort))
 	cmd.Env = os.Environ()
-	cmd.Stderr = os.Stderr
 
 	output, err := cmd.Output()
 	if err != nil {
-		return 0, err
+		return 0, withStderr(err)
 	}
+	return parsePortOutput(output, addressFamily)
+}
 
-	lines := []string{}
+// parsePortOutput finds the host port in the output of `docker port`, which has a line per address the port is published on, e.g. "0.0.0.0:49153" and "[::]:49153".
+// If addressFamily is set, only addresses of that family are considered.
+func parsePortOutput(output []byte, addressFamily string) (int, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(output))
 	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	if scanner.Err() != nil {
-		return 0, err
-	}
-
-	for _, line := range lines {
-		if !strings.HasPrefix(line, "0.0.0.0:") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
 			continue
 		}
-
-		_, portString, err := net.SplitHostPort(strings.TrimSpace(line))
-		if err != nil {
-			return 0, err
+		// Older versions of Docker print IPv6 addresses without brackets, e.g. ":::49153"
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		host := strings.Trim(line[:i], "[]")
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		isIPv4 := ip.To4() != nil
+		if (addressFamily == "ipv4" && !isIPv4) || (addressFamily == "ipv6" && isIPv4) {
+			continue
 		}
 
-		port, err := strconv.Atoi(portString)
+		port, err := strconv.Atoi(line[i+1:])
 		if err != nil {
 			return 0, err
 		}
-
 		return port, nil
 	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
 
-	return 0, fmt.Errorf("did not find port bound to 0.0.0.0 in `docker port` output")
-
+	return 0, fmt.Errorf("did not find a published port in `docker port` output")
 }
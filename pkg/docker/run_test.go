@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortOutput(t *testing.T) {
+	for _, tt := range []struct {
+		output        string
+		addressFamily string
+		port          int
+	}{
+		{"0.0.0.0:49153\n[::]:49153\n", "", 49153},
+		{"[::]:49154\n", "", 49154},
+		{":::49155\n", "", 49155},
+		{"[::]:49154\n0.0.0.0:49153\n", "ipv4", 49153},
+		{"0.0.0.0:49153\n[::]:49154\n", "ipv6", 49154},
+	} {
+		port, err := parsePortOutput([]byte(tt.output), tt.addressFamily)
+		require.NoError(t, err)
+		require.Equal(t, tt.port, port, tt.output)
+	}
+
+	_, err := parsePortOutput([]byte(""), "")
+	require.Error(t, err)
+}
+
+func TestPublishArg(t *testing.T) {
+	require.Equal(t, "0:5000", publishArg(Port{HostPort: 0, ContainerPort: 5000}, ""))
+	require.Equal(t, "[::]:8080:5000", publishArg(Port{HostIP: "::", HostPort: 8080, ContainerPort: 5000}, "ipv4"))
+	require.Equal(t, "0.0.0.0:8080:5000", publishArg(Port{HostPort: 8080, ContainerPort: 5000}, "ipv4"))
+}
+
+func TestGenerateDockerArgsDevices(t *testing.T) {
+	args := generateDockerArgs(internalRunOptions{RunOptions: RunOptions{
+		Image:   "model",
+		GPUs:    "device=0,1",
+		Devices: []string{"/dev/dri"},
+	}})
+	require.Equal(t, []string{"run", "--rm", "--shm-size", "8G", "--device", "/dev/dri", "--gpus", `"device=0,1"`, "model"}, args)
+
+	require.Equal(t, "all", gpusArg("all"))
+	require.Equal(t, "device=1", gpusArg("device=1"))
+	require.Equal(t, `"device=0,1"`, gpusArg(`"device=0,1"`))
+}
@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Squash flattens an image into a single layer and tags it with the same name. Its filesystem is exported from a
+// container and imported again, with the config that docker import can set, like the environment, entrypoint and
+// command, copied from the original image. Labels aren't kept.
+func Squash(imageName string) error {
+	inspect, err := ImageInspect(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+
+	createCmd := exec.Command("docker", "container", "create", imageName)
+	createCmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(createCmd.Args, " "))
+	out, err := createCmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to create container from %s: %w", imageName, withStderr(err))
+	}
+	containerID := strings.TrimSpace(string(out))
+	defer func() {
+		rmCmd := exec.Command("docker", "container", "rm", containerID)
+		if err := rmCmd.Run(); err != nil {
+			console.Warnf("Failed to remove container %s: %s", containerID, err)
+		}
+	}()
+
+	args := []string{"import"}
+	if inspect.Os != "" && inspect.Architecture != "" {
+		args = append(args, "--platform", inspect.Os+"/"+inspect.Architecture)
+	}
+	if inspect.Config != nil {
+		ports := []string{}
+		for port := range inspect.Config.ExposedPorts {
+			ports = append(ports, string(port))
+		}
+		for _, change := range squashChanges(inspect.Config.Env, inspect.Config.Entrypoint, inspect.Config.Cmd, inspect.Config.WorkingDir, inspect.Config.User, ports) {
+			args = append(args, "--change", change)
+		}
+	}
+	args = append(args, "-", imageName)
+
+	exportCmd := exec.Command("docker", "container", "export", containerID)
+	exportCmd.Env = os.Environ()
+	exportStderr := new(bytes.Buffer)
+	exportCmd.Stderr = exportStderr
+	importCmd := exec.Command("docker", args...)
+	importCmd.Env = os.Environ()
+	if importCmd.Stdin, err = exportCmd.StdoutPipe(); err != nil {
+		return err
+	}
+
+	console.Debug("$ " + strings.Join(exportCmd.Args, " ") + " | " + strings.Join(importCmd.Args, " "))
+	if err := exportCmd.Start(); err != nil {
+		return fmt.Errorf("Failed to export container: %w", err)
+	}
+	if _, err := importCmd.Output(); err != nil {
+		_ = exportCmd.Wait()
+		return fmt.Errorf("Failed to import image: %w", withStderr(err))
+	}
+	if err := exportCmd.Wait(); err != nil {
+		return fmt.Errorf("Failed to export container: %w", withOutput(err, exportStderr.Bytes()))
+	}
+	return nil
+}
+
+// squashChanges returns the Dockerfile instructions that docker import --change applies to set an image's config
+func squashChanges(env, entrypoint, cmd []string, workingDir, user string, ports []string) []string {
+	changes := []string{}
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		changes = append(changes, fmt.Sprintf("ENV %s=%s", name, dockerfileQuote(value)))
+	}
+	if len(entrypoint) > 0 {
+		changes = append(changes, "ENTRYPOINT "+jsonArray(entrypoint))
+	}
+	if len(cmd) > 0 {
+		changes = append(changes, "CMD "+jsonArray(cmd))
+	}
+	if workingDir != "" {
+		changes = append(changes, "WORKDIR "+workingDir)
+	}
+	if user != "" {
+		changes = append(changes, "USER "+user)
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		changes = append(changes, "EXPOSE "+port)
+	}
+	return changes
+}
+
+// dockerfileQuote quotes s as a double-quoted Dockerfile value, so it isn't split on spaces and variables in it
+// aren't expanded
+func dockerfileQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func jsonArray(args []string) string {
+	data, _ := json.Marshal(args)
+	return string(data)
+}
@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSquashChanges(t *testing.T) {
+	changes := squashChanges(
+		[]string{"PATH=/root/.pyenv/shims:$PATH", `GREETING=say "hi"`, "EMPTY="},
+		[]string{"/sbin/tini", "--"},
+		[]string{"python", "-m", "cog.server.http"},
+		"/src",
+		"",
+		[]string{"5000/tcp"},
+	)
+	require.Equal(t, []string{
+		`ENV PATH="/root/.pyenv/shims:\$PATH"`,
+		`ENV GREETING="say \"hi\""`,
+		`ENV EMPTY=""`,
+		`ENTRYPOINT ["/sbin/tini","--"]`,
+		`CMD ["python","-m","cog.server.http"]`,
+		"WORKDIR /src",
+		"EXPOSE 5000/tcp",
+	}, changes)
+}
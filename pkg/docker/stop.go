@@ -8,8 +8,25 @@ import (
 func Stop(id string) error {
 	cmd := exec.Command("docker", "container", "stop", "--time", "3", id)
 	cmd.Env = os.Environ()
-	cmd.Stderr = os.Stderr
 
 	_, err := cmd.Output()
-	return err
+	return withStderr(err)
+}
+
+// Restart stops a container and starts it again with the same options
+func Restart(id string) error {
+	cmd := exec.Command("docker", "container", "restart", "--time", "3", id)
+	cmd.Env = os.Environ()
+
+	_, err := cmd.Output()
+	return withStderr(err)
+}
+
+// Kill sends a signal to a container's main process, e.g. "TERM" or "HUP"
+func Kill(id string, signal string) error {
+	cmd := exec.Command("docker", "container", "kill", "--signal", signal, id)
+	cmd.Env = os.Environ()
+
+	_, err := cmd.Output()
+	return withStderr(err)
 }
@@ -3,20 +3,35 @@ package dockerfile
 import (
 	// blank import for embeds
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dependencies"
+	"github.com/replicate/cog/pkg/dotcog"
+	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/weights"
 )
 
 //go:embed embed/cog.whl
 var cogWheelEmbed []byte
 
+// CogWheelFilename is the filename of the Python cog package that comes with the CLI.
+// It needs to be in the full format, otherwise pip refuses to install it.
+const CogWheelFilename = "cog-0.0.1.dev-py3-none-any.whl"
+
+// CogWheel returns the Python cog package that comes with the CLI
+func CogWheel() []byte {
+	return cogWheelEmbed
+}
+
 const DockerignoreHeader = `# generated by replicate/cog
 __pycache__
 *.pyc
@@ -48,6 +63,10 @@ type Generator struct {
 	GOOS   string
 	GOARCH string
 
+	// Platforms are the platforms the image is built for, like linux/arm64, as passed to docker buildx build
+	// --platform. If it's empty, the image is built for the platform Docker builds for by default.
+	Platforms []string
+
 	// absolute path to tmpDir, a directory that will be cleaned up
 	tmpDir string
 	// tmpDir relative to Dir
@@ -57,10 +76,13 @@ type Generator struct {
 }
 
 func NewGenerator(config *config.Config, dir string) (*Generator, error) {
-	rootTmp := path.Join(dir, ".cog/tmp")
+	rootTmp := dotcog.TmpDir(dir)
 	if err := os.MkdirAll(rootTmp, 0o755); err != nil {
 		return nil, err
 	}
+	if err := dotcog.CleanStale(dir, dotcog.StaleTmpAge); err != nil {
+		console.Warnf("Failed to clean up stale files in %s: %s", rootTmp, err)
+	}
 	// tmpDir ends up being something like dir/.cog/tmp/build123456789
 	tmpDir, err := os.MkdirTemp(rootTmp, "build")
 	if err != nil {
@@ -88,12 +110,9 @@ func (g *Generator) GenerateBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	installPython := ""
-	if g.Config.Build.GPU {
-		installPython, err = g.installPythonCUDA()
-		if err != nil {
-			return "", err
-		}
+	installPython, err := g.installPython()
+	if err != nil {
+		return "", err
 	}
 	aptInstalls, err := g.aptInstalls()
 	if err != nil {
@@ -111,10 +130,16 @@ func (g *Generator) GenerateBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	pipWheelStage, err := g.pipWheelStage(baseImage, installPython)
+	if err != nil {
+		return "", err
+	}
 
 	return strings.Join(filterEmpty([]string{
 		"#syntax=docker/dockerfile:1.4",
 		g.tiniStage(),
+		pipWheelStage,
+		g.huggingFaceStage(),
 		"FROM " + baseImage,
 		g.preamble(),
 		g.installTini(),
@@ -123,9 +148,12 @@ func (g *Generator) GenerateBase() (string, error) {
 		aptInstalls,
 		pipInstalls,
 		run,
+		g.copyHuggingFace(),
+		g.createUser(),
 		`WORKDIR /src`,
 		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
+		g.user(),
+		g.serverCommand(),
 	}), "\n"), nil
 }
 
@@ -137,7 +165,7 @@ func (g *Generator) GenerateDockerfileWithoutSeparateWeights() (string, error) {
 	}
 	return strings.Join(filterEmpty([]string{
 		base,
-		`COPY . /src`,
+		"COPY " + g.chown() + ". /src",
 	}), "\n"), nil
 }
 
@@ -157,12 +185,9 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 	if err != nil {
 		return "", "", "", err
 	}
-	installPython := ""
-	if g.Config.Build.GPU {
-		installPython, err = g.installPythonCUDA()
-		if err != nil {
-			return "", "", "", err
-		}
+	installPython, err := g.installPython()
+	if err != nil {
+		return "", "", "", err
 	}
 	aptInstalls, err := g.aptInstalls()
 	if err != nil {
@@ -180,11 +205,17 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 	if err != nil {
 		return "", "", "", err
 	}
+	pipWheelStage, err := g.pipWheelStage(baseImage, installPython)
+	if err != nil {
+		return "", "", "", err
+	}
 
 	base := []string{
 		"#syntax=docker/dockerfile:1.4",
 		fmt.Sprintf("FROM %s AS %s", imageName+"-weights", "weights"),
 		g.tiniStage(),
+		pipWheelStage,
+		g.huggingFaceStage(),
 		"FROM " + baseImage,
 		g.preamble(),
 		g.installTini(),
@@ -193,17 +224,20 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 		aptInstalls,
 		pipInstalls,
 		runCommands,
+		g.copyHuggingFace(),
 	}
 
 	for _, p := range append(modelDirs, modelFiles...) {
-		base = append(base, "", fmt.Sprintf("COPY --from=%s --link %[2]s %[2]s", "weights", path.Join("/src", p)))
+		base = append(base, "", fmt.Sprintf("COPY --from=%s --link %s%[3]s %[3]s", "weights", g.chown(), path.Join("/src", p)))
 	}
 
 	base = append(base,
+		g.createUser(),
 		`WORKDIR /src`,
 		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
-		`COPY . /src`,
+		g.user(),
+		g.serverCommand(),
+		"COPY "+g.chown()+". /src",
 	)
 
 	dockerignoreContents = makeDockerignoreForWeights(modelDirs, modelFiles)
@@ -245,19 +279,43 @@ func (g *Generator) Cleanup() error {
 }
 
 func (g *Generator) baseImage() (string, error) {
-	if g.Config.Build.GPU {
-		return g.Config.CUDABaseImageTag()
+	return BaseImage(g.Config)
+}
+
+// BaseImage returns the image that the image for cfg is built on
+func BaseImage(cfg *config.Config) (string, error) {
+	if cfg.Build.GPU {
+		return cfg.CUDABaseImageTag()
 	}
-	return "python:" + g.Config.Build.PythonVersion, nil
+	return "python:" + cfg.Build.PythonVersion, nil
 }
 
 func (g *Generator) preamble() string {
+	libraryPath := "/usr/lib/x86_64-linux-gnu"
+	if len(g.Platforms) > 0 {
+		dirs := []string{}
+		for _, arch := range g.architectures() {
+			dirs = append(dirs, libraryDirs[arch])
+		}
+		libraryPath = strings.Join(dirs, ":")
+	}
 	return `ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
-ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin`
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:` + libraryPath + `:/usr/local/nvidia/lib64:/usr/local/nvidia/bin`
 }
 
 func (g *Generator) tiniStage() string {
+	if len(g.Platforms) > 0 {
+		// The tini release asset is for amd64, so download the one for the platform being built. The stage runs
+		// on the platform doing the build, because it only downloads a file.
+		return strings.Join([]string{
+			`FROM --platform=$BUILDPLATFORM curlimages/curl AS downloader`,
+			`ARG TINI_VERSION=0.19.0`,
+			`ARG TARGETARCH`,
+			`WORKDIR /tmp`,
+			`RUN curl -fsSL -o tini "https://github.com/krallin/tini/releases/download/v${TINI_VERSION}/tini-${TARGETARCH}" && chmod +x tini`,
+		}, "\n")
+	}
 	lines := []string{
 		`FROM curlimages/curl AS downloader`,
 		`ARG TINI_VERSION=0.19.0`,
@@ -280,14 +338,97 @@ func (g *Generator) installTini() string {
 	return strings.Join(lines, "\n")
 }
 
+// aptInstall installs APT packages, keeping the packages it downloads in a BuildKit cache so they aren't downloaded
+// again by the next build. The cache is locked because apt can't share it between builds running at the same time,
+// and docker-clean is moved out of the way because it deletes downloaded packages once they are installed. It's
+// followed by the packages to install and aptCleanup, which puts docker-clean back, so it's still in the image for
+// apt-get commands run in the model.
+const aptInstall = "RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy"
+
+// aptCleanup ends the RUN instruction started by aptInstall
+const aptCleanup = "rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi"
+
 func (g *Generator) aptInstalls() (string, error) {
-	packages := g.Config.Build.SystemPackages
+	packages := append([]string{}, g.Config.Build.SystemPackages...)
+
+	// pip needs git to install cog_package from a git URL, and the slim Python images that CPU models are built on
+	// don't have it
+	if strings.HasPrefix(g.Config.Build.CogPackage, "git+") && !containsString(packages, "git") {
+		packages = append(packages, "git")
+	}
+
+	// Add the system packages that some Python packages need but don't install, like libgl1 for opencv-python
+	requirementsByArch, err := g.pythonRequirements()
+	if err != nil {
+		return "", err
+	}
+	requirements := []string{}
+	for _, arch := range sortedKeys(requirementsByArch) {
+		requirements = append(requirements, strings.Split(requirementsByArch[arch], "\n")...)
+	}
+	for _, missing := range dependencies.MissingSystemPackages(requirements, packages) {
+		console.Infof("Adding system package %s, which the Python package %s needs. Add it to system_packages in cog.yaml to silence this message.", missing.Name, missing.NeededBy)
+		packages = append(packages, missing.Name)
+	}
+
 	if len(packages) == 0 {
 		return "", nil
 	}
-	return "RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy " +
+	return aptInstall + " " +
 		strings.Join(packages, " ") +
-		" && rm -rf /var/lib/apt/lists/*", nil
+		" && " + aptCleanup, nil
+}
+
+// installPython installs Python, unless the base image already has the right version
+func (g *Generator) installPython() (string, error) {
+	switch {
+	case g.Config.Build.CondaFile != "":
+		return g.installPythonConda()
+	case g.Config.Build.GPU:
+		return g.installPythonCUDA()
+	default:
+		return "", nil
+	}
+}
+
+// condaDir is where Miniconda is installed
+const condaDir = "/opt/conda"
+
+// minicondaVersion is the version of the Miniconda installer, which is pinned so builds are repeatable. It's only
+// used to run conda, because the model's Python is installed in its own environment.
+const minicondaVersion = "py311_24.7.1-0"
+
+// condaEnv is the conda environment the model's Python and packages are installed in
+const condaEnv = "cog"
+
+// installPythonConda installs Miniconda, creates an environment with python_version and the packages in
+// build.conda_file, and puts it first on the PATH, so its Python is the one that runs the model, and the one that
+// Python packages and cog are installed into. It's a separate environment, rather than the base one, because conda
+// itself needs the base one's Python, which can't be changed to an old version.
+func (g *Generator) installPythonConda() (string, error) {
+	contents, err := os.ReadFile(filepath.Join(g.Dir, g.Config.Build.CondaFile))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read conda_file: %w", err)
+	}
+	copyLines, containerPath, err := g.writeTemp("environment.yml", contents)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	if g.Config.Build.GPU {
+		// The CUDA base images don't have curl
+		lines = append(lines, aptInstall+" --no-install-recommends curl ca-certificates && "+aptCleanup)
+	}
+	lines = append(lines,
+		fmt.Sprintf("RUN curl -fsSL -o /tmp/miniconda.sh https://repo.anaconda.com/miniconda/Miniconda3-%s-Linux-$(uname -m).sh && bash /tmp/miniconda.sh -b -p %s && rm /tmp/miniconda.sh", minicondaVersion, condaDir),
+	)
+	lines = append(lines, copyLines...)
+	lines = append(lines,
+		fmt.Sprintf("RUN %[1]s/bin/conda create --yes --name %[2]s %[3]s && %[1]s/bin/conda env update --name %[2]s --file %[4]s && %[1]s/bin/conda clean --all --yes", condaDir, condaEnv, shellQuote("python="+g.Config.Build.PythonVersion), containerPath),
+		fmt.Sprintf(`ENV PATH="%s/envs/%s/bin:%s/bin:$PATH"`, condaDir, condaEnv, condaDir),
+	)
+	return strings.Join(lines, "\n"), nil
 }
 
 func (g *Generator) installPythonCUDA() (string, error) {
@@ -296,7 +437,7 @@ func (g *Generator) installPythonCUDA() (string, error) {
 	py := g.Config.Build.PythonVersion
 
 	return `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
+` + aptInstall + ` --no-install-recommends \
 	make \
 	build-essential \
 	libssl-dev \
@@ -315,7 +456,7 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	liblzma-dev \
 	git \
 	ca-certificates \
-	&& rm -rf /var/lib/apt/lists/*
+	&& ` + aptCleanup + `
 ` + fmt.Sprintf(`RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
 	git clone https://github.com/momo-lab/pyenv-install-latest.git "$(pyenv root)"/plugins/pyenv-install-latest && \
 	pyenv install-latest "%s" && \
@@ -323,35 +464,209 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	pip install "wheel<1"`, py, py), nil
 }
 
+// cogVersionRegexp matches versions of the cog package on PyPI, like 0.9.0 or 0.9.0b1
+var cogVersionRegexp = regexp.MustCompile(`^\d+(\.\d+)*\S*$`)
+
 func (g *Generator) installCog() (string, error) {
-	// Wheel name needs to be full format otherwise pip refuses to install it
-	cogFilename := "cog-0.0.1.dev-py3-none-any.whl"
-	lines, containerPath, err := g.writeTemp(cogFilename, cogWheelEmbed)
-	if err != nil {
-		return "", err
+	cogPackage := g.Config.Build.CogPackage
+	switch {
+	case cogPackage == "":
+		lines, containerPath, err := g.writeTemp(CogWheelFilename, cogWheelEmbed)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("RUN %s pip install%s %s", g.pipMounts(), g.pipIndexOptions(), containerPath))
+		return strings.Join(lines, "\n"), nil
+
+	case strings.HasSuffix(cogPackage, ".whl") && !strings.Contains(cogPackage, "://"):
+		// A local wheel, which may be outside the build context, so it's copied into it
+		wheelPath := cogPackage
+		if !filepath.IsAbs(wheelPath) {
+			wheelPath = filepath.Join(g.Dir, wheelPath)
+		}
+		contents, err := os.ReadFile(wheelPath)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read cog_package wheel: %w", err)
+		}
+		lines, containerPath, err := g.writeTemp(filepath.Base(wheelPath), contents)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("RUN %s pip install%s %s", g.pipMounts(), g.pipIndexOptions(), containerPath))
+		return strings.Join(lines, "\n"), nil
+
+	case cogVersionRegexp.MatchString(cogPackage):
+		// A version on PyPI
+		return fmt.Sprintf("RUN %s pip install%s %s", g.pipMounts(), g.pipIndexOptions(), shellQuote("cog=="+cogPackage)), nil
+
+	default:
+		// Anything else pip can install, like a git URL
+		return fmt.Sprintf("RUN %s pip install%s %s", g.pipMounts(), g.pipIndexOptions(), shellQuote(cogPackage)), nil
 	}
-	lines = append(lines, fmt.Sprintf("RUN --mount=type=cache,target=/root/.cache/pip pip install %s", containerPath))
-	return strings.Join(lines, "\n"), nil
 }
 
 func (g *Generator) pipInstalls() (string, error) {
-	requirements, err := g.Config.PythonRequirementsForArch(g.GOOS, g.GOARCH)
+	requirements, err := g.pythonRequirements()
 	if err != nil {
 		return "", err
 	}
-	if strings.Trim(requirements, "") == "" {
+	if requirementsEmpty(requirements) {
 		return "", nil
 	}
 
-	lines, containerPath, err := g.writeTemp("requirements.txt", []byte(requirements))
+	lines, containerPath, err := g.writeTempForArch("requirements.txt", requirements)
 	if err != nil {
 		return "", err
 	}
 
-	lines = append(lines, "RUN --mount=type=cache,target=/root/.cache/pip pip install -r "+containerPath)
+	if _, packages := splitRequirements(requirements); g.Config.Build.PipDownload && !requirementsEmpty(packages) {
+		// Install from the wheels built in pipWheelStage. The indexes are still used, for anything that wasn't built.
+		lines = append(lines, fmt.Sprintf("RUN --mount=type=bind,from=pip-wheels,source=/wheels,target=/tmp/wheels %s pip install --find-links /tmp/wheels%s -r %s", g.pipMounts(), g.pipIndexOptions(), containerPath))
+	} else {
+		lines = append(lines, fmt.Sprintf("RUN %s pip install%s -r %s", g.pipMounts(), g.pipIndexOptions(), containerPath))
+	}
 	return strings.Join(lines, "\n"), nil
 }
 
+// pipNetrcPath is where the build.pip_netrc_secret is mounted, which is where pip looks for credentials
+const pipNetrcPath = "/root/.netrc"
+
+// pipMounts returns the mounts for RUN instructions that fetch Python packages: pip's cache, and the secret with
+// the credentials for the package indexes, so they aren't saved in the image
+func (g *Generator) pipMounts() string {
+	mounts := "--mount=type=cache,target=/root/.cache/pip"
+	if secret := g.Config.Build.PipNetrcSecret; secret != "" {
+		mounts += fmt.Sprintf(" --mount=type=secret,id=%s,target=%s", secret, pipNetrcPath)
+	}
+	return mounts
+}
+
+// pipIndexOptions returns the options for pip to fetch packages from the indexes in cog.yaml, with a leading space,
+// or an empty string to use PyPI
+func (g *Generator) pipIndexOptions() string {
+	options := ""
+	if indexURL := g.Config.Build.PipIndexURL; indexURL != "" {
+		options += " --index-url " + shellQuote(indexURL)
+	}
+	for _, indexURL := range g.Config.Build.PipExtraIndexURLs {
+		options += " --extra-index-url " + shellQuote(indexURL)
+	}
+	return options
+}
+
+// pipWheelParallelism is how many packages are built at once in pipWheelStage
+const pipWheelParallelism = 8
+
+// pipWheelStage builds wheels of all the Python packages in a separate stage, if build.pip_download is set. Each
+// package is downloaded and built in parallel, which is much faster than pip install on high-latency networks, and
+// any missing packages fail the build before the slow steps in the main stage. The stage is based on the same image
+// and Python as the main stage, so the wheels are built for the same ABI and glibc.
+func (g *Generator) pipWheelStage(baseImage, installPython string) (string, error) {
+	if !g.Config.Build.PipDownload {
+		return "", nil
+	}
+	requirements, err := g.pythonRequirements()
+	if err != nil {
+		return "", err
+	}
+	options, packages := splitRequirements(requirements)
+	if requirementsEmpty(packages) {
+		return "", nil
+	}
+
+	lines := []string{"FROM " + baseImage + " AS pip-wheels", g.preamble()}
+	if installPython != "" {
+		lines = append(lines, installPython)
+	}
+	for _, file := range []struct {
+		name     string
+		contents map[string]string
+	}{
+		{"requirements.txt", requirements},
+		{"requirements-options.txt", options},
+		{"requirements-packages.txt", packages},
+	} {
+		copyLines, _, err := g.writeTempForArch(file.name, file.contents)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, copyLines...)
+	}
+	// Packages that are built separately can each resolve their dependencies to different versions, so finish with
+	// a build of everything together, which only builds what's missing for the whole set to be installed.
+	indexOptions := g.pipIndexOptions()
+	lines = append(lines, fmt.Sprintf("RUN %s xargs --no-run-if-empty --arg-file=/tmp/requirements-packages.txt --delimiter='\\n' --max-procs=%d --max-args=1 pip wheel%s --wheel-dir /wheels -r /tmp/requirements-options.txt && pip wheel%s --wheel-dir /wheels -r /tmp/requirements.txt", g.pipMounts(), pipWheelParallelism, indexOptions, indexOptions))
+	return strings.Join(lines, "\n"), nil
+}
+
+// splitRequirements splits the contents of requirements.txt files into the options in them, like --extra-index-url,
+// which apply to every package, and the packages
+func splitRequirements(requirements map[string]string) (options map[string]string, packages map[string]string) {
+	options = map[string]string{}
+	packages = map[string]string{}
+	for arch, contents := range requirements {
+		archOptions := []string{}
+		archPackages := []string{}
+		for _, line := range strings.Split(contents, "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "-"):
+				archOptions = append(archOptions, line)
+			default:
+				archPackages = append(archPackages, line)
+			}
+		}
+		options[arch] = strings.Join(archOptions, "\n")
+		packages[arch] = strings.Join(archPackages, "\n")
+	}
+	return options, packages
+}
+
+// HuggingFaceTokenSecret is the ID of the build secret with the token to download the files in huggingface with. The
+// secret is optional, because public repositories can be downloaded without one.
+const HuggingFaceTokenSecret = "huggingface_token"
+
+// huggingFaceDir is where the files in huggingface are downloaded to in huggingFaceStage
+const huggingFaceDir = "/huggingface"
+
+// huggingFaceStage downloads the files in huggingface in a separate stage, if it's set. The stage only depends on
+// huggingface, so the download is cached until it changes, and the files are copied into the image in a layer of their
+// own, which isn't pushed again when the code changes.
+func (g *Generator) huggingFaceStage() string {
+	hf := g.Config.HuggingFace
+	if hf == nil {
+		return ""
+	}
+	from := "FROM python:" + g.Config.Build.PythonVersion + "-slim AS huggingface"
+	if len(g.Platforms) > 0 {
+		// The files are the same on every platform, so they're only downloaded once
+		from = "FROM --platform=$BUILDPLATFORM python:" + g.Config.Build.PythonVersion + "-slim AS huggingface"
+	}
+	args := []string{shellQuote(hf.Repo), "--revision", shellQuote(hf.Revision), "--local-dir", huggingFaceDir}
+	if len(hf.Files) > 0 {
+		args = append(args, "--include")
+		for _, file := range hf.Files {
+			args = append(args, shellQuote(file))
+		}
+	}
+	return strings.Join([]string{
+		from,
+		"RUN --mount=type=cache,target=/root/.cache/pip pip install 'huggingface_hub>=0.23,<1'",
+		// The token is read from the secret in the same command it's used in, so it isn't saved in the image. The
+		// download's metadata in .cache is removed, because it's of no use in the image.
+		fmt.Sprintf("RUN --mount=type=secret,id=%s HF_TOKEN=\"$(cat /run/secrets/%[1]s 2>/dev/null)\" huggingface-cli download %s && rm -rf %s/.cache", HuggingFaceTokenSecret, strings.Join(args, " "), huggingFaceDir),
+	}, "\n")
+}
+
+// copyHuggingFace copies the files downloaded in huggingFaceStage into the image
+func (g *Generator) copyHuggingFace() string {
+	if g.Config.HuggingFace == nil {
+		return ""
+	}
+	return fmt.Sprintf("COPY --from=huggingface --link %s%s %s", g.chown(), huggingFaceDir, g.Config.HuggingFace.Path)
+}
+
 func (g *Generator) runCommands() (string, error) {
 	runCommands := g.Config.Build.Run
 
@@ -385,6 +700,51 @@ This is the offending line: %s`, command)
 	return strings.Join(lines, "\n"), nil
 }
 
+// createUser creates the non-root user the model runs as, if build.uid is set
+func (g *Generator) createUser() string {
+	uid := g.Config.Build.UID
+	if uid == 0 {
+		return ""
+	}
+	lines := []string{}
+	if g.Config.Build.GPU {
+		// Python is installed with pyenv in /root, which other users can't read by default
+		lines = append(lines, "RUN chmod 755 /root")
+	}
+	lines = append(lines, fmt.Sprintf("RUN groupadd --gid %[1]d cog && useradd --create-home --uid %[1]d --gid %[1]d cog && mkdir -p /src /home/cog/.cache && chown -R %[1]d:%[1]d /src /home/cog", uid))
+	return strings.Join(lines, "\n")
+}
+
+func (g *Generator) user() string {
+	if g.Config.Build.UID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("USER %d", g.Config.Build.UID)
+}
+
+// serverCommand returns the CMD that runs the model's HTTP server, which is Cog's unless cog.yaml sets server_command
+func (g *Generator) serverCommand() string {
+	command := g.Config.ServerCommand
+	if len(command) == 0 {
+		command = []string{"python", "-m", "cog.server.http"}
+	}
+	// Exec form is a JSON array, so the server gets signals directly, rather than through a shell
+	args := make([]string, len(command))
+	for i, arg := range command {
+		data, _ := json.Marshal(arg)
+		args[i] = string(data)
+	}
+	return "CMD [" + strings.Join(args, ", ") + "]"
+}
+
+// chown returns the flag to COPY files so they are owned by the user the model runs as
+func (g *Generator) chown() string {
+	if g.Config.Build.UID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--chown=%[1]d:%[1]d ", g.Config.Build.UID)
+}
+
 // writeTemp writes a temporary file that can be used as part of the build process
 // It returns the lines to add to Dockerfile to make it available and the filename it ends up as inside the container
 func (g *Generator) writeTemp(filename string, contents []byte) ([]string, string, error) {
@@ -398,6 +758,107 @@ func (g *Generator) writeTemp(filename string, contents []byte) ([]string, strin
 	return []string{fmt.Sprintf("COPY %s /tmp/%s", filepath.Join(g.relativeTmpDir, filename), filename)}, "/tmp/" + filename, nil
 }
 
+// pythonRequirements returns the requirements.txt for each architecture the image is built for, keyed by
+// architecture. If the requirements are the same for all of them, which they usually are, it has a single entry
+// with an empty key.
+func (g *Generator) pythonRequirements() (map[string]string, error) {
+	if len(g.Platforms) == 0 {
+		requirements, err := g.Config.PythonRequirementsForArch(g.GOOS, g.GOARCH)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"": requirements}, nil
+	}
+	byArch := map[string]string{}
+	same := true
+	first := ""
+	for i, arch := range g.architectures() {
+		requirements, err := g.Config.PythonRequirementsForArch("linux", arch)
+		if err != nil {
+			return nil, err
+		}
+		byArch[arch] = requirements
+		if i == 0 {
+			first = requirements
+		} else if requirements != first {
+			same = false
+		}
+	}
+	if same {
+		return map[string]string{"": first}, nil
+	}
+	return byArch, nil
+}
+
+// architectures returns the CPU architectures of g.Platforms, sorted and without duplicates
+func (g *Generator) architectures() []string {
+	seen := map[string]bool{}
+	arches := []string{}
+	for _, platform := range g.Platforms {
+		if arch := platformArch(platform); arch != "" && !seen[arch] {
+			seen[arch] = true
+			arches = append(arches, arch)
+		}
+	}
+	sort.Strings(arches)
+	return arches
+}
+
+// writeTempForArch is like writeTemp, but for a file that is different for each architecture, keyed by
+// architecture like pythonRequirements returns. A file is written for each architecture, and the one for the
+// architecture being built is copied to /tmp/filename.
+func (g *Generator) writeTempForArch(filename string, contents map[string]string) ([]string, string, error) {
+	if len(contents) == 1 {
+		for _, c := range contents {
+			return g.writeTemp(filename, []byte(c))
+		}
+	}
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for _, arch := range sortedKeys(contents) {
+		if _, _, err := g.writeTemp(base+"-"+arch+ext, []byte(contents[arch])); err != nil {
+			return []string{}, "", err
+		}
+	}
+	return []string{
+		"ARG TARGETARCH",
+		fmt.Sprintf("COPY %s /tmp/%s", filepath.Join(g.relativeTmpDir, base+"-${TARGETARCH}"+ext), filename),
+	}, "/tmp/" + filename, nil
+}
+
+// requirementsEmpty returns whether there are no Python requirements for any architecture
+func requirementsEmpty(requirements map[string]string) bool {
+	for _, contents := range requirements {
+		if contents != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s so it is passed to a command in a RUN instruction as a single argument
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func filterEmpty(list []string) []string {
 	filtered := []string{}
 	for _, s := range list {
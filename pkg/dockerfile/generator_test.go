@@ -34,7 +34,7 @@ RUN --mount=type=cache,target=/root/.cache/pip pip install /tmp/cog-0.0.1.dev-py
 
 func testInstallPython(version string) string {
 	return fmt.Sprintf(`ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy --no-install-recommends \
 	make \
 	build-essential \
 	libssl-dev \
@@ -53,7 +53,7 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	liblzma-dev \
 	git \
 	ca-certificates \
-	&& rm -rf /var/lib/apt/lists/*
+	&& rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi
 RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
 	git clone https://github.com/momo-lab/pyenv-install-latest.git "$(pyenv root)"/plugins/pyenv-install-latest && \
 	pyenv install-latest "%s" && \
@@ -157,7 +157,7 @@ ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ` + testInstallTini() + testInstallCog(gen.relativeTmpDir) + `
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi
 COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -r /tmp/requirements.txt
 RUN cowsay moo
@@ -208,7 +208,7 @@ ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia
 ` + testInstallTini() +
 		testInstallPython("3.8") +
 		testInstallCog(gen.relativeTmpDir) + `
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi
 COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -r /tmp/requirements.txt
 RUN cowsay moo
@@ -253,7 +253,7 @@ ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ` + testInstallTini() + testInstallCog(gen.relativeTmpDir) + `
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy cowsay && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy cowsay && rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi
 RUN cowsay moo
 WORKDIR /src
 EXPOSE 5000
@@ -360,7 +360,7 @@ ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia
 ` + testInstallTini() +
 		testInstallPython("3.8") +
 		testInstallCog(gen.relativeTmpDir) + `
-RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked if [ -f /etc/apt/apt.conf.d/docker-clean ]; then mv /etc/apt/apt.conf.d/docker-clean /tmp/docker-clean; fi && apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi
 COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -r /tmp/requirements.txt
 RUN cowsay moo
@@ -440,3 +440,345 @@ COPY . /src`
 
 	require.Equal(t, expected, actual)
 }
+
+func TestGenerateNonRootUser(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  uid: 1000
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	expected := `#syntax=docker/dockerfile:1.4
+` + testTiniStage() +
+		`FROM python:3.8
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+` + testInstallTini() + testInstallCog(gen.relativeTmpDir) + `
+RUN groupadd --gid 1000 cog && useradd --create-home --uid 1000 --gid 1000 cog && mkdir -p /src /home/cog/.cache && chown -R 1000:1000 /src /home/cog
+WORKDIR /src
+EXPOSE 5000
+USER 1000
+CMD ["python", "-m", "cog.server.http"]
+COPY --chown=1000:1000 . /src`
+
+	require.Equal(t, expected, actual)
+}
+
+func TestGeneratePipDownload(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  pip_download: true
+  python_packages:
+    - torch==1.5.1
+    - pandas==1.2.0.12
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	expected := `#syntax=docker/dockerfile:1.4
+` + testTiniStage() +
+		`FROM python:3.8 AS pip-wheels
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
+COPY ` + gen.relativeTmpDir + `/requirements-options.txt /tmp/requirements-options.txt
+COPY ` + gen.relativeTmpDir + `/requirements-packages.txt /tmp/requirements-packages.txt
+RUN --mount=type=cache,target=/root/.cache/pip xargs --no-run-if-empty --arg-file=/tmp/requirements-packages.txt --delimiter='\n' --max-procs=8 --max-args=1 pip wheel --wheel-dir /wheels -r /tmp/requirements-options.txt && pip wheel --wheel-dir /wheels -r /tmp/requirements.txt
+FROM python:3.8
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+` + testInstallTini() + testInstallCog(gen.relativeTmpDir) + `
+COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
+RUN --mount=type=bind,from=pip-wheels,source=/wheels,target=/tmp/wheels --mount=type=cache,target=/root/.cache/pip pip install --find-links /tmp/wheels -r /tmp/requirements.txt
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+
+	require.Equal(t, expected, actual)
+
+	packages, err := os.ReadFile(path.Join(gen.tmpDir, "requirements-packages.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "torch==1.5.1\npandas==1.2.0.12", string(packages))
+}
+
+func TestGeneratePipIndexes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  pip_index_url: https://pypi.example.com/simple
+  pip_extra_index_urls:
+    - https://internal.example.com/simple
+  pip_netrc_secret: netrc
+  python_packages:
+    - internal-package==1.0.0
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "RUN --mount=type=cache,target=/root/.cache/pip --mount=type=secret,id=netrc,target=/root/.netrc pip install --index-url 'https://pypi.example.com/simple' --extra-index-url 'https://internal.example.com/simple' -r /tmp/requirements.txt")
+	require.Contains(t, actual, "RUN --mount=type=cache,target=/root/.cache/pip --mount=type=secret,id=netrc,target=/root/.netrc pip install --index-url 'https://pypi.example.com/simple' --extra-index-url 'https://internal.example.com/simple' /tmp/cog-")
+}
+
+func TestGenerateHuggingFace(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+  uid: 1000
+huggingface:
+  repo: stabilityai/sdxl-turbo
+  revision: 462165984030d82259a11f4367a4eed129e94a7b
+  files:
+    - "*.safetensors"
+    - model_index.json
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `FROM python:3.11-slim AS huggingface
+RUN --mount=type=cache,target=/root/.cache/pip pip install 'huggingface_hub>=0.23,<1'
+RUN --mount=type=secret,id=huggingface_token HF_TOKEN="$(cat /run/secrets/huggingface_token 2>/dev/null)" huggingface-cli download 'stabilityai/sdxl-turbo' --revision '462165984030d82259a11f4367a4eed129e94a7b' --local-dir /huggingface --include '*.safetensors' 'model_index.json' && rm -rf /huggingface/.cache
+FROM python:3.11
+`)
+	// The files are copied before the code, so they're in a layer that doesn't change when it does
+	require.Contains(t, actual, "COPY --from=huggingface --link --chown=1000:1000 /huggingface /weights\nRUN groupadd")
+}
+
+func TestGenerateCondaFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "environment.yml"), []byte("dependencies:\n  - numpy=1.26\n"), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  cuda: "11.8"
+  python_version: "3.10"
+  conda_file: environment.yml
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `RUN curl -fsSL -o /tmp/miniconda.sh https://repo.anaconda.com/miniconda/Miniconda3-py311_24.7.1-0-Linux-$(uname -m).sh && bash /tmp/miniconda.sh -b -p /opt/conda && rm /tmp/miniconda.sh
+COPY `+gen.relativeTmpDir+`/environment.yml /tmp/environment.yml
+RUN /opt/conda/bin/conda create --yes --name cog 'python=3.10' && /opt/conda/bin/conda env update --name cog --file /tmp/environment.yml && /opt/conda/bin/conda clean --all --yes
+ENV PATH="/opt/conda/envs/cog/bin:/opt/conda/bin:$PATH"
+`)
+	require.NotContains(t, actual, "pyenv")
+
+	environment, err := os.ReadFile(path.Join(gen.tmpDir, "environment.yml"))
+	require.NoError(t, err)
+	require.Equal(t, "dependencies:\n  - numpy=1.26\n", string(environment))
+}
+
+func TestGenerateServerCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+predict: predict.py:Predictor
+server_command: ["python", "-m", "cog.server.http", "--threads", "4"]
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `CMD ["python", "-m", "cog.server.http", "--threads", "4"]`)
+	require.NotContains(t, actual, `CMD ["python", "-m", "cog.server.http"]`)
+}
+
+func TestGenerateInfersSystemPackages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  system_packages:
+    - libgl1-mesa-glx
+  python_packages:
+    - opencv-python==4.8.0.76
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "apt-get install -qqy libgl1-mesa-glx libglib2.0-0 && rm -rf /var/lib/apt/lists/* && if [ -f /tmp/docker-clean ]; then mv /tmp/docker-clean /etc/apt/apt.conf.d/docker-clean; fi")
+	require.Equal(t, []string{"libgl1-mesa-glx"}, conf.Build.SystemPackages)
+}
+
+func TestGenerateCogPackage(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "cog-0.9.0-py3-none-any.whl"), []byte("wheel"), 0o644))
+
+	for _, tt := range []struct {
+		cogPackage string
+		expected   func(relativeTmpDir string) string
+	}{
+		{"0.9.0b1", func(string) string {
+			return "RUN --mount=type=cache,target=/root/.cache/pip pip install 'cog==0.9.0b1'"
+		}},
+		{"cog-0.9.0-py3-none-any.whl", func(relativeTmpDir string) string {
+			return "COPY " + relativeTmpDir + "/cog-0.9.0-py3-none-any.whl /tmp/cog-0.9.0-py3-none-any.whl\nRUN --mount=type=cache,target=/root/.cache/pip pip install /tmp/cog-0.9.0-py3-none-any.whl"
+		}},
+		{"git+https://github.com/replicate/cog.git@main#subdirectory=python", func(string) string {
+			return "apt-get install -qqy git && "
+		}},
+		{"git+https://github.com/replicate/cog.git@main#subdirectory=python", func(string) string {
+			return "RUN --mount=type=cache,target=/root/.cache/pip pip install 'git+https://github.com/replicate/cog.git@main#subdirectory=python'"
+		}},
+	} {
+		conf, err := config.FromYAML([]byte(`
+build:
+  cog_package: "` + tt.cogPackage + `"
+predict: predict.py:Predictor
+`))
+		require.NoError(t, err)
+		require.NoError(t, conf.ValidateAndComplete(""))
+
+		gen, err := NewGenerator(conf, tmpDir)
+		require.NoError(t, err)
+		actual, err := gen.GenerateBase()
+		require.NoError(t, err)
+		require.Contains(t, actual, tt.expected(gen.relativeTmpDir))
+		require.NotContains(t, actual, "cog-0.0.1.dev-py3-none-any.whl")
+	}
+}
+
+func TestGeneratePlatforms(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.10"
+  python_packages:
+    - pandas==1.2.0.12
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.Platforms = []string{"linux/amd64", "linux/arm64"}
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `FROM --platform=$BUILDPLATFORM curlimages/curl AS downloader
+ARG TINI_VERSION=0.19.0
+ARG TARGETARCH
+WORKDIR /tmp
+RUN curl -fsSL -o tini "https://github.com/krallin/tini/releases/download/v${TINI_VERSION}/tini-${TARGETARCH}" && chmod +x tini`)
+	require.Contains(t, actual, "ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/lib/aarch64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin")
+	// The requirements are the same for both, so there's a single file
+	require.Contains(t, actual, "COPY "+gen.relativeTmpDir+"/requirements.txt /tmp/requirements.txt")
+}
+
+func TestWriteTempForArch(t *testing.T) {
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	gen, err := NewGenerator(conf, t.TempDir())
+	require.NoError(t, err)
+
+	lines, containerPath, err := gen.writeTempForArch("requirements.txt", map[string]string{
+		"amd64": "torch==2.0.1+cpu",
+		"arm64": "torch==2.0.1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ARG TARGETARCH", "COPY " + gen.relativeTmpDir + "/requirements-${TARGETARCH}.txt /tmp/requirements.txt"}, lines)
+	require.Equal(t, "/tmp/requirements.txt", containerPath)
+	arm64, err := os.ReadFile(path.Join(gen.tmpDir, "requirements-arm64.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "torch==2.0.1", string(arm64))
+}
+
+func TestGeneratePlatformsSameRequirements(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_packages:
+    - pandas==1.2.0.12
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.Platforms = []string{"linux/arm64"}
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "COPY "+gen.relativeTmpDir+"/requirements.txt /tmp/requirements.txt")
+	require.Contains(t, actual, "ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/aarch64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin")
+}
+
+func TestParsePlatforms(t *testing.T) {
+	platforms, err := ParsePlatforms("linux/amd64, linux/arm64/v8,linux/amd64")
+	require.NoError(t, err)
+	require.Equal(t, []string{"linux/amd64", "linux/arm64/v8"}, platforms)
+
+	_, err = ParsePlatforms("darwin/arm64")
+	require.Error(t, err)
+	_, err = ParsePlatforms("linux/s390x")
+	require.ErrorContains(t, err, "amd64, arm64")
+}
@@ -0,0 +1,57 @@
+package dockerfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// libraryDirs are the directories with the system libraries for each architecture Cog can build images for
+var libraryDirs = map[string]string{
+	"amd64": "/usr/lib/x86_64-linux-gnu",
+	"arm64": "/usr/lib/aarch64-linux-gnu",
+}
+
+// ParsePlatforms parses a comma-separated list of platforms to build an image for, like linux/amd64,linux/arm64, in
+// the form docker buildx build --platform takes them
+func ParsePlatforms(s string) ([]string, error) {
+	platforms := []string{}
+	seen := map[string]bool{}
+	for _, platform := range strings.Split(s, ",") {
+		platform = strings.TrimSpace(platform)
+		if platform == "" {
+			continue
+		}
+		parts := strings.Split(platform, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] != "linux" {
+			return nil, fmt.Errorf("Invalid platform %q. Platforms are in the form linux/amd64 or linux/arm64", platform)
+		}
+		if _, ok := libraryDirs[parts[1]]; !ok {
+			return nil, fmt.Errorf("Cog can't build images for %s. It can build them for %s", platform, strings.Join(supportedArchitectures(), ", "))
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms, nil
+}
+
+// platformArch returns the CPU architecture of a platform, like arm64 for linux/arm64/v8
+func platformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// supportedArchitectures returns the architectures Cog can build images for
+func supportedArchitectures() []string {
+	arches := []string{}
+	for arch := range libraryDirs {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	return arches
+}
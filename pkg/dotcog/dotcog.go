@@ -0,0 +1,124 @@
+// Package dotcog defines the layout of the .cog directory, where Cog keeps the files it generates for a project:
+//
+//	.cog/
+//	  build.json                       Metadata about the last image built with 'cog build'
+//	  dockerfiles/<os>-<arch>/Dockerfile  Dockerfiles generated by 'cog debug dump', for each platform
+//	  file_hashes.json                 Hashes of the project's files, so unchanged ones aren't read again
+//	  tmp/build*/                      Temporary files used by builds in progress
+//	  wheel/                           The Python cog package that comes with the CLI
+//
+// Everything in it can be regenerated, so it can be deleted at any time, and shouldn't be committed.
+package dotcog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dir is the name of the directory, relative to the project
+const Dir = ".cog"
+
+// StaleTmpAge is how old a temporary build directory must be before it is removed. Builds remove their own when they
+// finish, so older ones were left behind by builds that were killed.
+const StaleTmpAge = 24 * time.Hour
+
+// BuildMetadata describes an image built from the project
+type BuildMetadata struct {
+	Image      string    `json:"image"`
+	CogVersion string    `json:"cog_version"`
+	SourceHash string    `json:"source_hash,omitempty"`
+	BuiltAt    time.Time `json:"built_at"`
+}
+
+func TmpDir(projectDir string) string {
+	return filepath.Join(projectDir, Dir, "tmp")
+}
+
+func DockerfilePath(projectDir, goos, goarch string) string {
+	return filepath.Join(projectDir, Dir, "dockerfiles", goos+"-"+goarch, "Dockerfile")
+}
+
+func WheelDir(projectDir string) string {
+	return filepath.Join(projectDir, Dir, "wheel")
+}
+
+func BuildMetadataPath(projectDir string) string {
+	return filepath.Join(projectDir, Dir, "build.json")
+}
+
+func FileHashesPath(projectDir string) string {
+	return filepath.Join(projectDir, Dir, "file_hashes.json")
+}
+
+// ProvenancePath returns the path the provenance of the last push of imageName is written to. Characters that can't
+// be in filenames are replaced.
+func ProvenancePath(projectDir, imageName string) string {
+	return filepath.Join(projectDir, Dir, "provenance", imageFilename(imageName)+".json")
+}
+
+func imageFilename(imageName string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(imageName)
+}
+
+// WriteFile writes a file in the .cog directory, creating the directories it is in
+func WriteFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func WriteBuildMetadata(projectDir string, metadata BuildMetadata) error {
+	contents, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(BuildMetadataPath(projectDir), append(contents, '\n'))
+}
+
+// ReadBuildMetadata returns the metadata about the last image built from the project, or nil if there isn't any
+func ReadBuildMetadata(projectDir string) (*BuildMetadata, error) {
+	contents, err := os.ReadFile(BuildMetadataPath(projectDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	metadata := &BuildMetadata{}
+	if err := json.Unmarshal(contents, metadata); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", BuildMetadataPath(projectDir), err)
+	}
+	return metadata, nil
+}
+
+// CleanStale removes temporary build directories that are older than maxAge
+func CleanStale(projectDir string, maxAge time.Duration) error {
+	entries, err := os.ReadDir(TmpDir(projectDir))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "build") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) > maxAge {
+			if err := os.RemoveAll(filepath.Join(TmpDir(projectDir), entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
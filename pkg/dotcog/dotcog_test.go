@@ -0,0 +1,45 @@
+package dotcog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanStale(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(TmpDir(dir), "build123")
+	fresh := filepath.Join(TmpDir(dir), "build456")
+	require.NoError(t, os.MkdirAll(stale, 0o755))
+	require.NoError(t, os.MkdirAll(fresh, 0o755))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	require.NoError(t, CleanStale(dir, StaleTmpAge))
+	require.NoDirExists(t, stale)
+	require.DirExists(t, fresh)
+
+	// No .cog directory
+	require.NoError(t, CleanStale(t.TempDir(), StaleTmpAge))
+}
+
+func TestBuildMetadata(t *testing.T) {
+	dir := t.TempDir()
+
+	metadata, err := ReadBuildMetadata(dir)
+	require.NoError(t, err)
+	require.Nil(t, metadata)
+
+	builtAt := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, WriteBuildMetadata(dir, BuildMetadata{Image: "cog-hello", CogVersion: "0.8.0", BuiltAt: builtAt}))
+	metadata, err = ReadBuildMetadata(dir)
+	require.NoError(t, err)
+	require.Equal(t, &BuildMetadata{Image: "cog-hello", CogVersion: "0.8.0", BuiltAt: builtAt}, metadata)
+}
+
+func TestProvenancePath(t *testing.T) {
+	require.Equal(t, filepath.Join("proj", ".cog", "provenance", "r8.im_user_model_latest.json"), ProvenancePath("proj", "r8.im/user/model:latest"))
+}
@@ -4,13 +4,14 @@ import (
 	"time"
 )
 
+// StartupTimeout is how long to wait for a model's setup() to finish, unless it's set with setup_timeout or
+// --setup-timeout
+const StartupTimeout = 5 * time.Minute
+
 var (
 	Version               = "dev"
 	Commit                = ""
 	BuildTime             = "none"
-	Debug                 = false
-	ProfilingEnabled      = false
-	StartupTimeout        = 5 * time.Minute
 	ConfigFilename        = "cog.yaml"
 	ReplicateRegistryHost = "r8.im"
 	ReplicateWebsiteHost  = "replicate.com"
@@ -0,0 +1,44 @@
+package global
+
+import (
+	"context"
+	"time"
+)
+
+// Settings are the options that apply to everything a run of Cog does, like --debug and --timeout. They're passed
+// to what needs them, in a context or as arguments, rather than kept in package variables, so Cog can be used as a
+// library to do several things at once with different settings.
+type Settings struct {
+	Debug bool
+	// LogFormat is "text", or "json" for a JSON object per message
+	LogFormat string
+	// ProjectDir is the directory of the project commands work on. If empty, it is found from the working directory.
+	ProjectDir string
+	// HTTPTimeout limits requests to registries and requests to models other than predictions, like health checks.
+	// If 0, they aren't limited.
+	HTTPTimeout time.Duration
+	// AddressFamily forces containers' ports to be published on "ipv4" or "ipv6" only. If empty, both are used where available.
+	AddressFamily string
+}
+
+// DefaultSettings returns the settings that are used if none are set
+func DefaultSettings() *Settings {
+	return &Settings{LogFormat: "text", HTTPTimeout: 30 * time.Second}
+}
+
+type settingsKey struct{}
+
+// WithSettings returns a copy of ctx that carries settings
+func WithSettings(ctx context.Context, settings *Settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, settings)
+}
+
+// SettingsFromContext returns the settings in ctx, or the default settings if it doesn't have any
+func SettingsFromContext(ctx context.Context) *Settings {
+	if ctx != nil {
+		if settings, ok := ctx.Value(settingsKey{}).(*Settings); ok {
+			return settings
+		}
+	}
+	return DefaultSettings()
+}
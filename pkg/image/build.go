@@ -7,22 +7,75 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/dotcog"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
 const dockerignoreBackupPath = ".dockerignore.cog.bak"
 
+// BuildOptions are the options for building a model's image with Build
+type BuildOptions struct {
+	// Secrets are passed to docker buildx build --secret, in the form id=foo,src=/path/to/file
+	Secrets         []string
+	NoCache         bool
+	SeparateWeights bool
+	ProgressOutput  string
+	Cache           docker.BuildCache
+	// Platforms are the platforms to build the image for, like linux/arm64. If there are several, the image is a
+	// manifest list, which Docker can only load if it uses the containerd image store, so set Push to push it to its
+	// registry as it's built instead.
+	Platforms []string
+	// Push pushes an image built for Platforms to its registry as it's built
+	Push bool
+	// Squash flattens the image into a single layer once it's built
+	Squash bool
+	// RunTests runs the commands in the test section of cog.yaml in the image once it's built. If any of them fail,
+	// the image's name is removed and it isn't pushed.
+	RunTests bool
+	// Builder builds the images, like a docker.DryRunBuilder to do a dry run. If it's nil, they're built with Docker.
+	Builder docker.ImageBuilder
+}
+
 // Build a Cog model from a config
 //
 // This is separated out from docker.Build(), so that can be as close as possible to the behavior of 'docker build'.
-func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache, separateWeights bool, progressOutput string) error {
+func Build(cfg *config.Config, dir, imageName string, options BuildOptions) error {
 	console.Infof("Building Docker image from environment in cog.yaml as %s...", imageName)
 
+	if len(options.Platforms) > 0 && options.SeparateWeights {
+		return fmt.Errorf("--separate-weights can't be used with --platform")
+	}
+	if options.Squash && (options.SeparateWeights || len(options.Platforms) > 0) {
+		return fmt.Errorf("--squash-final can't be used with --separate-weights or --platform")
+	}
+
+	if err := checkLFSPointers(dir); err != nil {
+		return err
+	}
+	secrets := huggingFaceSecrets(cfg, options.Secrets)
+	builder := options.Builder
+	if builder == nil {
+		builder = docker.CLIBuilder{}
+	}
+
+	// Hash the source before building, so the hash is of what went into the image
+	sourceHash, err := SourceHash(dir)
+	if err != nil {
+		console.Warnf("Failed to hash source, so cog predict won't be able to tell if the image is stale: %s", err)
+	}
+	buildHash, err := BuildHash(cfg, dir, options)
+	if err != nil {
+		console.Warnf("%s, so cog build --if-changed will always build the image", err)
+	}
+
 	generator, err := dockerfile.NewGenerator(cfg, dir)
 	if err != nil {
 		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
@@ -32,18 +85,20 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
 		}
 	}()
+	generator.Platforms = options.Platforms
 
-	if separateWeights {
+	var dockerOptions docker.BuildOptions
+	if options.SeparateWeights {
 		weightsDockerfile, runnerDockerfile, dockerignore, err := generator.Generate(imageName)
 		if err != nil {
 			return fmt.Errorf("Failed to generate Dockerfile: %w", err)
 		}
 
-		if err := buildWeightsImage(dir, weightsDockerfile, imageName+"-weights", secrets, noCache, progressOutput); err != nil {
+		if err := buildWeightsImage(builder, dir, weightsDockerfile, imageName+"-weights", secrets, options.NoCache, options.ProgressOutput, options.Cache); err != nil {
 			return fmt.Errorf("Failed to build model weights Docker image: %w", err)
 		}
 
-		if err := buildRunnerImage(dir, runnerDockerfile, dockerignore, imageName, secrets, noCache, progressOutput); err != nil {
+		if err := buildRunnerImage(builder, dir, runnerDockerfile, dockerignore, imageName, secrets, options.NoCache, options.ProgressOutput, options.Cache); err != nil {
 			return fmt.Errorf("Failed to build runner Docker image: %w", err)
 		}
 	} else {
@@ -51,13 +106,43 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		if err != nil {
 			return fmt.Errorf("Failed to generate Dockerfile: %w", err)
 		}
-		if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
+		dockerOptions = docker.BuildOptions{Dir: dir, Dockerfile: dockerfileContents, ImageName: imageName, Secrets: secrets, NoCache: options.NoCache, ProgressOutput: options.ProgressOutput, Cache: cacheFor(options.Cache, imageName)}
+		if len(options.Platforms) > 0 {
+			// Build for one platform and load it into Docker first, so it can be run to get the schema for the labels
+			dockerOptions.Platforms = []string{localPlatform(options.Platforms)}
+		}
+		if err := builder.Build(dockerOptions); err != nil {
 			return fmt.Errorf("Failed to build Docker image: %w", err)
 		}
 	}
 
+	if builder.DryRun() {
+		// There's no image to run to get the schema from
+		return nil
+	}
+
+	if options.RunTests {
+		if err := RunTests(cfg, imageName); err != nil {
+			if rmErr := docker.RemoveImage(imageName); rmErr != nil {
+				console.Warnf("Failed to remove %s: %s", imageName, rmErr)
+			}
+			return err
+		}
+	}
+
+	if options.Squash {
+		spinner := console.StartSpinner("Squashing image into a single layer")
+		err := docker.Squash(imageName)
+		spinner.Stop("")
+		if err != nil {
+			return fmt.Errorf("Failed to squash image: %w", err)
+		}
+	}
+
 	console.Info("Adding labels to image...")
+	spinner := console.StartSpinner("Getting the model's schema")
 	schema, err := GenerateOpenAPISchema(imageName, cfg.Build.GPU)
+	spinner.Stop("")
 	if err != nil {
 		return fmt.Errorf("Failed to get type signature: %w", err)
 	}
@@ -90,6 +175,13 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		labels["org.cogmodel.openapi_schema"] = string(schemaJSON)
 	}
 
+	if sourceHash != "" {
+		labels[SourceHashLabel] = sourceHash
+	}
+	if buildHash != "" {
+		labels[BuildHashLabel] = buildHash
+	}
+
 	if isGitRepo(dir) {
 		if commit, err := gitHead(dir); commit != "" && err == nil {
 			labels["org.opencontainers.image.revision"] = commit
@@ -104,12 +196,38 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		}
 	}
 
-	if err := docker.BuildAddLabelsToImage(imageName, labels); err != nil {
+	if len(options.Platforms) > 0 {
+		// Labels can't be added to an image for another platform, or a manifest list, after it's built, so build it
+		// again for all the platforms with the labels. Everything else is cached from the first build.
+		dockerOptions.Platforms = options.Platforms
+		dockerOptions.Labels = labels
+		dockerOptions.Push = options.Push
+		if len(options.Platforms) > 1 {
+			console.Infof("Building Docker image for %s...", strings.Join(options.Platforms, ", "))
+		}
+		if err := builder.Build(dockerOptions); err != nil {
+			return fmt.Errorf("Failed to build Docker image: %w", err)
+		}
+	} else if err := builder.AddLabels(imageName, labels); err != nil {
 		return fmt.Errorf("Failed to add labels to image: %w", err)
 	}
+
+	if err := writeDotCog(dir, imageName, sourceHash); err != nil {
+		console.Warnf("Failed to write build metadata to %s: %s", dotcog.Dir, err)
+	}
 	return nil
 }
 
+// writeDotCog records the build in the project's .cog directory
+func writeDotCog(dir, imageName, sourceHash string) error {
+	return dotcog.WriteBuildMetadata(dir, dotcog.BuildMetadata{
+		Image:      imageName,
+		CogVersion: global.Version,
+		SourceHash: sourceHash,
+		BuiltAt:    time.Now().UTC(),
+	})
+}
+
 func BuildBase(cfg *config.Config, dir string, progressOutput string) (string, error) {
 	// TODO: better image management so we don't eat up disk space
 	// https://github.com/replicate/cog/issues/80
@@ -129,7 +247,7 @@ func BuildBase(cfg *config.Config, dir string, progressOutput string) (string, e
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate Dockerfile: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, []string{}, false, progressOutput); err != nil {
+	if err := docker.Build(docker.BuildOptions{Dir: dir, Dockerfile: dockerfileContents, ImageName: imageName, Secrets: huggingFaceSecrets(cfg, nil), ProgressOutput: progressOutput}); err != nil {
 		return "", fmt.Errorf("Failed to build Docker image: %w", err)
 	}
 	return imageName, nil
@@ -169,21 +287,42 @@ func gitTag(dir string) (string, error) {
 	return tag, nil
 }
 
-func buildWeightsImage(dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
+// cacheFor returns the cache to build imageName with. Unless it has been set, images that are pushed to a registry
+// use the cache exported inline in the image that was last pushed, so builds on other machines, like CI runners,
+// reuse its layers.
+func cacheFor(cache docker.BuildCache, imageName string) docker.BuildCache {
+	if len(cache.From) == 0 && strings.Contains(imageName, "/") {
+		cache.From = []string{imageName}
+	}
+	return cache
+}
+
+// localPlatform returns the platform to build the image for so it can be run on this machine: the one for its
+// architecture if it's one of platforms, or else the first of them, which Docker runs with emulation
+func localPlatform(platforms []string) string {
+	for _, platform := range platforms {
+		if parts := strings.Split(platform, "/"); len(parts) > 1 && parts[1] == runtime.GOARCH {
+			return platform
+		}
+	}
+	return platforms[0]
+}
+
+func buildWeightsImage(builder docker.ImageBuilder, dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string, cache docker.BuildCache) error {
 	if err := makeDockerignoreForWeightsImage(); err != nil {
 		return fmt.Errorf("Failed to create .dockerignore file: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
+	if err := builder.Build(docker.BuildOptions{Dir: dir, Dockerfile: dockerfileContents, ImageName: imageName, Secrets: secrets, NoCache: noCache, ProgressOutput: progressOutput, Cache: cacheFor(cache, imageName)}); err != nil {
 		return fmt.Errorf("Failed to build Docker image for model weights: %w", err)
 	}
 	return nil
 }
 
-func buildRunnerImage(dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
+func buildRunnerImage(builder docker.ImageBuilder, dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string, cache docker.BuildCache) error {
 	if err := writeDockerignore(dockerignoreContents); err != nil {
 		return fmt.Errorf("Failed to write .dockerignore file with weights included: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
+	if err := builder.Build(docker.BuildOptions{Dir: dir, Dockerfile: dockerfileContents, ImageName: imageName, Secrets: secrets, NoCache: noCache, ProgressOutput: progressOutput, Cache: cacheFor(cache, imageName)}); err != nil {
 		return fmt.Errorf("Failed to build Docker image: %w", err)
 	}
 	if err := restoreDockerignore(); err != nil {
@@ -0,0 +1,130 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dotcog"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// BuildHashLabel is the label on an image that records the hash of everything it was built from, which
+// 'cog build --if-changed' compares to tell whether it needs to be built again
+var BuildHashLabel = global.LabelNamespace + "build_hash"
+
+// cachedFileHash is the hash of a file's contents, which is used again while its size and modification time stay the same
+type cachedFileHash struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+}
+
+// BuildHash returns a hash of everything an image is built from: the contents of the files in the project that end up
+// in it, its configuration, the version of Cog and the options that change what's built. Unlike SourceHash, large
+// files are hashed by their contents, so builds can be skipped when it hasn't changed. The hashes of files are cached in
+// .cog, so they're only read again when their size or modification time changes.
+func BuildHash(cfg *config.Config, dir string, options BuildOptions) (string, error) {
+	cachePath := dotcog.FileHashesPath(dir)
+	cache := map[string]cachedFileHash{}
+	if contents, err := os.ReadFile(cachePath); err == nil {
+		if err := json.Unmarshal(contents, &cache); err != nil {
+			console.Debugf("Ignoring %s: %s", cachePath, err)
+			cache = map[string]cachedFileHash{}
+		}
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "cog %s\x00", global.Version)
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("Failed to convert config to JSON: %w", err)
+	}
+	fmt.Fprintf(hash, "config %s\x00", configJSON)
+	// Only the secrets' names and sources, because their contents are never in the image
+	fmt.Fprintf(hash, "secrets %s\x00", strings.Join(options.Secrets, "\n"))
+	fmt.Fprintf(hash, "separate weights %t\x00", options.SeparateWeights)
+	fmt.Fprintf(hash, "platforms %s\x00", strings.Join(options.Platforms, ","))
+	fmt.Fprintf(hash, "squash %t\x00", options.Squash)
+	if cogPackage := cfg.Build.CogPackage; strings.HasSuffix(cogPackage, ".whl") && !strings.Contains(cogPackage, "://") {
+		// A local wheel is copied into the image from outside the project
+		fileHash, err := hashFile(cogPackage)
+		if err != nil {
+			return "", fmt.Errorf("Failed to hash cog_package: %w", err)
+		}
+		fmt.Fprintf(hash, "cog package %s\x00", fileHash)
+	}
+
+	files := map[string]cachedFileHash{}
+	err = walkSource(dir, func(relPath, path string, info os.FileInfo) error {
+		cached, ok := cache[relPath]
+		if !ok || cached.Size != info.Size() || !cached.ModTime.Equal(info.ModTime()) {
+			fileHash, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			cached = cachedFileHash{Size: info.Size(), ModTime: info.ModTime(), Hash: fileHash}
+		}
+		files[relPath] = cached
+		fmt.Fprintf(hash, "file %s\x00%s\x00", relPath, cached.Hash)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash source: %w", err)
+	}
+
+	if contents, err := json.Marshal(files); err == nil {
+		if err := dotcog.WriteFile(cachePath, contents); err != nil {
+			console.Debugf("Failed to cache file hashes: %s", err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// BuiltBuildHash returns the build hash of imageName, from its label on the image locally or, if it isn't there and
+// its name has a registry or user in it, in the registry. It returns "" if the image doesn't exist, or wasn't built
+// with a build hash.
+func BuiltBuildHash(imageName string) (string, error) {
+	inspect, err := docker.ImageInspect(imageName)
+	switch {
+	case err == nil:
+		if inspect.Config == nil {
+			return "", nil
+		}
+		return inspect.Config.Labels[BuildHashLabel], nil
+	case !errors.Is(err, docker.ErrNoSuchImage):
+		return "", fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	case !strings.Contains(imageName, "/"):
+		return "", nil
+	}
+
+	labels, err := docker.RemoteImageLabels(imageName)
+	if errors.Is(err, docker.ErrNoSuchImage) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("Failed to inspect %s in its registry: %w", imageName, err)
+	}
+	return labels[BuildHashLabel], nil
+}
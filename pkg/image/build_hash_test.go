@@ -0,0 +1,50 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dotcog"
+)
+
+func TestBuildHash(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')\n"), 0o644))
+	weights := filepath.Join(dir, "weights.bin")
+	writeSizedFile(t, weights, sourceHashMaxFileSize+1)
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.11"}}
+
+	hash, err := BuildHash(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.FileExists(t, dotcog.FileHashesPath(dir))
+
+	// The hashes of files are cached, so the cache doesn't change the hash
+	unchanged, err := BuildHash(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.Equal(t, hash, unchanged)
+
+	// Retrained weights of the same size
+	f, err := os.OpenFile(weights, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("retrained"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Chtimes(weights, time.Now(), time.Now().Add(time.Minute)))
+	retrained, err := BuildHash(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.NotEqual(t, hash, retrained)
+
+	withOptions, err := BuildHash(cfg, dir, BuildOptions{SeparateWeights: true})
+	require.NoError(t, err)
+	require.NotEqual(t, retrained, withOptions)
+
+	cfg.Build.CUDA = "12.1"
+	withConfig, err := BuildHash(cfg, dir, BuildOptions{})
+	require.NoError(t, err)
+	require.NotEqual(t, retrained, withConfig)
+}
@@ -0,0 +1,198 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// Change is a difference between two images. Old is empty if it was added, and New is empty if it was removed.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// Diff is what changed between two images built by Cog
+type Diff struct {
+	// Config is the changes to cog.yaml, keyed by paths like build.python_version
+	Config []Change `json:"config"`
+	// PythonPackages is the changes to the versions of the installed Python packages, keyed by package name
+	PythonPackages []Change `json:"python_packages"`
+	// Schema is the changes to the inputs and output of the model, keyed by paths like Input.properties.prompt.type
+	Schema []Change `json:"schema"`
+}
+
+// Empty returns whether the images are the same
+func (d *Diff) Empty() bool {
+	return len(d.Config) == 0 && len(d.PythonPackages) == 0 && len(d.Schema) == 0
+}
+
+// diffSchemas are the components of the OpenAPI schema that are compared, which are what users of the model see
+var diffSchemas = []string{"Input", "Output", "TrainingInput", "TrainingOutput"}
+
+// DiffImages compares the config, installed Python packages and schema of two images built by Cog. The images are
+// run to list their Python packages, and to generate their schemas if they don't have them in their labels.
+func DiffImages(oldImage, newImage string) (*Diff, error) {
+	oldConfig, err := configValues(oldImage)
+	if err != nil {
+		return nil, err
+	}
+	newConfig, err := configValues(newImage)
+	if err != nil {
+		return nil, err
+	}
+	oldPackages, err := PythonPackages(oldImage)
+	if err != nil {
+		return nil, err
+	}
+	newPackages, err := PythonPackages(newImage)
+	if err != nil {
+		return nil, err
+	}
+	oldSchema, err := schemaValues(oldImage)
+	if err != nil {
+		return nil, err
+	}
+	newSchema, err := schemaValues(newImage)
+	if err != nil {
+		return nil, err
+	}
+	return &Diff{
+		Config:         diffValues(oldConfig, newConfig),
+		PythonPackages: diffValues(oldPackages, newPackages),
+		Schema:         diffValues(oldSchema, newSchema),
+	}, nil
+}
+
+// PythonPackages returns the versions of the Python packages installed in an image, keyed by their lowercase names
+func PythonPackages(imageName string) (map[string]string, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	err := docker.RunWithIO(docker.RunOptions{
+		Image: imageName,
+		Args:  []string{"python", "-m", "pip", "list", "--format", "freeze", "--disable-pip-version-check"},
+	}, nil, stdout, stderr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list Python packages in %s: %w\n%s", imageName, err, strings.TrimSpace(stderr.String()))
+	}
+	return parsePipFreeze(stdout.String()), nil
+}
+
+// parsePipFreeze parses the output of pip list --format freeze, which has a line like name==version for each package
+func parsePipFreeze(out string) map[string]string {
+	packages := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		name, version, found := strings.Cut(strings.TrimSpace(scanner.Text()), "==")
+		if !found || name == "" {
+			continue
+		}
+		packages[strings.ToLower(name)] = version
+	}
+	return packages
+}
+
+func configValues(imageName string) (map[string]string, error) {
+	conf, err := GetConfig(imageName)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := flattenJSON(conf, "", values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func schemaValues(imageName string) (map[string]string, error) {
+	schema, err := GetOrGenerateOpenAPISchema(imageName)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, name := range diffSchemas {
+		if ref := schema.Components.Schemas[name]; ref != nil && ref.Value != nil {
+			if err := flattenJSON(ref.Value, name, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// flattenJSON adds the leaves of v, encoded as JSON, to values, keyed by their paths, like build.python_version.
+// Lists of strings, like build.system_packages, are sets whose items are keyed by their values, like
+// build.system_packages[ffmpeg], so adding one to the start of a list doesn't change all the ones after it. Items in
+// other lists are keyed by their index.
+func flattenJSON(v interface{}, prefix string, values map[string]string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	flatten(decoded, prefix, values)
+	return nil
+}
+
+func flatten(v interface{}, prefix string, values map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(value, key, values)
+		}
+	case []interface{}:
+		if isStringList(v) {
+			for _, value := range v {
+				flatten(value, prefix+"["+value.(string)+"]", values)
+			}
+			return
+		}
+		for i, value := range v {
+			flatten(value, prefix+"["+strconv.Itoa(i)+"]", values)
+		}
+	default:
+		data, _ := json.Marshal(v)
+		values[prefix] = string(data)
+	}
+}
+
+func isStringList(list []interface{}) bool {
+	for _, value := range list {
+		if _, ok := value.(string); !ok {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// diffValues returns the keys that have been added, removed or changed, sorted by key
+func diffValues(before, after map[string]string) []Change {
+	changes := []Change{}
+	for key, oldValue := range before {
+		if newValue, ok := after[key]; !ok || newValue != oldValue {
+			changes = append(changes, Change{Key: key, Old: oldValue, New: after[key]})
+		}
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, Change{Key: key, New: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
@@ -0,0 +1,35 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestParsePipFreeze(t *testing.T) {
+	packages := parsePipFreeze("Pillow==10.0.1\ntorch==2.1.0+cu118\n\nnot a package\n")
+	require.Equal(t, map[string]string{"pillow": "10.0.1", "torch": "2.1.0+cu118"}, packages)
+}
+
+func TestDiffConfigs(t *testing.T) {
+	before := map[string]string{}
+	require.NoError(t, flattenJSON(&config.Config{
+		Build:   &config.Build{PythonVersion: "3.10", SystemPackages: []string{"ffmpeg", "libgl1"}},
+		Predict: "predict.py:Predictor",
+	}, "", before))
+	after := map[string]string{}
+	require.NoError(t, flattenJSON(&config.Config{
+		Build:   &config.Build{PythonVersion: "3.11", GPU: true, SystemPackages: []string{"git", "libgl1"}},
+		Predict: "predict.py:Predictor",
+	}, "", after))
+
+	// Only the packages that were added or removed are changes, not the ones that moved in the list
+	require.Equal(t, []Change{
+		{Key: "build.gpu", New: "true"},
+		{Key: "build.python_version", Old: `"3.10"`, New: `"3.11"`},
+		{Key: "build.system_packages[ffmpeg]", Old: `"ffmpeg"`},
+		{Key: "build.system_packages[git]", New: `"git"`},
+	}, diffValues(before, after))
+}
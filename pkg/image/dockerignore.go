@@ -0,0 +1,50 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// dockerignore matches files in a project against the patterns in its .dockerignore, the same way Docker does when
+// it sends the project to be built
+type dockerignore struct {
+	matcher *patternmatcher.PatternMatcher
+}
+
+// readDockerignore reads the project's .dockerignore. If it doesn't have one, nothing is ignored.
+func readDockerignore(dir string) (*dockerignore, error) {
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return &dockerignore{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &dockerignore{matcher: matcher}, nil
+}
+
+// ignores returns whether a file or directory, relative to the project, isn't sent to Docker
+func (d *dockerignore) ignores(relPath string) bool {
+	if d.matcher == nil {
+		return false
+	}
+	matched, err := d.matcher.MatchesOrParentMatches(filepath.ToSlash(relPath))
+	return err == nil && matched
+}
+
+// skipsDir returns whether nothing in a directory, relative to the project, is sent to Docker, so it doesn't need
+// walking. A directory that's ignored can still have files in it that are added back with patterns like !dir/file.
+func (d *dockerignore) skipsDir(relPath string) bool {
+	return d.ignores(relPath) && !d.matcher.Exclusions()
+}
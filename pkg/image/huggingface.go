@@ -0,0 +1,61 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+// huggingFaceSecrets adds the build secret with the token to download the files in huggingface in cog.yaml with to
+// secrets, unless it was passed with --secret. The token is HF_TOKEN, or else the one huggingface-cli login saved, the
+// same as the Hugging Face libraries use. Public repositories don't need one, so if there isn't one, the files are
+// downloaded without it.
+func huggingFaceSecrets(cfg *config.Config, secrets []string) []string {
+	if cfg.HuggingFace == nil {
+		return secrets
+	}
+	for _, secret := range secrets {
+		for _, option := range strings.Split(secret, ",") {
+			if option == "id="+dockerfile.HuggingFaceTokenSecret {
+				return secrets
+			}
+		}
+	}
+	if os.Getenv("HF_TOKEN") != "" {
+		return append(secrets, "id="+dockerfile.HuggingFaceTokenSecret+",env=HF_TOKEN")
+	}
+	if path := huggingFaceTokenPath(); path != "" {
+		return append(secrets, "id="+dockerfile.HuggingFaceTokenSecret+",src="+path)
+	}
+	return secrets
+}
+
+// huggingFaceTokenPath returns the path of the token saved by huggingface-cli login, or an empty string if there isn't
+// one
+func huggingFaceTokenPath() string {
+	path := os.Getenv("HF_TOKEN_PATH")
+	if path == "" {
+		hfHome := os.Getenv("HF_HOME")
+		if hfHome == "" {
+			cacheHome := os.Getenv("XDG_CACHE_HOME")
+			if cacheHome == "" {
+				cacheHome = "~/.cache"
+			}
+			hfHome = filepath.Join(cacheHome, "huggingface")
+		}
+		path = filepath.Join(hfHome, "token")
+	}
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
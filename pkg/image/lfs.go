@@ -0,0 +1,142 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// lfsPointerPrefix is how Git LFS pointer files start. Large files are left as these pointers when a repository is
+// cloned without Git LFS, or before they have been fetched.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+// lfsPointerMaxSize is the largest a pointer can be, which is the limit Git LFS itself uses
+const lfsPointerMaxSize = 1024
+
+// lfsPointersShown is how many pointers are listed in the error about them
+const lfsPointersShown = 10
+
+// FindLFSPointers returns the files that would be built into the image of the project in dir that are Git LFS
+// pointers, rather than the files they point to
+func FindLFSPointers(dir string) ([]string, error) {
+	ignored, err := readDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pointers := []string{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		skip := info.Name() == ".git" || info.Name() == ".cog"
+		if info.IsDir() {
+			if skip || ignored.skipsDir(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip || ignored.ignores(relPath) || !info.Mode().IsRegular() || info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+		isPointer, err := isLFSPointer(path)
+		if err != nil {
+			return err
+		}
+		if isPointer {
+			pointers = append(pointers, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look for Git LFS pointers: %w", err)
+	}
+	return pointers, nil
+}
+
+func isLFSPointer(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	start := make([]byte, len(lfsPointerPrefix))
+	if _, err := io.ReadFull(f, start); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return bytes.Equal(start, []byte(lfsPointerPrefix)), nil
+}
+
+// checkLFSPointers returns an error if there are Git LFS pointers in the project in dir, because they would be built
+// into the image instead of the weights they point to, and the model would fail when it loads them
+func checkLFSPointers(dir string) error {
+	pointers, err := FindLFSPointers(dir)
+	if err != nil {
+		console.Warnf("%s", err)
+		return nil
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	shown := pointers
+	if len(shown) > lfsPointersShown {
+		shown = shown[:lfsPointersShown]
+	}
+	list := "  " + strings.Join(shown, "\n  ")
+	if len(pointers) > len(shown) {
+		list += fmt.Sprintf("\n  ...and %d more", len(pointers)-len(shown))
+	}
+	return fmt.Errorf(`These files are Git LFS pointers, not the files they point to, so the image would be built without them:
+
+%s
+
+Run 'git lfs pull' to download them, or pass --lfs-pull to do it before building. If they shouldn't be in the image,
+add them to .dockerignore.`, list)
+}
+
+// PullLFS downloads the files in the project in dir that are stored in Git LFS, with git lfs pull. If the project is
+// a directory in a larger repository, like a monorepo, only the files in it are downloaded.
+func PullLFS(dir string) error {
+	if err := exec.Command("git", "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("--lfs-pull needs Git LFS, which isn't installed. See https://git-lfs.com for how to install it")
+	}
+	args := []string{"lfs", "pull"}
+	// The path of the project in the repository, like models/my-model/, which is empty at the root
+	prefixCmd := exec.Command("git", "rev-parse", "--show-prefix")
+	prefixCmd.Dir = dir
+	prefix, err := prefixCmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to find the project in its Git repository: %w", err)
+	}
+	if prefix := strings.TrimSpace(string(prefix)); prefix != "" {
+		args = append(args, "--include", prefix+"**")
+	}
+	console.Info("Downloading files stored in Git LFS...")
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output := console.Writer(console.InfoLevel)
+	defer output.Close()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	console.Debug("$ git " + strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to download files stored in Git LFS: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLFSPointer = `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345
+`
+
+func TestFindLFSPointers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "model.safetensors"), []byte(testLFSPointer), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.bin"), []byte(testLFSPointer), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("ignored.bin\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "short"), []byte("v"), 0o644))
+
+	pointers, err := FindLFSPointers(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"weights/model.safetensors"}, pointers)
+
+	err = checkLFSPointers(dir)
+	require.ErrorContains(t, err, "weights/model.safetensors")
+	require.ErrorContains(t, err, "git lfs pull")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "model.safetensors"), []byte("real weights"), 0o644))
+	require.NoError(t, checkLFSPointers(dir))
+}
+
+func TestFindLFSPointersMatchesDockerignoreLikeDocker(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cache/a/b/model.bin", "data/old.bin", "data/model.safetensors"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(testLFSPointer), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("**/*.bin\n./data/\n!data/*.safetensors\n"), 0o644))
+
+	pointers, err := FindLFSPointers(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"data/model.safetensors"}, pointers)
+}
@@ -69,3 +69,42 @@ func GetOpenAPISchema(imageName string) (*openapi3.T, error) {
 	}
 	return openapi3.NewLoader().LoadFromData([]byte(schemaString))
 }
+
+// GetOrGenerateOpenAPISchema returns the schema stored in the image's labels. If the image doesn't have one, it is booted
+// briefly to generate it, and the schema is cached by the image's ID so it doesn't have to be booted again.
+func GetOrGenerateOpenAPISchema(imageName string) (*openapi3.T, error) {
+	if schema, err := GetOpenAPISchema(imageName); err == nil {
+		return schema, nil
+	}
+
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	cached, err := readCachedSchema(inspect.ID)
+	if err != nil {
+		console.Debugf("Failed to read the cached schema of %s: %s", imageName, err)
+	}
+	if cached != nil {
+		console.Debugf("Using the cached schema of %s", imageName)
+		return openapi3.NewLoader().LoadFromData(cached)
+	}
+
+	console.Debugf("Image %s has no schema label, running it to generate the schema", imageName)
+	enableGPU := false
+	if conf, err := GetConfig(imageName); err == nil {
+		enableGPU = conf.Build.GPU
+	}
+	schema, err := GenerateOpenAPISchema(imageName, enableGPU)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate schema for %s: %w", imageName, err)
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCachedSchema(inspect.ID, schemaJSON); err != nil {
+		console.Debugf("Failed to cache the schema of %s: %s", imageName, err)
+	}
+	return openapi3.NewLoader().LoadFromData(schemaJSON)
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// schemaCacheDir returns the directory schemas generated by running images are cached in. They're cached by image ID,
+// which is a digest of the image, so an image without its schema in a label only has to be run once to get it, and a
+// schema is generated again when the image changes.
+func schemaCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cog", "schemas"), nil
+}
+
+func schemaCachePath(imageID string) (string, error) {
+	dir, err := schemaCacheDir()
+	if err != nil {
+		return "", err
+	}
+	// IDs are in the form sha256:<hex>
+	return filepath.Join(dir, strings.ReplaceAll(imageID, ":", "_")+".json"), nil
+}
+
+// readCachedSchema returns the schema cached for the image with ID imageID, or nil if there isn't one
+func readCachedSchema(imageID string) ([]byte, error) {
+	path, err := schemaCachePath(imageID)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return contents, err
+}
+
+// writeCachedSchema caches the schema of the image with ID imageID
+func writeCachedSchema(imageID string, schema []byte) error {
+	path, err := schemaCachePath(imageID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	// Written to a temporary file and renamed, so another cog reading it never sees part of it
+	tmpPath := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmpPath, schema, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
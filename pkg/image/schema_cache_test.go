@@ -0,0 +1,26 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	schema, err := readCachedSchema("sha256:abc")
+	require.NoError(t, err)
+	require.Nil(t, schema)
+
+	require.NoError(t, writeCachedSchema("sha256:abc", []byte(`{"openapi": "3.0.2"}`)))
+	schema, err = readCachedSchema("sha256:abc")
+	require.NoError(t, err)
+	require.Equal(t, `{"openapi": "3.0.2"}`, string(schema))
+
+	// A rebuilt image has a different ID, so its schema isn't cached
+	schema, err = readCachedSchema("sha256:def")
+	require.NoError(t, err)
+	require.Nil(t, schema)
+}
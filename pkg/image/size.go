@@ -0,0 +1,128 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	units "github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// largeEntrySize is the size above which files and directories in a project are worth mentioning in size suggestions
+const largeEntrySize = 100 * 1000 * 1000
+
+// weightsExtensions are the extensions of files that are usually model weights
+var weightsExtensions = map[string]bool{
+	".bin": true, ".ckpt": true, ".gguf": true, ".h5": true, ".msgpack": true, ".onnx": true, ".pb": true,
+	".pkl": true, ".pt": true, ".pth": true, ".safetensors": true, ".tflite": true,
+}
+
+type projectEntry struct {
+	name string
+	size int64
+	// weightsSize is the size of the model weights in it
+	weightsSize int64
+}
+
+// SizeSuggestions returns specific ways to make the image built from the project in dir smaller, based on the large
+// files and directories in it that end up in the image.
+func SizeSuggestions(dir string, separateWeights bool) ([]string, error) {
+	ignored, err := readDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []projectEntry{}
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if name == ".git" || name == ".cog" || ignored.ignores(name) {
+			continue
+		}
+		entry := projectEntry{name: name}
+		err := filepath.Walk(filepath.Join(dir, name), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			entry.size += info.Size()
+			if weightsExtensions[strings.ToLower(filepath.Ext(path))] {
+				entry.weightsSize += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].size > entries[j].size })
+
+	suggestions := []string{}
+	weights := []string{}
+	for _, entry := range entries {
+		if entry.weightsSize >= largeEntrySize {
+			weights = append(weights, fmt.Sprintf("%s (%s)", entry.name, units.HumanSize(float64(entry.size))))
+		} else if entry.size >= largeEntrySize {
+			suggestions = append(suggestions, fmt.Sprintf("%s is %s. If the model doesn't need it to run, add it to .dockerignore.", entry.name, units.HumanSize(float64(entry.size))))
+		}
+	}
+	if len(weights) > 0 {
+		suggestion := fmt.Sprintf("Model weights are copied into the image from %s. Download them in setup(), or mount them when the model runs, and add them to .dockerignore.", strings.Join(weights, ", "))
+		if !separateWeights {
+			suggestion += " If they need to be in the image, build with --separate-weights, so they are in their own layer that doesn't have to be pushed again when only your code changes."
+		}
+		suggestions = append([]string{suggestion}, suggestions...)
+	}
+	return suggestions, nil
+}
+
+// AddedSize returns the size of the layers in imageName on top of the image it was built on, which is what makes
+// one model's image larger than another's, because the base image is the same for every model with the same Python
+// and CUDA versions. If the base image isn't in Docker, or imageName doesn't have its layers, like when it's squashed,
+// it returns the size of the whole image.
+func AddedSize(cfg *config.Config, imageName string) (int64, error) {
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	baseImage, err := dockerfile.BaseImage(cfg)
+	if err != nil {
+		return 0, err
+	}
+	base, err := docker.ImageInspect(baseImage)
+	if err != nil {
+		console.Debugf("Failed to inspect base image %s, so using the size of the whole image: %s", baseImage, err)
+		return inspect.Size, nil
+	}
+	if !hasLayers(inspect.RootFS.Layers, base.RootFS.Layers) {
+		console.Debugf("%s isn't built on the layers of %s, so using the size of the whole image", imageName, baseImage)
+		return inspect.Size, nil
+	}
+	return inspect.Size - base.Size, nil
+}
+
+// hasLayers returns whether layers start with baseLayers
+func hasLayers(layers, baseLayers []string) bool {
+	if len(baseLayers) == 0 || len(layers) < len(baseLayers) {
+		return false
+	}
+	for i, layer := range baseLayers {
+		if layers[i] != layer {
+			return false
+		}
+	}
+	return true
+}
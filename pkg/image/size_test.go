@@ -0,0 +1,48 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeSuggestions(t *testing.T) {
+	dir := t.TempDir()
+	writeSizedFile(t, filepath.Join(dir, "predict.py"), 100)
+	writeSizedFile(t, filepath.Join(dir, "checkpoints", "model.safetensors"), 150*1000*1000)
+	writeSizedFile(t, filepath.Join(dir, "data", "train.csv"), 200*1000*1000)
+	writeSizedFile(t, filepath.Join(dir, "outputs", "sample.png"), 120*1000*1000)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("# generated\n/outputs/\n"), 0o644))
+
+	suggestions, err := SizeSuggestions(dir, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"Model weights are copied into the image from checkpoints (150MB). Download them in setup(), or mount them when the model runs, and add them to .dockerignore. If they need to be in the image, build with --separate-weights, so they are in their own layer that doesn't have to be pushed again when only your code changes.",
+		"data is 200MB. If the model doesn't need it to run, add it to .dockerignore.",
+	}, suggestions)
+
+	suggestions, err = SizeSuggestions(dir, true)
+	require.NoError(t, err)
+	require.Equal(t, "Model weights are copied into the image from checkpoints (150MB). Download them in setup(), or mount them when the model runs, and add them to .dockerignore.", suggestions[0])
+}
+
+// writeSizedFile writes a sparse file of size bytes, so tests don't have to write large files to disk
+func writeSizedFile(t *testing.T, path string, size int64) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+}
+
+func TestHasLayers(t *testing.T) {
+	require.True(t, hasLayers([]string{"a", "b", "c"}, []string{"a", "b"}))
+	require.True(t, hasLayers([]string{"a", "b"}, []string{"a", "b"}))
+	// Squashed
+	require.False(t, hasLayers([]string{"d"}, []string{"a", "b"}))
+	require.False(t, hasLayers([]string{"a", "c"}, []string{"a", "b"}))
+	require.False(t, hasLayers([]string{"a"}, []string{}))
+}
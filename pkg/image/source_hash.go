@@ -0,0 +1,97 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// SourceHashLabel is the label on an image that records the hash of the source it was built from
+var SourceHashLabel = global.LabelNamespace + "source_hash"
+
+// sourceHashMaxFileSize is the size above which files are hashed by their size rather than their contents, so large
+// model weights don't make hashing slow
+const sourceHashMaxFileSize = 10 * 1000 * 1000
+
+// SourceHash returns a hash of the files in a project that end up in its image, so it can be told whether an image was
+// built from the code that is in the project now. Large files are hashed by their size, so it's only a heuristic. Use
+// BuildHash to tell for certain.
+func SourceHash(dir string) (string, error) {
+	hash := sha256.New()
+	err := walkSource(dir, func(relPath, path string, info os.FileInfo) error {
+		fmt.Fprintf(hash, "%s\x00", relPath)
+		if info.Size() > sourceHashMaxFileSize {
+			fmt.Fprintf(hash, "%d\x00", info.Size())
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(hash, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash source: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// walkSource calls fn for each file in the project in dir that ends up in its image, in lexical order, with its path
+// relative to dir with forward slashes
+func walkSource(dir string, fn func(relPath, path string, info os.FileInfo) error) error {
+	ignored, err := readDockerignore(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		name := info.Name()
+		// Python writes bytecode into the project when the model runs, which doesn't change its source
+		skip := name == ".git" || name == ".cog" || name == "__pycache__" || strings.HasSuffix(name, ".pyc")
+		if info.IsDir() {
+			if skip || ignored.skipsDir(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip || ignored.ignores(relPath) || !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(filepath.ToSlash(relPath), path, info)
+	})
+}
+
+// IsStale returns whether the project in dir has changed since imageName was built from it. Images that weren't built
+// with a source hash are never stale.
+func IsStale(imageName, dir string) (bool, error) {
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return false, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	if inspect.Config == nil || inspect.Config.Labels[SourceHashLabel] == "" {
+		return false, nil
+	}
+	hash, err := SourceHash(dir)
+	if err != nil {
+		return false, err
+	}
+	return hash != inspect.Config.Labels[SourceHashLabel], nil
+}
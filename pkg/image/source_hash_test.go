@@ -0,0 +1,31 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceHash(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("predict: predict.py:Predictor\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("outputs\n"), 0o644))
+
+	hash, err := SourceHash(dir)
+	require.NoError(t, err)
+
+	// Bytecode and ignored files don't change the hash
+	writeSizedFile(t, filepath.Join(dir, "__pycache__", "predict.cpython-311.pyc"), 100)
+	writeSizedFile(t, filepath.Join(dir, "outputs", "output.png"), 100)
+	unchanged, err := SourceHash(dir)
+	require.NoError(t, err)
+	require.Equal(t, hash, unchanged)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('goodbye')\n"), 0o644))
+	changed, err := SourceHash(dir)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, changed)
+}
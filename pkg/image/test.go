@@ -0,0 +1,36 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// RunTests runs each of the commands in the test section of cog.yaml in a container of the image, and returns an
+// error for the first one that fails
+func RunTests(cfg *config.Config, imageName string) error {
+	for _, command := range cfg.Test {
+		console.Infof("Running test: %s", command)
+		options := docker.RunOptions{
+			Args:  []string{"sh", "-c", command},
+			Image: imageName,
+		}
+		if cfg.Build.GPU {
+			options.GPUs = "all"
+		}
+		output := console.Writer(console.InfoLevel)
+		err := docker.RunWithIO(options, nil, output, output)
+		if options.GPUs != "" && err == docker.ErrMissingDeviceDriver {
+			console.Warn("Missing device driver, running the tests without GPU")
+			options.GPUs = ""
+			err = docker.RunWithIO(options, nil, output, output)
+		}
+		output.Close()
+		if err != nil {
+			return fmt.Errorf("Test failed: %s: %w", command, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Package modelcard generates Hugging Face model cards for Cog models from their OpenAPI schema
+package modelcard
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/schema"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+//go:embed modelcard.md.tmpl
+var cardTemplate string
+
+// Model is what a model card describes, besides the model's schema
+type Model struct {
+	// Image is the name of the image the model was pushed as, like r8.im/user/model
+	Image string
+	// BaseModel is the ID of the repository on the Hugging Face Hub that the model's weights are from, if they are
+	BaseModel string
+}
+
+// Input is a row in the table of inputs
+type Input struct {
+	Name        string
+	Type        string
+	Default     string
+	Required    bool
+	Description string
+}
+
+type templateData struct {
+	Model
+	Name       string
+	Inputs     []Input
+	Required   []string
+	OutputType string
+}
+
+// Generate returns a model card in Markdown, with the metadata the Hugging Face Hub reads at the top, for the model
+// described by s
+func Generate(s *openapi3.T, model Model) (string, error) {
+	data := templateData{
+		Model:      model,
+		Name:       name(model.Image),
+		Inputs:     []Input{},
+		Required:   []string{},
+		OutputType: schema.TypeName(schema.Output(s)),
+	}
+	if input := schema.Input(s); input != nil {
+		for _, name := range schema.InputNames(s) {
+			prop := schema.Resolve(input.Properties[name])
+			row := Input{
+				Name:     name,
+				Type:     schema.TypeName(prop),
+				Required: slices.ContainsString(input.Required, name),
+			}
+			if prop == nil {
+				prop = &openapi3.Schema{}
+			}
+			row.Description = tableCell(prop.Description)
+			if prop.Default != nil {
+				value, err := json.Marshal(prop.Default)
+				if err != nil {
+					return "", fmt.Errorf("Failed to encode the default of %s: %w", name, err)
+				}
+				row.Default = tableCell(string(value))
+			}
+			data.Inputs = append(data.Inputs, row)
+			if row.Required {
+				data.Required = append(data.Required, name)
+			}
+		}
+	}
+
+	tmpl, err := template.New("modelcard").Parse(cardTemplate)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("Failed to generate model card: %w", err)
+	}
+	return out.String(), nil
+}
+
+// name returns the name of the model from its image, like model for r8.im/user/model:latest
+func name(image string) string {
+	name := path.Base(image)
+	if i := strings.LastIndex(name, ":"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// tableCell escapes s so it can go in a cell of a Markdown table
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,56 @@
+package modelcard
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func testSchema(t *testing.T) *openapi3.T {
+	s, err := openapi3.NewLoader().LoadFromData([]byte(`{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {"schemas": {
+    "Input": {
+      "type": "object",
+      "properties": {
+        "steps": {"type": "integer", "default": 4, "description": "Number of | denoising\nsteps", "x-order": 1},
+        "prompt": {"type": "string", "description": "Text prompt", "x-order": 0}
+      },
+      "required": ["prompt"]
+    },
+    "Output": {"type": "string", "format": "uri"}
+  }}
+}`))
+	require.NoError(t, err)
+	return s
+}
+
+func TestGenerate(t *testing.T) {
+	card, err := Generate(testSchema(t), Model{Image: "r8.im/hooli/sdxl-turbo:latest", BaseModel: "stabilityai/sdxl-turbo"})
+	require.NoError(t, err)
+	require.Contains(t, card, "---\nlibrary_name: cog\ntags:\n- cog\nbase_model: stabilityai/sdxl-turbo\n---\n\n# sdxl-turbo\n")
+	require.Contains(t, card, "$ cog predict r8.im/hooli/sdxl-turbo:latest -i prompt=...\n")
+	require.Contains(t, card, `-d '{"input": {"prompt": ...}}'`)
+	require.Contains(t, card, "| `prompt` | string | *required* | Text prompt |\n| `steps` | integer | `4` | Number of \\| denoising steps |\n")
+	require.Contains(t, card, "## Output\n\nstring (uri)\n")
+}
+
+func TestGenerateWithoutBaseModel(t *testing.T) {
+	card, err := Generate(testSchema(t), Model{Image: "hotdog-detector"})
+	require.NoError(t, err)
+	require.NotContains(t, card, "base_model")
+	require.NotContains(t, card, "huggingface.co")
+	require.Contains(t, card, "# hotdog-detector\n")
+}
+
+func TestGenerateInputWithoutSchema(t *testing.T) {
+	input := openapi3.NewObjectSchema()
+	input.Properties["anything"] = nil
+	s := &openapi3.T{Components: &openapi3.Components{Schemas: openapi3.Schemas{"Input": openapi3.NewSchemaRef("", input)}}}
+	card, err := Generate(s, Model{Image: "hotdog-detector"})
+	require.NoError(t, err)
+	require.Contains(t, card, "| `anything` | any |")
+}
@@ -0,0 +1,133 @@
+package predict
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ErrUnauthorized is returned when a model rejects the credentials a request was sent with, or needs some
+var ErrUnauthorized = errors.New("401 Unauthorized")
+
+// Auth is the credentials for a model served behind something that authenticates requests, like a staging
+// deployment's gateway
+type Auth struct {
+	// Token is sent as a bearer token
+	Token string
+	// TokenCommand is a shell command that prints a bearer token, like 'gcloud auth print-identity-token'. It's used if
+	// Token isn't set, and is run again to refresh the token when the model responds with 401 Unauthorized.
+	TokenCommand string
+	// Username and Password are sent with basic auth, if there's no token
+	Username string
+	Password string
+
+	mu sync.Mutex
+	// commandToken is the last token TokenCommand printed
+	commandToken string
+}
+
+// authorize adds the credentials to req
+func (a *Auth) authorize(req *http.Request) error {
+	token, err := a.token(false)
+	if err != nil {
+		return err
+	}
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case a.Username != "" || a.Password != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return nil
+}
+
+// token returns the bearer token to send, if there is one. If refresh is set, TokenCommand is run again even if it has
+// already printed a token.
+func (a *Auth) token(refresh bool) (string, error) {
+	if a.Token != "" || a.TokenCommand == "" {
+		return a.Token, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.commandToken != "" && !refresh {
+		return a.commandToken, nil
+	}
+	cmd := exec.Command("sh", "-c", a.TokenCommand)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to run token command '%s': %w", a.TokenCommand, err)
+	}
+	a.commandToken = strings.TrimSpace(string(out))
+	if a.commandToken == "" {
+		return "", fmt.Errorf("Token command '%s' didn't print a token", a.TokenCommand)
+	}
+	return a.commandToken, nil
+}
+
+// canRefresh returns whether a new token can be got when the current one is rejected
+func (a *Auth) canRefresh() bool {
+	return a.Token == "" && a.TokenCommand != ""
+}
+
+// authTransport adds credentials to requests to the model. If a request is rejected with 401 Unauthorized, the token
+// is refreshed and the request sent again, if that's possible. Otherwise, ErrUnauthorized is returned.
+type authTransport struct {
+	base http.RoundTripper
+	auth *Auth
+	// host is the host and port of the model. Requests to other hosts, like redirects to where a file is stored, are
+	// sent without the credentials.
+	host string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrip mustn't change the request it's given
+	authorized := req.Clone(req.Context())
+	if err := t.auth.authorize(authorized); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(authorized)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body has been sent, so the request can only be sent again if there's a way to get it again
+	if t.auth.canRefresh() && (req.Body == nil || req.GetBody != nil) {
+		resp.Body.Close()
+		if _, err := t.auth.token(true); err != nil {
+			return nil, err
+		}
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.auth.authorize(retry); err != nil {
+			return nil, err
+		}
+		if resp, err = t.base.RoundTrip(retry); err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+	}
+	return nil, unauthorizedError(resp)
+}
+
+// unauthorizedError returns ErrUnauthorized with the reason the model gave, if it gave one
+func unauthorizedError(resp *http.Response) error {
+	defer resp.Body.Close()
+	// Gateways usually explain in a line or two, but don't read a whole HTML error page
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if reason := strings.TrimSpace(string(body)); reason != "" && !strings.HasPrefix(reason, "<") {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, reason)
+	}
+	return ErrUnauthorized
+}
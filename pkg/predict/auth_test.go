@@ -0,0 +1,101 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"status": "succeeded", "output": "hello"}`))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	predictor.SetAuth(&Auth{Token: "abc"})
+	_, err := predictor.Predict(context.Background(), Inputs{})
+	require.NoError(t, err)
+	require.Equal(t, "Bearer abc", authorization)
+
+	predictor.SetAuth(&Auth{Username: "user", Password: "secret"})
+	_, err = predictor.Predict(context.Background(), Inputs{})
+	require.NoError(t, err)
+	require.Equal(t, "Basic dXNlcjpzZWNyZXQ=", authorization)
+}
+
+func TestAuthRefreshesTokenOn401(t *testing.T) {
+	// The token command prints a new token each time it's run
+	counter := filepath.Join(t.TempDir(), "counter")
+	tokenCommand := "echo -n x >> " + counter + " && cat " + counter
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer xx" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		request := Request{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		_, _ = w.Write([]byte(`{"status": "succeeded", "output": "hello"}`))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	predictor.SetAuth(&Auth{TokenCommand: tokenCommand})
+	prediction, err := predictor.Predict(context.Background(), Inputs{})
+	require.NoError(t, err)
+	require.Equal(t, "succeeded", string(prediction.Status))
+	require.Equal(t, 2, requests)
+
+	token, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	require.Equal(t, "xx", string(token))
+}
+
+func TestAuthUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("token expired"))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	predictor.SetAuth(&Auth{Token: "abc"})
+	_, err := predictor.Predict(context.Background(), Inputs{})
+	require.ErrorIs(t, err, ErrUnauthorized)
+	require.ErrorContains(t, err, "token expired")
+
+	_, err = predictor.GetSchema()
+	require.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAuthIsOnlySentToModel(t *testing.T) {
+	var redirectedAuthorization string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectedAuthorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer storage.Close()
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		http.Redirect(w, r, storage.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	predictor.SetAuth(&Auth{Token: "abc"})
+	_, _ = predictor.GetSchema()
+	require.Equal(t, "Bearer abc", authorization)
+	require.Empty(t, redirectedAuthorization)
+}
@@ -0,0 +1,295 @@
+package predict
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// batchSyncInterval is how often the results of a batch are synced to disk. If cog crashes, the results since then
+// are run again when the batch is resumed.
+const batchSyncInterval = 5 * time.Second
+
+// BatchWriter writes the results of a batch of predictions to a file as JSONL, one line per result, as they finish.
+// Alongside it is a cursor file that records how many results have been synced to disk, so a batch that was stopped
+// part of the way through can be resumed without running those predictions again. The cursor is removed when the batch
+// finishes.
+type BatchWriter struct {
+	path       string
+	cursorPath string
+	file       *os.File
+	buf        *bufio.Writer
+
+	// completed is the number of results that have been written and size is the size of the file after them. synced
+	// is what they were when the results were last synced.
+	completed int
+	size      int64
+	synced    batchCursor
+	syncedAt  time.Time
+
+	// pending are encoded results that were passed to WriteAt before the ones in front of them, by index
+	pending map[int][]byte
+}
+
+// batchCursor is what's in the cursor file of a batch
+type batchCursor struct {
+	// Completed is how many results have been written
+	Completed int `json:"completed"`
+	// Size is the size of the results file after they were written. Anything after it is from results that hadn't
+	// been synced, and is removed when the batch is resumed.
+	Size int64 `json:"size"`
+}
+
+// OpenBatchWriter opens path to write the results of a batch to. If resume is set, it continues a batch that didn't
+// finish, and Completed returns how many results it already has.
+func OpenBatchWriter(path string, resume bool) (*BatchWriter, error) {
+	w := &BatchWriter{path: path, cursorPath: path + ".cursor", syncedAt: time.Now(), pending: map[int][]byte{}}
+
+	contents, err := os.ReadFile(w.cursorPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if resume {
+			return nil, fmt.Errorf("There is no batch to resume, because %s doesn't exist. The batch has either finished, or hasn't been started", w.cursorPath)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("Failed to read %s: %w", w.cursorPath, err)
+	case !resume:
+		return nil, fmt.Errorf("%s is from a batch that didn't finish. Pass --resume to continue it, or delete %s to start again", path, w.cursorPath)
+	default:
+		if err := json.Unmarshal(contents, &w.synced); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", w.cursorPath, err)
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	if w.file, err = os.OpenFile(path, flags, 0o644); err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	if resume {
+		// Remove the results that were written after the last sync, which may have only been partly written
+		if err := w.file.Truncate(w.synced.Size); err != nil {
+			w.file.Close()
+			return nil, fmt.Errorf("Failed to truncate %s: %w", path, err)
+		}
+		if _, err := w.file.Seek(w.synced.Size, io.SeekStart); err != nil {
+			w.file.Close()
+			return nil, err
+		}
+	}
+	w.buf = bufio.NewWriter(w.file)
+	w.completed, w.size = w.synced.Completed, w.synced.Size
+
+	// Write the cursor straight away, so the batch can be resumed if it's stopped before the first sync
+	if err := w.Sync(); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Completed returns how many results have been written, including ones from before the batch was resumed
+func (w *BatchWriter) Completed() int {
+	return w.completed
+}
+
+// Pending returns the indexes of the results that were passed to WriteAt, but are waiting for the ones in front of
+// them to be written
+func (w *BatchWriter) Pending() []int {
+	indexes := []int{}
+	for index := range w.pending {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Write writes a result as a line of JSON after the ones already written. It's synced to disk every
+// batchSyncInterval.
+func (w *BatchWriter) Write(result interface{}) error {
+	return w.WriteAt(w.completed, result)
+}
+
+// WriteAt writes the result of the index'th prediction of the batch, counting from 0. Results can be passed in any
+// order, like when predictions run concurrently, but they're written in order: a result is held until the ones in
+// front of it have been written, so the cursor only ever counts results that are all in the file.
+func (w *BatchWriter) WriteAt(index int, result interface{}) error {
+	if _, ok := w.pending[index]; ok || index < w.completed {
+		return fmt.Errorf("The result of prediction %d has already been written", index)
+	}
+	line, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Failed to encode result as JSON: %w", err)
+	}
+	w.pending[index] = append(line, '\n')
+
+	for {
+		line, ok := w.pending[w.completed]
+		if !ok {
+			break
+		}
+		delete(w.pending, w.completed)
+		if _, err := w.buf.Write(line); err != nil {
+			return fmt.Errorf("Failed to write to %s: %w", w.path, err)
+		}
+		w.completed++
+		w.size += int64(len(line))
+	}
+
+	if time.Since(w.syncedAt) >= batchSyncInterval {
+		return w.Sync()
+	}
+	return nil
+}
+
+// Sync writes the results to disk and records them in the cursor, so they're kept if the batch is resumed
+func (w *BatchWriter) Sync() error {
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("Failed to write to %s: %w", w.path, err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("Failed to sync %s: %w", w.path, err)
+	}
+
+	cursor := batchCursor{Completed: w.completed, Size: w.size}
+	contents, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file and renamed, so a crash never leaves a partly written cursor
+	tmpPath := w.cursorPath + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", w.cursorPath, err)
+	}
+	if err := os.Rename(tmpPath, w.cursorPath); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", w.cursorPath, err)
+	}
+	w.synced = cursor
+	w.syncedAt = time.Now()
+	return nil
+}
+
+// Close syncs the results and closes the file, keeping the cursor so the batch can be resumed
+func (w *BatchWriter) Close() error {
+	err := w.Sync()
+	if closeErr := w.file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Failed to close %s: %w", w.path, closeErr)
+	}
+	return err
+}
+
+// Finish syncs the results, closes the file and removes the cursor, because there's nothing left to resume
+func (w *BatchWriter) Finish() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(w.cursorPath); err != nil {
+		return fmt.Errorf("Failed to remove %s: %w", w.cursorPath, err)
+	}
+	return nil
+}
+
+// ReadBatchInputs calls fn with the inputs of each prediction in a batch, in order. path is either a JSONL file with a
+// JSON object of inputs on each line, or, if it ends in .csv, a CSV file with a header row of input names. Blank
+// lines are skipped, and so are empty CSV cells, so the model's default is used for them. If a record isn't valid, fn
+// is called with why instead, so the batch can carry on without it. If fn returns an error, reading stops and it's
+// returned.
+func ReadBatchInputs(path string, fn func(input map[string]interface{}, err error) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = readCSVInputs(f, fn)
+	} else {
+		err = readJSONLInputs(f, fn)
+	}
+	var readErr *batchReadError
+	if errors.As(err, &readErr) {
+		return fmt.Errorf("Failed to read %s: %w", path, readErr.err)
+	}
+	return err
+}
+
+// batchReadError is an error reading a file of inputs, as opposed to one returned by the callback
+type batchReadError struct {
+	err error
+}
+
+func (e *batchReadError) Error() string {
+	return e.err.Error()
+}
+
+func readJSONLInputs(r io.Reader, fn func(input map[string]interface{}, err error) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return &batchReadError{readErr}
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var input map[string]interface{}
+			var err error
+			if jsonErr := json.Unmarshal(line, &input); jsonErr != nil {
+				err = fmt.Errorf("The line isn't a JSON object of inputs: %w", jsonErr)
+			}
+			if err := fn(input, err); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+func readCSVInputs(r io.Reader, fn func(input map[string]interface{}, err error) error) error {
+	reader := csv.NewReader(r)
+	// Rows with the wrong number of fields are failed predictions, rather than stopping the batch
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return &batchReadError{err}
+	}
+	// Spreadsheets often save CSV files with a byte order mark at the start
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &batchReadError{err}
+		}
+		if len(row) != len(header) {
+			err = fmt.Errorf("The row has %d fields, but the header has %d", len(row), len(header))
+			if err := fn(nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		input := map[string]interface{}{}
+		for i, value := range row {
+			if value != "" {
+				input[header[i]] = value
+			}
+		}
+		if err := fn(input, nil); err != nil {
+			return err
+		}
+	}
+}
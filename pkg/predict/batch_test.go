@@ -0,0 +1,105 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+
+	w, err := OpenBatchWriter(path, false)
+	require.NoError(t, err)
+	require.Equal(t, 0, w.Completed())
+	require.NoError(t, w.Write(map[string]int{"index": 0}))
+	require.NoError(t, w.Sync())
+	// Not synced, so it's lost when the batch is resumed
+	require.NoError(t, w.Write(map[string]int{"index": 1}))
+	require.NoError(t, w.buf.Flush())
+
+	// It didn't finish, so it can't be started again without --resume
+	_, err = OpenBatchWriter(path, false)
+	require.ErrorContains(t, err, "Pass --resume")
+
+	w, err = OpenBatchWriter(path, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, w.Completed())
+	require.NoError(t, w.Write(map[string]int{"index": 1}))
+	require.NoError(t, w.Write(map[string]int{"index": 2}))
+	require.NoError(t, w.Finish())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"index\":0}\n{\"index\":1}\n{\"index\":2}\n", string(contents))
+	require.NoFileExists(t, path+".cursor")
+
+	// It finished, so there's nothing to resume
+	_, err = OpenBatchWriter(path, true)
+	require.ErrorContains(t, err, "There is no batch to resume")
+}
+
+func TestBatchWriterWriteAtInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+
+	w, err := OpenBatchWriter(path, false)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteAt(2, map[string]int{"index": 2}))
+	require.NoError(t, w.WriteAt(1, map[string]int{"index": 1}))
+	// They're held until the first one is written
+	require.Equal(t, 0, w.Completed())
+	require.Equal(t, []int{1, 2}, w.Pending())
+	require.NoError(t, w.WriteAt(0, map[string]int{"index": 0}))
+	require.Equal(t, 3, w.Completed())
+	require.Equal(t, []int{}, w.Pending())
+	require.ErrorContains(t, w.WriteAt(1, map[string]int{"index": 1}), "has already been written")
+	require.NoError(t, w.Finish())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"index\":0}\n{\"index\":1}\n{\"index\":2}\n", string(contents))
+}
+
+type batchInput struct {
+	input map[string]interface{}
+	err   string
+}
+
+func readBatchInputs(t *testing.T, name, contents string) []batchInput {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	inputs := []batchInput{}
+	require.NoError(t, ReadBatchInputs(path, func(input map[string]interface{}, err error) error {
+		record := batchInput{input: input}
+		if err != nil {
+			record.err = err.Error()
+		}
+		inputs = append(inputs, record)
+		return nil
+	}))
+	return inputs
+}
+
+func TestReadBatchInputsJSONL(t *testing.T) {
+	inputs := readBatchInputs(t, "inputs.jsonl", "{\"prompt\": \"a cat\", \"steps\": 4}\n\n[1, 2]\n{\"image\": \"@cat.jpg\"}")
+	require.Len(t, inputs, 3)
+	require.Equal(t, map[string]interface{}{"prompt": "a cat", "steps": float64(4)}, inputs[0].input)
+	require.Contains(t, inputs[1].err, "The line isn't a JSON object of inputs")
+	require.Equal(t, map[string]interface{}{"image": "@cat.jpg"}, inputs[2].input)
+}
+
+func TestReadBatchInputsCSV(t *testing.T) {
+	inputs := readBatchInputs(t, "inputs.csv", "\ufeffprompt,steps\n\"a cat, sitting\",4\na dog,\n\nonly one field\n")
+	require.Len(t, inputs, 3)
+	require.Equal(t, map[string]interface{}{"prompt": "a cat, sitting", "steps": "4"}, inputs[0].input)
+	// Empty cells are left out, so the model's default is used
+	require.Equal(t, map[string]interface{}{"prompt": "a dog"}, inputs[1].input)
+	require.Equal(t, "The row has 1 fields, but the header has 2", inputs[2].err)
+
+	path := filepath.Join(t.TempDir(), "bad.csv")
+	require.NoError(t, os.WriteFile(path, []byte("prompt\n\"a cat\n"), 0o644))
+	err := ReadBatchInputs(path, func(input map[string]interface{}, err error) error { return nil })
+	require.ErrorContains(t, err, "Failed to read "+path)
+}
@@ -0,0 +1,69 @@
+package predict
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/httpclient"
+)
+
+// idleConnTimeout is shorter than the 5 second keep-alive timeout of the model's server, so connections aren't
+// reused just as the server closes them
+const idleConnTimeout = 4 * time.Second
+
+// sharedTransport is used by all predictors, so connections to the model are reused between predictions, health
+// checks and polls. HTTP/2 is used for models served over HTTPS that support it.
+var sharedTransport = httpclient.WithUserAgent(newTransport())
+
+func newTransport() *http.Transport {
+	transport := httpclient.NewTransport()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 100
+	transport.IdleConnTimeout = idleConnTimeout
+	return transport
+}
+
+// SetHTTPClient replaces the client used to run predictions, e.g. to change its timeouts. Other requests to the model
+// still use the shared transport.
+func (p *Predictor) SetHTTPClient(client *http.Client) {
+	p.client = client
+}
+
+// SetAuth sets the credentials that requests to the model are sent with, for models served behind something that
+// authenticates requests
+func (p *Predictor) SetAuth(auth *Auth) {
+	p.auth = auth
+}
+
+// SetRequestTimeout limits requests to the model that should return quickly, like health checks and fetching the
+// schema. Predictions aren't limited by it. If d is 0, they aren't limited.
+func (p *Predictor) SetRequestTimeout(d time.Duration) {
+	p.requestTimeout = d
+}
+
+// predictionClient returns the client for running predictions, which aren't limited by requestTimeout
+func (p *Predictor) predictionClient() *http.Client {
+	if p.client != nil {
+		return p.client
+	}
+	return &http.Client{Transport: p.transport()}
+}
+
+// requestClient returns the client for requests that should return quickly
+func (p *Predictor) requestClient() *http.Client {
+	return &http.Client{Transport: p.transport(), Timeout: p.requestTimeout}
+}
+
+// transport returns the transport for requests to the model, which adds its credentials to them if it has any
+func (p *Predictor) transport() http.RoundTripper {
+	if p.auth == nil {
+		return sharedTransport
+	}
+	host := ""
+	if u, err := url.Parse(p.baseURL); err == nil {
+		host = u.Host
+	}
+	return &authTransport{base: sharedTransport, auth: p.auth, host: host}
+}
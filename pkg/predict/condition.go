@@ -0,0 +1,265 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition is a check on the result of a prediction, like output.score < 0.5. It's one of:
+//
+//   - error, which matches predictions that didn't succeed
+//   - a path, like output.nsfw, which matches if the value there is truthy: not false, null, 0 or empty
+//   - a path, an operator (==, !=, <, <=, >, >=) and a value, which is a number, true, false, null or a string, which
+//     can be quoted with ' or "
+//
+// Paths start with a field of the prediction, like output, status, error, logs or metrics, followed by .name for
+// fields of objects and [i] for items of arrays, like output[0].label.
+type Condition struct {
+	source string
+	// isError is set for the error condition
+	isError bool
+	path    []pathElement
+	op      string
+	value   interface{}
+}
+
+// pathElement is a field of an object if key is set, or else an item of an array
+type pathElement struct {
+	key   string
+	index int
+}
+
+// conditionOps are the comparison operators, with the ones that are prefixes of others after them
+var conditionOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+var pathElementRegexp = regexp.MustCompile(`^(?:\.?([A-Za-z_][A-Za-z0-9_-]*)|\[(\d+)\])`)
+
+// ParseCondition parses a condition, like output.score < 0.5
+func ParseCondition(s string) (*Condition, error) {
+	c := &Condition{source: strings.TrimSpace(s)}
+	if c.source == "error" {
+		c.isError = true
+		return c, nil
+	}
+
+	pathString, valueString := c.source, ""
+	if i, op := findOp(c.source); i >= 0 {
+		c.op = op
+		pathString, valueString = strings.TrimSpace(c.source[:i]), strings.TrimSpace(c.source[i+len(op):])
+		if valueString == "" {
+			return nil, fmt.Errorf("Invalid condition %q: there's no value after %s", s, op)
+		}
+		c.value = parseConditionValue(valueString)
+	}
+
+	path, err := parsePath(pathString)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid condition %q: %w", s, err)
+	}
+	c.path = path
+	return c, nil
+}
+
+// String returns the condition as it was written
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Matches returns whether a prediction matches the condition, along with a description of the value that was checked.
+// It returns an error if the path isn't in the prediction, or the value can't be compared.
+func (c *Condition) Matches(prediction *Response) (bool, string, error) {
+	if c.isError {
+		return prediction.Status != "succeeded", "the status is " + string(prediction.Status), nil
+	}
+
+	data, err := json.Marshal(prediction)
+	if err != nil {
+		return false, "", err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return false, "", err
+	}
+	for _, element := range c.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if element.key == "" {
+				return false, "", fmt.Errorf("%s: can't get item %d of an object", c.source, element.index)
+			}
+			child, ok := v[element.key]
+			if !ok {
+				return false, "", fmt.Errorf("%s: there's no field %q", c.source, element.key)
+			}
+			value = child
+		case []interface{}:
+			if element.key != "" {
+				return false, "", fmt.Errorf("%s: can't get field %q of an array", c.source, element.key)
+			}
+			if element.index >= len(v) {
+				return false, "", fmt.Errorf("%s: there's no item %d, because there are only %d", c.source, element.index, len(v))
+			}
+			value = v[element.index]
+		default:
+			return false, "", fmt.Errorf("%s: can't get a field or item of %s", c.source, describeValue(value))
+		}
+	}
+
+	description := fmt.Sprintf("%s is %s", pathString(c.path), describeValue(value))
+	if c.op == "" {
+		return truthy(value), description, nil
+	}
+	matches, err := compare(value, c.op, c.value)
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", c.source, err)
+	}
+	return matches, description, nil
+}
+
+// findOp returns the index and operator of the first comparison operator in s, or -1
+func findOp(s string) (int, string) {
+	for i := range s {
+		for _, op := range conditionOps {
+			if strings.HasPrefix(s[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parsePath(s string) ([]pathElement, error) {
+	if s == "" {
+		return nil, fmt.Errorf("there's no path, like output.score")
+	}
+	path := []pathElement{}
+	rest := s
+	for rest != "" {
+		m := pathElementRegexp.FindStringSubmatch(rest)
+		// Paths start with a field name without a dot, and other field names have one
+		if m == nil || (m[1] != "" && strings.HasPrefix(m[0], ".") != (len(path) > 0)) || (m[1] == "" && len(path) == 0) {
+			return nil, fmt.Errorf("invalid path %q", s)
+		}
+		if m[1] != "" {
+			path = append(path, pathElement{key: m[1]})
+		} else {
+			index, err := strconv.Atoi(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q", s)
+			}
+			path = append(path, pathElement{index: index})
+		}
+		rest = rest[len(m[0]):]
+	}
+	return path, nil
+}
+
+func pathString(path []pathElement) string {
+	s := ""
+	for i, element := range path {
+		switch {
+		case element.key != "" && i == 0:
+			s += element.key
+		case element.key != "":
+			s += "." + element.key
+		default:
+			s += fmt.Sprintf("[%d]", element.index)
+		}
+	}
+	return s
+}
+
+// parseConditionValue parses the value a path is compared to. Anything that isn't a number, true, false, null or a
+// quoted string is a string as it is, so quotes can be left out in the shell, like status == failed.
+func parseConditionValue(s string) interface{} {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err == nil {
+		return value
+	}
+	return s
+}
+
+func compare(a interface{}, op string, b interface{}) (bool, error) {
+	switch op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	}
+	var cmp int
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return false, fmt.Errorf("can't compare the number %v to %s", a, describeValue(b))
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return false, fmt.Errorf("can't compare the string %q to %s", a, describeValue(b))
+		}
+		cmp = strings.Compare(a, b)
+	default:
+		return false, fmt.Errorf("can't compare %s with %s", describeValue(a), op)
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func equal(a, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return string(aJSON) == string(bJSON)
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// describeValue returns a short description of a JSON value for messages
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	}
+	data, _ := json.Marshal(v)
+	if len(data) > 100 {
+		return string(data[:100]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,69 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCondition(t *testing.T) {
+	var output interface{} = map[string]interface{}{
+		"score":  0.3,
+		"label":  "cat",
+		"nsfw":   false,
+		"boxes":  []interface{}{map[string]interface{}{"label": "dog"}},
+		"nested": nil,
+	}
+	succeeded := &Response{Status: "succeeded", Output: &output}
+	failed := &Response{Status: "failed", Error: "CUDA out of memory"}
+
+	for _, tt := range []struct {
+		condition  string
+		prediction *Response
+		matches    bool
+	}{
+		{"error", succeeded, false},
+		{"error", failed, true},
+		{"output.score < 0.5", succeeded, true},
+		{"output.score>=0.5", succeeded, false},
+		{"output.label == 'cat'", succeeded, true},
+		{`output.label != "cat"`, succeeded, false},
+		{"output.boxes[0].label == dog", succeeded, true},
+		{"output.nsfw", succeeded, false},
+		{"output.boxes", succeeded, true},
+		{"output.nested == null", succeeded, true},
+		{"status == failed", failed, true},
+		{"error == 'CUDA out of memory'", failed, true},
+	} {
+		c, err := ParseCondition(tt.condition)
+		require.NoError(t, err, tt.condition)
+		matches, _, err := c.Matches(tt.prediction)
+		require.NoError(t, err, tt.condition)
+		require.Equal(t, tt.matches, matches, tt.condition)
+	}
+}
+
+func TestConditionDescription(t *testing.T) {
+	var output interface{} = map[string]interface{}{"score": 0.3}
+	c, err := ParseCondition("output.score < 0.5")
+	require.NoError(t, err)
+	_, description, err := c.Matches(&Response{Status: "succeeded", Output: &output})
+	require.NoError(t, err)
+	require.Equal(t, "output.score is 0.3", description)
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, condition := range []string{"", "output.score <", ".output", "output..score", "output[x]", "output[0]label", "< 0.5"} {
+		_, err := ParseCondition(condition)
+		require.Error(t, err, condition)
+	}
+
+	var output interface{} = map[string]interface{}{"score": 0.3, "items": []interface{}{1.0}}
+	prediction := &Response{Status: "succeeded", Output: &output}
+	for _, condition := range []string{"output.missing", "output.items[1]", "output.score.value", "output.score < 'high'", "output.items > 1"} {
+		c, err := ParseCondition(condition)
+		require.NoError(t, err, condition)
+		_, _, err = c.Matches(prediction)
+		require.Error(t, err, condition)
+	}
+}
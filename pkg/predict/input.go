@@ -1,19 +1,18 @@
 package predict
 
 import (
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/replicate/cog/pkg/util/console"
-	"github.com/replicate/cog/pkg/util/mime"
-	"github.com/vincent-petithory/dataurl"
 )
 
 type Input struct {
 	String *string
 	File   *string
+	// Value is a value that has already been decoded from JSON, such as the output of another prediction
+	Value *interface{}
 }
 
 type Inputs map[string]Input
@@ -53,20 +52,3 @@ func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	}
 	return input
 }
-
-func (inputs *Inputs) toMap() (map[string]string, error) {
-	keyVals := map[string]string{}
-	for key, input := range *inputs {
-		if input.String != nil {
-			keyVals[key] = *input.String
-		} else if input.File != nil {
-			content, err := os.ReadFile(*input.File)
-			if err != nil {
-				return keyVals, err
-			}
-			mimeType := mime.TypeByExtension(filepath.Ext(*input.File))
-			keyVals[key] = dataurl.New(content, mimeType).String()
-		}
-	}
-	return keyVals, nil
-}
@@ -0,0 +1,87 @@
+package predict
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// FileLimits are the limits a model sets on a file input with Input(max_size=..., accept=[...])
+type FileLimits struct {
+	MaxSize int64
+	Accept  []string
+}
+
+// InputFileLimits returns the limits on the file inputs in a model's schema, by input name
+func InputFileLimits(schema *openapi3.T) map[string]FileLimits {
+	limits := map[string]FileLimits{}
+	if schema.Components.Schemas == nil || schema.Components.Schemas["Input"] == nil {
+		return limits
+	}
+	for name, property := range schema.Components.Schemas["Input"].Value.Properties {
+		if property.Value == nil {
+			continue
+		}
+		fileLimits := FileLimits{}
+		if maxSize, ok := property.Value.Extensions["x-cog-max-size"].(float64); ok {
+			fileLimits.MaxSize = int64(maxSize)
+		}
+		if accept, ok := property.Value.Extensions["x-cog-accept"].([]interface{}); ok {
+			for _, pattern := range accept {
+				if s, ok := pattern.(string); ok {
+					fileLimits.Accept = append(fileLimits.Accept, s)
+				}
+			}
+		}
+		if fileLimits.MaxSize > 0 || len(fileLimits.Accept) > 0 {
+			limits[name] = fileLimits
+		}
+	}
+	return limits
+}
+
+// Accepts returns whether a file of the given MIME type is accepted. Patterns can end in /*, like image/*.
+func (l FileLimits) Accepts(mimeType string) bool {
+	if len(l.Accept) == 0 {
+		return true
+	}
+	for _, pattern := range l.Accept {
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+		if pattern == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFileLimits returns an error if a file in inputs is bigger than, or a different type to, what the model
+// accepts, so it isn't uploaded only to be rejected
+func (inputs Inputs) CheckFileLimits(schema *openapi3.T) error {
+	limits := InputFileLimits(schema)
+	for name, input := range inputs {
+		fileLimits, ok := limits[name]
+		if !ok || input.File == nil {
+			continue
+		}
+		info, err := os.Stat(*input.File)
+		if err != nil {
+			return err
+		}
+		if fileLimits.MaxSize > 0 && info.Size() > fileLimits.MaxSize {
+			return fmt.Errorf("%s is %d bytes, but the model only accepts files up to %d bytes for %s", *input.File, info.Size(), fileLimits.MaxSize, name)
+		}
+		// Types of some extensions have parameters, like text/plain; charset=utf-8
+		mimeType, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(*input.File)), ";")
+		if !fileLimits.Accepts(mimeType) {
+			return fmt.Errorf("%s is %s, but the model only accepts %s for %s", *input.File, mimeType, strings.Join(fileLimits.Accept, ", "), name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFileLimits(t *testing.T) {
+	fileSchema := openapi3.NewStringSchema()
+	fileSchema.Format = "uri"
+	fileSchema.Extensions = map[string]interface{}{
+		"x-cog-max-size": float64(10),
+		"x-cog-accept":   []interface{}{"text/*", "application/json"},
+	}
+	inputSchema := openapi3.NewObjectSchema().WithProperty("file", fileSchema).WithProperty("text", openapi3.NewStringSchema())
+	schema := &openapi3.T{Components: openapi3.Components{Schemas: openapi3.Schemas{"Input": openapi3.NewSchemaRef("", inputSchema)}}}
+
+	require.Equal(t, map[string]FileLimits{"file": {MaxSize: 10, Accept: []string{"text/*", "application/json"}}}, InputFileLimits(schema))
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	big := filepath.Join(dir, "big.txt")
+	image := filepath.Join(dir, "small.png")
+	require.NoError(t, os.WriteFile(small, []byte("hello"), 0o644))
+	require.NoError(t, os.WriteFile(big, []byte("hello world!"), 0o644))
+	require.NoError(t, os.WriteFile(image, []byte("hello"), 0o644))
+
+	require.NoError(t, NewInputs(map[string]string{"file": "@" + small, "text": "hello"}).CheckFileLimits(schema))
+	require.ErrorContains(t, NewInputs(map[string]string{"file": "@" + big}).CheckFileLimits(schema), "up to 10 bytes")
+	require.ErrorContains(t, NewInputs(map[string]string{"file": "@" + image}).CheckFileLimits(schema), "image/png")
+	// URLs are passed through
+	require.NoError(t, NewInputs(map[string]string{"file": "https://example.com/big.png"}).CheckFileLimits(schema))
+}
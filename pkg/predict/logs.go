@@ -0,0 +1,56 @@
+package predict
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// maxLogLineLength is how much of a line lastLineWriter keeps, so a model that prints a lot without a newline
+// doesn't use up memory
+const maxLogLineLength = 1024
+
+// lastLineWriter passes logs through to out, remembering the last line that wasn't blank
+type lastLineWriter struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	partial  []byte
+	lastLine string
+}
+
+func (w *lastLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	for _, b := range p {
+		// Progress bars redraw the line with \r
+		if b == '\n' || b == '\r' {
+			if line := strings.TrimSpace(string(w.partial)); line != "" {
+				w.lastLine = line
+			}
+			w.partial = w.partial[:0]
+		} else if len(w.partial) < maxLogLineLength {
+			w.partial = append(w.partial, b)
+		}
+	}
+	w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// LastLine returns the last line that has been written, or the line being written if it isn't blank
+func (w *lastLineWriter) LastLine() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if partial := bytes.TrimSpace(w.partial); len(partial) > 0 {
+		return string(partial)
+	}
+	return w.lastLine
+}
+
+// Close closes out, if it's a writer that needs closing once the logs have finished, like a console.Writer
+func (w *lastLineWriter) Close() error {
+	if closer, ok := w.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package predict
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastLineWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := &lastLineWriter{out: out}
+	require.Equal(t, "", w.LastLine())
+
+	_, err := w.Write([]byte("Loading weights\n\n"))
+	require.NoError(t, err)
+	require.Equal(t, "Loading weights", w.LastLine())
+
+	_, err = w.Write([]byte("  0%|          | 0/20\r 45%|████▌"))
+	require.NoError(t, err)
+	require.Equal(t, "45%|████▌", w.LastLine())
+
+	_, err = w.Write([]byte("     | 9/20\r   "))
+	require.NoError(t, err)
+	require.Equal(t, "45%|████▌     | 9/20", w.LastLine())
+
+	require.Equal(t, "Loading weights\n\n  0%|          | 0/20\r 45%|████▌     | 9/20\r   ", out.String())
+}
@@ -1,11 +1,16 @@
 package predict
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,19 +22,44 @@ import (
 
 type status string
 
+// StatusTimedOut is the status of a prediction that took longer than the model's max_prediction_time
+const StatusTimedOut status = "timed_out"
+
+// ErrBusy is returned when the model is already running as many predictions as it can, so the prediction should be
+// sent again once one of them has finished
+var ErrBusy = errors.New("The model is busy running other predictions")
+
 type HealthcheckResponse struct {
 	Status string `json:"status"`
+	// Setup is the result of running setup(), once it has finished
+	Setup *SetupResult `json:"setup"`
+}
+
+type SetupResult struct {
+	Status      string     `json:"status"`
+	Logs        string     `json:"logs"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
 }
 
 type Request struct {
+	ID string `json:"id,omitempty"`
 	// TODO: could this be Inputs?
-	Input map[string]string `json:"input"`
+	Input map[string]interface{} `json:"input"`
 }
 
 type Response struct {
 	Status status       `json:"status"`
 	Output *interface{} `json:"output"`
 	Error  string       `json:"error"`
+	// Logs are the lines the model printed while running this prediction. They don't include logs from setup().
+	Logs string `json:"logs"`
+	// Stdout and Stderr are the same lines as Logs, split into what the model wrote to stdout and to stderr
+	Stdout      string                 `json:"stdout"`
+	Stderr      string                 `json:"stderr"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+	Metrics     map[string]interface{} `json:"metrics,omitempty"`
 }
 
 type ValidationErrorResponse struct {
@@ -46,53 +76,184 @@ type Predictor struct {
 	// Running state
 	containerID string
 	port        int
+	// containerPort is the port the model's HTTP API listens on in the container, and hostIP is the host address
+	// it's published on, if it's published on a particular one
+	containerPort int
+	hostIP        string
+
+	// baseURL is where the model's HTTP API is served, e.g. http://localhost:49153
+	baseURL string
+
+	// maxPredictionTime is how long a prediction can run for before it is cancelled. If 0, there is no limit.
+	maxPredictionTime time.Duration
+
+	// setupTimeout is how long Start waits for setup() to finish. If 0, there is no limit.
+	setupTimeout time.Duration
+
+	// requestTimeout limits requests that should return quickly, like health checks. If 0, there is no limit.
+	requestTimeout time.Duration
+
+	// client runs predictions. If nil, a client using the shared transport is used.
+	client *http.Client
+
+	// auth is the credentials requests to the model are sent with, if it needs any
+	auth *Auth
+
+	uploadProgress UploadProgress
+
+	// onStart is called with the ID of the container as soon as it has been started
+	onStart func(containerID string)
 }
 
-func NewPredictor(runOptions docker.RunOptions) Predictor {
-	if global.Debug {
+// NewPredictor returns a Predictor that runs a model in a container with runOptions. The model logs debugging
+// messages if settings.Debug is set, its ports are published on settings.AddressFamily, and requests to it other than
+// predictions are limited by settings.HTTPTimeout.
+func NewPredictor(runOptions docker.RunOptions, settings *global.Settings) Predictor {
+	runOptions.AddressFamily = settings.AddressFamily
+	if settings.Debug {
 		runOptions.Env = append(runOptions.Env, "COG_LOG_LEVEL=debug")
 	} else {
 		runOptions.Env = append(runOptions.Env, "COG_LOG_LEVEL=warning")
 	}
-	return Predictor{runOptions: runOptions}
+	if settings.AddressFamily == "ipv6" {
+		// The server binds to 0.0.0.0 by default, which isn't reachable on IPv6-only networks
+		runOptions.Env = append(runOptions.Env, "COG_HOST=::")
+	}
+	return Predictor{runOptions: runOptions, setupTimeout: global.StartupTimeout, requestTimeout: settings.HTTPTimeout}
+}
+
+// NewRemotePredictor returns a Predictor for a model that is already being served at url, e.g. a deployed endpoint.
+// Start and Stop must not be called on it.
+func NewRemotePredictor(url string) Predictor {
+	return Predictor{baseURL: strings.TrimSuffix(url, "/"), requestTimeout: global.DefaultSettings().HTTPTimeout}
 }
 
 func (p *Predictor) Start(logsWriter io.Writer) error {
 	var err error
 	containerPort := 5000
 
-	p.runOptions.Ports = append(p.runOptions.Ports, docker.Port{HostPort: 0, ContainerPort: containerPort})
+	switch p.runOptions.Network {
+	case "none":
+		return fmt.Errorf("The model's HTTP API can't be reached with network mode 'none'")
+	case "host":
+		// Ports can't be published with the host network, so the server listens on the host's port directly
+		for _, port := range p.runOptions.Ports {
+			if port.ContainerPort == containerPort && port.HostPort != 0 {
+				p.runOptions.Env = append(p.runOptions.Env, fmt.Sprintf("PORT=%d", port.HostPort))
+				containerPort = port.HostPort
+			}
+		}
+		p.runOptions.Ports = nil
+	}
+
+	// Publish the API on a random host port, unless the caller has chosen one
+	published := p.runOptions.Network == "host"
+	for _, port := range p.runOptions.Ports {
+		if port.ContainerPort == containerPort {
+			published = true
+			p.hostIP = port.HostIP
+		}
+	}
+	if !published {
+		p.runOptions.Ports = append(p.runOptions.Ports, docker.Port{HostPort: 0, ContainerPort: containerPort})
+	}
 
 	p.containerID, err = docker.RunDaemon(p.runOptions, logsWriter)
 	if err != nil {
 		return fmt.Errorf("Failed to start container: %w", err)
 	}
+	if p.onStart != nil {
+		p.onStart(p.containerID)
+	}
 
-	p.port, err = docker.GetPort(p.containerID, containerPort)
-	if err != nil {
-		return fmt.Errorf("Failed to determine container port: %w", err)
+	p.containerPort = containerPort
+	if err := p.updateURL(); err != nil {
+		return err
+	}
+
+	logs := &lastLineWriter{out: logsWriter}
+	p.followLogs(logs, time.Time{})
+
+	return p.waitForContainerReady(logs)
+}
+
+// Restart restarts the model's container and waits for setup() to finish again, e.g. to load code that has changed
+// in a project directory mounted into it
+func (p *Predictor) Restart(logsWriter io.Writer) error {
+	since := time.Now()
+	if err := docker.Restart(p.containerID); err != nil {
+		return fmt.Errorf("Failed to restart container: %w", err)
+	}
+	// Random host ports are allocated again when a container restarts
+	if err := p.updateURL(); err != nil {
+		return err
+	}
+
+	// Following the logs stops when the container stops, so follow them again from when it was restarted
+	logs := &lastLineWriter{out: logsWriter}
+	p.followLogs(logs, since)
+
+	return p.waitForContainerReady(logs)
+}
+
+// updateURL sets the URL of the model's HTTP API from the host port its container port is published on
+func (p *Predictor) updateURL() error {
+	if p.runOptions.Network == "host" {
+		p.port = p.containerPort
+	} else {
+		port, err := docker.GetPort(p.containerID, p.containerPort, p.runOptions.AddressFamily)
+		if err != nil {
+			return fmt.Errorf("Failed to determine container port: %w", err)
+		}
+		p.port = port
+	}
+	// localhost rather than 127.0.0.1, so this works on hosts that only have IPv4 or IPv6
+	host := "localhost"
+	if ip := net.ParseIP(p.hostIP); ip != nil && !ip.IsUnspecified() {
+		// The port is only published on that address, like a LAN interface, so localhost won't reach it
+		host = ip.String()
 	}
+	p.baseURL = "http://" + net.JoinHostPort(host, strconv.Itoa(p.port))
+	return nil
+}
 
+// followLogs writes the container's logs from since onwards to logs in the background
+func (p *Predictor) followLogs(logs *lastLineWriter, since time.Time) {
 	go func() {
-		if err := docker.ContainerLogsFollow(p.containerID, logsWriter); err != nil {
+		if err := docker.ContainerLogsFollowSince(p.containerID, since, logs); err != nil {
 			// if user hits ctrl-c we expect an error signal
 			if !strings.Contains(err.Error(), "signal: interrupt") {
 				console.Warnf("Error getting container logs: %s", err)
 			}
 		}
+		if err := logs.Close(); err != nil {
+			console.Debugf("Failed to write container logs: %s", err)
+		}
 	}()
-
-	return p.waitForContainerReady()
 }
 
-func (p *Predictor) waitForContainerReady() error {
-	url := fmt.Sprintf("http://localhost:%d/health-check", p.port)
+// setupProgressInterval is how often waitForContainerReady says it's still waiting for setup() to finish
+const setupProgressInterval = 30 * time.Second
 
+func (p *Predictor) waitForContainerReady(logs *lastLineWriter) error {
 	start := time.Now()
+	lastProgress := start
 	for {
-		now := time.Now()
-		if now.Sub(start) > global.StartupTimeout {
-			return fmt.Errorf("Timed out")
+		elapsed := time.Since(start)
+		if p.setupTimeout > 0 && elapsed > p.setupTimeout {
+			message := fmt.Sprintf("Timed out after %s waiting for setup() to finish. Set setup_timeout in cog.yaml or pass --setup-timeout to wait for longer", p.setupTimeout)
+			if line := logs.LastLine(); line != "" {
+				message += fmt.Sprintf(". The last thing the model printed was: %s", line)
+			}
+			return errors.New(message)
+		}
+		if time.Since(lastProgress) >= setupProgressInterval {
+			lastProgress = time.Now()
+			if line := logs.LastLine(); line != "" {
+				console.Infof("Still running setup() after %s. Last log line: %s", elapsed.Round(time.Second), line)
+			} else {
+				console.Infof("Still running setup() after %s...", elapsed.Round(time.Second))
+			}
 		}
 
 		time.Sleep(100 * time.Millisecond)
@@ -105,57 +266,138 @@ func (p *Predictor) waitForContainerReady() error {
 			return fmt.Errorf("Container exited unexpectedly")
 		}
 
-		resp, err := http.Get(url)
+		ready, err := p.checkHealth()
 		if err != nil {
-			continue
-		}
-		if resp.StatusCode != http.StatusOK {
-			continue
-		}
-		healthcheck := &HealthcheckResponse{}
-		if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
-			return fmt.Errorf("Container healthcheck returned invalid response: %w", err)
-		}
-		// These status values are defined in python/cog/server/http.py
-		switch healthcheck.Status {
-		case "STARTING":
-			continue
-		case "SETUP_FAILED":
-			return fmt.Errorf("Model setup failed")
-		case "READY":
+			return err
+		}
+		if ready {
 			return nil
-		default:
-			return fmt.Errorf("Container healthcheck returned unexpected status: %s", healthcheck.Status)
 		}
 	}
 }
 
+// checkHealth returns whether the model has finished running setup(), or an error if setup failed. Errors reaching
+// the model are ignored, because its server may not have started yet.
+func (p *Predictor) checkHealth() (bool, error) {
+	resp, err := p.requestClient().Get(p.baseURL + "/health-check")
+	if err != nil {
+		return false, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// Models built with old versions of Cog don't have /health-check, and are ready once they respond at all
+		rootResp, err := p.requestClient().Get(p.baseURL + "/")
+		if err != nil {
+			return false, nil
+		}
+		rootResp.Body.Close()
+		return rootResp.StatusCode == http.StatusOK, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+
+	healthcheck := &HealthcheckResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
+		return false, fmt.Errorf("Container healthcheck returned invalid response: %w", err)
+	}
+	// These status values are defined in python/cog/server/http.py
+	switch healthcheck.Status {
+	case "STARTING":
+		return false, nil
+	case "SETUP_FAILED":
+		if healthcheck.Setup != nil && strings.TrimSpace(healthcheck.Setup.Logs) != "" {
+			return false, fmt.Errorf("Model setup failed:\n%s", strings.TrimSpace(healthcheck.Setup.Logs))
+		}
+		return false, fmt.Errorf("Model setup failed")
+	case "READY", "BUSY":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Container healthcheck returned unexpected status: %s", healthcheck.Status)
+	}
+}
+
+// SetSetupTimeout sets how long Start waits for the model's setup() to finish. If d is 0, it waits for as long as
+// setup() takes.
+func (p *Predictor) SetSetupTimeout(d time.Duration) {
+	p.setupTimeout = d
+}
+
+// SetMaxPredictionTime limits how long predictions can run for. Predictions that run for longer are cancelled and have the status StatusTimedOut.
+func (p *Predictor) SetMaxPredictionTime(d time.Duration) {
+	p.maxPredictionTime = d
+}
+
+// SetUploadProgress sets a function that is called as files in predictions' inputs are uploaded
+func (p *Predictor) SetUploadProgress(progress UploadProgress) {
+	p.uploadProgress = progress
+}
+
+// URL returns the base URL of the model's HTTP API
+func (p *Predictor) URL() string {
+	return p.baseURL
+}
+
+// RunsContainer returns whether the model is run in a container that was started with Start, rather than being served
+// somewhere else
+func (p *Predictor) RunsContainer() bool {
+	return p.containerID != ""
+}
+
+// SetOnStart sets a function that is called with the ID of the model's container as soon as it has been started, before
+// setup() has finished, e.g. so it can be stopped from another goroutine if the command is interrupted
+func (p *Predictor) SetOnStart(fn func(containerID string)) {
+	p.onStart = fn
+}
+
+// Stop stops the model's container, if it has been started
 func (p *Predictor) Stop() error {
+	if p.containerID == "" {
+		return nil
+	}
 	return docker.Stop(p.containerID)
 }
 
-func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
-	inputMap, err := inputs.toMap()
+// Predict runs a prediction and waits for it to complete. If ctx is done before then, e.g. when the user hits Ctrl-C
+// while a file is being uploaded, the request is stopped and the prediction is cancelled.
+func (p *Predictor) Predict(ctx context.Context, inputs Inputs) (*Response, error) {
+	// The ID lets the prediction be cancelled if it runs for too long, or if the context is cancelled
+	id, err := newPredictionID()
 	if err != nil {
 		return nil, err
 	}
-	request := Request{Input: inputMap}
-	requestBody, err := json.Marshal(request)
+	httpClient := *p.predictionClient()
+	if p.maxPredictionTime > 0 {
+		// The server cancels predictions that run for too long itself, but in case it doesn't, cancel it from here
+		httpClient.Timeout = p.maxPredictionTime + predictionTimeoutGrace
+	}
+	requestBody, err := inputs.requestBody(id, p.uploadProgress)
 	if err != nil {
 		return nil, err
 	}
 
-	url := fmt.Sprintf("http://localhost:%d/predictions", p.port)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBody))
+	url := p.baseURL + "/predictions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, requestBody())
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Close = true
+	// So the request can be sent again with a refreshed token
+	req.GetBody = func() (io.ReadCloser, error) { return requestBody(), nil }
 
-	httpClient := &http.Client{}
+	start := time.Now()
 	resp, err := httpClient.Do(req)
 	if err != nil {
+		if urlErr, ok := err.(interface{ Timeout() bool }); ok && urlErr.Timeout() && p.maxPredictionTime > 0 {
+			p.cancel(id)
+			return p.timedOut(), nil
+		}
+		if ctx.Err() != nil {
+			// Closing the connection doesn't stop the prediction, and a deployed model would carry on running it
+			console.Info("Cancelling prediction...")
+			p.cancel(id)
+		}
 		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
 	}
 	defer resp.Body.Close()
@@ -169,10 +411,168 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 		return nil, buildInputValidationErrorMessage(errorResponse)
 	}
 
+	if resp.StatusCode == http.StatusConflict {
+		return nil, ErrBusy
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("/predictions call returned status %d", resp.StatusCode)
 	}
 
+	prediction := &Response{}
+	if err = json.NewDecoder(resp.Body).Decode(prediction); err != nil {
+		return nil, fmt.Errorf("Failed to decode prediction response: %w", err)
+	}
+	if p.maxPredictionTime > 0 && prediction.Status != "succeeded" && time.Since(start) >= p.maxPredictionTime {
+		timedOut := p.timedOut()
+		timedOut.Logs = prediction.Logs
+		timedOut.Stdout = prediction.Stdout
+		timedOut.Stderr = prediction.Stderr
+		return timedOut, nil
+	}
+	return prediction, nil
+}
+
+// PredictProgressive runs a prediction asynchronously and polls the model for its state until it has completed.
+// onUpdate is called with each state it polls, so output can be shown while the model is still producing it.
+// The model must support GET /predictions/{id}; use SupportsProgressive to check. If ctx is done before the prediction
+// has completed, it is cancelled.
+func (p *Predictor) PredictProgressive(ctx context.Context, inputs Inputs, onUpdate func(*Response) error) (*Response, error) {
+	id, err := newPredictionID()
+	if err != nil {
+		return nil, err
+	}
+	requestBody, err := inputs.requestBody(id, p.uploadProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the connection fails while a big file is being uploaded, the request is sent again with the same ID. The model
+	// may have started the prediction before the connection failed, in which case it answers the retry with 409 Conflict.
+	url := p.baseURL + "/predictions/" + id
+	start := time.Now()
+	var resp *http.Response
+	attempt := 0
+	for ; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, requestBody())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "respond-async")
+		req.GetBody = func() (io.ReadCloser, error) { return requestBody(), nil }
+
+		resp, err = p.predictionClient().Do(req)
+		if err == nil {
+			break
+		}
+		if attempt >= uploadRetries || ctx.Err() != nil {
+			return nil, fmt.Errorf("Failed to PUT HTTP request to %s: %w", url, err)
+		}
+		console.Warnf("Failed to send prediction request, retrying: %s", err)
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		errorResponse := &ValidationErrorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(errorResponse); err != nil {
+			return nil, fmt.Errorf("/predictions call returned status 422, and the response body failed to decode: %w", err)
+		}
+
+		return nil, buildInputValidationErrorMessage(errorResponse)
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		// The model is busy with something else, unless it's running this prediction from an earlier attempt
+		if attempt == 0 {
+			return nil, ErrBusy
+		}
+		if _, err := p.getPrediction(id); err != nil {
+			return nil, ErrBusy
+		}
+	} else if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("/predictions call returned status %d", resp.StatusCode)
+	}
+
+	for {
+		time.Sleep(predictionPollInterval)
+
+		if err := ctx.Err(); err != nil {
+			console.Info("Cancelling prediction...")
+			p.cancel(id)
+			return nil, err
+		}
+		if p.maxPredictionTime > 0 && time.Since(start) >= p.maxPredictionTime+predictionTimeoutGrace {
+			p.cancel(id)
+			return p.timedOut(), nil
+		}
+
+		prediction, err := p.getPrediction(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := onUpdate(prediction); err != nil {
+			return nil, err
+		}
+
+		switch prediction.Status {
+		case "succeeded":
+			return prediction, nil
+		case "failed", "canceled":
+			if p.maxPredictionTime > 0 && time.Since(start) >= p.maxPredictionTime {
+				timedOut := p.timedOut()
+				timedOut.Logs = prediction.Logs
+				timedOut.Stdout = prediction.Stdout
+				timedOut.Stderr = prediction.Stderr
+				return timedOut, nil
+			}
+			return prediction, nil
+		}
+	}
+}
+
+// PredictStream runs a prediction like PredictProgressive, and calls onOutput with each item the model outputs as it's
+// output, like the tokens of a language model. It's for models whose output is an iterator, which is an array in the
+// state that's polled that grows as the model yields items. Other output is only in the response it returns.
+func (p *Predictor) PredictStream(ctx context.Context, inputs Inputs, onOutput func(item interface{}) error) (*Response, error) {
+	streamed := 0
+	return p.PredictProgressive(ctx, inputs, func(prediction *Response) error {
+		if prediction.Output == nil {
+			return nil
+		}
+		items, ok := (*prediction.Output).([]interface{})
+		if !ok {
+			return nil
+		}
+		for ; streamed < len(items); streamed++ {
+			if err := onOutput(items[streamed]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SupportsProgressive returns whether the model's HTTP API, as described by schema, can be polled for the state of a
+// running prediction. Models built with older versions of Cog can't be.
+func SupportsProgressive(schema *openapi3.T) bool {
+	path := schema.Paths["/predictions/{prediction_id}"]
+	return path != nil && path.Get != nil
+}
+
+func (p *Predictor) getPrediction(id string) (*Response, error) {
+	url := p.baseURL + "/predictions/" + id
+	resp, err := p.requestClient().Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to GET HTTP request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/predictions/%s call returned status %d", id, resp.StatusCode)
+	}
+
 	prediction := &Response{}
 	if err = json.NewDecoder(resp.Body).Decode(prediction); err != nil {
 		return nil, fmt.Errorf("Failed to decode prediction response: %w", err)
@@ -180,11 +580,43 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	return prediction, nil
 }
 
+// predictionPollInterval is how often the state of a running prediction is polled
+const predictionPollInterval = 500 * time.Millisecond
+
+// predictionTimeoutGrace is how long to wait after maxPredictionTime for the server to cancel a prediction itself
+const predictionTimeoutGrace = 10 * time.Second
+
+func (p *Predictor) timedOut() *Response {
+	return &Response{
+		Status: StatusTimedOut,
+		Error:  fmt.Sprintf("Prediction timed out after %s", p.maxPredictionTime),
+	}
+}
+
+// cancel cancels a running prediction. Errors are ignored, because the prediction may have already finished.
+func (p *Predictor) cancel(id string) {
+	resp, err := p.requestClient().Post(p.baseURL+"/predictions/"+id+"/cancel", "application/json", nil)
+	if err != nil {
+		console.Debugf("Failed to cancel prediction %s: %s", id, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func newPredictionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate prediction ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (p *Predictor) GetSchema() (*openapi3.T, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
+	resp, err := p.requestClient().Get(p.baseURL + "/openapi.json")
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Failed to get OpenAPI schema: %d", resp.StatusCode)
 	}
@@ -0,0 +1,160 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHealth(t *testing.T) {
+	for _, tt := range []struct {
+		body  string
+		ready bool
+		err   string
+	}{
+		{`{"status": "STARTING", "setup": null}`, false, ""},
+		{`{"status": "READY", "setup": {"status": "succeeded", "logs": ""}}`, true, ""},
+		{`{"status": "BUSY", "setup": {"status": "succeeded", "logs": ""}}`, true, ""},
+		{`{"status": "SETUP_FAILED", "setup": {"status": "failed", "logs": "Traceback...\nOSError: weights not found\n"}}`, false, "OSError: weights not found"},
+		{`{"status": "SETUP_FAILED", "setup": null}`, false, "Model setup failed"},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(tt.body))
+		}))
+		predictor := NewRemotePredictor(server.URL)
+		ready, err := predictor.checkHealth()
+		if tt.err != "" {
+			require.ErrorContains(t, err, tt.err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, tt.ready, ready, tt.body)
+		server.Close()
+	}
+}
+
+func TestCheckHealthWithoutHealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	ready, err := predictor.checkHealth()
+	require.NoError(t, err)
+	require.True(t, ready)
+}
+
+func TestPredictCancelsWhenContextIsCancelled(t *testing.T) {
+	started := make(chan string, 1)
+	canceled := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/predictions" {
+			request := &Request{}
+			if err := json.NewDecoder(r.Body).Decode(request); err == nil {
+				started <- request.ID
+			}
+			// The prediction runs until the client goes away
+			<-r.Context().Done()
+			return
+		}
+		canceled <- r.URL.Path
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	predictor := NewRemotePredictor(server.URL)
+	done := make(chan error, 1)
+	go func() {
+		_, err := predictor.Predict(ctx, Inputs{})
+		done <- err
+	}()
+
+	id := <-started
+	require.NotEmpty(t, id)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	select {
+	case path := <-canceled:
+		require.Equal(t, "/predictions/"+id+"/cancel", path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The prediction wasn't cancelled")
+	}
+}
+
+func TestPredictReturnsErrBusy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"detail": "Already running a prediction"}`))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	_, err := predictor.Predict(context.Background(), Inputs{})
+	require.ErrorIs(t, err, ErrBusy)
+}
+
+func TestPredictStream(t *testing.T) {
+	// Each time the prediction is polled, the model has output another token
+	tokens := []interface{}{"Hello", ",", " world"}
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"status": "starting"}`))
+			return
+		}
+		polls++
+		prediction := map[string]interface{}{"status": "processing", "output": tokens[:polls]}
+		if polls == len(tokens) {
+			prediction["status"] = "succeeded"
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(prediction))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	streamed := []interface{}{}
+	prediction, err := predictor.PredictStream(context.Background(), Inputs{}, func(item interface{}) error {
+		streamed = append(streamed, item)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "succeeded", string(prediction.Status))
+	require.Equal(t, tokens, streamed)
+}
+
+func TestPredictProgressiveFollowsPredictionStartedByEarlierAttempt(t *testing.T) {
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+			if puts == 1 {
+				// The model starts the prediction, but the connection fails before the response is sent
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "succeeded", "output": "hello"}`))
+	}))
+	defer server.Close()
+
+	predictor := NewRemotePredictor(server.URL)
+	prediction, err := predictor.PredictProgressive(context.Background(), Inputs{}, func(*Response) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, 2, puts)
+	require.Equal(t, "succeeded", string(prediction.Status))
+}
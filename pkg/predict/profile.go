@@ -0,0 +1,72 @@
+package predict
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v2"
+)
+
+// ProfilesPath is where profiles are read from
+const ProfilesPath = "~/.config/cog/profiles.yaml"
+
+// Profile is a model served somewhere else, like a staging deployment, and the credentials for it. Profiles are named
+// in ProfilesPath, like:
+//
+//	staging:
+//	  url: https://staging.example.com/my-model
+//	  token_command: gcloud auth print-identity-token
+//
+// Values can refer to environment variables, like token: $STAGING_TOKEN, so secrets don't have to be in the file.
+type Profile struct {
+	URL          string `yaml:"url"`
+	Token        string `yaml:"token"`
+	TokenCommand string `yaml:"token_command"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+}
+
+// LoadProfile returns the profile with a name from ProfilesPath
+func LoadProfile(name string) (*Profile, error) {
+	path, err := homedir.Expand(ProfilesPath)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("There is no profile named '%s', because %s doesn't exist", name, ProfilesPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", ProfilesPath, err)
+	}
+	return parseProfile(contents, name)
+}
+
+func parseProfile(contents []byte, name string) (*Profile, error) {
+	profiles := map[string]*Profile{}
+	if err := yaml.UnmarshalStrict(contents, &profiles); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", ProfilesPath, err)
+	}
+	profile, ok := profiles[name]
+	if !ok || profile == nil {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("There is no profile named '%s' in %s. The profiles are: %s", name, ProfilesPath, strings.Join(names, ", "))
+	}
+	profile.URL = os.ExpandEnv(profile.URL)
+	profile.Token = os.ExpandEnv(profile.Token)
+	profile.Username = os.ExpandEnv(profile.Username)
+	profile.Password = os.ExpandEnv(profile.Password)
+	return profile, nil
+}
+
+// Auth returns the profile's credentials
+func (p *Profile) Auth() *Auth {
+	return &Auth{Token: p.Token, TokenCommand: p.TokenCommand, Username: p.Username, Password: p.Password}
+}
@@ -0,0 +1,33 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfile(t *testing.T) {
+	t.Setenv("STAGING_TOKEN", "abc")
+	contents := []byte(`staging:
+  url: https://staging.example.com/my-model
+  token: $STAGING_TOKEN
+production:
+  url: https://example.com/my-model
+  token_command: gcloud auth print-identity-token
+`)
+
+	profile, err := parseProfile(contents, "staging")
+	require.NoError(t, err)
+	require.Equal(t, "https://staging.example.com/my-model", profile.URL)
+	require.Equal(t, "abc", profile.Auth().Token)
+
+	profile, err = parseProfile(contents, "production")
+	require.NoError(t, err)
+	require.Equal(t, "gcloud auth print-identity-token", profile.Auth().TokenCommand)
+
+	_, err = parseProfile(contents, "dev")
+	require.ErrorContains(t, err, "The profiles are: production, staging")
+
+	_, err = parseProfile([]byte("staging:\n  tokn: abc\n"), "staging")
+	require.ErrorContains(t, err, "tokn")
+}
@@ -0,0 +1,23 @@
+package predict
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// progressRegexp matches the percentage at the start of a tqdm progress bar, e.g. " 45%|████▌     | 9/20"
+var progressRegexp = regexp.MustCompile(`(\d{1,3})%\|`)
+
+// Progress returns how complete the prediction is as a percentage, if the model has reported it.
+// Models report progress by printing a tqdm progress bar; the last one in the logs is used.
+func (r *Response) Progress() (int, bool) {
+	matches := progressRegexp.FindAllStringSubmatch(r.Logs, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	progress, err := strconv.Atoi(matches[len(matches)-1][1])
+	if err != nil || progress > 100 {
+		return 0, false
+	}
+	return progress, true
+}
@@ -0,0 +1,26 @@
+package predict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	for _, tt := range []struct {
+		logs     string
+		progress int
+		ok       bool
+	}{
+		{"", 0, false},
+		{"loading weights\n", 0, false},
+		{"  0%|          | 0/20 [00:00<?, ?it/s]", 0, true},
+		{"  0%|          | 0/20 [00:00<?, ?it/s]\r 45%|████▌     | 9/20 [00:04<00:05,  2.10it/s]", 45, true},
+		{"100%|██████████| 20/20 [00:09<00:00,  2.10it/s]\ndone\n", 100, true},
+		{"disk 250%| full", 0, false},
+	} {
+		progress, ok := (&Response{Logs: tt.logs}).Progress()
+		require.Equal(t, tt.ok, ok, tt.logs)
+		require.Equal(t, tt.progress, progress, tt.logs)
+	}
+}
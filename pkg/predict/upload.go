@@ -0,0 +1,150 @@
+package predict
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// uploadRetries is how many times a prediction request is sent again if the connection fails while it is being sent
+const uploadRetries = 3
+
+// UploadProgress is called while a prediction request is being sent, with the number of bytes of files that have
+// been sent and the total size of the files
+type UploadProgress func(sent, total int64)
+
+// requestBody returns a function that streams a prediction request as JSON. Files are read and encoded as data URLs
+// as the request is sent, so they don't have to be held in memory. Each call returns a new body, so requests can be
+// retried.
+func (inputs Inputs) requestBody(id string, progress UploadProgress) (func() io.ReadCloser, error) {
+	var total int64
+	for _, input := range inputs {
+		if input.File == nil {
+			continue
+		}
+		info, err := os.Stat(*input.File)
+		if err != nil {
+			return nil, err
+		}
+		total += info.Size()
+	}
+	return func() io.ReadCloser {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(inputs.writeRequest(w, id, total, progress))
+		}()
+		return r
+	}, nil
+}
+
+// writeRequest writes a prediction request as JSON, in the same form as Request
+func (inputs Inputs) writeRequest(w io.Writer, id string, total int64, progress UploadProgress) error {
+	bw := bufio.NewWriter(w)
+	if id != "" {
+		idJSON, err := json.Marshal(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, `{"id":%s,"input":{`, idJSON)
+	} else {
+		fmt.Fprint(bw, `{"input":{`)
+	}
+
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sent int64
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Fprint(bw, ",")
+		}
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "%s:", keyJSON)
+
+		input := inputs[key]
+		switch {
+		case input.File != nil:
+			onRead := func(n int64) {
+				sent += n
+				if progress != nil {
+					progress(sent, total)
+				}
+			}
+			if err := writeDataURL(bw, *input.File, onRead); err != nil {
+				return err
+			}
+		case input.String != nil:
+			if err := writeJSON(bw, *input.String); err != nil {
+				return err
+			}
+		case input.Value != nil:
+			if err := writeJSON(bw, *input.Value); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprint(bw, "null")
+		}
+	}
+	fmt.Fprint(bw, "}}")
+	return bw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// writeDataURL writes a file as a JSON string containing a base64 data URL
+func writeDataURL(w io.Writer, path string, onRead func(int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Some types have parameters, like "text/plain; charset=utf-8", which can't have spaces in a data URL
+	mimeType := strings.ReplaceAll(mime.TypeByExtension(filepath.Ext(path)), " ", "")
+	if _, err := fmt.Fprintf(w, `"data:%s;base64,`, mimeType); err != nil {
+		return err
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(encoder, &progressReader{r: f, onRead: onRead}); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, `"`)
+	return err
+}
+
+type progressReader struct {
+	r      io.Reader
+	onRead func(int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.onRead(int64(n))
+	}
+	return n, err
+}
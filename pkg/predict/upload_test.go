@@ -0,0 +1,51 @@
+package predict
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBody(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "input.png")
+	content := bytes.Repeat([]byte{0, 1, 2, 3, 4}, 10000)
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+
+	var value interface{} = []interface{}{"a", float64(1)}
+	inputs := NewInputs(map[string]string{"image": "@" + path, "text": `say "hello"`})
+	inputs["list"] = Input{Value: &value}
+
+	var sent, total int64
+	body, err := inputs.requestBody("abc", func(s, t int64) { sent, total = s, t })
+	require.NoError(t, err)
+
+	// Each body is a complete request, so they can be retried
+	for i := 0; i < 2; i++ {
+		b, err := io.ReadAll(body())
+		require.NoError(t, err)
+
+		request := Request{}
+		require.NoError(t, json.Unmarshal(b, &request))
+		require.Equal(t, "abc", request.ID)
+		require.Equal(t, `say "hello"`, request.Input["text"])
+		require.Equal(t, []interface{}{"a", float64(1)}, request.Input["list"])
+		require.Equal(t, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(content), request.Input["image"])
+	}
+	require.Equal(t, int64(len(content)), sent)
+	require.Equal(t, int64(len(content)), total)
+}
+
+func TestRequestBodyWithoutID(t *testing.T) {
+	body, err := Inputs{}.requestBody("", nil)
+	require.NoError(t, err)
+	b, err := io.ReadAll(body())
+	require.NoError(t, err)
+	require.Equal(t, `{"input":{}}`, string(b))
+}
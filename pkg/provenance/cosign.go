@@ -0,0 +1,122 @@
+package provenance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// cosignPredicateType is what cosign calls SLSA provenance v1
+const cosignPredicateType = "slsaprovenance1"
+
+// VerifyOptions are the identity the provenance must be signed by. Either Key, or CertificateIdentity and
+// CertificateOIDCIssuer for keyless signing, must be set.
+type VerifyOptions struct {
+	Key                   string
+	CertificateIdentity   string
+	CertificateOIDCIssuer string
+}
+
+// CosignInstalled returns whether the cosign command is available
+func CosignInstalled() bool {
+	_, err := exec.LookPath("cosign")
+	return err == nil
+}
+
+// Attest signs the statement's predicate and attaches it to image in its registry. If key is empty, cosign signs
+// it keylessly, which asks the user to log in with an OIDC provider if it isn't running in CI.
+func Attest(statement *Statement, image, key string) error {
+	predicate, err := json.Marshal(statement.Predicate)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cog-provenance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	predicatePath := filepath.Join(dir, "predicate.json")
+	if err := os.WriteFile(predicatePath, predicate, 0o644); err != nil {
+		return err
+	}
+
+	args := []string{"attest", "--yes", "--type", cosignPredicateType, "--predicate", predicatePath}
+	if key != "" {
+		args = append(args, "--key", key)
+	}
+	args = append(args, image)
+	cmd := exec.Command("cosign", args...)
+	output := console.Writer(console.InfoLevel)
+	defer output.Close()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to attach provenance with cosign: %w", err)
+	}
+	return nil
+}
+
+// Verify checks the signatures of the provenance attached to image and returns the statements that were signed
+func Verify(image string, options VerifyOptions) ([]*Statement, error) {
+	args := []string{"verify-attestation", "--type", cosignPredicateType}
+	switch {
+	case options.Key != "":
+		args = append(args, "--key", options.Key)
+	case options.CertificateIdentity != "" && options.CertificateOIDCIssuer != "":
+		args = append(args, "--certificate-identity", options.CertificateIdentity, "--certificate-oidc-issuer", options.CertificateOIDCIssuer)
+	default:
+		return nil, fmt.Errorf("To verify provenance, pass either the key it was signed with, or the certificate identity and OIDC issuer it was signed by")
+	}
+	args = append(args, image)
+	cmd := exec.Command("cosign", args...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to verify provenance: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseVerifyOutput(out)
+}
+
+// parseVerifyOutput reads the statements out of the DSSE envelopes cosign verify-attestation prints, one per line
+func parseVerifyOutput(out []byte) ([]*Statement, error) {
+	statements := []*Statement{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		envelope := struct {
+			PayloadType string `json:"payloadType"`
+			Payload     string `json:"payload"`
+		}{}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, fmt.Errorf("Failed to parse cosign output: %w", err)
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode attestation: %w", err)
+		}
+		statement := &Statement{}
+		if err := json.Unmarshal(payload, statement); err != nil {
+			return nil, fmt.Errorf("Failed to parse attestation: %w", err)
+		}
+		statements = append(statements, statement)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
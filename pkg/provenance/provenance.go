@@ -0,0 +1,185 @@
+// Package provenance generates and checks SLSA build provenance for images built by Cog.
+//
+// The provenance is an in-toto statement (https://in-toto.io/Statement/v1) with a SLSA provenance predicate
+// (https://slsa.dev/provenance/v1). It is attached to pushed images with cosign, which stores it in the registry
+// next to the image.
+package provenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://slsa.dev/provenance/v1"
+	BuildType     = "https://github.com/replicate/cog/build/v1"
+	BuilderID     = "https://github.com/replicate/cog"
+
+	revisionLabel = "org.opencontainers.image.revision"
+)
+
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type RunDetails struct {
+	Builder  Builder   `json:"builder"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type Metadata struct {
+	StartedOn  *time.Time `json:"startedOn,omitempty"`
+	FinishedOn *time.Time `json:"finishedOn,omitempty"`
+}
+
+// Build describes a build of an image, for generating its provenance
+type Build struct {
+	// Image is the pushed image, by digest (repository@sha256:...)
+	Image string
+	// Labels are the labels Cog added to the image
+	Labels map[string]string
+	// SourceURI is where the source came from, e.g. the URL of the Git remote. It may be empty.
+	SourceURI string
+	// Parameters are the options the build was run with
+	Parameters map[string]interface{}
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+// New generates the provenance of a build
+func New(build Build) (*Statement, error) {
+	subject, err := subjectFromReference(build.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	external := map[string]interface{}{}
+	for key, value := range build.Parameters {
+		external[key] = value
+	}
+	if configJSON, ok := build.Labels[global.LabelNamespace+"config"]; ok {
+		external["config"] = json.RawMessage(configJSON)
+	}
+
+	dependencies := []ResourceDescriptor{}
+	if commit := build.Labels[revisionLabel]; commit != "" {
+		source := ResourceDescriptor{Name: "source", Digest: map[string]string{"gitCommit": commit}}
+		if build.SourceURI != "" {
+			source.URI = "git+" + build.SourceURI
+		}
+		dependencies = append(dependencies, source)
+	}
+	if sourceHash := build.Labels[global.LabelNamespace+"source_hash"]; sourceHash != "" {
+		dependencies = append(dependencies, ResourceDescriptor{Name: "files", Digest: map[string]string{"cogSourceHash": sourceHash}})
+	}
+
+	statement := &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{subject},
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType:            BuildType,
+				ExternalParameters:   external,
+				InternalParameters:   map[string]interface{}{"cogVersion": global.Version},
+				ResolvedDependencies: dependencies,
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{ID: BuilderID, Version: map[string]string{"cog": global.Version}},
+			},
+		},
+	}
+	if !build.StartedOn.IsZero() && !build.FinishedOn.IsZero() {
+		startedOn := build.StartedOn.UTC()
+		finishedOn := build.FinishedOn.UTC()
+		statement.Predicate.RunDetails.Metadata = &Metadata{StartedOn: &startedOn, FinishedOn: &finishedOn}
+	}
+	return statement, nil
+}
+
+// Check returns an error if the statement isn't provenance generated by Cog for the image with the given digest
+// reference (repository@sha256:...)
+func Check(statement *Statement, image string) error {
+	if statement.PredicateType != PredicateType {
+		return fmt.Errorf("Attestation has predicate type %s, not %s", statement.PredicateType, PredicateType)
+	}
+	if statement.Predicate.BuildDefinition.BuildType != BuildType {
+		return fmt.Errorf("Image was not built by Cog. Its build type is %s", statement.Predicate.BuildDefinition.BuildType)
+	}
+	want, err := subjectFromReference(image)
+	if err != nil {
+		return err
+	}
+	for _, subject := range statement.Subject {
+		if subject.Digest["sha256"] == want.Digest["sha256"] {
+			return nil
+		}
+	}
+	return fmt.Errorf("Provenance does not describe %s", image)
+}
+
+// SourceDescription returns a short description of the source the image was built from, for showing to users
+func (s *Statement) SourceDescription() string {
+	for _, dependency := range s.Predicate.BuildDefinition.ResolvedDependencies {
+		if commit := dependency.Digest["gitCommit"]; commit != "" {
+			if dependency.URI != "" {
+				return strings.TrimPrefix(dependency.URI, "git+") + " at commit " + commit
+			}
+			return "commit " + commit
+		}
+	}
+	for _, dependency := range s.Predicate.BuildDefinition.ResolvedDependencies {
+		if hash := dependency.Digest["cogSourceHash"]; hash != "" {
+			return "files with source hash " + hash
+		}
+	}
+	return "unknown source"
+}
+
+func subjectFromReference(image string) (Subject, error) {
+	name, digest, found := strings.Cut(image, "@")
+	if !found {
+		return Subject{}, fmt.Errorf("%s is not a reference by digest", image)
+	}
+	algorithm, hex, found := strings.Cut(digest, ":")
+	if !found || algorithm != "sha256" || hex == "" {
+		return Subject{}, fmt.Errorf("%s does not have a sha256 digest", image)
+	}
+	return Subject{Name: name, Digest: map[string]string{"sha256": hex}}, nil
+}
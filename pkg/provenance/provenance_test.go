@@ -0,0 +1,75 @@
+package provenance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const testDigest = "r8.im/user/model@sha256:0123456789abcdef"
+
+func TestNew(t *testing.T) {
+	startedOn := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	statement, err := New(Build{
+		Image: testDigest,
+		Labels: map[string]string{
+			global.LabelNamespace + "config":      `{"build":{"gpu":true}}`,
+			global.LabelNamespace + "source_hash": "abc123",
+			"org.opencontainers.image.revision":   "deadbeef",
+		},
+		SourceURI:  "https://github.com/user/model",
+		Parameters: map[string]interface{}{"separateWeights": true},
+		StartedOn:  startedOn,
+		FinishedOn: startedOn.Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, StatementType, statement.Type)
+	require.Equal(t, PredicateType, statement.PredicateType)
+	require.Equal(t, []Subject{{Name: "r8.im/user/model", Digest: map[string]string{"sha256": "0123456789abcdef"}}}, statement.Subject)
+	require.Equal(t, BuildType, statement.Predicate.BuildDefinition.BuildType)
+	require.Equal(t, true, statement.Predicate.BuildDefinition.ExternalParameters["separateWeights"])
+	require.Equal(t, []ResourceDescriptor{
+		{Name: "source", URI: "git+https://github.com/user/model", Digest: map[string]string{"gitCommit": "deadbeef"}},
+		{Name: "files", Digest: map[string]string{"cogSourceHash": "abc123"}},
+	}, statement.Predicate.BuildDefinition.ResolvedDependencies)
+	require.Equal(t, startedOn, *statement.Predicate.RunDetails.Metadata.StartedOn)
+	require.Equal(t, "https://github.com/user/model at commit deadbeef", statement.SourceDescription())
+
+	// The config is embedded as JSON, not as a string
+	out, err := json.Marshal(statement)
+	require.NoError(t, err)
+	require.Contains(t, string(out), `"config":{"build":{"gpu":true}}`)
+
+	require.NoError(t, Check(statement, testDigest))
+	require.Error(t, Check(statement, "r8.im/user/model@sha256:fedcba"))
+}
+
+func TestNewRequiresDigest(t *testing.T) {
+	_, err := New(Build{Image: "r8.im/user/model:latest"})
+	require.Error(t, err)
+}
+
+func TestParseVerifyOutput(t *testing.T) {
+	statement, err := New(Build{Image: testDigest})
+	require.NoError(t, err)
+	payload, err := json.Marshal(statement)
+	require.NoError(t, err)
+	envelope, err := json.Marshal(map[string]interface{}{
+		"payloadType": "application/vnd.in-toto+json",
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []interface{}{},
+	})
+	require.NoError(t, err)
+
+	statements, err := parseVerifyOutput(append(envelope, '\n'))
+	require.NoError(t, err)
+	require.Len(t, statements, 1)
+	require.NoError(t, Check(statements[0], testDigest))
+	require.Equal(t, "unknown source", statements[0].SourceDescription())
+}
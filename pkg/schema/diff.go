@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// Difference is a single way in which two model schemas differ
+type Difference struct {
+	// Path is the part of the schema that differs, e.g. "input.prompt" or "output"
+	Path    string
+	Message string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// Diff compares the inputs and output of two model schemas.
+// It returns an empty slice if the interfaces match.
+func Diff(from, to *openapi3.T) []Difference {
+	diffs := []Difference{}
+	diffs = append(diffs, diffInputs(Input(from), Input(to))...)
+	diffs = append(diffs, diffSchemas("output", Output(from), Output(to))...)
+	return diffs
+}
+
+func diffInputs(from, to *openapi3.Schema) []Difference {
+	diffs := []Difference{}
+	fromProps := openapi3.Schemas{}
+	toProps := openapi3.Schemas{}
+	fromRequired := []string{}
+	toRequired := []string{}
+	if from != nil {
+		fromProps = from.Properties
+		fromRequired = from.Required
+	}
+	if to != nil {
+		toProps = to.Properties
+		toRequired = to.Required
+	}
+
+	names := map[string]bool{}
+	for name := range fromProps {
+		names[name] = true
+	}
+	for name := range toProps {
+		names[name] = true
+	}
+
+	for _, name := range slices.StringKeys(names) {
+		path := "input." + name
+		fromProp, inFrom := fromProps[name]
+		toProp, inTo := toProps[name]
+		switch {
+		case !inTo:
+			diffs = append(diffs, Difference{Path: path, Message: "removed"})
+		case !inFrom:
+			message := "added"
+			if slices.ContainsString(toRequired, name) {
+				message = "added (required)"
+			}
+			diffs = append(diffs, Difference{Path: path, Message: message})
+		default:
+			diffs = append(diffs, diffSchemas(path, Resolve(fromProp), Resolve(toProp))...)
+			fromReq := slices.ContainsString(fromRequired, name)
+			toReq := slices.ContainsString(toRequired, name)
+			if fromReq && !toReq {
+				diffs = append(diffs, Difference{Path: path, Message: "no longer required"})
+			} else if !fromReq && toReq {
+				diffs = append(diffs, Difference{Path: path, Message: "now required"})
+			}
+		}
+	}
+	return diffs
+}
+
+func diffSchemas(path string, from, to *openapi3.Schema) []Difference {
+	if from == nil && to == nil {
+		return []Difference{}
+	}
+	if from == nil {
+		return []Difference{{Path: path, Message: "added"}}
+	}
+	if to == nil {
+		return []Difference{{Path: path, Message: "removed"}}
+	}
+
+	diffs := []Difference{}
+	fromType, toType := TypeName(from), TypeName(to)
+	if fromType != toType {
+		diffs = append(diffs, Difference{Path: path, Message: fmt.Sprintf("type changed from %s to %s", fromType, toType)})
+	}
+	if !sameEnum(from.Enum, to.Enum) {
+		diffs = append(diffs, Difference{Path: path, Message: fmt.Sprintf("choices changed from %v to %v", from.Enum, to.Enum)})
+	}
+	return diffs
+}
+
+func sameEnum(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := make([]string, len(a))
+	bs := make([]string, len(b))
+	for i := range a {
+		as[i] = fmt.Sprint(a[i])
+		bs[i] = fmt.Sprint(b[i])
+	}
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSchema(t *testing.T, components string) *openapi3.T {
+	s, err := openapi3.NewLoader().LoadFromData([]byte(`{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {"schemas": ` + components + `}
+}`))
+	require.NoError(t, err)
+	return s
+}
+
+func TestDiffIdentical(t *testing.T) {
+	components := `{
+  "Input": {
+    "type": "object",
+    "properties": {
+      "prompt": {"type": "string", "x-order": 0},
+      "steps": {"type": "integer", "x-order": 1}
+    },
+    "required": ["prompt"]
+  },
+  "Output": {"type": "string", "format": "uri"}
+}`
+	require.Empty(t, Diff(loadSchema(t, components), loadSchema(t, components)))
+}
+
+func TestDiffChanges(t *testing.T) {
+	from := loadSchema(t, `{
+  "Input": {
+    "type": "object",
+    "properties": {
+      "prompt": {"type": "string"},
+      "steps": {"type": "integer"},
+      "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}]}
+    },
+    "required": ["prompt"]
+  },
+  "scheduler": {"type": "string", "enum": ["DDIM", "K_EULER"]},
+  "Output": {"type": "string", "format": "uri"}
+}`)
+	to := loadSchema(t, `{
+  "Input": {
+    "type": "object",
+    "properties": {
+      "prompt": {"type": "string"},
+      "steps": {"type": "number"},
+      "seed": {"type": "integer"},
+      "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}]}
+    },
+    "required": ["prompt", "seed"]
+  },
+  "scheduler": {"type": "string", "enum": ["DDIM"]},
+  "Output": {"type": "array", "items": {"type": "string", "format": "uri"}}
+}`)
+
+	diffs := []string{}
+	for _, d := range Diff(from, to) {
+		diffs = append(diffs, d.String())
+	}
+	require.Equal(t, []string{
+		"input.scheduler: choices changed from [DDIM K_EULER] to [DDIM]",
+		"input.seed: added (required)",
+		"input.steps: type changed from integer to number",
+		"output: type changed from string (uri) to array of string (uri)",
+	}, diffs)
+}
+
+func TestInputNamesOrder(t *testing.T) {
+	s := loadSchema(t, `{
+  "Input": {
+    "type": "object",
+    "properties": {
+      "b": {"type": "string", "x-order": 0},
+      "a": {"type": "string", "x-order": 1}
+    }
+  }
+}`)
+	require.Equal(t, []string{"b", "a"}, InputNames(s))
+}
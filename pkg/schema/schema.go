@@ -0,0 +1,192 @@
+// Package schema provides helpers for working with the OpenAPI schemas that Cog models expose
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Input returns the schema for a model's inputs, or nil if the model doesn't define one
+func Input(s *openapi3.T) *openapi3.Schema {
+	return component(s, "Input")
+}
+
+// Output returns the schema for a model's output, or nil if the model doesn't define one
+func Output(s *openapi3.T) *openapi3.Schema {
+	return component(s, "Output")
+}
+
+func component(s *openapi3.T, name string) *openapi3.Schema {
+	if s == nil || s.Components == nil {
+		return nil
+	}
+	ref, ok := s.Components.Schemas[name]
+	if !ok || ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+// InputNames returns the names of a model's inputs, sorted by the order Cog declared them in
+func InputNames(s *openapi3.T) []string {
+	input := Input(s)
+	if input == nil {
+		return []string{}
+	}
+	names := make([]string, 0, len(input.Properties))
+	for name := range input.Properties {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return order(input.Properties[names[i]]) < order(input.Properties[names[j]])
+	})
+	return names
+}
+
+// order returns the x-order extension Cog uses to record the order inputs were declared in
+func order(ref *openapi3.SchemaRef) float64 {
+	if ref == nil || ref.Value == nil {
+		return 0
+	}
+	if o, ok := ref.Value.Extensions["x-order"].(float64); ok {
+		return o
+	}
+	return 0
+}
+
+// Resolve returns the schema that a property actually refers to.
+// Cog wraps enums in a single-item allOf that points at the enum definition.
+func Resolve(ref *openapi3.SchemaRef) *openapi3.Schema {
+	if ref == nil || ref.Value == nil {
+		return nil
+	}
+	s := ref.Value
+	if s.Type == "" && len(s.AllOf) == 1 && s.AllOf[0].Value != nil {
+		return s.AllOf[0].Value
+	}
+	return s
+}
+
+// TypeName returns a short human-readable description of a schema's type, e.g. "string", "string (uri)" or "array of integer"
+func TypeName(s *openapi3.Schema) string {
+	if s == nil {
+		return "any"
+	}
+	switch {
+	case s.Type == "array":
+		if s.Items != nil {
+			return "array of " + TypeName(Resolve(s.Items))
+		}
+		return "array"
+	case s.Type == "" && len(s.AnyOf) > 0:
+		types := []string{}
+		for _, ref := range s.AnyOf {
+			types = append(types, TypeName(Resolve(ref)))
+		}
+		return strings.Join(types, " | ")
+	case s.Type == "":
+		return "any"
+	case s.Format != "":
+		return fmt.Sprintf("%s (%s)", s.Type, s.Format)
+	}
+	return s.Type
+}
+
+// JSONSchema returns the model's input and output schemas as standalone JSON Schemas, with references to other OpenAPI
+// components inlined
+func JSONSchema(s *openapi3.T) map[string]interface{} {
+	result := map[string]interface{}{}
+	if input := Input(s); input != nil {
+		result["input"] = inlineComponents(input)
+	}
+	if output := Output(s); output != nil {
+		result["output"] = inlineComponents(output)
+	}
+	return result
+}
+
+// componentRefPrefix is the start of references to OpenAPI components
+const componentRefPrefix = "#/components/schemas/"
+
+// inliner replaces the $refs in schemas with the schemas they point to
+type inliner struct {
+	// visiting is the schemas that are being inlined further up, so a schema that refers to itself, like a tree,
+	// keeps its $ref rather than being inlined forever
+	visiting map[*openapi3.Schema]bool
+	// defs is the components that are still referred to, by name
+	defs map[string]*openapi3.Schema
+}
+
+// inlineComponents returns a copy of s with all $refs replaced by the schemas they point to. Components that refer to
+// themselves can't be inlined, so they're put in $defs in the result, and referred to there.
+func inlineComponents(s *openapi3.Schema) *openapi3.Schema {
+	in := &inliner{visiting: map[*openapi3.Schema]bool{}, defs: map[string]*openapi3.Schema{}}
+	result := in.inline(s)
+	if len(in.defs) == 0 {
+		return result
+	}
+	// Inlining the components can refer to more of them
+	defs := map[string]*openapi3.Schema{}
+	for len(defs) < len(in.defs) {
+		for name, def := range in.defs {
+			if _, ok := defs[name]; !ok {
+				defs[name] = in.inline(def)
+			}
+		}
+	}
+	extensions := map[string]interface{}{"$defs": defs}
+	for key, value := range result.Extensions {
+		extensions[key] = value
+	}
+	result.Extensions = extensions
+	return result
+}
+
+func (in *inliner) inline(s *openapi3.Schema) *openapi3.Schema {
+	if s == nil {
+		return nil
+	}
+	in.visiting[s] = true
+	defer delete(in.visiting, s)
+	c := *s
+	c.Properties = openapi3.Schemas{}
+	for name, prop := range s.Properties {
+		c.Properties[name] = in.inlineRef(prop)
+	}
+	c.Items = in.inlineRef(s.Items)
+	c.Not = in.inlineRef(s.Not)
+	c.AdditionalProperties.Schema = in.inlineRef(s.AdditionalProperties.Schema)
+	c.AllOf = in.inlineRefs(s.AllOf)
+	c.AnyOf = in.inlineRefs(s.AnyOf)
+	c.OneOf = in.inlineRefs(s.OneOf)
+	return &c
+}
+
+func (in *inliner) inlineRef(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref == nil {
+		return nil
+	}
+	if in.visiting[ref.Value] {
+		name, ok := strings.CutPrefix(ref.Ref, componentRefPrefix)
+		if !ok {
+			return openapi3.NewSchemaRef("", &openapi3.Schema{})
+		}
+		in.defs[name] = ref.Value
+		return openapi3.NewSchemaRef("#/$defs/"+name, nil)
+	}
+	return openapi3.NewSchemaRef("", in.inline(ref.Value))
+}
+
+func (in *inliner) inlineRefs(refs openapi3.SchemaRefs) openapi3.SchemaRefs {
+	if refs == nil {
+		return nil
+	}
+	inlined := openapi3.SchemaRefs{}
+	for _, ref := range refs {
+		inlined = append(inlined, in.inlineRef(ref))
+	}
+	return inlined
+}
@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputNames(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		components string
+		expected   []string
+	}{
+		{
+			name:       "no input",
+			components: `{"Output": {"type": "string"}}`,
+			expected:   []string{},
+		},
+		{
+			name: "sorted by x-order",
+			components: `{"Input": {"type": "object", "properties": {
+  "steps": {"type": "integer", "x-order": 2},
+  "prompt": {"type": "string", "x-order": 0},
+  "seed": {"type": "integer", "x-order": 1}
+}}}`,
+			expected: []string{"prompt", "seed", "steps"},
+		},
+		{
+			name:       "one input without x-order",
+			components: `{"Input": {"type": "object", "properties": {"prompt": {"type": "string"}}}}`,
+			expected:   []string{"prompt"},
+		},
+	} {
+		require.Equal(t, tt.expected, InputNames(loadSchema(t, tt.components)), tt.name)
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	for _, tt := range []struct {
+		schema   *openapi3.Schema
+		expected string
+	}{
+		{nil, "any"},
+		{&openapi3.Schema{}, "any"},
+		{&openapi3.Schema{Type: "string"}, "string"},
+		{&openapi3.Schema{Type: "string", Format: "uri"}, "string (uri)"},
+		{&openapi3.Schema{Type: "array"}, "array"},
+		{&openapi3.Schema{Type: "array", Items: openapi3.NewSchemaRef("", &openapi3.Schema{Type: "integer"})}, "array of integer"},
+		{&openapi3.Schema{AnyOf: openapi3.SchemaRefs{
+			openapi3.NewSchemaRef("", &openapi3.Schema{Type: "string"}),
+			openapi3.NewSchemaRef("", &openapi3.Schema{Type: "number"}),
+		}}, "string | number"},
+		// Enums are wrapped in an allOf that points at them
+		{&openapi3.Schema{Type: "array", Items: openapi3.NewSchemaRef("", &openapi3.Schema{AllOf: openapi3.SchemaRefs{
+			openapi3.NewSchemaRef("#/components/schemas/scheduler", &openapi3.Schema{Type: "string", Enum: []interface{}{"DDIM"}}),
+		}})}, "array of string"},
+	} {
+		require.Equal(t, tt.expected, TypeName(tt.schema))
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		components string
+		expected   string
+	}{
+		{
+			name:       "no input or output",
+			components: `{}`,
+			expected:   `{}`,
+		},
+		{
+			name: "refs are inlined",
+			components: `{
+  "Input": {"type": "object", "properties": {"scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}]}}},
+  "scheduler": {"type": "string", "enum": ["DDIM", "K_EULER"]},
+  "Output": {"type": "array", "items": {"$ref": "#/components/schemas/Image"}},
+  "Image": {"type": "string", "format": "uri"}
+}`,
+			expected: `{
+  "input": {"type": "object", "properties": {"scheduler": {"allOf": [{"type": "string", "enum": ["DDIM", "K_EULER"]}]}}},
+  "output": {"type": "array", "items": {"type": "string", "format": "uri"}}
+}`,
+		},
+	} {
+		result, err := json.Marshal(JSONSchema(loadSchema(t, tt.components)))
+		require.NoError(t, err, tt.name)
+		require.JSONEq(t, tt.expected, string(result), tt.name)
+	}
+}
+
+func TestJSONSchemaSelfReference(t *testing.T) {
+	// A tree, whose nodes have nodes as children
+	node := &openapi3.Schema{Type: "object"}
+	node.Properties = openapi3.Schemas{
+		"children": openapi3.NewSchemaRef("", &openapi3.Schema{Type: "array", Items: openapi3.NewSchemaRef("#/components/schemas/Node", node)}),
+	}
+	s := &openapi3.T{Components: &openapi3.Components{Schemas: openapi3.Schemas{"Output": openapi3.NewSchemaRef("", node)}}}
+
+	result, err := json.Marshal(JSONSchema(s))
+	require.NoError(t, err)
+	// The reference is to $defs, so it resolves in the JSON Schema
+	require.JSONEq(t, `{"output": {
+  "type": "object",
+  "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}}},
+  "$defs": {"Node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}}}}}
+}}`, string(result))
+}
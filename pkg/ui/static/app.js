@@ -0,0 +1,301 @@
+// Renders a form for a Cog model from its OpenAPI schema and runs predictions with it.
+// The model's URL is set in config.js as window.COG_ENDPOINT. If it is empty, the page is assumed to be served by the model.
+(function () {
+  "use strict";
+
+  var endpoint = (window.COG_ENDPOINT || "").replace(/\/$/, "");
+  var schema = null;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function resolve(prop) {
+    if (prop && prop.$ref) {
+      return lookup(prop.$ref);
+    }
+    if (prop && !prop.type && prop.allOf && prop.allOf.length === 1) {
+      return resolve(prop.allOf[0]);
+    }
+    return prop || {};
+  }
+
+  function lookup(ref) {
+    var name = ref.replace("#/components/schemas/", "");
+    return schema.components.schemas[name] || {};
+  }
+
+  function typeName(prop) {
+    prop = resolve(prop);
+    if (prop.type === "array") {
+      return "array of " + typeName(prop.items);
+    }
+    if (prop.format) {
+      return prop.type + " (" + prop.format + ")";
+    }
+    return prop.type || "any";
+  }
+
+  function renderField(name, raw, required) {
+    var prop = resolve(raw);
+    var field = document.createElement("div");
+    field.className = "field";
+
+    var label = document.createElement("label");
+    label.htmlFor = "input-" + name;
+    label.textContent = name + (required ? " *" : "") + " ";
+    var type = document.createElement("span");
+    type.className = "type";
+    type.textContent = typeName(raw);
+    label.appendChild(type);
+    field.appendChild(label);
+
+    var input;
+    if (prop.enum) {
+      input = document.createElement("select");
+      prop.enum.forEach(function (value) {
+        var option = document.createElement("option");
+        option.value = value;
+        option.textContent = value;
+        input.appendChild(option);
+      });
+    } else if (prop.type === "boolean") {
+      input = document.createElement("input");
+      input.type = "checkbox";
+    } else if (prop.type === "string" && prop.format === "uri") {
+      input = document.createElement("input");
+      input.type = "file";
+    } else if (prop.type === "integer" || prop.type === "number") {
+      input = document.createElement("input");
+      input.type = "number";
+      input.step = prop.type === "integer" ? "1" : "any";
+      if (prop.minimum !== undefined) input.min = prop.minimum;
+      if (prop.maximum !== undefined) input.max = prop.maximum;
+    } else if (prop.type === "string") {
+      input = document.createElement("textarea");
+      input.rows = 2;
+    } else {
+      input = document.createElement("textarea");
+      input.rows = 3;
+      input.placeholder = "JSON";
+    }
+    input.id = "input-" + name;
+    input.name = name;
+    input.dataset.type = prop.type || "json";
+    input.dataset.format = prop.format || "";
+
+    var defaultValue = raw.default !== undefined ? raw.default : prop.default;
+    if (defaultValue !== undefined && input.type !== "file") {
+      if (input.type === "checkbox") {
+        input.checked = !!defaultValue;
+      } else if (input.dataset.type === "json") {
+        input.value = JSON.stringify(defaultValue);
+      } else {
+        input.value = defaultValue;
+      }
+    }
+    field.appendChild(input);
+
+    var description = raw.description || prop.description;
+    if (description) {
+      var p = document.createElement("div");
+      p.className = "description";
+      p.textContent = description;
+      field.appendChild(p);
+    }
+    return field;
+  }
+
+  function renderForm() {
+    var input = schema.components.schemas.Input || { properties: {} };
+    var required = input.required || [];
+    var names = Object.keys(input.properties || {});
+    names.sort(function (a, b) {
+      return (input.properties[a]["x-order"] || 0) - (input.properties[b]["x-order"] || 0);
+    });
+    var container = $("inputs");
+    container.innerHTML = "";
+    names.forEach(function (name) {
+      container.appendChild(renderField(name, input.properties[name], required.indexOf(name) >= 0));
+    });
+  }
+
+  function readFile(file) {
+    return new Promise(function (resolve, reject) {
+      var reader = new FileReader();
+      reader.onload = function () {
+        resolve(reader.result);
+      };
+      reader.onerror = reject;
+      reader.readAsDataURL(file);
+    });
+  }
+
+  function setFieldError(field, message) {
+    var container = field.parentNode;
+    var error = container.querySelector(".field-error");
+    if (!message) {
+      if (error) container.removeChild(error);
+      return;
+    }
+    if (!error) {
+      error = document.createElement("div");
+      error.className = "field-error error";
+      container.appendChild(error);
+    }
+    error.textContent = message;
+  }
+
+  function collectInput() {
+    var fields = $("inputs").querySelectorAll("input, select, textarea");
+    var input = {};
+    var pending = [];
+    var invalid = [];
+    fields.forEach(function (field) {
+      var name = field.name;
+      var type = field.dataset.type;
+      setFieldError(field, null);
+      if (field.type === "file") {
+        if (field.files.length > 0) {
+          pending.push(
+            readFile(field.files[0]).then(function (url) {
+              input[name] = url;
+            })
+          );
+        }
+      } else if (field.type === "checkbox") {
+        input[name] = field.checked;
+      } else if (field.value === "") {
+        return;
+      } else if (type === "integer" || type === "number") {
+        input[name] = Number(field.value);
+      } else if (type === "json") {
+        try {
+          input[name] = JSON.parse(field.value);
+        } catch (err) {
+          setFieldError(field, "Invalid JSON: " + err.message);
+          invalid.push(name);
+        }
+      } else {
+        input[name] = field.value;
+      }
+    });
+    if (invalid.length > 0) {
+      return Promise.reject(new Error("Invalid input: " + invalid.join(", ")));
+    }
+    return Promise.all(pending).then(function () {
+      return input;
+    });
+  }
+
+  function mediaKind(value) {
+    var match = /^data:(image|audio|video)\//.exec(value);
+    if (match) {
+      return match[1];
+    }
+    var path = value.split("?")[0].toLowerCase();
+    if (/\.(png|jpe?g|gif|webp|bmp|svg)$/.test(path)) return "image";
+    if (/\.(wav|mp3|ogg|flac|m4a)$/.test(path)) return "audio";
+    if (/\.(mp4|webm|mov)$/.test(path)) return "video";
+    return null;
+  }
+
+  function renderValue(container, value) {
+    if (Array.isArray(value) && value.every(function (v) { return typeof v === "string" && mediaKind(v); })) {
+      value.forEach(function (v) {
+        renderValue(container, v);
+      });
+      return;
+    }
+    if (typeof value === "string") {
+      var kind = mediaKind(value);
+      if (kind) {
+        var el = document.createElement(kind === "image" ? "img" : kind);
+        el.src = value;
+        if (kind !== "image") el.controls = true;
+        container.appendChild(el);
+        return;
+      }
+      if (/^data:/.test(value)) {
+        var a = document.createElement("a");
+        a.href = value;
+        a.download = "output";
+        a.textContent = "Download output";
+        container.appendChild(a);
+        return;
+      }
+    }
+    var pre = document.createElement("pre");
+    pre.textContent = typeof value === "string" ? value : JSON.stringify(value, null, 2);
+    container.appendChild(pre);
+  }
+
+  function setStatus(text, isError) {
+    $("status").textContent = text;
+    $("status").className = isError ? "error" : "";
+  }
+
+  function predict(event) {
+    event.preventDefault();
+    $("submit").disabled = true;
+    $("output").innerHTML = "";
+    $("logs").textContent = "";
+    setStatus("Running...");
+    var started = Date.now();
+
+    collectInput()
+      .then(function (input) {
+        return fetch(endpoint + "/predictions", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ input: input }),
+        });
+      })
+      .then(function (resp) {
+        return resp.json().then(function (body) {
+          if (!resp.ok) {
+            throw new Error(body.detail ? JSON.stringify(body.detail, null, 2) : "Request failed with status " + resp.status);
+          }
+          return body;
+        });
+      })
+      .then(function (prediction) {
+        var seconds = ((Date.now() - started) / 1000).toFixed(1);
+        if (prediction.status !== "succeeded") {
+          setStatus("Prediction " + prediction.status + ": " + (prediction.error || ""), true);
+        } else {
+          setStatus("Finished in " + seconds + "s");
+          renderValue($("output"), prediction.output);
+        }
+        $("logs").textContent = prediction.logs || "";
+      })
+      .catch(function (err) {
+        setStatus(err.message, true);
+      })
+      .then(function () {
+        $("submit").disabled = false;
+      });
+  }
+
+  $("endpoint").textContent = endpoint || window.location.origin;
+  $("form").addEventListener("submit", predict);
+
+  fetch(endpoint + "/openapi.json")
+    .then(function (resp) {
+      if (!resp.ok) {
+        throw new Error("Failed to get OpenAPI schema: " + resp.status);
+      }
+      return resp.json();
+    })
+    .then(function (s) {
+      schema = s;
+      if (schema.info && schema.info.title) {
+        document.title = schema.info.title;
+        $("title").textContent = schema.info.title;
+      }
+      renderForm();
+    })
+    .catch(function (err) {
+      setStatus(err.message, true);
+    });
+})();
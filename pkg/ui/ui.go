@@ -0,0 +1,63 @@
+// Package ui is a small web UI for trying out a model. It renders a form from the model's OpenAPI schema.
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+//go:embed static
+var static embed.FS
+
+// ConfigJS returns the contents of config.js, which tells the UI the URL of the model's HTTP API.
+// If endpoint is empty, the UI uses the server it is served from.
+func ConfigJS(endpoint string) []byte {
+	encoded, _ := json.Marshal(endpoint)
+	return []byte(fmt.Sprintf("window.COG_ENDPOINT = %s;\n", encoded))
+}
+
+// Handler serves the UI for a model served at endpoint
+func Handler(endpoint string) http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServer(http.FS(files))
+	config := ConfigJS(endpoint)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config.js" {
+			w.Header().Set("Content-Type", "text/javascript")
+			_, _ = w.Write(config)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// Export writes the UI to dir as static files, configured to use the model served at endpoint
+func Export(dir string, endpoint string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	entries, err := static.ReadDir("static")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		contents, err := static.ReadFile(path.Join("static", entry.Name()))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), contents, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "config.js"), ConfigJS(endpoint), 0o644)
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, path string) string {
+	rec := httptest.NewRecorder()
+	Handler("http://localhost:5000").ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	require.Equal(t, 200, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestHandlerServesIndex(t *testing.T) {
+	require.Contains(t, get(t, "/"), `<script src="app.js"></script>`)
+}
+
+func TestHandlerServesConfig(t *testing.T) {
+	require.Equal(t, "window.COG_ENDPOINT = \"http://localhost:5000\";\n", get(t, "/config.js"))
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Export(dir, "https://my-model.internal"))
+
+	for _, name := range []string{"index.html", "app.js", "style.css"} {
+		require.FileExists(t, filepath.Join(dir, name))
+	}
+	config, err := os.ReadFile(filepath.Join(dir, "config.js"))
+	require.NoError(t, err)
+	require.Equal(t, "window.COG_ENDPOINT = \"https://my-model.internal\";\n", string(config))
+}
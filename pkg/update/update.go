@@ -12,8 +12,13 @@ import (
 
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/httpclient"
 )
 
+// updateCheckTimeout is how long to wait for the update check, which is short so it doesn't hold up the command if
+// the server is slow
+const updateCheckTimeout = time.Second
+
 func isUpdateEnabled() bool {
 	return os.Getenv("COG_NO_UPDATE_CHECK") == ""
 }
@@ -52,7 +57,7 @@ func DisplayAndCheckForRelease() error {
 func startCheckingForRelease() {
 	go func() {
 		console.Debugf("Checking for updates...")
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
 		defer cancel()
 		switch r, err := checkForRelease(ctx); {
 		case err == nil:
@@ -89,7 +94,7 @@ func checkForRelease(ctx context.Context) (*updateCheckResponse, error) {
 	q.Add("arch", runtime.GOARCH)
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.New(updateCheckTimeout).Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -2,10 +2,15 @@
 package console
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 )
@@ -16,10 +21,26 @@ import (
 // - Console user interface elements (progress, interactive prompts, etc)
 // - Switching between human and machine modes for these things (e.g. don't display progress bars or colors in logs, don't prompt for input when in a script)
 type Console struct {
-	Color     bool
+	Color bool
+	// IsMachine makes messages be written as a JSON object per line, for logs that are read by other programs
 	IsMachine bool
 	Level     Level
 	mu        sync.Mutex
+
+	// stderr is where messages are written. If it's nil, they are written to os.Stderr.
+	stderr io.Writer
+	// stdin is where answers to prompts are read from. If it's nil, they are read from os.Stdin.
+	stdin       io.Reader
+	stdinReader *bufio.Reader
+	// status is the line a spinner or progress bar has drawn at the bottom of stderr, if there is one
+	status string
+}
+
+// machineMessage is how a message is written in machine mode
+type machineMessage struct {
+	Level   string    `json:"level"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
 }
 
 // Debug prints a verbose debugging message, that is not displayed by default to the user.
@@ -79,7 +100,37 @@ func (c *Console) Fatalf(msg string, v ...interface{}) {
 func (c *Console) Output(s string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	fmt.Fprintln(os.Stdout, s)
+	c.withoutStatus(func() {
+		fmt.Fprintln(os.Stdout, s)
+	})
+}
+
+// OutputPart writes a string to stdout without adding a newline, for output that's printed a piece at a time, like
+// the tokens of a language model. Call Output("") to end the line.
+func (c *Console) OutputPart(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.withoutStatus(func() {
+		fmt.Fprint(os.Stdout, s)
+	})
+}
+
+// Writer returns a writer for the output of other programs, like Docker or a model. Each line written to it is
+// logged as a message of the given level in machine mode, and otherwise it's written to stderr as it is. Close it
+// when the program has finished, so the last line is logged even if it doesn't end in a newline.
+func (c *Console) Writer(level Level) io.WriteCloser {
+	if !c.IsMachine {
+		return nopCloser{c.errWriter()}
+	}
+	return &lineWriter{console: c, level: level}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
 
 func (c *Console) log(level Level, msg string) {
@@ -87,6 +138,11 @@ func (c *Console) log(level Level, msg string) {
 		return
 	}
 
+	if c.IsMachine {
+		c.logJSON(level, msg)
+		return
+	}
+
 	prompt := ""
 	formattedMsg := msg
 
@@ -103,11 +159,87 @@ func (c *Console) log(level Level, msg string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	for _, line := range strings.Split(formattedMsg, "\n") {
-		if c.Color && level == DebugLevel {
-			line = aurora.Faint(line).String()
+	c.withoutStatus(func() {
+		for _, line := range strings.Split(formattedMsg, "\n") {
+			if c.Color && level == DebugLevel {
+				line = aurora.Faint(line).String()
+			}
+			line = prompt + line
+			fmt.Fprintln(c.errWriter(), line)
 		}
-		line = prompt + line
-		fmt.Fprintln(os.Stderr, line)
+	})
+}
+
+// withoutStatus removes the line drawn by a spinner or progress bar while write writes, and then draws it again
+// below what was written. It must be called with the lock held.
+func (c *Console) withoutStatus(write func()) {
+	if c.status == "" {
+		write()
+		return
+	}
+	fmt.Fprint(c.errWriter(), "\r\033[K")
+	write()
+	fmt.Fprint(c.errWriter(), c.status)
+}
+
+func (c *Console) logJSON(level Level, msg string) {
+	data, err := json.Marshal(machineMessage{Level: level.String(), Time: time.Now().UTC(), Message: msg})
+	if err != nil {
+		// It's only strings, so this can't happen
+		panic(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(c.errWriter(), string(data))
+}
+
+func (c *Console) errWriter() io.Writer {
+	if c.stderr != nil {
+		return c.stderr
+	}
+	return os.Stderr
+}
+
+// lineWriter logs each line written to it as a message
+type lineWriter struct {
+	console *Console
+	level   Level
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		// Progress bars redraw the line with \r, so only the last version of it is logged
+		line := w.partial[:i]
+		if j := bytes.LastIndexByte(bytes.TrimRight(line, "\r"), '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		if line := strings.TrimRight(string(line), "\r"); strings.TrimSpace(line) != "" {
+			w.console.log(w.level, line)
+		}
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close logs what has been written since the last newline, if anything
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	partial := len(w.partial) > 0
+	w.mu.Unlock()
+	if partial {
+		_, err := w.Write([]byte("\n"))
+		return err
 	}
+	return nil
 }
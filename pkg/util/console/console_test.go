@@ -0,0 +1,56 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineLog(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{IsMachine: true, Level: InfoLevel, stderr: out}
+
+	c.Debug("hidden")
+	c.Warnf("Disk is %d%% full\nor so", 90)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 1)
+	var msg machineMessage
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &msg))
+	require.Equal(t, "warn", msg.Level)
+	require.Equal(t, "Disk is 90% full\nor so", msg.Message)
+	require.False(t, msg.Time.IsZero())
+}
+
+func TestMachineWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{IsMachine: true, Level: InfoLevel, stderr: out}
+
+	w := c.Writer(InfoLevel)
+	_, err := w.Write([]byte("Loading model\nDownloading 10%\rDownloading 100%\r\n\nPartial"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" line\nNo newline at the end"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg machineMessage
+		require.NoError(t, json.Unmarshal([]byte(line), &msg))
+		require.Equal(t, "info", msg.Level)
+		messages = append(messages, msg.Message)
+	}
+	require.Equal(t, []string{"Loading model", "Downloading 100%", "Partial line", "No newline at the end"}, messages)
+}
+
+func TestWriterNotMachine(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{Level: InfoLevel, stderr: out}
+
+	_, err := c.Writer(InfoLevel).Write([]byte("raw\r"))
+	require.NoError(t, err)
+	require.Equal(t, "raw\r", out.String())
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"io"
 	"os"
 
 	"github.com/mattn/go-isatty"
@@ -23,6 +24,17 @@ func SetColor(color bool) {
 	ConsoleInstance.Color = color
 }
 
+// SetMachine sets whether to write messages as JSON, for logs that are read by other programs
+func SetMachine(machine bool) {
+	ConsoleInstance.IsMachine = machine
+}
+
+// Writer returns a writer for the output of other programs, which logs each line as a message of the given level in
+// machine mode. Close it when the program has finished.
+func Writer(level Level) io.WriteCloser {
+	return ConsoleInstance.Writer(level)
+}
+
 // Debug level message.
 func Debug(msg string) {
 	ConsoleInstance.Debug(msg)
@@ -73,12 +85,51 @@ func Fatalf(msg string, v ...interface{}) {
 	ConsoleInstance.Fatalf(msg, v...)
 }
 
+// Confirm asks a yes or no question, and returns whether the answer is yes. The default is no, which is also the
+// answer in machine mode.
+func Confirm(prompt string) bool {
+	return ConsoleInstance.Confirm(prompt)
+}
+
+// Ask asks for a line of text. In machine mode, it returns ErrNotInteractive.
+func Ask(prompt string) (string, error) {
+	return ConsoleInstance.Ask(prompt)
+}
+
+// AskSecret asks for a line of text without showing what's typed. In machine mode, it returns ErrNotInteractive.
+func AskSecret(prompt string) (string, error) {
+	return ConsoleInstance.AskSecret(prompt)
+}
+
 // Output a line to stdout. Useful for printing primary output of a command, or the output of a subcommand.
 func Output(s string) {
 	ConsoleInstance.Output(s)
 }
 
+// OutputPart writes part of a line to stdout, for output that's printed a piece at a time
+func OutputPart(s string) {
+	ConsoleInstance.OutputPart(s)
+}
+
 // IsTTY checks if a file is a TTY or not. E.g. IsTTY(os.Stdin)
 func IsTTY(f *os.File) bool {
 	return isatty.IsTerminal(f.Fd())
 }
+
+// IsAnimated returns whether stderr is a terminal that spinners and progress bars, and the progress output of other
+// programs like docker, can be drawn on
+func IsAnimated() bool {
+	return ConsoleInstance.animated()
+}
+
+// StartSpinner shows a spinner with a message, like "Pushing image", until Stop is called. In machine mode, or if
+// stderr isn't a terminal, the message is logged instead.
+func StartSpinner(message string) *Spinner {
+	return ConsoleInstance.StartSpinner(message)
+}
+
+// NewProgressBar returns a progress bar for an operation that's total long. In machine mode, or if stderr isn't a
+// terminal, the percentage is logged every 10% instead.
+func NewProgressBar(message string, total int64, bytes bool) *ProgressBar {
+	return ConsoleInstance.NewProgressBar(message, total, bytes)
+}
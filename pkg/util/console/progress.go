@@ -0,0 +1,206 @@
+package console
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	spinnerInterval  = 100 * time.Millisecond
+	progressInterval = 100 * time.Millisecond
+	progressBarWidth = 30
+	// progressLogStep is how often progress is logged, in percent, when it can't be drawn
+	progressLogStep = 10
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner shows that something is happening while an operation of unknown length runs. In a terminal, it's drawn
+// on the last line of stderr with how long the operation has taken. Otherwise, the message is logged when it starts
+// and when it stops, so machine mode gets a message for each.
+type Spinner struct {
+	console *Console
+	message string
+	started time.Time
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// StartSpinner shows a spinner with a message, like "Pushing image", until Stop is called
+func (c *Console) StartSpinner(message string) *Spinner {
+	s := &Spinner{console: c, message: message, started: time.Now(), done: make(chan struct{})}
+	if !c.animated() {
+		c.Info(message + "...")
+		return s
+	}
+	s.stopped.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *Spinner) run() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		elapsed := time.Since(s.started).Truncate(time.Second)
+		s.console.setStatus(fmt.Sprintf("%s %s... (%s)", spinnerFrames[frame%len(spinnerFrames)], s.message, elapsed))
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop removes the spinner and logs message in its place, if it isn't empty. It's safe to call more than once.
+func (s *Spinner) Stop(message string) {
+	s.once.Do(func() {
+		close(s.done)
+		s.stopped.Wait()
+		s.console.clearStatus()
+		if message != "" {
+			s.console.Info(message)
+		}
+	})
+}
+
+// ProgressBar shows how much of an operation of known length, like an upload, has been done. In a terminal, it's
+// drawn as a bar on the last line of stderr. Otherwise, the percentage is logged every 10%.
+type ProgressBar struct {
+	console *Console
+	message string
+	total   int64
+	// bytes makes the amounts be shown as sizes, like 12MB / 1.2GB
+	bytes bool
+
+	mu       sync.Mutex
+	current  int64
+	drawn    time.Time
+	logged   int
+	finished bool
+}
+
+// NewProgressBar returns a progress bar for an operation that's total long. If bytes is set, the amounts are shown as
+// sizes.
+func (c *Console) NewProgressBar(message string, total int64, bytes bool) *ProgressBar {
+	return &ProgressBar{console: c, message: message, total: total, bytes: bytes, logged: -1}
+}
+
+// Set sets how much has been done
+func (p *ProgressBar) Set(current int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.set(current)
+}
+
+// Add adds to how much has been done. It's safe to call from several goroutines.
+func (p *ProgressBar) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.set(p.current + n)
+}
+
+func (p *ProgressBar) set(current int64) {
+	if p.finished {
+		return
+	}
+	if current > p.total {
+		current = p.total
+	}
+	p.current = current
+
+	if p.console.animated() {
+		// Redrawing for every write would be slow, so it's only redrawn every so often, and when it's complete
+		if current < p.total && time.Since(p.drawn) < progressInterval {
+			return
+		}
+		p.drawn = time.Now()
+		p.console.setStatus(p.render())
+		return
+	}
+	if percent := p.percent() / progressLogStep * progressLogStep; percent != p.logged {
+		p.logged = percent
+		p.console.Infof("%s: %d%%", p.message, percent)
+	}
+}
+
+// Write adds the length of b to how much has been done, so a progress bar can be used with io.TeeReader
+func (p *ProgressBar) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Finish removes the progress bar and logs message in its place, if it isn't empty
+func (p *ProgressBar) Finish(message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return
+	}
+	p.finished = true
+	if p.console.animated() {
+		p.console.clearStatus()
+	}
+	if message != "" {
+		p.console.Info(message)
+	}
+}
+
+func (p *ProgressBar) percent() int {
+	if p.total <= 0 {
+		return 100
+	}
+	return int(p.current * 100 / p.total)
+}
+
+// render returns the progress bar, like: Uploading inputs [=========>          ] 45% 12MB / 27MB
+func (p *ProgressBar) render() string {
+	filled := progressBarWidth * p.percent() / 100
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	amounts := fmt.Sprintf("%d / %d", p.current, p.total)
+	if p.bytes {
+		amounts = units.HumanSize(float64(p.current)) + " / " + units.HumanSize(float64(p.total))
+	}
+	return fmt.Sprintf("%s [%s] %3d%% %s", p.message, bar, p.percent(), amounts)
+}
+
+// animated returns whether spinners and progress bars can be drawn, which needs stderr to be a terminal that messages
+// are written to as text
+func (c *Console) animated() bool {
+	return !c.IsMachine && c.stderr == nil && isatty.IsTerminal(os.Stderr.Fd())
+}
+
+// setStatus draws a line at the bottom of stderr that's replaced each time it's drawn. Messages that are logged
+// while it's shown are written above it.
+func (c *Console) setStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if width, err := GetWidth(); err == nil && width > 1 && len([]rune(status)) >= int(width) {
+		// If the line wrapped, \r would only go back to the start of the last part of it
+		status = string([]rune(status)[:width-1])
+	}
+	c.status = status
+	fmt.Fprint(c.errWriter(), "\r\033[K"+status)
+}
+
+// clearStatus removes the line drawn by setStatus
+func (c *Console) clearStatus() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status != "" {
+		fmt.Fprint(c.errWriter(), "\r\033[K")
+		c.status = ""
+	}
+}
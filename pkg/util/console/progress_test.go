@@ -0,0 +1,71 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func machineMessages(t *testing.T, out *bytes.Buffer) []string {
+	t.Helper()
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg machineMessage
+		require.NoError(t, json.Unmarshal([]byte(line), &msg))
+		messages = append(messages, msg.Message)
+	}
+	return messages
+}
+
+func TestSpinnerMachine(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{IsMachine: true, Level: InfoLevel, stderr: out}
+
+	s := c.StartSpinner("Pushing image r8.im/user/model")
+	s.Stop("Pushed image r8.im/user/model")
+	s.Stop("Stopped twice")
+
+	require.Equal(t, []string{"Pushing image r8.im/user/model...", "Pushed image r8.im/user/model"}, machineMessages(t, out))
+}
+
+func TestProgressBarMachine(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{IsMachine: true, Level: InfoLevel, stderr: out}
+
+	p := c.NewProgressBar("Uploading inputs", 200, true)
+	p.Set(0)
+	p.Set(5)
+	p.Set(45)
+	_, err := p.Write(make([]byte, 10))
+	require.NoError(t, err)
+	p.Set(500)
+	p.Finish("Uploaded inputs")
+	p.Set(100)
+
+	require.Equal(t, []string{
+		"Uploading inputs: 0%",
+		"Uploading inputs: 20%",
+		"Uploading inputs: 100%",
+		"Uploaded inputs",
+	}, machineMessages(t, out))
+}
+
+func TestProgressBarRender(t *testing.T) {
+	p := (&Console{}).NewProgressBar("Uploading", 4, false)
+	p.current = 1
+	require.Equal(t, "Uploading [=======>                      ]  25% 1 / 4", p.render())
+	p.current = 4
+	require.Equal(t, "Uploading [==============================] 100% 4 / 4", p.render())
+}
+
+func TestLogClearsStatus(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{Level: InfoLevel, stderr: out}
+	c.status = "⠋ Pulling image..."
+
+	c.Info("hello")
+	require.Equal(t, "\r\033[Khello\n⠋ Pulling image...", out.String())
+}
@@ -0,0 +1,96 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moby/term"
+)
+
+// ErrNotInteractive is returned by prompts in machine mode, where there's nobody to answer them
+var ErrNotInteractive = errors.New("Can't ask for input when the log format is json")
+
+// Confirm asks a yes or no question, and returns whether the answer is yes. The default is no, which is also the
+// answer in machine mode or if stdin is closed.
+func (c *Console) Confirm(prompt string) bool {
+	if c.IsMachine {
+		c.Infof("%s Answering no, because the log format is json", prompt)
+		return false
+	}
+	for {
+		answer, err := c.ask(prompt + " (y/N) ")
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true
+		case "", "n", "no":
+			return false
+		}
+		c.Warn("Please enter 'y' or 'n'")
+	}
+}
+
+// Ask asks for a line of text and returns it without surrounding whitespace. In machine mode, it returns
+// ErrNotInteractive.
+func (c *Console) Ask(prompt string) (string, error) {
+	if c.IsMachine {
+		return "", ErrNotInteractive
+	}
+	return c.ask(prompt + " ")
+}
+
+// AskSecret is like Ask, but what's typed isn't shown, if stdin is a terminal
+func (c *Console) AskSecret(prompt string) (string, error) {
+	if c.IsMachine {
+		return "", ErrNotInteractive
+	}
+	if c.stdin == nil {
+		fd := os.Stdin.Fd()
+		if term.IsTerminal(fd) {
+			state, err := term.SaveState(fd)
+			if err != nil {
+				return "", err
+			}
+			if err := term.DisableEcho(fd, state); err != nil {
+				return "", err
+			}
+			defer func() {
+				_ = term.RestoreTerminal(fd, state)
+				// The newline that was typed wasn't shown either
+				fmt.Fprintln(c.errWriter())
+			}()
+		}
+	}
+	return c.ask(prompt + " ")
+}
+
+// ask writes the prompt to stderr, so it isn't mixed up with a command's output, and reads a line from stdin
+func (c *Console) ask(prompt string) (string, error) {
+	c.mu.Lock()
+	fmt.Fprint(c.errWriter(), prompt)
+	if c.stdinReader == nil {
+		var stdin io.Reader = os.Stdin
+		if c.stdin != nil {
+			stdin = c.stdin
+		}
+		// The reader is kept, so input that was buffered for one prompt isn't lost for the next
+		c.stdinReader = bufio.NewReader(stdin)
+	}
+	reader := c.stdinReader
+	c.mu.Unlock()
+
+	line, err := reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("stdin is closed, so there's no answer to %q", strings.TrimSpace(prompt))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
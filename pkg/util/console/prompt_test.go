@@ -0,0 +1,47 @@
+package console
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirm(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{Level: InfoLevel, stderr: out, stdin: strings.NewReader("maybe\nyes\n\n")}
+
+	require.True(t, c.Confirm("Delete it?"))
+	require.Contains(t, out.String(), "Delete it? (y/N) ")
+	require.Contains(t, out.String(), "Please enter 'y' or 'n'")
+	require.False(t, c.Confirm("Delete it?"))
+	// stdin is closed
+	require.False(t, c.Confirm("Delete it?"))
+}
+
+func TestAsk(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{Level: InfoLevel, stderr: out, stdin: strings.NewReader("  alice \nsecret")}
+
+	name, err := c.Ask("Name:")
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+	token, err := c.AskSecret("Token:")
+	require.NoError(t, err)
+	require.Equal(t, "secret", token)
+	_, err = c.Ask("More?")
+	require.ErrorContains(t, err, "stdin is closed")
+	require.Equal(t, "Name: Token: More? ", out.String())
+}
+
+func TestPromptMachine(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &Console{IsMachine: true, Level: InfoLevel, stderr: out, stdin: strings.NewReader("yes\n")}
+
+	require.False(t, c.Confirm("Delete it?"))
+	_, err := c.Ask("Name:")
+	require.ErrorIs(t, err, ErrNotInteractive)
+	_, err = c.AskSecret("Token:")
+	require.ErrorIs(t, err, ErrNotInteractive)
+}
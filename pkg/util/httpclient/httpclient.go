@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	dialTimeout         = 10 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+// UserAgent returns the User-Agent Cog sends with its requests, e.g. cog/0.9.0 (linux; amd64)
+func UserAgent() string {
+	return fmt.Sprintf("cog/%s (%s; %s)", global.Version, runtime.GOOS, runtime.GOARCH)
+}
+
+// NewTransport returns a transport like http.DefaultTransport, but with timeouts for connecting and TLS handshakes,
+// so requests to hosts that don't respond fail rather than hang. Responses aren't limited, so it can be used for
+// requests that take a long time, like running predictions.
+func NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	return transport
+}
+
+// WithUserAgent wraps transport so requests that don't have a User-Agent are sent with Cog's
+func WithUserAgent(transport http.RoundTripper) http.RoundTripper {
+	return &userAgentTransport{transport: transport}
+}
+
+type userAgentTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTrippers mustn't modify the request they're given
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", UserAgent())
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// New returns a client for requests to registries and other services, which sends Cog's User-Agent and gives up on
+// requests that take longer than timeout, which is set with --timeout. If timeout is 0, they aren't limited.
+func New(timeout time.Duration) *http.Client {
+	transport := NewTransport()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{
+		Transport: WithUserAgent(transport),
+		Timeout:   timeout,
+	}
+}
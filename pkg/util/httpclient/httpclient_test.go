@@ -0,0 +1,44 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgent(t *testing.T) {
+	userAgents := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.UserAgent()
+	}))
+	defer server.Close()
+
+	resp, err := New(time.Minute).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, UserAgent(), <-userAgents)
+	require.Regexp(t, `^cog/\S+ \(\w+; \w+\)$`, UserAgent())
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "custom")
+	resp, err = New(time.Minute).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "custom", <-userAgents)
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	_, err := New(50 * time.Millisecond).Get(server.URL)
+	require.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/httpclient"
 )
 
 func WaitForPort(port int, timeout time.Duration) error {
@@ -29,6 +30,7 @@ func WaitForPort(port int, timeout time.Duration) error {
 func WaitForHTTPOK(url string, timeout time.Duration) error {
 	start := time.Now()
 	console.Debugf("Waiting for %s to become accessible", url)
+	client := httpclient.New(timeout)
 	for {
 		now := time.Now()
 		if now.Sub(start) > timeout {
@@ -36,10 +38,11 @@ func WaitForHTTPOK(url string, timeout time.Duration) error {
 		}
 
 		time.Sleep(100 * time.Millisecond)
-		resp, err := http.Get(url)
+		resp, err := client.Get(url)
 		if err != nil {
 			continue
 		}
+		resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
 			continue
 		}
@@ -0,0 +1,202 @@
+// Package workspace loads cog-workspace.yaml files, which list the models kept in one repository so they can be built,
+// tested and pushed together
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const DefaultFilename = "cog-workspace.yaml"
+
+type Config struct {
+	// Models are the directories of the models, relative to the workspace file. They can be glob patterns, like
+	// models/*, which match the directories that have a cog.yaml in them.
+	Models []string `yaml:"models"`
+	// Shared are files and directories outside the models' directories that all the models depend on, relative to
+	// the workspace file. If any of them change, all the models have changed. They're only used to tell what has
+	// changed: images are built from their model's directory, so they don't have the shared files in them.
+	Shared []string `yaml:"shared"`
+
+	// Dir is the directory the workspace file is in
+	Dir string `yaml:"-"`
+	// Filename is the name of the workspace file
+	Filename string `yaml:"-"`
+}
+
+// Load reads and validates a workspace file
+func Load(path string) (*Config, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s does not exist. Are you in the right directory?", path)
+		}
+		return nil, err
+	}
+	conf, err := FromYAML(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", path, err)
+	}
+	conf.Dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	conf.Filename = filepath.Base(path)
+	return conf, nil
+}
+
+// FromYAML parses and validates the contents of a workspace file
+func FromYAML(contents []byte) (*Config, error) {
+	conf := &Config{}
+	if err := yaml.UnmarshalStrict(contents, conf); err != nil {
+		return nil, fmt.Errorf("Failed to parse workspace yaml: %w", err)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func (c *Config) Validate() error {
+	if len(c.Models) == 0 {
+		return fmt.Errorf("No models are listed in 'models'")
+	}
+	errs := []error{}
+	for _, field := range []struct {
+		name  string
+		paths []string
+	}{{"models", c.Models}, {"shared", c.Shared}} {
+		for _, p := range field.paths {
+			switch {
+			case strings.TrimSpace(p) == "":
+				errs = append(errs, fmt.Errorf("'%s' has an empty path in it", field.name))
+			case filepath.IsAbs(p):
+				errs = append(errs, fmt.Errorf("%s in '%s' must be relative to the workspace file", p, field.name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ModelDirs returns the directories of the models, relative to the workspace file, in the order they're listed.
+// Directories that glob patterns match are sorted.
+func (c *Config) ModelDirs() ([]string, error) {
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range c.Models {
+		isGlob := strings.ContainsAny(pattern, "*?[")
+		matches := []string{filepath.Join(c.Dir, pattern)}
+		if isGlob {
+			var err error
+			if matches, err = filepath.Glob(filepath.Join(c.Dir, pattern)); err != nil {
+				return nil, fmt.Errorf("%s in 'models' is not a valid pattern: %w", pattern, err)
+			}
+			sort.Strings(matches)
+		}
+
+		found := false
+		for _, match := range matches {
+			if _, err := os.Stat(filepath.Join(match, global.ConfigFilename)); err != nil {
+				if isGlob {
+					continue
+				}
+				return nil, fmt.Errorf("%s in 'models' doesn't have a %s in it", pattern, global.ConfigFilename)
+			}
+			found = true
+			dir, err := filepath.Rel(c.Dir, match)
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.ToSlash(dir)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s in 'models' doesn't match any directories with a %s in them", pattern, global.ConfigFilename)
+		}
+	}
+	return dirs, nil
+}
+
+// Changed returns the directories in dirs of the models that have changed, given the files that have changed, both
+// relative to the workspace file. A model has changed if a file in its directory has, or one of the shared files, or
+// the workspace file itself.
+func (c *Config) Changed(dirs, changedFiles []string) []string {
+	shared := append([]string{c.Filename}, c.Shared...)
+	for _, file := range changedFiles {
+		for _, p := range shared {
+			if p != "" && contains(p, file) {
+				return dirs
+			}
+		}
+	}
+
+	changed := []string{}
+	for _, dir := range dirs {
+		for _, file := range changedFiles {
+			if contains(dir, file) {
+				changed = append(changed, dir)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// contains returns whether the file at p, or in the directory at p, is file
+func contains(p, file string) bool {
+	p = path.Clean(filepath.ToSlash(p))
+	file = path.Clean(filepath.ToSlash(file))
+	return p == "." || file == p || strings.HasPrefix(file, p+"/")
+}
+
+// ChangedFiles returns the files in the workspace that have changed since ref, a Git commit like origin/main, relative
+// to the workspace file. They're compared with the commit the current branch diverged from ref at, so changes made to
+// ref since then don't count. Changes that haven't been committed yet, and new files Git isn't ignoring, do.
+func (c *Config) ChangedFiles(ref string) ([]string, error) {
+	// Without --no-renames, a file moved out of a model would only show up in the model it was moved to
+	changed, err := c.git("diff", "--name-only", "--no-renames", "--relative", "--merge-base", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find the files that have changed since %s: %w", ref, err)
+	}
+	untracked, err := c.git("ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find new files: %w", err)
+	}
+	return append(changed, untracked...), nil
+}
+
+// git runs a git command in the workspace directory and returns the lines it outputs
+func (c *Config) git(args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,77 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeModel(t *testing.T, dir string) {
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n"), 0o644))
+}
+
+func TestValidate(t *testing.T) {
+	_, err := FromYAML([]byte(`shared: [lib]`))
+	require.ErrorContains(t, err, "No models are listed")
+
+	_, err = FromYAML([]byte(`
+models:
+  - /models/detector
+  - ""
+`))
+	require.ErrorContains(t, err, "/models/detector in 'models' must be relative to the workspace file")
+	require.ErrorContains(t, err, "'models' has an empty path in it")
+
+	_, err = FromYAML([]byte(`
+models: [detector]
+platforms: [linux/amd64]
+`))
+	require.ErrorContains(t, err, "field platforms not found")
+}
+
+func TestModelDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeModel(t, filepath.Join(dir, "models", "detector"))
+	writeModel(t, filepath.Join(dir, "models", "classifier"))
+	writeModel(t, filepath.Join(dir, "upscaler"))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "models", "notebooks"), 0o755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, DefaultFilename), []byte(`
+models:
+  - upscaler
+  - models/*
+  - models/detector
+`), 0o644))
+	conf, err := Load(filepath.Join(dir, DefaultFilename))
+	require.NoError(t, err)
+	dirs, err := conf.ModelDirs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"upscaler", "models/classifier", "models/detector"}, dirs)
+
+	conf.Models = []string{"models/notebooks"}
+	_, err = conf.ModelDirs()
+	require.ErrorContains(t, err, "models/notebooks in 'models' doesn't have a cog.yaml in it")
+
+	conf.Models = []string{"other/*"}
+	_, err = conf.ModelDirs()
+	require.ErrorContains(t, err, "other/* in 'models' doesn't match any directories with a cog.yaml in them")
+}
+
+func TestChanged(t *testing.T) {
+	conf := &Config{
+		Models:   []string{"models/*"},
+		Shared:   []string{"lib", "requirements-common.txt"},
+		Filename: DefaultFilename,
+	}
+	dirs := []string{"models/detector", "models/detector-v2", "models/classifier"}
+
+	require.Equal(t, []string{"models/detector"}, conf.Changed(dirs, []string{"models/detector/predict.py", "README.md"}))
+	require.Equal(t, []string{"models/detector-v2", "models/classifier"}, conf.Changed(dirs, []string{"models/detector-v2/cog.yaml", "models/classifier/weights/model.pt"}))
+	require.Equal(t, []string{}, conf.Changed(dirs, []string{"docs/index.md"}))
+	require.Equal(t, dirs, conf.Changed(dirs, []string{"lib/preprocess.py"}))
+	require.Equal(t, dirs, conf.Changed(dirs, []string{"requirements-common.txt"}))
+	require.Equal(t, dirs, conf.Changed(dirs, []string{DefaultFilename}))
+}
@@ -8,3 +8,11 @@ class ConfigDoesNotExist(CogError):
 
 class PredictorNotSet(CogError):
     """Exception raised when 'predict' is not set in cog.yaml when it needs to be."""
+
+
+class InputTooLargeError(CogError):
+    """Exception raised when a file input is bigger than the input's max_size."""
+
+
+class UnsupportedInputTypeError(CogError):
+    """Exception raised when a file input isn't one of the types in the input's accept list."""
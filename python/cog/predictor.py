@@ -3,6 +3,7 @@ import importlib.util
 import inspect
 import io
 import os.path
+import urllib.parse
 from abc import ABC, abstractmethod
 from collections.abc import Iterator
 from pathlib import Path
@@ -22,13 +23,18 @@ except ImportError:  # Python < 3.8
     from typing_compat import get_args, get_origin
 
 import yaml
-from pydantic import BaseModel, Field, create_model
+from pydantic import BaseModel, Field, create_model, root_validator
 from pydantic.fields import FieldInfo
 
 # Added in Python 3.9. Can be from typing if we drop support for <3.9
 from typing_extensions import Annotated
 
-from .errors import ConfigDoesNotExist, PredictorNotSet
+from .errors import (
+    ConfigDoesNotExist,
+    InputTooLargeError,
+    PredictorNotSet,
+    UnsupportedInputTypeError,
+)
 from .types import (
     File as CogFile,
 )
@@ -185,6 +191,21 @@ class BaseInput(BaseModel):
         # But, after validation, we want to pass the actual value to predict(), not the enum object
         use_enum_values = True
 
+    @root_validator(pre=True)
+    def check_file_limits(cls, values: Dict[str, Any]) -> Dict[str, Any]:
+        """
+        Check files against the limits set with Input(max_size=..., accept=...) before they are decoded.
+
+        This raises errors that aren't ValueErrors, so Pydantic doesn't turn them into validation errors, and the
+        HTTP server can respond with 413 or 415.
+        """
+        for name, field in cls.__fields__.items():
+            max_size = field.field_info.extra.get("x-cog-max-size")
+            accept = field.field_info.extra.get("x-cog-accept")
+            if max_size is not None or accept:
+                check_file_limits(name, values.get(name), max_size, accept)
+        return values
+
     def cleanup(self) -> None:
         """
         Cleanup any temporary files created by the input.
@@ -202,6 +223,42 @@ class BaseInput(BaseModel):
                     pass
 
 
+def check_file_limits(
+    name: str, value: Any, max_size: Optional[int], accept: Optional[List[str]]
+) -> None:
+    """
+    Check the size and type of a file passed as a data URL. Files passed as other URLs aren't checked, because they
+    haven't been downloaded yet.
+    """
+    if not isinstance(value, str) or not value.startswith("data:"):
+        return
+    header, _, data = value[len("data:") :].partition(",")
+    params = header.split(";")
+    content_type = params[0] or "text/plain"
+    if "base64" in params[1:]:
+        size = len(data) * 3 // 4 - data[-2:].count("=")
+    else:
+        size = len(urllib.parse.unquote_to_bytes(data))
+
+    if max_size is not None and size > max_size:
+        raise InputTooLargeError(
+            f"The file for {name} is {size} bytes, but the model only accepts files up to {max_size} bytes."
+        )
+    if accept and not any(
+        content_type_matches(content_type, pattern) for pattern in accept
+    ):
+        raise UnsupportedInputTypeError(
+            f"The file for {name} is {content_type}, but the model only accepts {', '.join(accept)}."
+        )
+
+
+def content_type_matches(content_type: str, pattern: str) -> bool:
+    """Match a content type against a pattern like image/png or image/*."""
+    if pattern.endswith("/*"):
+        return content_type.startswith(pattern[:-1])
+    return content_type == pattern
+
+
 def get_predict(predictor: Any) -> Callable:
     if hasattr(predictor, "predict"):
         return predictor.predict
@@ -254,6 +311,13 @@ def get_input_type(predictor: BasePredictor) -> Type[BaseInput]:
         default.extra["x-order"] = order
         order += 1
 
+        if (
+            "x-cog-max-size" in default.extra or "x-cog-accept" in default.extra
+        ) and InputType not in (CogFile, CogPath):
+            raise TypeError(
+                f"The input {name} uses the option max_size or accept. These can only be used with File or Path types."
+            )
+
         # Choices!
         if default.extra.get("choices"):
             choices = default.extra["choices"]
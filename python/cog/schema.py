@@ -65,6 +65,9 @@ class PredictionResponse(PredictionBaseModel):
     completed_at: t.Optional[datetime]
 
     logs: str = ""
+    # The same logs, split into what the model wrote to stdout and to stderr
+    stdout: str = ""
+    stderr: str = ""
     error: t.Optional[str]
     status: t.Optional[Status]
 
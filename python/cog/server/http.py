@@ -16,11 +16,13 @@ from anyio.lowlevel import RunVar
 from fastapi import Body, FastAPI, Header, HTTPException, Path, Response
 from fastapi.encoders import jsonable_encoder
 from fastapi.exceptions import RequestValidationError
+from fastapi.middleware.cors import CORSMiddleware
 from fastapi.responses import JSONResponse
 from pydantic import ValidationError
 from pydantic.error_wrappers import ErrorWrapper
 
 from .. import schema
+from ..errors import InputTooLargeError, UnsupportedInputTypeError
 from ..files import upload_file
 from ..json import upload_files
 from ..logging import setup_logging
@@ -57,6 +59,17 @@ def create_app(
         # version=None # TODO
     )
 
+    # Pages on other origins, like a demo page exported with `cog docs --demo-html`, can only call the model if it
+    # allows them to
+    cors_origins = os.environ.get("COG_CORS_ORIGINS")
+    if cors_origins:
+        app.add_middleware(
+            CORSMiddleware,
+            allow_origins=[o.strip() for o in cors_origins.split(",") if o.strip()],
+            allow_methods=["*"],
+            allow_headers=["*"],
+        )
+
     app.state.health = Health.STARTING
     app.state.setup_result = None
     app.state.setup_result_payload = None
@@ -67,6 +80,7 @@ def create_app(
         predictor_ref=predictor_ref,
         shutdown_event=shutdown_event,
         upload_url=upload_url,
+        max_prediction_time=config.get("max_prediction_time"),
     )
     # TODO: avoid loading predictor code in this process
     predictor = load_predictor_from_ref(predictor_ref)
@@ -90,6 +104,16 @@ def create_app(
     def shutdown() -> None:
         runner.shutdown()
 
+    @app.exception_handler(InputTooLargeError)
+    def input_too_large(request: Any, exc: InputTooLargeError) -> JSONResponse:
+        return JSONResponse({"detail": str(exc)}, status_code=413)
+
+    @app.exception_handler(UnsupportedInputTypeError)
+    def unsupported_input_type(
+        request: Any, exc: UnsupportedInputTypeError
+    ) -> JSONResponse:
+        return JSONResponse({"detail": str(exc)}, status_code=415)
+
     @app.get("/")
     def root() -> Any:
         return {
@@ -209,6 +233,21 @@ def create_app(
         encoded_response = jsonable_encoder(response_object)
         return JSONResponse(content=encoded_response)
 
+    @app.get("/predictions/{prediction_id}")
+    def get_prediction(prediction_id: str = Path(..., title="Prediction ID")) -> Any:
+        """
+        Get the current state of a prediction, including any output it has produced so far
+        """
+        response = runner.get(prediction_id)
+        if response is None:
+            return JSONResponse({}, status_code=404)
+
+        response_object = response.dict()
+        response_object["output"] = upload_files(
+            response_object["output"], upload_file=upload_file
+        )
+        return JSONResponse(content=jsonable_encoder(response_object))
+
     @app.post("/predictions/{prediction_id}/cancel")
     def cancel(prediction_id: str = Path(..., title="Prediction ID")) -> Any:
         """
@@ -293,8 +332,12 @@ class Server(uvicorn.Server):
 
 
 def is_port_in_use(port: int) -> bool:
-    with socket.socket(socket.AF_INET, socket.SOCK_STREAM) as s:
-        return s.connect_ex(("localhost", port)) == 0
+    # Resolve localhost rather than assuming IPv4, so this works on IPv6-only hosts
+    try:
+        with socket.create_connection(("localhost", port), timeout=1):
+            return True
+    except OSError:
+        return False
 
 
 def signal_ignore(signum: Any, frame: Any) -> None:
@@ -366,6 +409,9 @@ if __name__ == "__main__":
         mode=args.mode,
     )
 
+    # Serve on IPv4 by default. Set COG_HOST to "::" to serve on IPv6 (and IPv4, where the OS supports dual-stack
+    # sockets), which the CLI does when it's run with --address-family ipv6
+    host = os.getenv("COG_HOST", "0.0.0.0")
     port = int(os.getenv("PORT", 5000))
     if is_port_in_use(port):
         log.error(f"Port {port} is already in use")
@@ -373,7 +419,7 @@ if __name__ == "__main__":
 
     server_config = uvicorn.Config(
         app,
-        host="0.0.0.0",
+        host=host,
         port=port,
         log_config=None,
         # This is the default, but to be explicit: only run a single worker
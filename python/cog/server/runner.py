@@ -1,5 +1,6 @@
 import io
 import threading
+import time
 import traceback
 from datetime import datetime, timezone
 from multiprocessing.pool import AsyncResult, ThreadPool
@@ -41,6 +42,7 @@ class PredictionRunner:
         predictor_ref: str,
         shutdown_event: Optional[threading.Event],
         upload_url: Optional[str] = None,
+        max_prediction_time: Optional[float] = None,
     ) -> None:
         self._thread = None
         self._threadpool = ThreadPool(processes=1)
@@ -53,6 +55,7 @@ class PredictionRunner:
 
         self._shutdown_event = shutdown_event
         self._upload_url = upload_url
+        self._max_prediction_time = max_prediction_time
 
     def setup(self) -> AsyncResult:
         if self.is_busy():
@@ -124,6 +127,7 @@ class PredictionRunner:
                 "request": prediction,
                 "event_handler": event_handler,
                 "should_cancel": self._should_cancel,
+                "max_prediction_time": self._max_prediction_time,
             },
             callback=cleanup,
             error_callback=handle_error,
@@ -138,10 +142,16 @@ class PredictionRunner:
         if not self._result.ready():
             return True
 
-        self._response = None
+        # Keep the response of the last prediction, so get() can still return it
+        # once it has completed.
         self._result = None
         return False
 
+    def get(self, prediction_id: str) -> Optional[schema.PredictionResponse]:
+        if self._response is None or self._response.id != prediction_id:
+            return None
+        return self._response
+
     def shutdown(self) -> None:
         self._worker.terminate()
         self._threadpool.terminate()
@@ -205,6 +215,8 @@ class PredictionEventHandler:
         self.p.status = schema.Status.PROCESSING
         self.p.output = None
         self.p.logs = ""
+        self.p.stdout = ""
+        self.p.stderr = ""
         self.p.started_at = datetime.now(tz=timezone.utc)
 
         self._webhook_sender = webhook_sender
@@ -230,9 +242,13 @@ class PredictionEventHandler:
         self.p.output.append(self._upload_files(output))
         self._send_webhook(schema.WebhookEvent.OUTPUT)
 
-    def append_logs(self, logs: str) -> None:
+    def append_logs(self, logs: str, source: str = "stdout") -> None:
         assert self.p.logs is not None
         self.p.logs += logs
+        if source == "stderr":
+            self.p.stderr += logs
+        else:
+            self.p.stdout += logs
         self._send_webhook(schema.WebhookEvent.LOGS)
 
     def succeeded(self) -> None:
@@ -325,6 +341,7 @@ def predict(
     request: schema.PredictionRequest,
     event_handler: PredictionEventHandler,
     should_cancel: threading.Event,
+    max_prediction_time: Optional[float] = None,
 ) -> schema.PredictionResponse:
     # Set up logger context within prediction thread.
     structlog.contextvars.clear_contextvars()
@@ -336,10 +353,11 @@ def predict(
             request=request,
             event_handler=event_handler,
             should_cancel=should_cancel,
+            max_prediction_time=max_prediction_time,
         )
     except Exception as e:
         tb = traceback.format_exc()
-        event_handler.append_logs(tb)
+        event_handler.append_logs(tb, source="stderr")
         event_handler.failed(error=str(e))
         raise
 
@@ -350,6 +368,7 @@ def _predict(
     request: schema.PredictionRequest,
     event_handler: PredictionEventHandler,
     should_cancel: threading.Event,
+    max_prediction_time: Optional[float] = None,
 ) -> schema.PredictionResponse:
     initial_prediction = request.dict()
 
@@ -362,16 +381,26 @@ def _predict(
                 input_dict[k] = v.convert()
             except requests.exceptions.RequestException as e:
                 tb = traceback.format_exc()
-                event_handler.append_logs(tb)
+                event_handler.append_logs(tb, source="stderr")
                 event_handler.failed(error=str(e))
                 log.warn("failed to download url path from input", exc_info=True)
                 return event_handler.response
 
+    deadline = None
+    if max_prediction_time is not None:
+        deadline = time.monotonic() + max_prediction_time
+    timed_out = False
+
     for event in worker.predict(input_dict, poll=0.1):
         if should_cancel.is_set():
             worker.cancel()
             should_cancel.clear()
 
+        if deadline is not None and not timed_out and time.monotonic() > deadline:
+            log.warn("prediction timed out", max_prediction_time=max_prediction_time)
+            timed_out = True
+            worker.cancel()
+
         if isinstance(event, Heartbeat):
             # Heartbeat events exist solely to ensure that we have a
             # regular opportunity to check for cancelation and
@@ -381,7 +410,7 @@ def _predict(
             pass
 
         elif isinstance(event, Log):
-            event_handler.append_logs(event.message)
+            event_handler.append_logs(event.message, source=event.source)
 
         elif isinstance(event, PredictionOutputType):
             if output_type is not None:
@@ -402,7 +431,11 @@ def _predict(
                 event_handler.set_output(event.payload)
 
         elif isinstance(event, Done):
-            if event.canceled:
+            if event.canceled and timed_out:
+                event_handler.failed(
+                    error=f"Prediction timed out after {max_prediction_time} seconds"
+                )
+            elif event.canceled:
                 event_handler.canceled()
             elif event.error:
                 event_handler.failed(error=str(event.error_detail))
@@ -28,8 +28,16 @@ def Input(
     max_length: int = None,
     regex: str = None,
     choices: List[Union[str, int]] = None,
+    max_size: int = None,
+    accept: List[str] = None,
 ) -> Any:
     """Input is similar to pydantic.Field, but doesn't require a default value to be the first argument."""
+    # File limits are passed through to the schema as extensions, so clients can check files before uploading them
+    extra: Dict[str, Any] = {}
+    if max_size is not None:
+        extra["x-cog-max-size"] = max_size
+    if accept is not None:
+        extra["x-cog-accept"] = accept
     return Field(
         default,
         description=description,
@@ -39,6 +47,7 @@ def Input(
         max_length=max_length,
         regex=regex,
         choices=choices,
+        **extra,
     )
 
 
@@ -0,0 +1,6 @@
+from cog import BasePredictor, File, Input
+
+
+class Predictor(BasePredictor):
+    def predict(self, file: File = Input(max_size=10, accept=["text/*"])) -> str:
+        return file.read().decode("utf-8")
@@ -486,6 +486,33 @@ def test_prediction_cancel(client):
     assert resp.status_code == 200
 
 
+@uses_predictor("yield_files")
+def test_get_prediction(client, match):
+    resp = client.get("/predictions/123")
+    assert resp.status_code == 404
+
+    resp = client.put(
+        "/predictions/123",
+        json={},
+        headers={"Prefer": "respond-async"},
+    )
+    assert resp.status_code == 202
+
+    n = 0
+    while n < 50:
+        resp = client.get("/predictions/123")
+        assert resp.status_code == 200
+        if resp.json()["status"] == "succeeded":
+            break
+        time.sleep(0.1)
+        n += 1
+
+    assert resp.json() == match({"id": "123", "status": "succeeded"})
+    output = resp.json()["output"]
+    assert len(output) == 3
+    assert all(o.startswith("data:image/bmp;base64,") for o in output)
+
+
 @uses_predictor_with_client_options(
     "setup_weights",
     env={"COG_WEIGHTS": "data:text/plain; charset=utf-8;base64,aGVsbG8="},
@@ -494,3 +521,29 @@ def test_weights_are_read_from_environment_variables(client, match):
     resp = client.post("/predictions")
     assert resp.status_code == 200
     assert resp.json() == match({"status": "succeeded", "output": "hello"})
+
+
+@uses_predictor_with_client_options(
+    "setup", env={"COG_CORS_ORIGINS": "https://demo.example.com"}
+)
+def test_cors(client):
+    resp = client.options(
+        "/predictions",
+        headers={
+            "Origin": "https://demo.example.com",
+            "Access-Control-Request-Method": "POST",
+        },
+    )
+    assert resp.status_code == 200
+    assert (
+        resp.headers["Access-Control-Allow-Origin"] == "https://demo.example.com"
+    )
+
+    resp = client.get("/", headers={"Origin": "https://other.example.com"})
+    assert "Access-Control-Allow-Origin" not in resp.headers
+
+
+@uses_predictor("setup")
+def test_no_cors_by_default(client):
+    resp = client.get("/", headers={"Origin": "https://demo.example.com"})
+    assert "Access-Control-Allow-Origin" not in resp.headers
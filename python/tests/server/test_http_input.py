@@ -160,6 +160,39 @@ def test_file_bad_input(client):
     assert resp.status_code == 422
 
 
+@uses_predictor("input_file_limits")
+def test_file_limits(client, match):
+    schema = client.get("/openapi.json").json()
+    file_schema = schema["components"]["schemas"]["Input"]["properties"]["file"]
+    assert file_schema["x-cog-max-size"] == 10
+    assert file_schema["x-cog-accept"] == ["text/*"]
+
+    def data_url(content_type, data):
+        return f"data:{content_type};base64," + base64.b64encode(data).decode("utf-8")
+
+    resp = client.post(
+        "/predictions", json={"input": {"file": data_url("text/plain", b"bar")}}
+    )
+    assert resp.status_code == 200
+    assert resp.json() == match({"output": "bar", "status": "succeeded"})
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"file": data_url("text/plain", b"way too long for this")}},
+    )
+    assert resp.status_code == 413
+
+    resp = client.post(
+        "/predictions", json={"input": {"file": data_url("image/png", b"bar")}}
+    )
+    assert resp.status_code == 415
+
+
+def test_file_limits_on_wrong_type():
+    with pytest.raises(TypeError):
+        make_client("input_file_limits_wrong_type")
+
+
 @uses_predictor("input_multiple")
 def test_multiple_arguments(client, match):
     resp = client.post(
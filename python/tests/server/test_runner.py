@@ -120,6 +120,25 @@ def test_prediction_runner_cancel(runner):
     assert isinstance(response.completed_at, datetime)
 
 
+def test_prediction_runner_max_prediction_time():
+    runner = PredictionRunner(
+        predictor_ref=_fixture_path("sleep"),
+        shutdown_event=threading.Event(),
+        max_prediction_time=0.2,
+    )
+    try:
+        runner.setup().get(5)
+        request = PredictionRequest(input={"sleep": 5})
+        _, async_result = runner.predict(request)
+
+        response = async_result.get(timeout=2)
+        assert response.output is None
+        assert response.status == "failed"
+        assert response.error == "Prediction timed out after 0.2 seconds"
+    finally:
+        runner.shutdown()
+
+
 def test_prediction_runner_cancel_matching_id(runner):
     request = PredictionRequest(id="abcd1234", input={"sleep": 0.5})
     _, async_result = runner.predict(request)
@@ -149,7 +168,11 @@ PREDICT_TESTS = [
     ([Done()], [mock.call.succeeded()]),
     ([Done(canceled=True)], [mock.call.canceled()]),
     ([Done(error=True, error_detail="foo")], [mock.call.failed(error="foo")]),
-    ([Log(source="stdout", message="help")], [mock.call.append_logs("help")]),
+    ([Log(source="stdout", message="help")], [mock.call.append_logs("help", source="stdout")]),
+    (
+        [Log(source="stderr", message="warning")],
+        [mock.call.append_logs("warning", source="stderr")],
+    ),
     (
         [PredictionOutputType(multi=False), PredictionOutput(payload="hello world")],
         [mock.call.set_output("hello world")],
@@ -227,7 +250,10 @@ def test_prediction_event_handler():
 
     h.append_logs("running a prediction\n")
     h.append_logs("still running\n")
-    assert p.logs == "running a prediction\nstill running\n"
+    h.append_logs("a warning\n", source="stderr")
+    assert p.logs == "running a prediction\nstill running\na warning\n"
+    assert p.stdout == "running a prediction\nstill running\n"
+    assert p.stderr == "a warning\n"
 
     h.succeeded()
     assert p.status == Status.SUCCEEDED
@@ -0,0 +1,19 @@
+from typing import List
+
+from cog import BaseModel, BasePredictor, Path
+
+
+class Output(BaseModel):
+    text: str
+    images: List[Path]
+
+
+class Predictor(BasePredictor):
+    def predict(self) -> Output:
+        images = []
+        for i, contents in enumerate(["foo", "bar"]):
+            out_path = Path(f"/tmp/out-{i}.txt")
+            with out_path.open("w") as f:
+                f.write(contents)
+            images.append(out_path)
+        return Output(text="hello", images=images)
@@ -1,3 +1,4 @@
+import json
 import pathlib
 import shutil
 import subprocess
@@ -99,6 +100,47 @@ def test_predict_writes_multiple_files_to_files(tmpdir_factory):
         assert f.read() == "baz"
 
 
+def test_predict_writes_multiple_files_to_output_directory(tmpdir_factory):
+    project_dir = Path(__file__).parent / "fixtures/file-list-output-project"
+    out_dir = pathlib.Path(tmpdir_factory.mktemp("project"))
+    shutil.copytree(project_dir, out_dir, dirs_exist_ok=True)
+    result = subprocess.run(
+        ["cog", "predict", "-o", "outputs"],
+        cwd=out_dir,
+        check=True,
+        capture_output=True,
+    )
+    assert result.stdout == b""
+    # The directory is created, because a list of files can't be written to one file
+    with open(out_dir / "outputs" / "output.0.txt") as f:
+        assert f.read() == "foo"
+    with open(out_dir / "outputs" / "output.2.txt") as f:
+        assert f.read() == "baz"
+
+
+def test_predict_writes_files_in_objects_to_files(tmpdir_factory):
+    project_dir = Path(__file__).parent / "fixtures/file-object-output-project"
+    out_dir = pathlib.Path(tmpdir_factory.mktemp("project"))
+    shutil.copytree(project_dir, out_dir, dirs_exist_ok=True)
+    result = subprocess.run(
+        ["cog", "predict", "-o", "outputs/"],
+        cwd=out_dir,
+        check=True,
+        capture_output=True,
+    )
+    # The output is printed with the paths the files were written to in place of them
+    output = json.loads(result.stdout)
+    assert output["text"] == "hello"
+    assert output["images"] == [
+        "outputs/output.images.0.txt",
+        "outputs/output.images.1.txt",
+    ]
+    with open(out_dir / "outputs" / "output.images.0.txt") as f:
+        assert f.read() == "foo"
+    with open(out_dir / "outputs" / "output.images.1.txt") as f:
+        assert f.read() == "bar"
+
+
 def test_predict_writes_strings_to_files(tmpdir_factory):
     project_dir = Path(__file__).parent / "fixtures/string-project"
     out_dir = pathlib.Path(tmpdir_factory.mktemp("project"))